@@ -193,6 +193,14 @@ const (
 	RedemptionCodeStatusUsed     = 3 // also don't use 0
 )
 
+// 兑换码类型
+const (
+	RedemptionTypeQuota        = 0 // 直接增加额度
+	RedemptionTypeTopupCoupon  = 1 // 充值优惠券，在线充值时按比例赠送额度
+	RedemptionTypeGroupUpgrade = 2 // 临时升级用户分组
+	RedemptionTypeModelCredit  = 3 // 只能用于指定模型的额度
+)
+
 const (
 	ChannelStatusUnknown          = 0
 	ChannelStatusEnabled          = 1 // don't use 0, 0 is the default value!
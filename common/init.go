@@ -15,13 +15,15 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+
+	ReencryptSecrets = flag.Bool("reencrypt-secrets", false, "re-encrypt stored secrets with the current master key and exit")
 )
 
 func printHelp() {
 	fmt.Println("New API " + Version + " - All in one API service for OpenAI API.")
 	fmt.Println("Copyright (C) 2023 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/songquanpeng/veloera")
-	fmt.Println("Usage: veloera [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: veloera [--port <port>] [--log-dir <log directory>] [--reencrypt-secrets] [--version] [--help]")
 }
 
 func LoadEnv() {
@@ -52,6 +54,7 @@ func LoadEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	InitSecretEncryption()
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -0,0 +1,185 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 静态加密使用信封加密：每个值使用随机数据密钥 AES-GCM 加密，数据密钥再由主密钥加密。
+// 密文格式为 enc:v1:<主密钥 ID>:<加密的数据密钥>:<加密的值>，主密钥 ID 用于轮换后找到对应的旧密钥
+const secretPrefix = "enc:v1:"
+
+type secretMasterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	secretCurrentKey *secretMasterKey
+	secretMasterKeys = make(map[string]*secretMasterKey)
+)
+
+func newSecretMasterKey(raw string) *secretMasterKey {
+	sum := sha256.Sum256([]byte(raw))
+	idSum := sha256.Sum256(sum[:])
+	return &secretMasterKey{id: hex.EncodeToString(idSum[:4]), key: sum[:]}
+}
+
+// InitSecretEncryption 从环境变量加载主密钥：
+// SECRET_ENCRYPTION_KEY 或 SECRET_ENCRYPTION_KEY_FILE 为当前主密钥，
+// SECRET_ENCRYPTION_OLD_KEYS 为逗号分隔的旧主密钥，只用于解密，轮换后执行 --reencrypt-secrets 重新加密
+func InitSecretEncryption() {
+	current := os.Getenv("SECRET_ENCRYPTION_KEY")
+	if current == "" && os.Getenv("SECRET_ENCRYPTION_KEY_FILE") != "" {
+		data, err := os.ReadFile(os.Getenv("SECRET_ENCRYPTION_KEY_FILE"))
+		if err != nil {
+			FatalLog("failed to read SECRET_ENCRYPTION_KEY_FILE: " + err.Error())
+		}
+		current = strings.TrimSpace(string(data))
+	}
+	for _, old := range strings.Split(os.Getenv("SECRET_ENCRYPTION_OLD_KEYS"), ",") {
+		if old = strings.TrimSpace(old); old != "" {
+			key := newSecretMasterKey(old)
+			secretMasterKeys[key.id] = key
+		}
+	}
+	if current != "" {
+		secretCurrentKey = newSecretMasterKey(current)
+		secretMasterKeys[secretCurrentKey.id] = secretCurrentKey
+		SysLog("secret encryption at rest enabled, master key id: " + secretCurrentKey.id)
+	}
+}
+
+// SecretEncryptionEnabled 是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	return secretCurrentKey != nil
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// SecretNeedsReencrypt 值未加密或不是由当前主密钥加密时返回 true
+func SecretNeedsReencrypt(value string) bool {
+	if secretCurrentKey == nil || value == "" {
+		return false
+	}
+	if !IsEncryptedSecret(value) {
+		return true
+	}
+	return !strings.HasPrefix(value, secretPrefix+secretCurrentKey.id+":")
+}
+
+func sealSecret(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openSecret(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted secret")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// EncryptSecret 使用当前主密钥加密，未配置主密钥或已经加密时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if secretCurrentKey == nil || plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealSecret(secretCurrentKey.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealSecret(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + secretCurrentKey.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptSecret 解密 EncryptSecret 的结果，未加密的旧数据原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted secret")
+	}
+	masterKey, ok := secretMasterKeys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("master key %s not found, please check SECRET_ENCRYPTION_KEY and SECRET_ENCRYPTION_OLD_KEYS", parts[0])
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := openSecret(masterKey.key, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openSecret(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ReencryptSecret 使用当前主密钥重新加密，未配置主密钥时返回明文
+func ReencryptSecret(value string) (string, error) {
+	plaintext, err := DecryptSecret(value)
+	if err != nil {
+		return "", err
+	}
+	if secretCurrentKey == nil {
+		return plaintext, nil
+	}
+	return EncryptSecret(plaintext)
+}
+
+// MaskSecret 只保留首尾少量字符，用于在界面中辨认密钥
+func MaskSecret(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + strings.Repeat("*", 8) + string(runes[len(runes)-4:])
+}
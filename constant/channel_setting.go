@@ -1,9 +1,21 @@
 package constant
 
 var (
-	ForceFormat                     = "force_format"        // ForceFormat 强制格式化为OpenAI格式
-	ChanelSettingProxy              = "proxy"               // Proxy 代理
-	ChannelSettingThinkingToContent = "thinking_to_content" // ThinkingToContent
-	ChannelSettingStreamSupport     = "stream_support"      // StreamSupport 控制上游流式请求行为
-	StreamSupportNonStreamOnly      = "NON_STREAM_ONLY"     // StreamSupport 仅非流式请求
+	ForceFormat                     = "force_format"            // ForceFormat 强制格式化为OpenAI格式
+	ChanelSettingProxy              = "proxy"                   // Proxy 代理
+	ChannelSettingThinkingToContent = "thinking_to_content"     // ThinkingToContent
+	ChannelSettingStreamSupport     = "stream_support"          // StreamSupport 控制上游流式请求行为
+	StreamSupportNonStreamOnly      = "NON_STREAM_ONLY"         // StreamSupport 仅非流式请求
+	ChannelSettingCostRatio         = "cost_ratio"              // CostRatio 上游成本相对于基础额度（不含分组倍率）的倍率
+	ChannelSettingCostPrice         = "cost_price"              // CostPrice 按模型配置的上游成本价格表
+	ChannelSettingPIIRedaction      = "pii_redaction"           // PIIRedaction 转发前使用的个人信息脱敏策略名
+	ChannelSettingHTTP2             = "http2"                   // HTTP2 是否尝试使用 HTTP/2，未设置时使用全局配置
+	ChannelSettingMaxConnsPerHost   = "max_conns_per_host"      // MaxConnsPerHost 单个上游主机的最大连接数
+	ChannelSettingMaxIdleConns      = "max_idle_conns_per_host" // MaxIdleConnsPerHost 单个上游主机保留的最大空闲连接数
+	ChannelSettingResponseTimeout   = "response_header_timeout" // ResponseHeaderTimeout 等待响应头的超时秒数
+	ChannelSettingCACert            = "ca_cert"                 // CACert 校验上游证书使用的 PEM 格式 CA 证书
+	ChannelSettingClientCert        = "client_cert"             // ClientCert mTLS 客户端证书（PEM）
+	ChannelSettingClientKey         = "client_key"              // ClientKey mTLS 客户端私钥（PEM）
+	ChannelSettingStructuredOutput  = "structured_output"       // StructuredOutput response_format 的处理方式：native、prompt 或 tool
+	ChannelSettingToolEmulation     = "tool_emulation"          // ToolEmulation 是否在提示词中模拟工具调用，未设置时使用全局配置
 )
@@ -7,4 +7,13 @@ const (
 	ContextKeyUserStatus       = "user_status"
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
+	ContextKeyRoutingHints     = "routing_hints"
+	// ContextKeySessionAffinity 会话亲和的绑定键，请求成功后记录所用的渠道和密钥
+	ContextKeySessionAffinity = "session_affinity_key"
+	// ContextKeySessionAffinityHit 本次请求的渠道是否来自已有的会话绑定
+	ContextKeySessionAffinityHit = "session_affinity_hit"
+	// ContextKeyPinnedChannelKey 会话绑定指定的渠道和密钥序号，值为 [2]int{渠道 ID, 密钥序号}
+	ContextKeyPinnedChannelKey = "pinned_channel_key"
+	// ContextKeyChannelKeyIndex 多密钥渠道本次使用的密钥序号
+	ContextKeyChannelKeyIndex = "channel_key_index"
 )
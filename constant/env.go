@@ -17,6 +17,16 @@ var NotifyLimitCount int
 var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 
+// 上游连接池与超时设置，超时单位为秒，0 表示不限制
+var RelayMaxIdleConns int
+var RelayMaxIdleConnsPerHost int
+var RelayMaxConnsPerHost int
+var RelayIdleConnTimeout int
+var RelayDialTimeout int
+var RelayTLSHandshakeTimeout int
+var RelayResponseHeaderTimeout int
+var RelayHTTP2Enabled bool
+
 //var GeminiModelMap = map[string]string{
 //	"gemini-1.0-pro": "v1",
 //}
@@ -37,6 +47,16 @@ func InitEnv() {
 	// GenerateDefaultToken 是否生成初始令牌，默认关闭。
 	GenerateDefaultToken = common.GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
 
+	RelayMaxIdleConns = common.GetEnvOrDefault("RELAY_MAX_IDLE_CONNS", 500)
+	RelayMaxIdleConnsPerHost = common.GetEnvOrDefault("RELAY_MAX_IDLE_CONNS_PER_HOST", 100)
+	RelayMaxConnsPerHost = common.GetEnvOrDefault("RELAY_MAX_CONNS_PER_HOST", 0)
+	RelayIdleConnTimeout = common.GetEnvOrDefault("RELAY_IDLE_CONN_TIMEOUT", 90)
+	RelayDialTimeout = common.GetEnvOrDefault("RELAY_DIAL_TIMEOUT", 10)
+	RelayTLSHandshakeTimeout = common.GetEnvOrDefault("RELAY_TLS_HANDSHAKE_TIMEOUT", 10)
+	// 非流式请求需要等待上游生成完毕才返回响应头，默认不限制
+	RelayResponseHeaderTimeout = common.GetEnvOrDefault("RELAY_RESPONSE_HEADER_TIMEOUT", 0)
+	RelayHTTP2Enabled = common.GetEnvOrDefaultBool("RELAY_HTTP2_ENABLED", true)
+
 	//modelVersionMapStr := strings.TrimSpace(os.Getenv("GEMINI_MODEL_MAP"))
 	//if modelVersionMapStr == "" {
 	//	return
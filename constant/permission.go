@@ -0,0 +1,79 @@
+package constant
+
+// 管理接口的细粒度权限，自定义角色和 access token 的授权范围都使用这些权限
+const (
+	PermissionChannelsRead     = "channels:read"     // 查看渠道
+	PermissionChannelsWrite    = "channels:write"    // 新增、修改、删除和测试渠道
+	PermissionChannelsKeys     = "channels:keys"     // 查看渠道密钥
+	PermissionUsersRead        = "users:read"        // 查看用户
+	PermissionUsersManage      = "users:manage"      // 新增、修改、删除和封禁用户
+	PermissionLogsRead         = "logs:read"         // 查看所有用户的日志和任务
+	PermissionLogsDelete       = "logs:delete"       // 清理历史日志
+	PermissionRedemptionsRead  = "redemptions:read"  // 查看兑换码
+	PermissionRedemptionsWrite = "redemptions:write" // 生成、修改和删除兑换码
+	PermissionDataRead         = "data:read"         // 查看全站数据看板
+	PermissionGroupsRead       = "groups:read"       // 查看分组列表
+	PermissionOptionsRead      = "options:read"      // 查看系统设置
+	PermissionOptionsWrite     = "options:write"     // 修改系统设置
+	PermissionRolesManage      = "roles:manage"      // 管理自定义角色和分配角色
+	PermissionAuditRead        = "audit:read"        // 查询、导出和校验审计日志
+	PermissionRefundsManage    = "refunds:manage"    // 审核消费退款申请，查看渠道退款统计
+)
+
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionChannelsKeys,
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionRedemptionsRead,
+	PermissionRedemptionsWrite,
+	PermissionDataRead,
+	PermissionGroupsRead,
+	PermissionOptionsRead,
+	PermissionOptionsWrite,
+	PermissionRolesManage,
+	PermissionAuditRead,
+	PermissionRefundsManage,
+}
+
+// AdminPermissions 内置管理员角色拥有的权限，系统设置、角色管理和审计日志仍然只属于超级管理员
+var AdminPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionChannelsKeys,
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionRedemptionsRead,
+	PermissionRedemptionsWrite,
+	PermissionDataRead,
+	PermissionGroupsRead,
+	PermissionRefundsManage,
+}
+
+// ReservedPermissions 只属于超级管理员、不能分配给自定义角色的权限，避免持有者为自己授予任意权限
+var ReservedPermissions = []string{
+	PermissionRolesManage,
+}
+
+func IsReservedPermission(permission string) bool {
+	for _, p := range ReservedPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package constant
+
+// 令牌可以使用的路由偏好，由管理员在用户的 routing_hints 字段中授权，保存逗号分隔的名称
+const (
+	RoutingHintTags          = "tags"            // 渠道标签白名单与黑名单
+	RoutingHintNoRetry       = "no_retry"        // 失败后不重试其他渠道
+	RoutingHintMaxPriceRatio = "max_price_ratio" // 排除成本倍率高于指定值的渠道
+	RoutingHintRegion        = "region"          // 优先使用指定标签的渠道
+	RoutingHintNoCache       = "no_cache"        // 不使用内存渠道缓存
+)
+
+// 携带路由偏好的请求头
+const (
+	HeaderChannelTags        = "X-Veloera-Channel-Tags"
+	HeaderExcludeChannelTags = "X-Veloera-Exclude-Channel-Tags"
+	HeaderNoRetry            = "X-Veloera-No-Retry"
+	HeaderMaxPriceRatio      = "X-Veloera-Max-Price-Ratio"
+	HeaderRegion             = "X-Veloera-Region"
+	HeaderNoCache            = "X-Veloera-No-Cache"
+)
+
+// HeaderSessionId 客户端指定的会话标识，用于会话亲和路由
+const HeaderSessionId = "X-Veloera-Session-Id"
+
+var RoutingHints = []string{RoutingHintTags, RoutingHintNoRetry, RoutingHintMaxPriceRatio, RoutingHintRegion, RoutingHintNoCache}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func auditLogQueryFromRequest(c *gin.Context) model.AuditLogQuery {
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogQuery{
+		ActorId:    actorId,
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetId:   c.Query("target_id"),
+		StartTime:  startTimestamp,
+		EndTime:    endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	logs, total, err := model.GetAuditLogs(auditLogQueryFromRequest(c), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// ExportAuditLogs 按时间顺序导出审计日志，format=csv 时导出 CSV，否则导出包含哈希的 JSON
+func ExportAuditLogs(c *gin.Context) {
+	logs, err := model.GetAuditLogsForExport(auditLogQueryFromRequest(c))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	filename := fmt.Sprintf("audit-%d", common.GetTimestamp())
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		writer := csv.NewWriter(c.Writer)
+		_ = writer.Write([]string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "before", "after", "ip", "user_agent", "prev_hash", "hash"})
+		for _, log := range logs {
+			_ = writer.Write([]string{
+				strconv.Itoa(log.Id),
+				strconv.FormatInt(log.CreatedAt, 10),
+				strconv.Itoa(log.ActorId),
+				log.ActorName,
+				log.Action,
+				log.TargetType,
+				log.TargetId,
+				log.Before,
+				log.After,
+				log.Ip,
+				log.UserAgent,
+				log.PrevHash,
+				log.Hash,
+			})
+		}
+		writer.Flush()
+		return
+	}
+	data, err := json.Marshal(logs)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// VerifyAuditLogs 校验审计日志的哈希链是否完整
+func VerifyAuditLogs(c *gin.Context) {
+	checked, brokenId, err := model.VerifyAuditChain()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"checked":   checked,
+			"intact":    brokenId == 0,
+			"broken_id": brokenId,
+		},
+	})
+}
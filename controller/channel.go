@@ -7,8 +7,10 @@ import (
 	"strconv"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/middleware"
 	"veloera/model"
+	"veloera/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -41,6 +43,13 @@ type OpenAIModelsResponse struct {
 	Success bool          `json:"success"`
 }
 
+// hideChannelKeys 列表接口从不返回密钥，按标签聚合时会读取完整的渠道信息，需要在返回前清空
+func hideChannelKeys(channels []*model.Channel) {
+	for _, channel := range channels {
+		channel.Key = ""
+	}
+}
+
 func GetAllChannels(c *gin.Context) {
 	p, _ := strconv.Atoi(c.Query("p"))
 	pageSize, _ := strconv.Atoi(c.Query("page_size"))
@@ -81,6 +90,7 @@ func GetAllChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	hideChannelKeys(channelData)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -182,6 +192,7 @@ func FixChannelsAbilities(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.fix_abilities", "channel", "all", nil, gin.H{"fixed": count})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -224,6 +235,7 @@ func SearchChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	hideChannelKeys(channelData)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -249,12 +261,49 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 开启敏感操作验证后，密钥需要重新验证身份后通过 GetChannelKey 查看，没有 channels:keys 权限时不返回密钥
+	keyHidden := !middleware.IsStepUpSatisfied(c) || !middleware.HasPermission(c, constant.PermissionChannelsKeys)
+	keyPreview := ""
+	if keyHidden {
+		keyPreview = common.MaskSecret(channel.Key)
+		channel.Key = ""
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "",
+		"data":        channel, // The key will be included in the response
+		"key_hidden":  keyHidden,
+		"key_preview": keyPreview,
+	})
+	return
+}
+
+// GetChannelKey 返回渠道密钥，路由上要求重新验证身份
+func GetChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "channel.view_key", "channel", id, nil, gin.H{"name": channel.Name})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    channel, // The key will be included in the response
+		"data": gin.H{
+			"key": channel.Key,
+		},
 	})
-	return
 }
 
 func AddChannel(c *gin.Context) {
@@ -314,6 +363,7 @@ func AddChannel(c *gin.Context) {
 
 	// refresh prefix cache for the groups this channel belongs to
 	middleware.RefreshPrefixChannelsCache(channel.Group)
+	model.RecordAudit(c, "channel.create", "channel", channel.Id, nil, channel)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -324,6 +374,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -333,6 +384,9 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	if origin != nil {
+		model.RecordAudit(c, "channel.delete", "channel", id, origin, nil)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -349,6 +403,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.delete_disabled", "channel", "disabled", gin.H{"deleted": rows}, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -385,6 +440,7 @@ func DisableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.tag_disable", "channel_tag", channelTag.Tag, gin.H{"status": "enabled"}, gin.H{"status": "disabled"})
 	if channels, err := model.GetChannelsByTag(channelTag.Tag, false); err == nil {
 		groupSet := make(map[string]struct{})
 		for _, ch := range channels {
@@ -424,6 +480,7 @@ func EnableTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.tag_enable", "channel_tag", channelTag.Tag, gin.H{"status": "disabled"}, gin.H{"status": "enabled"})
 	if channels, err := model.GetChannelsByTag(channelTag.Tag, false); err == nil {
 		groupSet := make(map[string]struct{})
 		for _, ch := range channels {
@@ -470,6 +527,7 @@ func EditTagChannels(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.tag_edit", "channel_tag", channelTag.Tag, gin.H{}, channelTag)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -500,6 +558,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.batch_delete", "channel", "batch", gin.H{"ids": channelBatch.Ids}, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -539,6 +598,7 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	origin, _ := model.GetChannelById(channel.Id, true)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -547,6 +607,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if updated, err := model.GetChannelById(channel.Id, true); err == nil && origin != nil {
+		model.RecordAudit(c, "channel.update", "channel", channel.Id, origin, updated)
+	}
 
 	// refresh prefix cache as channel configuration may change
 	middleware.RefreshPrefixChannelsCache(channel.Group)
@@ -661,6 +724,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "channel.batch_tag", "channel", "batch", gin.H{}, channelBatch)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -668,3 +732,21 @@ func BatchSetChannelTag(c *gin.Context) {
 	})
 	return
 }
+
+// GetChannelCacheStats 各渠道的提示词缓存命中率和会话亲和命中次数
+func GetChannelCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    service.GetChannelCacheStats(),
+	})
+}
+
+func ResetChannelCacheStats(c *gin.Context) {
+	service.ResetChannelCacheStats()
+	model.RecordAudit(c, "channel.reset_cache_stats", "channel", "all", gin.H{}, gin.H{"cache_stats": "reset"})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"veloera/constant"
+	"veloera/middleware"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportConfig 导出渠道和系统设置，format=yaml 时导出 YAML，否则导出 JSON。
+// include_secrets=true 时包含渠道密钥和密钥类配置，需要 channels:keys 权限并重新验证身份
+func ExportConfig(c *gin.Context) {
+	includeSecrets := c.Query("include_secrets") == "true"
+	if includeSecrets && (!middleware.HasPermission(c, constant.PermissionChannelsKeys) || !middleware.IsStepUpSatisfied(c)) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "导出密钥需要查看渠道密钥的权限，并在最近重新验证过身份",
+		})
+		return
+	}
+	bundle, err := model.ExportConfigBundle(includeSecrets)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if includeSecrets {
+		model.RecordAudit(c, "config.export_secrets", "config", "", nil, gin.H{"channels": len(bundle.Channels)})
+	}
+	filename := fmt.Sprintf("veloera-config-%d", bundle.ExportedAt)
+	if c.Query("format") == "yaml" {
+		data, err := yaml.Marshal(bundle)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.yaml", filename))
+		c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+	c.IndentedJSON(http.StatusOK, bundle)
+}
+
+// ImportConfig 导入 YAML 或 JSON 格式的配置文档，dry_run=true 时只返回变更列表，
+// prune=true 时删除文档中不存在的渠道；文档中省略的配置项和留空的渠道密钥保持不变
+func ImportConfig(c *gin.Context) {
+	if !middleware.HasPermission(c, constant.PermissionChannelsWrite) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "导入配置需要修改渠道的权限",
+		})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	// JSON 是 YAML 的子集，统一按 YAML 解析
+	var bundle model.ConfigBundle
+	if err := yaml.Unmarshal(body, &bundle); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "配置文档格式错误：" + err.Error(),
+		})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	changes, affectedGroups, err := model.ApplyConfigBundle(&bundle, c.Query("prune") == "true", dryRun)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if changes == nil {
+		changes = make([]model.ConfigChange, 0)
+	}
+	if !dryRun && len(changes) > 0 {
+		for _, group := range affectedGroups {
+			middleware.RefreshPrefixChannelsCache(group)
+		}
+		model.RecordAudit(c, "config.import", "config", "", nil, gin.H{"changes": changes})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"dry_run": dryRun,
+			"changes": changes,
+		},
+	})
+}
@@ -205,6 +205,7 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "log.delete_history", "log", targetTimestamp, gin.H{"deleted": count}, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
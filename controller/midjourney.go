@@ -162,6 +162,8 @@ func UpdateMidjourneyTaskBulk() {
 						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
 						if err != nil {
 							common.LogError(ctx, "fail to increase user quota: "+err.Error())
+						} else if err = model.SettleCreditLots(task.UserId, -task.Quota); err != nil {
+							common.LogError(ctx, "fail to settle credit lots: "+err.Error())
 						}
 						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, common.LogQuota(task.Quota))
 						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
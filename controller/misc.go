@@ -8,6 +8,7 @@ import (
 	"veloera/common"
 	"veloera/constant"
 	"veloera/model"
+	"veloera/service"
 	"veloera/setting"
 	"veloera/setting/operation_setting"
 	"veloera/setting/system_setting"
@@ -65,7 +66,10 @@ func GetStatus(c *gin.Context) {
 			"enable_data_export":          common.DataExportEnabled,
 			"data_export_default_time":    common.DataExportDefaultTime,
 			"default_collapse_sidebar":    common.DefaultCollapseSidebar,
-			"enable_online_topup":         setting.PayAddress != "" && setting.EpayId != "" && setting.EpayKey != "",
+			"enable_online_topup":         len(service.GetPaymentProviders()) > 0,
+			"enable_epay_topup":           service.GetPaymentProvider("epay").Enabled(),
+			"enable_stripe_topup":         service.GetPaymentProvider("stripe").Enabled(),
+			"refund_enabled":              operation_setting.GetRefundSetting().Enabled,
 			"mj_notify_enabled":           setting.MjNotifyEnabled,
 			"chats":                       setting.Chats,
 			"demo_site_enabled":           operation_setting.DemoSiteEnabled,
@@ -75,6 +79,7 @@ func GetStatus(c *gin.Context) {
 			"oidc_authorization_endpoint": system_setting.GetOIDCSettings().AuthorizationEndpoint,
 			"setup":                       constant.Setup,
 			"check_in_enabled":            common.CheckInEnabled,
+			"passkey_login_enabled":       system_setting.GetSecuritySettings().PasskeyLoginEnabled,
 		},
 	})
 	return
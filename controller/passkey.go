@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+	"veloera/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionKeyWebAuthnChallenge = "webauthn_challenge"
+	sessionKeyWebAuthnTime      = "webauthn_challenge_time"
+	// webAuthnTimeout 通行密钥挑战的有效秒数
+	webAuthnTimeout = 300
+)
+
+// newWebAuthnChallenge 生成挑战并保存到会话，每个挑战只能使用一次
+func newWebAuthnChallenge(c *gin.Context) (string, error) {
+	challenge, err := service.NewWebAuthnChallenge()
+	if err != nil {
+		return "", err
+	}
+	session := sessions.Default(c)
+	session.Set(sessionKeyWebAuthnChallenge, challenge)
+	session.Set(sessionKeyWebAuthnTime, common.GetTimestamp())
+	if err := session.Save(); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+func takeWebAuthnChallenge(c *gin.Context) string {
+	session := sessions.Default(c)
+	challenge, _ := session.Get(sessionKeyWebAuthnChallenge).(string)
+	createdAt, _ := session.Get(sessionKeyWebAuthnTime).(int64)
+	session.Delete(sessionKeyWebAuthnChallenge)
+	session.Delete(sessionKeyWebAuthnTime)
+	_ = session.Save()
+	if common.GetTimestamp()-createdAt > webAuthnTimeout {
+		return ""
+	}
+	return challenge
+}
+
+func passkeyCredentialDescriptors(userId int) []gin.H {
+	passkeys, _ := model.GetPasskeysByUserId(userId)
+	descriptors := make([]gin.H, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		descriptors = append(descriptors, gin.H{"type": "public-key", "id": passkey.CredentialId})
+	}
+	return descriptors
+}
+
+// GetPasskeys 返回当前用户注册的通行密钥
+func GetPasskeys(c *gin.Context) {
+	passkeys, err := model.GetPasskeysByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    passkeys,
+	})
+}
+
+// PasskeyRegisterBegin 返回 navigator.credentials.create 所需的参数，二进制字段使用 Base64URL 编码
+func PasskeyRegisterBegin(c *gin.Context) {
+	id := c.GetInt("id")
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	challenge, err := newWebAuthnChallenge(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"challenge": challenge,
+			"rp": gin.H{
+				"id":   system_setting.GetWebAuthnRPID(),
+				"name": common.SystemName,
+			},
+			"user": gin.H{
+				"id":          base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(user.Id))),
+				"name":        user.Username,
+				"displayName": displayName,
+			},
+			"pubKeyCredParams": []gin.H{
+				{"type": "public-key", "alg": -7},
+				{"type": "public-key", "alg": -8},
+				{"type": "public-key", "alg": -257},
+			},
+			"excludeCredentials": passkeyCredentialDescriptors(id),
+			"authenticatorSelection": gin.H{
+				"residentKey":      "preferred",
+				"userVerification": "required",
+			},
+			"attestation": "none",
+			"timeout":     webAuthnTimeout * 1000,
+		},
+	})
+}
+
+type PasskeyRegisterRequest struct {
+	Name       string                      `json:"name"`
+	Credential service.WebAuthnAttestation `json:"credential"`
+}
+
+// PasskeyRegisterFinish 校验浏览器返回的凭据并保存通行密钥
+func PasskeyRegisterFinish(c *gin.Context) {
+	var req PasskeyRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	credentialId, publicKey, signCount, err := service.VerifyWebAuthnAttestation(req.Credential, takeWebAuthnChallenge(c))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len([]rune(name)) > 64 {
+		name = string([]rune(name)[:64])
+	}
+	passkey := &model.Passkey{
+		UserId:       c.GetInt("id"),
+		Name:         name,
+		CredentialId: credentialId,
+		PublicKey:    publicKey,
+		SignCount:    int64(signCount),
+	}
+	if err := passkey.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存通行密钥失败，该通行密钥可能已经注册",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    passkey,
+	})
+}
+
+// DeletePasskey 删除当前用户的通行密钥
+func DeletePasskey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.DeletePasskey(id, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// PasskeyLoginBegin 返回 navigator.credentials.get 所需的参数，
+// 已登录时只允许当前用户的通行密钥，用于重新验证身份
+func PasskeyLoginBegin(c *gin.Context) {
+	session := sessions.Default(c)
+	userId, loggedIn := session.Get("id").(int)
+	if !loggedIn && !system_setting.GetSecuritySettings().PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通行密钥登录",
+		})
+		return
+	}
+	challenge, err := newWebAuthnChallenge(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	options := gin.H{
+		"challenge":        challenge,
+		"rpId":             system_setting.GetWebAuthnRPID(),
+		"userVerification": "required",
+		"timeout":          webAuthnTimeout * 1000,
+	}
+	if loggedIn {
+		options["allowCredentials"] = passkeyCredentialDescriptors(userId)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    options,
+	})
+}
+
+// PasskeyLoginFinish 校验通行密钥断言并登录，通行密钥同时满足两步验证的要求
+func PasskeyLoginFinish(c *gin.Context) {
+	if !system_setting.GetSecuritySettings().PasskeyLoginEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通行密钥登录",
+		})
+		return
+	}
+	var assertion service.WebAuthnAssertion
+	if err := c.ShouldBindJSON(&assertion); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	passkey, err := verifyPasskeyAssertion(c, assertion)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	user, err := model.GetUserById(passkey.UserId, false)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户已被封禁",
+		})
+		return
+	}
+	completeLogin(user, c, true)
+}
+
+func verifyPasskeyAssertion(c *gin.Context, assertion service.WebAuthnAssertion) (*model.Passkey, error) {
+	challenge := takeWebAuthnChallenge(c)
+	rawId, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(assertion.Id, "="))
+	if err != nil {
+		return nil, errors.New("无效的凭据 ID")
+	}
+	passkey, err := model.GetPasskeyByCredentialId(base64.RawURLEncoding.EncodeToString(rawId))
+	if err != nil {
+		return nil, errors.New("通行密钥未注册")
+	}
+	signCount, err := service.VerifyWebAuthnAssertion(assertion, challenge, passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := passkey.UpdateUsage(signCount); err != nil {
+		common.SysError("failed to update passkey usage: " + err.Error())
+	}
+	return passkey, nil
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"veloera/common"
 	"veloera/middleware"
 	"veloera/model"
 	"veloera/setting"
@@ -118,6 +119,9 @@ func enhancePricingWithPrefixes(pricing []model.Pricing, group string) []model.P
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := operation_setting.DefaultModelRatio2JSONString()
+	common.OptionMapRWMutex.RLock()
+	oldValue := common.OptionMap["ModelRatio"]
+	common.OptionMapRWMutex.RUnlock()
 	err := model.UpdateOption("ModelRatio", defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -134,6 +138,8 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "option.reset_model_ratio", "option", "ModelRatio",
+		map[string]any{"ModelRatio": oldValue}, map[string]any{"ModelRatio": defaultStr})
 	c.JSON(200, gin.H{
 		"success": true,
 		"message": "重置模型倍率成功",
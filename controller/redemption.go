@@ -3,8 +3,10 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"veloera/common"
 	"veloera/model"
+	"veloera/setting"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -96,6 +98,38 @@ func GetRedemption(c *gin.Context) {
 	return
 }
 
+// validatePromotion 校验兑换码类型相关的字段，返回错误信息
+func validatePromotion(redemption *model.Redemption) string {
+	redemption.Campaign = strings.TrimSpace(redemption.Campaign)
+	if len(redemption.Campaign) > 64 {
+		return "活动名称长度不能超过 64"
+	}
+	if redemption.NewUserDays < 0 {
+		return "新用户天数不能为负数"
+	}
+	switch redemption.Type {
+	case common.RedemptionTypeQuota:
+	case common.RedemptionTypeTopupCoupon:
+		if redemption.BonusPercent <= 0 || redemption.BonusPercent > 1000 {
+			return "充值优惠券的赠送比例必须在 1-1000 之间"
+		}
+	case common.RedemptionTypeGroupUpgrade:
+		if _, ok := setting.GetGroupRatioCopy()[redemption.UpgradeGroup]; !ok {
+			return "升级的分组不存在"
+		}
+		if redemption.UpgradeDays <= 0 {
+			return "分组升级天数必须大于 0"
+		}
+	case common.RedemptionTypeModelCredit:
+		if strings.TrimSpace(redemption.Models) == "" {
+			return "模型额度券必须指定可用的模型"
+		}
+	default:
+		return "未知的兑换码类型"
+	}
+	return ""
+}
+
 func AddRedemption(c *gin.Context) {
 	redemption := model.Redemption{}
 	err := c.ShouldBindJSON(&redemption)
@@ -123,6 +157,13 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if message := validatePromotion(&redemption); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
 
 	var keys []string
 	if redemption.Key != "" {
@@ -144,15 +185,23 @@ func AddRedemption(c *gin.Context) {
 		}
 
 		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt("id"),
-			Name:        redemption.Name,
-			Key:         redemption.Key,
-			CreatedTime: common.GetTimestamp(),
-			Quota:       redemption.Quota,
-			IsGift:      redemption.IsGift,
-			MaxUses:     redemption.MaxUses,
-			ValidFrom:   redemption.ValidFrom,
-			ValidUntil:  redemption.ValidUntil,
+			UserId:       c.GetInt("id"),
+			Name:         redemption.Name,
+			Key:          redemption.Key,
+			CreatedTime:  common.GetTimestamp(),
+			Quota:        redemption.Quota,
+			IsGift:       redemption.IsGift,
+			MaxUses:      redemption.MaxUses,
+			ValidFrom:    redemption.ValidFrom,
+			ValidUntil:   redemption.ValidUntil,
+			Type:         redemption.Type,
+			Campaign:     redemption.Campaign,
+			UserGroups:   redemption.UserGroups,
+			NewUserDays:  redemption.NewUserDays,
+			BonusPercent: redemption.BonusPercent,
+			UpgradeGroup: redemption.UpgradeGroup,
+			UpgradeDays:  redemption.UpgradeDays,
+			Models:       redemption.Models,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -184,15 +233,23 @@ func AddRedemption(c *gin.Context) {
 		for i := 0; i < redemption.Count; i++ {
 			key := common.GetUUID()
 			cleanRedemption := model.Redemption{
-				UserId:      c.GetInt("id"),
-				Name:        redemption.Name,
-				Key:         key,
-				CreatedTime: common.GetTimestamp(),
-				Quota:       redemption.Quota,
-				IsGift:      redemption.IsGift,
-				MaxUses:     redemption.MaxUses,
-				ValidFrom:   redemption.ValidFrom,
-				ValidUntil:  redemption.ValidUntil,
+				UserId:       c.GetInt("id"),
+				Name:         redemption.Name,
+				Key:          key,
+				CreatedTime:  common.GetTimestamp(),
+				Quota:        redemption.Quota,
+				IsGift:       redemption.IsGift,
+				MaxUses:      redemption.MaxUses,
+				ValidFrom:    redemption.ValidFrom,
+				ValidUntil:   redemption.ValidUntil,
+				Type:         redemption.Type,
+				Campaign:     redemption.Campaign,
+				UserGroups:   redemption.UserGroups,
+				NewUserDays:  redemption.NewUserDays,
+				BonusPercent: redemption.BonusPercent,
+				UpgradeGroup: redemption.UpgradeGroup,
+				UpgradeDays:  redemption.UpgradeDays,
+				Models:       redemption.Models,
 			}
 			err = cleanRedemption.Insert()
 			if err != nil {
@@ -206,6 +263,18 @@ func AddRedemption(c *gin.Context) {
 			keys = append(keys, key)
 		}
 	}
+	// 兑换码内容属于密钥，只记录生成数量和面值
+	model.RecordAudit(c, "redemption.create", "redemption", redemption.Name, nil, gin.H{
+		"name":        redemption.Name,
+		"count":       len(keys),
+		"quota":       redemption.Quota,
+		"is_gift":     redemption.IsGift,
+		"max_uses":    redemption.MaxUses,
+		"valid_from":  redemption.ValidFrom,
+		"valid_until": redemption.ValidUntil,
+		"type":        redemption.Type,
+		"campaign":    redemption.Campaign,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -217,6 +286,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	origin, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -225,6 +295,9 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if origin != nil {
+		model.RecordAudit(c, "redemption.delete", "redemption", id, origin, nil)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -251,6 +324,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	origin := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -259,6 +333,22 @@ func UpdateRedemption(c *gin.Context) {
 		cleanRedemption.Quota = redemption.Quota
 		cleanRedemption.ValidFrom = redemption.ValidFrom
 		cleanRedemption.ValidUntil = redemption.ValidUntil
+		// 兑换码类型创建后不能修改
+		redemption.Type = cleanRedemption.Type
+		if message := validatePromotion(&redemption); message != "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
+		cleanRedemption.Campaign = redemption.Campaign
+		cleanRedemption.UserGroups = redemption.UserGroups
+		cleanRedemption.NewUserDays = redemption.NewUserDays
+		cleanRedemption.BonusPercent = redemption.BonusPercent
+		cleanRedemption.UpgradeGroup = redemption.UpgradeGroup
+		cleanRedemption.UpgradeDays = redemption.UpgradeDays
+		cleanRedemption.Models = redemption.Models
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -268,6 +358,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "redemption.update", "redemption", cleanRedemption.Id, origin, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -322,6 +413,7 @@ func DeleteRedemptionsByName(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "redemption.delete_by_name", "redemption", name, gin.H{"name": name, "deleted": count}, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -361,6 +453,7 @@ func BatchDisableRedemptions(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "redemption.batch_disable", "redemption", "batch", gin.H{"ids": requestData.Ids}, gin.H{"disabled": count})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -379,6 +472,7 @@ func DeleteDisabledRedemptions(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "redemption.delete_disabled", "redemption", "disabled", gin.H{"deleted": count}, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -386,3 +480,20 @@ func DeleteDisabledRedemptions(c *gin.Context) {
 		"data":    count,
 	})
 }
+
+// GetCampaignStats 按活动名称统计兑换码的发放和使用情况
+func GetCampaignStats(c *gin.Context) {
+	stats, err := model.GetCampaignStats()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/common"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefundRequestBody struct {
+	LogId     int    `json:"log_id"`
+	CreatedAt int64  `json:"created_at"`
+	Reason    string `json:"reason"`
+}
+
+type ProcessRefundBody struct {
+	Remark string `json:"remark"`
+}
+
+func getRefundRequests(c *gin.Context, query model.RefundRequestQuery) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	query.Status, _ = strconv.Atoi(c.Query("status"))
+	requests, total, err := model.GetRefundRequests(query, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if query.UserId != 0 {
+		// 普通用户看到的日志 ID 经过取模处理，渠道信息不对用户展示
+		for _, request := range requests {
+			request.LogId = request.LogId % 1024
+			request.ChannelId = 0
+			request.AdminId = 0
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     requests,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// CreateRefundRequest 用户针对自己的消费记录申请退款
+func CreateRefundRequest(c *gin.Context) {
+	body := RefundRequestBody{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" || len(body.Reason) > 500 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "退款原因长度必须在1-500之间",
+		})
+		return
+	}
+	request, err := model.CreateRefundRequest(c.GetInt("id"), body.LogId, body.CreatedAt, body.Reason)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    request.Id,
+	})
+}
+
+func GetSelfRefundRequests(c *gin.Context) {
+	getRefundRequests(c, model.RefundRequestQuery{UserId: c.GetInt("id")})
+}
+
+func GetRefundRequests(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel"))
+	getRefundRequests(c, model.RefundRequestQuery{ChannelId: channelId})
+}
+
+func processRefundRequest(c *gin.Context, approve bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	body := ProcessRefundBody{}
+	_ = c.ShouldBindJSON(&body)
+	request, err := model.ProcessRefundRequest(id, approve, c.GetInt("id"), strings.TrimSpace(body.Remark))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	action := "refund.reject"
+	if approve {
+		action = "refund.approve"
+	}
+	model.RecordAudit(c, action, "refund_request", id, nil, request)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    request,
+	})
+}
+
+// ApproveRefundRequest 通过退款申请，额度退还给用户和令牌
+func ApproveRefundRequest(c *gin.Context) {
+	processRefundRequest(c, true)
+}
+
+func RejectRefundRequest(c *gin.Context) {
+	processRefundRequest(c, false)
+}
+
+// GetRefundChannelStats 按渠道统计退款情况，用于发现质量较差的上游
+func GetRefundChannelStats(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.GetRefundChannelStats(startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
+}
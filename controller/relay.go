@@ -91,7 +91,11 @@ func Relay(c *gin.Context) {
 			break
 		}
 
-		openaiErr = relayRequest(c, relayMode, channel)
+		if delay, ok := getHedgeDelay(c, relayMode, group, originalModel); ok && i == 0 {
+			channel, openaiErr = relayHedged(c, relayMode, channel, group, originalModel, delay)
+		} else {
+			openaiErr = relayRequest(c, relayMode, channel)
+		}
 
 		if openaiErr == nil {
 			return // 成功处理请求，直接返回
@@ -267,7 +271,7 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, retryCount)
+	channel, err := model.GetRandomSatisfiedChannelWithHints(group, originalModel, retryCount, middleware.GetRoutingHints(c))
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
 	}
@@ -288,6 +292,9 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	if hints := middleware.GetRoutingHints(c); hints != nil && hints.NoRetry {
+		return false
+	}
 	if openaiErr.StatusCode == http.StatusTooManyRequests {
 		return true
 	}
@@ -446,6 +453,9 @@ func shouldRetryTaskRelay(c *gin.Context, channelId int, taskErr *dto.TaskError,
 	if _, ok := c.Get("specific_channel_id"); ok {
 		return false
 	}
+	if hints := middleware.GetRoutingHints(c); hints != nil && hints.NoRetry {
+		return false
+	}
 	if taskErr.StatusCode == http.StatusTooManyRequests {
 		return true
 	}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/middleware"
+	"veloera/model"
+	relayconstant "veloera/relay/constant"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type hedgeResult struct {
+	index   int
+	ctx     *gin.Context
+	channel *model.Channel
+	err     *dto.OpenAIErrorWithStatusCode
+	elapsed time.Duration
+}
+
+// getHedgeDelay 只有文本类请求支持对冲，指定渠道时不对冲
+func getHedgeDelay(c *gin.Context, relayMode int, group, originalModel string) (time.Duration, bool) {
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions:
+	default:
+		return 0, false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0, false
+	}
+	if hints := middleware.GetRoutingHints(c); hints != nil && hints.NoRetry {
+		return 0, false
+	}
+	return operation_setting.GetHedgeDelay(group, originalModel)
+}
+
+// getHedgeChannel 选择一个与首个渠道不同的渠道，优先使用同优先级的渠道
+func getHedgeChannel(c *gin.Context, group, originalModel string, primaryId int) *model.Channel {
+	hints := middleware.GetRoutingHints(c)
+	for retry := 0; retry <= 1; retry++ {
+		for i := 0; i < 3; i++ {
+			channel, err := model.GetRandomSatisfiedChannelWithHints(group, originalModel, retry, hints)
+			if err != nil {
+				break
+			}
+			if channel.Id != primaryId {
+				return channel
+			}
+		}
+	}
+	return nil
+}
+
+// relayHedged 首个渠道在 delay 内没有写出首字节时，向第二个渠道发起相同的请求，
+// 先写出响应的渠道获胜，另一个被取消且不计费。返回最终结果所属的渠道
+func relayHedged(c *gin.Context, relayMode int, primary *model.Channel, group, originalModel string, delay time.Duration) (*model.Channel, *dto.OpenAIErrorWithStatusCode) {
+	race := service.NewHedgeRace(c)
+	defer race.Close()
+
+	results := make(chan hedgeResult, 2)
+	start := func(index int, ctx *gin.Context, channel *model.Channel) {
+		// 每个尝试使用独立的渠道列表，避免共享底层数组
+		ctx.Set("use_channel", append([]string(nil), c.GetStringSlice("use_channel")...))
+		addUsedChannel(c, channel.Id)
+		go func() {
+			startTime := time.Now()
+			defer func() {
+				if r := recover(); r != nil {
+					common.LogError(ctx, fmt.Sprintf("panic in hedged request: %v", r))
+					results <- hedgeResult{index: index, ctx: ctx, channel: channel,
+						err: service.OpenAIErrorWrapperLocal(fmt.Errorf("%v", r), "hedge_panic", http.StatusInternalServerError)}
+				}
+			}()
+			err := relayRequest(ctx, relayMode, channel)
+			results <- hedgeResult{index: index, ctx: ctx, channel: channel, err: err, elapsed: time.Since(startTime)}
+		}()
+	}
+
+	start(1, race.NewAttempt(c), primary)
+	running := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var first *hedgeResult
+	select {
+	case result := <-results:
+		running--
+		first = &result
+	case <-timer.C:
+		if race.Winner() == 0 {
+			if channel := getHedgeChannel(c, group, originalModel, primary.Id); channel != nil {
+				ctx := race.NewAttempt(c)
+				middleware.SetupContextForSelectedChannel(ctx, channel, originalModel)
+				common.LogInfo(c, fmt.Sprintf("channel #%d has no response after %s, hedging to channel #%d", primary.Id, delay, channel.Id))
+				start(2, ctx, channel)
+				running++
+			}
+		}
+	}
+
+	var collected []hedgeResult
+	if first != nil {
+		collected = append(collected, *first)
+	}
+	for ; running > 0; running-- {
+		collected = append(collected, <-results)
+	}
+	if len(collected) == 1 {
+		return collected[0].channel, collected[0].err
+	}
+
+	winner := race.Winner()
+	var final *hedgeResult
+	for i := range collected {
+		result := &collected[i]
+		if winner == result.index {
+			final = result
+			continue
+		}
+		if winner != 0 {
+			recordHedgeLoser(result, winner)
+			continue
+		}
+		// 两个尝试都没有写出响应，均视为失败，优先返回首个渠道的错误
+		if final == nil || result.index == 1 {
+			if final != nil {
+				go processChannelError(c, final.channel.Id, final.channel.Type, final.channel.Name, final.channel.GetAutoBan(), final.err)
+			}
+			final = result
+		} else {
+			go processChannelError(c, result.channel.Id, result.channel.Type, result.channel.Name, result.channel.GetAutoBan(), result.err)
+		}
+	}
+	return final.channel, final.err
+}
+
+// recordHedgeLoser 记录落败的尝试，额度已在请求处理中退还
+func recordHedgeLoser(result *hedgeResult, winner int) {
+	ctx := result.ctx
+	other := map[string]interface{}{
+		"hedged":     true,
+		"hedge_lost": true,
+		"admin_info": map[string]interface{}{"use_channel": ctx.GetStringSlice("use_channel")},
+	}
+	content := fmt.Sprintf("对冲请求落败，渠道 #%d 未被采用，不计费", result.channel.Id)
+	if result.err != nil && result.err.Error.Message != "" {
+		common.LogInfo(ctx, fmt.Sprintf("hedged request on channel #%d lost to attempt %d: %s", result.channel.Id, winner, result.err.Error.Message))
+	}
+	model.RecordConsumeLog(ctx, ctx.GetInt("id"), result.channel.Id, 0, 0, ctx.GetString("original_model"),
+		ctx.GetString("token_name"), 0, 0, content, ctx.GetInt("token_id"), 0, int(result.elapsed.Seconds()),
+		false, ctx.GetString("group"), other)
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/constant"
+	"veloera/middleware"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPermissions 返回所有可分配给自定义角色的权限
+func GetPermissions(c *gin.Context) {
+	permissions := make([]string, 0, len(constant.AllPermissions))
+	for _, permission := range constant.AllPermissions {
+		if !constant.IsReservedPermission(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    permissions,
+	})
+}
+
+func GetRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    roles,
+	})
+}
+
+// normalizeRole 校验角色名称和权限列表，返回错误信息。
+// 保留权限不能分配给自定义角色，也不能授予操作者自己没有的权限
+func normalizeRole(c *gin.Context, role *model.Role) string {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" || len([]rune(role.Name)) > 64 {
+		return "角色名称不能为空且长度不能超过 64"
+	}
+	for _, permission := range strings.Split(role.Permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" {
+			continue
+		}
+		if !constant.IsValidPermission(permission) {
+			return "未知的权限：" + permission
+		}
+		if constant.IsReservedPermission(permission) {
+			return "该权限只属于超级管理员，不能分配给自定义角色：" + permission
+		}
+		if !middleware.HasPermission(c, permission) {
+			return "不能授予自己没有的权限：" + permission
+		}
+	}
+	role.Permissions = strings.Join(model.ParsePermissions(role.Permissions), ",")
+	return ""
+}
+
+func AddRole(c *gin.Context) {
+	role := model.Role{}
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if message := normalizeRole(c, &role); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	cleanRole := model.Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+	}
+	if err := cleanRole.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存角色失败，角色名称可能已经存在",
+		})
+		return
+	}
+	model.RecordAudit(c, "role.create", "role", cleanRole.Id, nil, cleanRole)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+}
+
+func UpdateRole(c *gin.Context) {
+	role := model.Role{}
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if message := normalizeRole(c, &role); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	cleanRole, err := model.GetRoleById(role.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	origin := *cleanRole
+	cleanRole.Name = role.Name
+	cleanRole.Description = role.Description
+	cleanRole.Permissions = role.Permissions
+	if err := cleanRole.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "保存角色失败，角色名称可能已经存在",
+		})
+		return
+	}
+	model.RecordAudit(c, "role.update", "role", cleanRole.Id, origin, cleanRole)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRole,
+	})
+}
+
+// DeleteRole 删除角色，已分配该角色的用户会失去对应权限
+func DeleteRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	role, err := model.GetRoleById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := role.Delete(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "role.delete", "role", role.Id, role, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+type AssignRoleRequest struct {
+	UserId int `json:"user_id"`
+	RoleId int `json:"role_id"`
+}
+
+// AssignRole 为用户分配自定义角色，role_id 为 0 表示取消分配
+func AssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	if req.RoleId != 0 {
+		role, err := model.GetRoleById(req.RoleId)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "角色不存在",
+			})
+			return
+		}
+		for _, permission := range role.PermissionList() {
+			if !middleware.HasPermission(c, permission) {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "不能分配包含自己没有的权限的角色：" + permission,
+				})
+				return
+			}
+		}
+	}
+	if err := model.AssignUserRole(req.UserId, req.RoleId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "role.assign", "user", req.UserId, gin.H{"custom_role_id": user.CustomRoleId}, gin.H{"custom_role_id": req.RoleId})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"veloera/model"
+	"veloera/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validateSubscriptionPlan(plan *model.SubscriptionPlan) string {
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" || len(plan.Name) > 64 {
+		return "套餐名称长度必须在1-64之间"
+	}
+	if plan.Price <= 0 {
+		return "套餐价格必须大于 0"
+	}
+	if plan.Quota < 0 {
+		return "每月额度不能为负数"
+	}
+	if plan.RolloverPercent < 0 || plan.RolloverPercent > 100 {
+		return "结转比例必须在 0-100 之间"
+	}
+	if plan.Group != "" {
+		if _, ok := setting.GetGroupRatioCopy()[plan.Group]; !ok {
+			return "分组不存在"
+		}
+	}
+	if plan.Status != model.SubscriptionPlanStatusDisabled {
+		plan.Status = model.SubscriptionPlanStatusEnabled
+	}
+	return ""
+}
+
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+// GetAvailableSubscriptionPlans 用户可以订阅的套餐
+func GetAvailableSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetAllSubscriptionPlans(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	plan.Id = 0
+	if message := validateSubscriptionPlan(&plan); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	if err := plan.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "subscription_plan.create", "subscription_plan", plan.Id, nil, plan)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+// UpdateSubscriptionPlan 修改套餐，已订阅的用户从下个周期开始按新的额度发放
+func UpdateSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	origin, err := model.GetSubscriptionPlanById(plan.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if message := validateSubscriptionPlan(&plan); message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	if err := plan.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "subscription_plan.update", "subscription_plan", plan.Id, origin, plan)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	plan, err := model.GetSubscriptionPlanById(id)
+	if err == nil {
+		err = plan.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordAudit(c, "subscription_plan.delete", "subscription_plan", id, plan, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetSelfSubscriptions 当前用户的订阅记录，active 为正在生效的订阅
+func GetSelfSubscriptions(c *gin.Context) {
+	subs, err := model.GetUserSubscriptions(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subs,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"veloera/common"
 	"veloera/model"
+	"veloera/setting/operation_setting"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -123,6 +124,15 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.GuardrailPolicy != "" {
+		if _, ok := operation_setting.GetGuardrailSetting().Policies[token.GuardrailPolicy]; !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "护栏策略不存在",
+			})
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -149,6 +159,7 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		GuardrailPolicy:    token.GuardrailPolicy,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -202,6 +213,15 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if token.GuardrailPolicy != "" {
+		if _, ok := operation_setting.GetGuardrailSetting().Policies[token.GuardrailPolicy]; !ok {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "护栏策略不存在",
+			})
+			return
+		}
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -242,6 +262,7 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.GuardrailPolicy = token.GuardrailPolicy
 	}
 	err = cleanToken.Update()
 	if err != nil {
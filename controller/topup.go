@@ -3,8 +3,9 @@ package controller
 import (
 	"fmt"
 	"log"
-	"net/url"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"veloera/common"
@@ -12,38 +13,25 @@ import (
 	"veloera/service"
 	"veloera/setting"
 
-	"github.com/Calcium-Ion/go-epay/epay"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 )
 
 type EpayRequest struct {
 	Amount        int64  `json:"amount"`
-	PaymentMethod string `json:"payment_method"`
-	TopUpCode     string `json:"top_up_code"`
+	PaymentMethod string `json:"payment_method"` // zfb、wx 使用易支付，stripe 使用 Stripe
+	TopUpCode     string `json:"top_up_code"`    // 充值优惠券
+	PlanId        int    `json:"plan_id"`        // 订阅套餐，不为 0 时忽略 amount 和 top_up_code
+	Months        int    `json:"months"`
 }
 
 type AmountRequest struct {
-	Amount    int64  `json:"amount"`
-	TopUpCode string `json:"top_up_code"`
-}
-
-func GetEpayClient() *epay.Client {
-	if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
-		return nil
-	}
-	withUrl, err := epay.NewClient(&epay.Config{
-		PartnerID: setting.EpayId,
-		Key:       setting.EpayKey,
-	}, setting.PayAddress)
-	if err != nil {
-		return nil
-	}
-	return withUrl
+	Amount        int64  `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	TopUpCode     string `json:"top_up_code"`
 }
 
-func getPayMoney(amount int64, group string) float64 {
+func getPayMoney(amount int64, group string, provider service.PaymentProvider) float64 {
 	dAmount := decimal.NewFromInt(amount)
 
 	if !common.DisplayInCurrencyEnabled {
@@ -57,7 +45,7 @@ func getPayMoney(amount int64, group string) float64 {
 	}
 
 	dTopupGroupRatio := decimal.NewFromFloat(topupGroupRatio)
-	dPrice := decimal.NewFromFloat(setting.Price)
+	dPrice := decimal.NewFromFloat(provider.UnitPrice())
 
 	payMoney := dAmount.Mul(dPrice).Mul(dTopupGroupRatio)
 
@@ -74,17 +62,27 @@ func getMinTopup() int64 {
 	return int64(minTopup)
 }
 
-func RequestEpay(c *gin.Context) {
+// RequestPayment 创建在线充值或订阅套餐订单，根据 payment_method 选择支付渠道
+func RequestPayment(c *gin.Context) {
 	var req EpayRequest
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
 		return
 	}
+	if req.PlanId != 0 {
+		requestSubscriptionPayment(c, &req)
+		return
+	}
 	if req.Amount < getMinTopup() {
 		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getMinTopup())})
 		return
 	}
+	provider := service.GetPaymentProvider(req.PaymentMethod)
+	if !provider.Enabled() {
+		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
+		return
+	}
 
 	id := c.GetInt("id")
 	group, err := model.GetUserGroup(id, true)
@@ -92,38 +90,21 @@ func RequestEpay(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
-	payMoney := getPayMoney(req.Amount, group)
+	payMoney := getPayMoney(req.Amount, group, provider)
 	if payMoney < 0.01 {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
 	}
-	payType := "wxpay"
-	if req.PaymentMethod == "zfb" {
-		payType = "alipay"
-	}
-	if req.PaymentMethod == "wx" {
-		req.PaymentMethod = "wxpay"
-		payType = "wxpay"
+	req.TopUpCode = strings.TrimSpace(req.TopUpCode)
+	if req.TopUpCode != "" {
+		if _, err := model.CheckTopUpCoupon(req.TopUpCode, id); err != nil {
+			c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+			return
+		}
 	}
-	callBackAddress := service.GetCallbackAddress()
-	returnUrl, _ := url.Parse(setting.ServerAddress + "/log")
-	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
 	tradeNo = fmt.Sprintf("USR%dNO%s", id, tradeNo)
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
-		return
-	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           payType,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("TUC%d", req.Amount),
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
-	})
+	result, err := purchase(provider, &req, tradeNo, fmt.Sprintf("TUC%d", req.Amount), payMoney)
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
@@ -135,19 +116,89 @@ func RequestEpay(c *gin.Context) {
 		amount = dAmount.Div(dQuotaPerUnit).IntPart()
 	}
 	topUp := &model.TopUp{
-		UserId:     id,
-		Amount:     amount,
-		Money:      payMoney,
-		TradeNo:    tradeNo,
-		CreateTime: time.Now().Unix(),
-		Status:     "pending",
+		UserId:        id,
+		Amount:        amount,
+		Money:         payMoney,
+		TradeNo:       tradeNo,
+		CreateTime:    time.Now().Unix(),
+		Status:        "pending",
+		CouponCode:    req.TopUpCode,
+		PaymentMethod: provider.Name(),
+		Currency:      provider.Currency(),
+		ProviderRef:   result.ProviderRef,
 	}
 	err = topUp.Insert()
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
+	c.JSON(200, gin.H{"message": "success", "data": result.Params, "url": result.Url})
+}
+
+func purchase(provider service.PaymentProvider, req *EpayRequest, tradeNo string, name string, payMoney float64) (*service.PaymentPurchaseResult, error) {
+	result, err := provider.Purchase(&service.PaymentPurchaseArgs{
+		TradeNo:   tradeNo,
+		Method:    req.PaymentMethod,
+		Name:      name,
+		Money:     payMoney,
+		NotifyUrl: service.GetCallbackAddress() + "/api/user/epay/notify",
+		ReturnUrl: setting.ServerAddress + "/log",
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create %s payment: %s", provider.Name(), err.Error()))
+	}
+	return result, err
+}
+
+// requestSubscriptionPayment 创建订阅套餐订单，实付金额为套餐月价乘以月数，再按支付渠道的单价换算
+func requestSubscriptionPayment(c *gin.Context, req *EpayRequest) {
+	if req.Months <= 0 {
+		req.Months = 1
+	}
+	if req.Months > 12 {
+		c.JSON(200, gin.H{"message": "error", "data": "单次最多订阅 12 个月"})
+		return
+	}
+	provider := service.GetPaymentProvider(req.PaymentMethod)
+	if !provider.Enabled() {
+		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
+		return
+	}
+	id := c.GetInt("id")
+	plan, err := model.CheckSubscriptionOrder(id, req.PlanId)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	payMoney := decimal.NewFromFloat(plan.Price).Mul(decimal.NewFromInt(int64(req.Months))).
+		Mul(decimal.NewFromFloat(provider.UnitPrice())).InexactFloat64()
+	if payMoney < 0.01 {
+		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
+		return
+	}
+	tradeNo := fmt.Sprintf("SUB%dNO%s%d", id, common.GetRandomString(6), time.Now().Unix())
+	result, err := purchase(provider, req, tradeNo, fmt.Sprintf("SUB%d-%d", plan.Id, req.Months), payMoney)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+	topUp := &model.TopUp{
+		UserId:        id,
+		Money:         payMoney,
+		TradeNo:       tradeNo,
+		CreateTime:    time.Now().Unix(),
+		Status:        "pending",
+		PaymentMethod: provider.Name(),
+		Currency:      provider.Currency(),
+		ProviderRef:   result.ProviderRef,
+		PlanId:        plan.Id,
+		Months:        req.Months,
+	}
+	if err := topUp.Insert(); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "data": result.Params, "url": result.Url})
 }
 
 // tradeNo lock
@@ -178,72 +229,170 @@ func UnlockOrder(tradeNo string) {
 }
 
 func EpayNotify(c *gin.Context) {
-	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-		r[t] = c.Request.URL.Query().Get(t)
-		return r
-	}, map[string]string{})
-	client := GetEpayClient()
-	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-			return
+	handlePaymentNotify(c, service.GetPaymentProvider("epay"))
+}
+
+func StripeWebhook(c *gin.Context) {
+	handlePaymentNotify(c, service.GetPaymentProvider("stripe"))
+}
+
+// handlePaymentNotify 处理支付渠道的异步通知，同一订单的通知可能重复到达，
+// 入账和退款都只处理订单状态的变化部分
+func handlePaymentNotify(c *gin.Context, provider service.PaymentProvider) {
+	event, err := provider.ParseNotify(c.Request)
+	if err == nil {
+		switch event.Type {
+		case service.PaymentEventPaid:
+			err = completeTopUp(provider, event)
+		case service.PaymentEventRefunded:
+			err = refundTopUp(provider, event)
 		}
 	}
-	verifyInfo, err := client.Verify(params)
-	if err == nil && verifyInfo.VerifyStatus {
-		_, err := c.Writer.Write([]byte("success"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
+	if err != nil {
+		log.Printf("%s 支付回调处理失败: %v", provider.Name(), err)
+	}
+	status, body := provider.NotifyResponse(err == nil)
+	c.String(status, body)
+}
+
+// completeTopUp 支付成功后为用户增加额度，只有待支付的订单会入账
+func completeTopUp(provider service.PaymentProvider, event *service.PaymentEvent) error {
+	LockOrder(event.TradeNo)
+	defer UnlockOrder(event.TradeNo)
+	topUp := model.GetTopUpByTradeNo(event.TradeNo)
+	if topUp == nil || topUp.PaymentMethod != provider.Name() {
+		return fmt.Errorf("未找到订单 %s", event.TradeNo)
+	}
+	if topUp.Status != "pending" {
+		return nil
+	}
+	// 订单创建后管理员可能修改支付币种，币种不一致时金额无法比较
+	if event.Currency != "" && topUp.Currency != "" && !strings.EqualFold(event.Currency, topUp.Currency) {
+		return fmt.Errorf("订单 %s 支付币种 %s 与订单币种 %s 不一致", topUp.TradeNo, event.Currency, topUp.Currency)
+	}
+	if event.Money+0.005 < topUp.Money {
+		return fmt.Errorf("订单 %s 支付金额 %f 小于订单金额 %f", topUp.TradeNo, event.Money, topUp.Money)
+	}
+	topUp.Status = "success"
+	if event.ProviderRef != "" {
+		topUp.ProviderRef = event.ProviderRef
+	}
+	err := topUp.Update()
+	if err != nil {
+		return fmt.Errorf("更新订单 %s 失败: %v", topUp.TradeNo, err)
+	}
+	if topUp.PlanId != 0 {
+		sub, err := model.ActivateSubscription(topUp.UserId, topUp.PlanId, topUp.Months)
+		if sub != nil {
+			// 记录订单对应的订阅，退款时取消该订阅
+			topUp.SubscriptionId = sub.Id
+			if err := topUp.Update(); err != nil {
+				log.Printf("订单 %s 记录订阅失败: %v", topUp.TradeNo, err)
+			}
 		}
-	} else {
-		_, err := c.Writer.Write([]byte("fail"))
 		if err != nil {
-			log.Println("易支付回调写入失败")
+			return fmt.Errorf("订单 %s 开通订阅失败: %v", topUp.TradeNo, err)
 		}
-		log.Println("易支付回调签名验证失败")
-		return
+		log.Printf("%s 支付回调开通订阅成功 %v", provider.Name(), topUp)
+		return nil
+	}
+	dAmount := decimal.NewFromInt(int64(topUp.Amount))
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
+	err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
+	if err != nil {
+		return fmt.Errorf("订单 %s 更新用户额度失败: %v", topUp.TradeNo, err)
 	}
+	model.AddPaidCreditLot(topUp.UserId, topUp.TradeNo, quotaToAdd, topUp.Money, topUp.Currency)
+	log.Printf("%s 支付回调更新用户成功 %v", provider.Name(), topUp)
+	model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%.2f %s", common.LogQuota(quotaToAdd), topUp.Money, topUp.Currency))
 
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		LockOrder(verifyInfo.ServiceTradeNo)
-		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp == nil {
-			log.Printf("易支付回调未找到订单: %v", verifyInfo)
-			return
+	// 充值赠送、首充赠送和优惠券，返佣只按实际充值的额度计算
+	if _, err := model.ApplyTopUpPromotions(topUp, quotaToAdd); err != nil {
+		log.Printf("发放充值赠送失败: %v", err)
+	}
+
+	// 处理返佣逻辑
+	err = model.ProcessRebate(topUp.UserId, quotaToAdd, "充值", topUp.TradeNo)
+	if err != nil {
+		log.Printf("处理充值返佣失败: %v", err)
+	}
+	return nil
+}
+
+// refundTopUp 按退款金额占支付金额的比例扣回充值和赠送的额度，event.RefundedMoney 为累计退款金额
+func refundTopUp(provider service.PaymentProvider, event *service.PaymentEvent) error {
+	topUp := model.GetTopUpByProviderRef(provider.Name(), event.ProviderRef)
+	if topUp == nil && event.TradeNo != "" {
+		topUp = model.GetTopUpByTradeNo(event.TradeNo)
+	}
+	if topUp == nil {
+		return fmt.Errorf("未找到交易 %s 对应的订单", event.ProviderRef)
+	}
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+	topUp = model.GetTopUpByTradeNo(topUp.TradeNo)
+	if topUp == nil || topUp.Status == "pending" || topUp.Money <= 0 {
+		return nil
+	}
+	refundedMoney := math.Min(event.RefundedMoney, topUp.Money)
+	if refundedMoney <= topUp.RefundedMoney {
+		return nil
+	}
+	if topUp.PlanId != 0 {
+		// 订阅套餐退款（包括部分退款）立即结束订阅
+		topUp.RefundedMoney = refundedMoney
+		topUp.Status = "refunded"
+		if err := topUp.Update(); err != nil {
+			return fmt.Errorf("更新订单 %s 失败: %v", topUp.TradeNo, err)
 		}
-		if topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
-			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
+		subscriptionId := topUp.SubscriptionId
+		if subscriptionId == 0 {
+			// 早于记录订阅的订单，按套餐找到用户当前的订阅
+			if sub, err := model.GetUserActiveSubscription(topUp.UserId); err == nil && sub.PlanId == topUp.PlanId {
+				subscriptionId = sub.Id
 			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", common.LogQuota(quotaToAdd), topUp.Money))
+		}
+		return model.CancelSubscription(subscriptionId, fmt.Sprintf("订单 %s 已退款", topUp.TradeNo))
+	}
+	dAmount := decimal.NewFromInt(topUp.Amount)
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	dTotalQuota := dAmount.Mul(dQuotaPerUnit).Add(decimal.NewFromInt(int64(topUp.BonusQuota)))
+	dMoney := decimal.NewFromFloat(topUp.Money)
+	reverted := dTotalQuota.Mul(decimal.NewFromFloat(topUp.RefundedMoney)).Div(dMoney).IntPart()
+	toRevert := int(dTotalQuota.Mul(decimal.NewFromFloat(refundedMoney)).Div(dMoney).IntPart() - reverted)
+	// 邀请者的返佣按同样的比例扣回
+	inviterId, rebate := model.GetRebate(topUp.TradeNo)
+	dRebate := decimal.NewFromInt(int64(rebate))
+	rebateReverted := dRebate.Mul(decimal.NewFromFloat(topUp.RefundedMoney)).Div(dMoney).IntPart()
+	rebateToRevert := int(dRebate.Mul(decimal.NewFromFloat(refundedMoney)).Div(dMoney).IntPart() - rebateReverted)
 
-			// 处理返佣逻辑
-			err = model.ProcessRebate(topUp.UserId, quotaToAdd, "充值")
-			if err != nil {
-				log.Printf("处理充值返佣失败: %v", err)
+	topUp.RefundedMoney = refundedMoney
+	if refundedMoney >= topUp.Money {
+		topUp.Status = "refunded"
+	}
+	if err := topUp.Update(); err != nil {
+		return fmt.Errorf("更新订单 %s 失败: %v", topUp.TradeNo, err)
+	}
+	if toRevert > 0 {
+		if err := model.DecreaseUserQuota(topUp.UserId, toRevert); err != nil {
+			return fmt.Errorf("订单 %s 扣回用户额度失败: %v", topUp.TradeNo, err)
+		}
+		// 优先从本订单的充值和赠送批次中扣回，已消耗的部分视为从用户其他额度中扣回
+		revoked, err := model.RevokeCreditLots(topUp.UserId, topUp.TradeNo, toRevert)
+		if err != nil {
+			log.Printf("订单 %s 扣回额度批次失败: %v", topUp.TradeNo, err)
+		} else if revoked < toRevert {
+			if err := model.SettleCreditLots(topUp.UserId, toRevert-revoked); err != nil {
+				log.Printf("订单 %s 结算额度批次失败: %v", topUp.TradeNo, err)
 			}
 		}
-	} else {
-		log.Printf("易支付异常回调: %v", verifyInfo)
 	}
+	if err := model.RevokeRebate(inviterId, topUp.TradeNo, rebateToRevert); err != nil {
+		log.Printf("订单 %s 扣回返佣失败: %v", topUp.TradeNo, err)
+	}
+	model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("在线充值退款，退款金额：%.2f %s，扣回额度：%v", refundedMoney, topUp.Currency, common.LogQuota(toRevert)))
+	return nil
 }
 
 func RequestAmount(c *gin.Context) {
@@ -264,10 +413,11 @@ func RequestAmount(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
-	payMoney := getPayMoney(req.Amount, group)
+	provider := service.GetPaymentProvider(req.PaymentMethod)
+	payMoney := getPayMoney(req.Amount, group, provider)
 	if payMoney <= 0.01 {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
+	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64), "currency": provider.Currency()})
 }
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/service"
+	"veloera/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// setupStripeTest 使用临时 SQLite 数据库和模拟的 Stripe 服务
+func setupStripeTest(t *testing.T) *gin.Engine {
+	t.Setenv("SQL_DSN", "")
+	t.Setenv("LOG_SQL_DSN", "")
+	common.RedisEnabled = false
+	common.IsMasterNode = true
+	common.SQLitePath = filepath.Join(t.TempDir(), "veloera.db") + "?_busy_timeout=5000"
+	if err := model.InitDB(); err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+	if err := model.InitLogDB(); err != nil {
+		t.Fatalf("InitLogDB() error = %v", err)
+	}
+	t.Cleanup(func() { _ = model.CloseDB() })
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		_ = r.ParseForm()
+		tradeNo := r.PostForm.Get("client_reference_id")
+		_, _ = fmt.Fprintf(w, `{"id":"cs_%s","url":"https://checkout.stripe.test/cs_%s"}`, tradeNo, tradeNo)
+	}))
+	t.Cleanup(stub.Close)
+
+	settings := system_setting.GetStripeSettings()
+	saved := *settings
+	t.Cleanup(func() { *settings = saved })
+	settings.Enabled = true
+	settings.SecretKey = "sk_test"
+	settings.WebhookSecret = testWebhookSecret
+	settings.ApiBase = stub.URL
+	settings.Currency = "usd"
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/stripe/webhook", StripeWebhook)
+	return router
+}
+
+// createStripeOrder 通过模拟的 Stripe 服务创建充值订单
+func createStripeOrder(t *testing.T, userId int, tradeNo string, amount int64) *model.TopUp {
+	provider := service.GetPaymentProvider("stripe")
+	result, err := provider.Purchase(&service.PaymentPurchaseArgs{TradeNo: tradeNo, Name: "TUC" + tradeNo, Money: float64(amount)})
+	if err != nil {
+		t.Fatalf("Purchase() error = %v", err)
+	}
+	topUp := &model.TopUp{
+		UserId:        userId,
+		Amount:        amount,
+		Money:         float64(amount),
+		TradeNo:       tradeNo,
+		CreateTime:    time.Now().Unix(),
+		Status:        "pending",
+		PaymentMethod: provider.Name(),
+		Currency:      provider.Currency(),
+		ProviderRef:   result.ProviderRef,
+	}
+	if err := topUp.Insert(); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	return topUp
+}
+
+func postStripeEvent(router *gin.Engine, payload string, secret string) int {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	req := httptest.NewRequest(http.MethodPost, "/api/stripe/webhook", strings.NewReader(payload))
+	req.Header.Set("Stripe-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func checkoutCompletedEvent(tradeNo string, amountTotal int64, currency string) string {
+	return fmt.Sprintf(`{"id":"evt_%s","type":"checkout.session.completed","data":{"object":{"id":"cs_%s","client_reference_id":"%s","payment_intent":"pi_%s","payment_status":"paid","amount_total":%d,"currency":"%s"}}}`,
+		tradeNo, tradeNo, tradeNo, tradeNo, amountTotal, currency)
+}
+
+func chargeRefundedEvent(tradeNo string, amount int64, amountRefunded int64) string {
+	return fmt.Sprintf(`{"id":"evt_refund_%s","type":"charge.refunded","data":{"object":{"id":"ch_%s","payment_intent":"pi_%s","amount":%d,"amount_refunded":%d,"currency":"usd","metadata":{"trade_no":"%s"}}}}`,
+		tradeNo, tradeNo, tradeNo, amount, amountRefunded, tradeNo)
+}
+
+func createPayer(t *testing.T) *model.User {
+	user := &model.User{Username: "payer", Password: "password", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, AffCode: "payer"}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user error = %v", err)
+	}
+	return user
+}
+
+func getQuota(t *testing.T, userId int) int {
+	quota, err := model.GetUserQuota(userId, true)
+	if err != nil {
+		t.Fatalf("GetUserQuota() error = %v", err)
+	}
+	return quota
+}
+
+func TestStripeWebhookFulfilAndRefund(t *testing.T) {
+	router := setupStripeTest(t)
+	user := createPayer(t)
+	createStripeOrder(t, user.Id, "USR1NOpaid", 10)
+	paid := checkoutCompletedEvent("USR1NOpaid", 1000, "usd")
+	quotaPerOrder := int(10 * common.QuotaPerUnit)
+
+	if code := postStripeEvent(router, paid, "whsec_other"); code != http.StatusBadRequest {
+		t.Fatalf("forged webhook status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if quota := getQuota(t, user.Id); quota != 0 {
+		t.Fatalf("quota after forged webhook = %d, want 0", quota)
+	}
+
+	// Stripe 会重复投递同一事件，只入账一次
+	for i := 0; i < 2; i++ {
+		if code := postStripeEvent(router, paid, testWebhookSecret); code != http.StatusOK {
+			t.Fatalf("paid webhook #%d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if quota := getQuota(t, user.Id); quota != quotaPerOrder {
+		t.Fatalf("quota after paid webhooks = %d, want %d", quota, quotaPerOrder)
+	}
+	if topUp := model.GetTopUpByTradeNo("USR1NOpaid"); topUp.Status != "success" || topUp.ProviderRef != "pi_USR1NOpaid" {
+		t.Fatalf("order after paid webhooks = %+v", topUp)
+	}
+
+	// 部分退款重复投递只扣回一次，累计退款金额增加后再扣回差额
+	halfRefund := chargeRefundedEvent("USR1NOpaid", 1000, 500)
+	for i := 0; i < 2; i++ {
+		if code := postStripeEvent(router, halfRefund, testWebhookSecret); code != http.StatusOK {
+			t.Fatalf("refund webhook #%d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if quota := getQuota(t, user.Id); quota != quotaPerOrder/2 {
+		t.Fatalf("quota after partial refund = %d, want %d", quota, quotaPerOrder/2)
+	}
+	fullRefund := chargeRefundedEvent("USR1NOpaid", 1000, 1000)
+	for i := 0; i < 2; i++ {
+		if code := postStripeEvent(router, fullRefund, testWebhookSecret); code != http.StatusOK {
+			t.Fatalf("full refund webhook #%d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if quota := getQuota(t, user.Id); quota != 0 {
+		t.Fatalf("quota after full refund = %d, want 0", quota)
+	}
+	if topUp := model.GetTopUpByTradeNo("USR1NOpaid"); topUp.Status != "refunded" || topUp.RefundedMoney != 10 {
+		t.Fatalf("order after full refund = %+v", topUp)
+	}
+
+	// 退款后重复投递支付事件不会再次入账
+	if code := postStripeEvent(router, paid, testWebhookSecret); code != http.StatusOK {
+		t.Fatalf("replayed paid webhook status = %d, want %d", code, http.StatusOK)
+	}
+	if quota := getQuota(t, user.Id); quota != 0 {
+		t.Fatalf("quota after replayed paid webhook = %d, want 0", quota)
+	}
+}
+
+func TestStripeWebhookRejectsMismatchedPayment(t *testing.T) {
+	router := setupStripeTest(t)
+	user := createPayer(t)
+	createStripeOrder(t, user.Id, "USR1NOmismatch", 10)
+
+	cases := []struct {
+		name  string
+		event string
+	}{
+		{"currency", checkoutCompletedEvent("USR1NOmismatch", 1000, "jpy")},
+		{"amount", checkoutCompletedEvent("USR1NOmismatch", 999, "usd")},
+	}
+	for _, tc := range cases {
+		if code := postStripeEvent(router, tc.event, testWebhookSecret); code != http.StatusBadRequest {
+			t.Fatalf("%s mismatch status = %d, want %d", tc.name, code, http.StatusBadRequest)
+		}
+	}
+	if topUp := model.GetTopUpByTradeNo("USR1NOmismatch"); topUp.Status != "pending" {
+		t.Fatalf("order status = %s, want pending", topUp.Status)
+	}
+	if quota := getQuota(t, user.Id); quota != 0 {
+		t.Fatalf("quota = %d, want 0", quota)
+	}
+}
+
+func TestStripeRefundRevokesRebate(t *testing.T) {
+	router := setupStripeTest(t)
+	rebateEnabled, rebatePercentage := common.RebateEnabled, common.RebatePercentage
+	t.Cleanup(func() { common.RebateEnabled, common.RebatePercentage = rebateEnabled, rebatePercentage })
+	common.RebateEnabled = true
+	common.RebatePercentage = 10
+
+	inviter := &model.User{Username: "inviter", Password: "password", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, AffCode: "inviter"}
+	if err := model.DB.Create(inviter).Error; err != nil {
+		t.Fatalf("create inviter error = %v", err)
+	}
+	user := createPayer(t)
+	if err := model.DB.Model(user).Update("inviter_id", inviter.Id).Error; err != nil {
+		t.Fatalf("update inviter error = %v", err)
+	}
+	createStripeOrder(t, user.Id, "USR1NOrebate", 10)
+	rebate := int(10 * common.QuotaPerUnit / 10)
+
+	if code := postStripeEvent(router, checkoutCompletedEvent("USR1NOrebate", 1000, "usd"), testWebhookSecret); code != http.StatusOK {
+		t.Fatalf("paid webhook status = %d, want %d", code, http.StatusOK)
+	}
+	if quota := getQuota(t, inviter.Id); quota != rebate {
+		t.Fatalf("inviter quota after paid webhook = %d, want %d", quota, rebate)
+	}
+
+	// 部分退款按比例扣回返佣，重复投递只扣回一次
+	halfRefund := chargeRefundedEvent("USR1NOrebate", 1000, 500)
+	for i := 0; i < 2; i++ {
+		if code := postStripeEvent(router, halfRefund, testWebhookSecret); code != http.StatusOK {
+			t.Fatalf("refund webhook #%d status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if quota := getQuota(t, inviter.Id); quota != rebate/2 {
+		t.Fatalf("inviter quota after partial refund = %d, want %d", quota, rebate/2)
+	}
+	if code := postStripeEvent(router, chargeRefundedEvent("USR1NOrebate", 1000, 1000), testWebhookSecret); code != http.StatusOK {
+		t.Fatalf("full refund webhook status = %d, want %d", code, http.StatusOK)
+	}
+	if quota := getQuota(t, inviter.Id); quota != 0 {
+		t.Fatalf("inviter quota after full refund = %d, want 0", quota)
+	}
+}
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"net/http"
+	"veloera/common"
+	"veloera/middleware"
+	"veloera/model"
+	"veloera/service"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionKeyPending2FAUser = "pending_2fa_user_id"
+	sessionKeyPending2FATime = "pending_2fa_time"
+	// pending2FATimeout 密码验证通过后输入两步验证码的有效秒数
+	pending2FATimeout = 300
+)
+
+type TwoFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Login2FA 密码或第三方登录通过后校验两步验证码并完成登录
+func Login2FA(c *gin.Context) {
+	var req TwoFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	session := sessions.Default(c)
+	userId, _ := session.Get(sessionKeyPending2FAUser).(int)
+	pendingTime, _ := session.Get(sessionKeyPending2FATime).(int64)
+	if userId == 0 || common.GetTimestamp()-pendingTime > pending2FATimeout {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "登录状态已过期，请重新登录",
+		})
+		return
+	}
+	twoFA, err := model.GetTwoFAByUserId(userId)
+	if err != nil || !twoFA.Enabled || !twoFA.Verify(req.Code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil || user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户已被封禁",
+		})
+		return
+	}
+	completeLogin(user, c, true)
+}
+
+// GetTwoFAStatus 返回当前用户两步验证和通行密钥的启用情况
+func GetTwoFAStatus(c *gin.Context) {
+	id := c.GetInt("id")
+	data := gin.H{
+		"enabled":                  false,
+		"recovery_codes_remaining": 0,
+		"has_passkey":              model.HasPasskey(id),
+	}
+	if twoFA, err := model.GetTwoFAByUserId(id); err == nil && twoFA.Enabled {
+		data["enabled"] = true
+		data["recovery_codes_remaining"] = twoFA.RemainingRecoveryCodes()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+// SetupTwoFA 生成新的 TOTP 密钥，用户使用验证器应用扫描后调用 EnableTwoFA 启用
+func SetupTwoFA(c *gin.Context) {
+	id := c.GetInt("id")
+	if model.IsTwoFAEnabled(id) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "两步验证已启用，如需更换验证器请先关闭",
+		})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	twoFA, err := model.SetupTwoFA(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": twoFA.Secret,
+			"uri":    common.TOTPURI(common.SystemName, user.Username, twoFA.Secret),
+		},
+	})
+}
+
+// EnableTwoFA 校验验证器生成的验证码后启用两步验证，返回只显示一次的恢复码
+func EnableTwoFA(c *gin.Context) {
+	var req TwoFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	id := c.GetInt("id")
+	twoFA, err := model.GetTwoFAByUserId(id)
+	if err != nil || twoFA.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请先生成两步验证密钥",
+		})
+		return
+	}
+	if !twoFA.ValidateTOTP(req.Code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	codes, err := twoFA.Enable()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 当前会话已经验证过验证码，视为通过两步验证
+	session := sessions.Default(c)
+	session.Set(middleware.SessionKeyMFA, true)
+	session.Set(middleware.SessionKeyStepUpTime, common.GetTimestamp())
+	_ = session.Save()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFA 使用验证码或恢复码关闭两步验证
+func DisableTwoFA(c *gin.Context) {
+	twoFA, ok := verifyTwoFARequest(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteTwoFAByUserId(twoFA.UserId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// ResetTwoFARecoveryCodes 使用验证码重新生成恢复码，旧的恢复码全部失效
+func ResetTwoFARecoveryCodes(c *gin.Context) {
+	twoFA, ok := verifyTwoFARequest(c)
+	if !ok {
+		return
+	}
+	codes, err := twoFA.ResetRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func verifyTwoFARequest(c *gin.Context) (*model.TwoFA, bool) {
+	var req TwoFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return nil, false
+	}
+	twoFA, err := model.GetTwoFAByUserId(c.GetInt("id"))
+	if err != nil || !twoFA.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未启用两步验证",
+		})
+		return nil, false
+	}
+	if !twoFA.Verify(req.Code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return nil, false
+	}
+	return twoFA, true
+}
+
+type StepUpRequest struct {
+	Password string                     `json:"password"`
+	Code     string                     `json:"code"`
+	Passkey  *service.WebAuthnAssertion `json:"passkey"`
+}
+
+// StepUp 敏感操作前重新验证身份：启用两步验证或注册通行密钥的用户必须使用其验证，否则验证密码
+func StepUp(c *gin.Context) {
+	var req StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	id := c.GetInt("id")
+	verified := false
+	mfa := false
+	twoFA, twoFAErr := model.GetTwoFAByUserId(id)
+	twoFAEnabled := twoFAErr == nil && twoFA.Enabled
+	switch {
+	case req.Passkey != nil:
+		passkey, err := verifyPasskeyAssertion(c, *req.Passkey)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		verified = passkey.UserId == id
+		mfa = verified
+	case req.Code != "":
+		verified = twoFAEnabled && twoFA.Verify(req.Code)
+		mfa = verified
+	case req.Password != "":
+		if twoFAEnabled || model.HasPasskey(id) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请使用两步验证码或通行密钥验证身份",
+			})
+			return
+		}
+		user, err := model.GetUserById(id, true)
+		verified = err == nil && common.ValidatePasswordAndHash(req.Password, user.Password)
+	}
+	if !verified {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "身份验证失败",
+		})
+		return
+	}
+	session := sessions.Default(c)
+	session.Set(middleware.SessionKeyStepUpTime, common.GetTimestamp())
+	if mfa {
+		session.Set(middleware.SessionKeyMFA, true)
+	}
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无法保存会话信息，请重试",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -54,3 +54,40 @@ func GetUserQuotaDates(c *gin.Context) {
 	})
 	return
 }
+
+func GetMarginReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	groupBy := c.DefaultQuery("group_by", "channel")
+	data, err := model.GetMarginReport(startTimestamp, endTimestamp, groupBy)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+	return
+}
+
+// GetCreditLiability 统计用户尚未消耗且未过期的付费额度
+func GetCreditLiability(c *gin.Context) {
+	data, err := model.GetCreditLiability()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
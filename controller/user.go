@@ -67,6 +67,33 @@ func Login(c *gin.Context) {
 
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
+	// 启用两步验证的用户先记录待验证状态，验证码通过后再完成登录
+	if model.IsTwoFAEnabled(user.Id) {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Set(sessionKeyPending2FAUser, user.Id)
+		session.Set(sessionKeyPending2FATime, common.GetTimestamp())
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "无法保存会话信息，请重试",
+				"success": false,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "",
+			"success": true,
+			"data": gin.H{
+				"require_2fa": true,
+			},
+		})
+		return
+	}
+	completeLogin(user, c, false)
+}
+
+// completeLogin 写入登录会话，mfa 表示本次登录是否通过了两步验证或通行密钥
+func completeLogin(user *model.User, c *gin.Context, mfa bool) {
 	session := sessions.Default(c)
 
 	// Clear any existing session data first
@@ -86,6 +113,8 @@ func setupLogin(user *model.User, c *gin.Context) {
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
+	session.Set(middleware.SessionKeyMFA, mfa)
+	session.Set(middleware.SessionKeyStepUpTime, common.GetTimestamp())
 
 	err = session.Save()
 	if err != nil {
@@ -103,6 +132,7 @@ func setupLogin(user *model.User, c *gin.Context) {
 		Role:        user.Role,
 		Status:      user.Status,
 		Group:       user.Group,
+		Permissions: model.PermissionNames(model.GetUserPermissions(user.Id, user.Role, "")),
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -365,6 +395,19 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
+	// access token 不经过两步验证，管理员和拥有自定义角色的用户必须在满足两步验证要求的会话中生成
+	mfaRole := user.Role
+	if user.CustomRoleId != 0 && mfaRole < common.RoleAdminUser {
+		mfaRole = common.RoleAdminUser
+	}
+	if !middleware.IsAdminMFASatisfied(c, mfaRole) {
+		c.JSON(http.StatusOK, gin.H{
+			"success":      false,
+			"message":      "管理员账户需要启用两步验证或通行密钥，并使用其重新登录后才能生成访问令牌",
+			"mfa_required": true,
+		})
+		return
+	}
 	// get rand int 28-32
 	randI := common.GetRandomInt(4)
 	key, err := common.GenerateRandomKey(29 + randI)
@@ -376,6 +419,25 @@ func GenerateAccessToken(c *gin.Context) {
 		common.SysError("failed to generate key: " + err.Error())
 		return
 	}
+	// scopes 为逗号分隔的权限列表，只能从自己拥有的权限中选择，为空表示不限制
+	scopes := model.ParsePermissions(c.Query("scopes"))
+	if c.Query("scopes") != "" && len(scopes) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的授权范围",
+		})
+		return
+	}
+	permissions := model.GetUserPermissions(user.Id, user.Role, "")
+	for _, scope := range scopes {
+		if !permissions[scope] {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法授予自己没有的权限：" + scope,
+			})
+			return
+		}
+	}
 	user.SetAccessToken(key)
 
 	if model.DB.Where("access_token = ?", user.AccessToken).First(user).RowsAffected != 0 {
@@ -393,6 +455,13 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := model.UpdateUserAccessScopes(user.Id, strings.Join(scopes, ",")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -402,6 +471,35 @@ func GenerateAccessToken(c *gin.Context) {
 	return
 }
 
+// auditUserSnapshot 审计日志中记录的用户字段
+func auditUserSnapshot(user *model.User) gin.H {
+	return gin.H{
+		"username":      user.Username,
+		"display_name":  user.DisplayName,
+		"role":          user.Role,
+		"status":        user.Status,
+		"group":         user.Group,
+		"quota":         user.Quota,
+		"routing_hints": user.RoutingHints,
+	}
+}
+
+// checkRoutingHints 校验管理员授权给用户的路由偏好名称
+func checkRoutingHints(hints string) error {
+	for _, hint := range strings.Split(hints, ",") {
+		hint = strings.TrimSpace(hint)
+		if hint != "" && !common.StringsContains(constant.RoutingHints, hint) {
+			return fmt.Errorf("未知的路由偏好 %s", hint)
+		}
+	}
+	return nil
+}
+
+// customRoleManageDenied 通过自定义角色获得用户管理权限的普通用户不能管理自己和其他拥有自定义角色的用户
+func customRoleManageDenied(c *gin.Context, target *model.User) bool {
+	return c.GetBool("custom_role_elevated") && (target.Id == c.GetInt("id") || target.CustomRoleId != 0)
+}
+
 type TransferAffQuotaRequest struct {
 	Quota int `json:"quota" binding:"required"`
 }
@@ -476,6 +574,20 @@ func GetSelf(c *gin.Context) {
 		})
 		return
 	}
+	scopes := ""
+	if c.GetBool("use_access_token") {
+		scopes = user.AccessScopes
+	}
+	user.Permissions = model.PermissionNames(model.GetUserPermissions(user.Id, user.Role, scopes))
+	// webhook 密钥在数据库中加密保存，返回给用户本人时解密
+	if setting := user.GetSetting(); setting != nil {
+		if secret, ok := setting[constant.UserSettingWebhookSecret].(string); ok && common.IsEncryptedSecret(secret) {
+			if plaintext, err := common.DecryptSecret(secret); err == nil {
+				setting[constant.UserSettingWebhookSecret] = plaintext
+				user.SetSetting(setting)
+			}
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -600,7 +712,7 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 	myRole := c.GetInt("role")
-	if myRole <= originUser.Role && myRole != common.RoleRootUser {
+	if myRole <= originUser.Role && myRole != common.RoleRootUser || customRoleManageDenied(c, originUser) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
@@ -614,10 +726,24 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := checkRoutingHints(updatedUser.RoutingHints); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
 	updatePassword := updatedUser.Password != ""
+	// Edit 只修改用户名、显示名称、分组、额度、路由偏好和密码
+	after := auditUserSnapshot(&updatedUser)
+	after["role"] = originUser.Role
+	after["status"] = originUser.Status
+	if updatePassword {
+		after["password"] = "changed"
+	}
 	if err := updatedUser.Edit(updatePassword); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -628,6 +754,7 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	model.RecordAudit(c, "user.update", "user", originUser.Id, auditUserSnapshot(originUser), after)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -700,7 +827,7 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 	myRole := c.GetInt("role")
-	if myRole <= originUser.Role {
+	if myRole <= originUser.Role || customRoleManageDenied(c, originUser) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权删除同权限等级或更高权限等级的用户",
@@ -708,6 +835,9 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 	err = model.HardDeleteUserById(id)
+	if err == nil {
+		model.RecordAudit(c, "user.delete", "user", id, auditUserSnapshot(originUser), nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -786,6 +916,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordAudit(c, "user.create", "user", cleanUser.Id, nil, auditUserSnapshot(&cleanUser))
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -824,13 +955,14 @@ func ManageUser(c *gin.Context) {
 		return
 	}
 	myRole := c.GetInt("role")
-	if myRole <= user.Role && myRole != common.RoleRootUser {
+	if myRole <= user.Role && myRole != common.RoleRootUser || customRoleManageDenied(c, &user) {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权更新同权限等级或更高权限等级的用户信息",
 		})
 		return
 	}
+	before := auditUserSnapshot(&user)
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -890,6 +1022,15 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+	case "reset_2fa":
+		// 用户丢失验证设备时由管理员清除两步验证和通行密钥
+		if err := model.ResetUserMFA(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
@@ -899,6 +1040,14 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	switch req.Action {
+	case "delete":
+		model.RecordAudit(c, "user.delete", "user", user.Id, before, nil)
+	case "reset_2fa":
+		model.RecordAudit(c, "user.reset_2fa", "user", user.Id, gin.H{"mfa": "configured"}, gin.H{"mfa": "reset"})
+	default:
+		model.RecordAudit(c, "user."+req.Action, "user", user.Id, before, auditUserSnapshot(&user))
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -966,7 +1115,7 @@ func TopUp(c *gin.Context) {
 		return
 	}
 	id := c.GetInt("id")
-	quota, isGift, err := model.Redeem(req.Key, id) // 修改这里，接收所有三个返回值
+	redemption, err := model.Redeem(req.Key, id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -978,13 +1127,34 @@ func TopUp(c *gin.Context) {
 		"success": true,
 		"message": "",
 		"data": gin.H{
-			"quota":   quota,
-			"is_gift": isGift, // 可以选择返回给前端，用于显示不同的提示信息
+			"quota":         redemption.Quota,
+			"is_gift":       redemption.IsGift, // 可以选择返回给前端，用于显示不同的提示信息
+			"type":          redemption.Type,
+			"upgrade_group": redemption.UpgradeGroup,
+			"upgrade_days":  redemption.UpgradeDays,
+			"models":        redemption.Models,
 		},
 	})
 	return
 }
 
+// GetSelfModelCredits 返回当前用户剩余的模型额度
+func GetSelfModelCredits(c *gin.Context) {
+	credits, err := model.GetUserModelCredits(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    credits,
+	})
+}
+
 type UpdateUserSettingRequest struct {
 	QuotaWarningType           string  `json:"notify_type"`
 	QuotaWarningThreshold      float64 `json:"quota_warning_threshold"`
@@ -1074,7 +1244,15 @@ func UpdateUserSetting(c *gin.Context) {
 	if req.QuotaWarningType == constant.NotifyTypeWebhook {
 		settings[constant.UserSettingWebhookUrl] = req.WebhookUrl
 		if req.WebhookSecret != "" {
-			settings[constant.UserSettingWebhookSecret] = req.WebhookSecret
+			webhookSecret, err := common.EncryptSecret(req.WebhookSecret)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "保存 Webhook 密钥失败",
+				})
+				return
+			}
+			settings[constant.UserSettingWebhookSecret] = webhookSecret
 		}
 	}
 
@@ -1188,3 +1366,49 @@ func getAndValidateCheckInSettings() (checkInQuota, checkInMaxQuota int, err err
 
 	return checkInQuota, checkInMaxQuota, nil
 }
+
+func getCreditLots(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	lots, total, err := model.GetUserCreditLots(userId, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     lots,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetSelfCreditLots 当前用户的额度明细，按消耗顺序排列
+func GetSelfCreditLots(c *gin.Context) {
+	getCreditLots(c, c.GetInt("id"))
+}
+
+func GetUserCreditLots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	getCreditLots(c, id)
+}
@@ -24,6 +24,13 @@ type ClaudeMediaMessage struct {
 	Input     any             `json:"input,omitempty"`
 	Content   json.RawMessage `json:"content,omitempty"`
 	ToolUseId string          `json:"tool_use_id,omitempty"`
+	// 提示词缓存断点
+	CacheControl *ClaudeCacheControl `json:"cache_control,omitempty"`
+}
+
+type ClaudeCacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
 }
 
 func (c *ClaudeMediaMessage) SetText(s string) {
@@ -108,9 +115,10 @@ func (c *ClaudeMessage) ParseContent() ([]ClaudeMediaMessage, error) {
 }
 
 type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description,omitempty"`
-	InputSchema map[string]interface{} `json:"input_schema"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  map[string]interface{} `json:"input_schema"`
+	CacheControl *ClaudeCacheControl    `json:"cache_control,omitempty"`
 }
 
 type InputSchema struct {
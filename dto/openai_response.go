@@ -250,4 +250,5 @@ type OutputTokenDetails struct {
 	TextTokens      int `json:"text_tokens"`
 	AudioTokens     int `json:"audio_tokens"`
 	ReasoningTokens int `json:"reasoning_tokens"`
+	ImageTokens     int `json:"image_tokens,omitempty"`
 }
@@ -6,6 +6,8 @@ const (
 	RealtimeEventTypeConversationCreate = "conversation.item.create"
 	RealtimeEventTypeResponseCreate     = "response.create"
 	RealtimeEventInputAudioBufferAppend = "input_audio_buffer.append"
+	RealtimeEventInputAudioBufferCommit = "input_audio_buffer.commit"
+	RealtimeEventTypeResponseCancel     = "response.cancel"
 )
 
 const (
@@ -17,6 +19,10 @@ const (
 	RealtimeEventResponseFunctionCallArgumentsDelta = "response.function_call_arguments.delta"
 	RealtimeEventResponseFunctionCallArgumentsDone  = "response.function_call_arguments.done"
 	RealtimeEventConversationItemCreated            = "conversation.item.created"
+	RealtimeEventTypeResponseCreated                = "response.created"
+	RealtimeEventResponseTextDelta                  = "response.text.delta"
+	RealtimeEventInputAudioTranscriptionDelta       = "conversation.item.input_audio_transcription.delta"
+	RealtimeEventInputAudioTranscriptionCompleted   = "conversation.item.input_audio_transcription.completed"
 )
 
 type RealtimeEvent struct {
@@ -29,10 +35,20 @@ type RealtimeEvent struct {
 	Response *RealtimeResponse `json:"response,omitempty"`
 	Delta    string            `json:"delta,omitempty"`
 	Audio    string            `json:"audio,omitempty"`
+	// 以下字段用于非 OpenAI 协议转换后的事件
+	ResponseId string `json:"response_id,omitempty"`
+	ItemId     string `json:"item_id,omitempty"`
+	CallId     string `json:"call_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
 }
 
 type RealtimeResponse struct {
-	Usage *RealtimeUsage `json:"usage"`
+	Id     string         `json:"id,omitempty"`
+	Object string         `json:"object,omitempty"`
+	Status string         `json:"status,omitempty"`
+	Usage  *RealtimeUsage `json:"usage"`
 }
 
 type RealtimeUsage struct {
@@ -44,6 +60,8 @@ type RealtimeUsage struct {
 }
 
 type RealtimeSession struct {
+	Id                      string                  `json:"id,omitempty"`
+	Model                   string                  `json:"model,omitempty"`
 	Modalities              []string                `json:"modalities"`
 	Instructions            string                  `json:"instructions"`
 	Voice                   string                  `json:"voice"`
@@ -77,6 +95,8 @@ type RealtimeItem struct {
 	Name      *string           `json:"name,omitempty"`
 	ToolCalls any               `json:"tool_calls,omitempty"`
 	CallId    string            `json:"call_id,omitempty"`
+	Arguments string            `json:"arguments,omitempty"`
+	Output    string            `json:"output,omitempty"`
 }
 type RealtimeContent struct {
 	Type       string `json:"type"`
@@ -53,6 +53,15 @@ func main() {
 		common.FatalLog("failed to initialize database: " + err.Error())
 	}
 
+	if *common.ReencryptSecrets {
+		count, err := model.ReencryptSecrets()
+		if err != nil {
+			common.FatalLog("failed to re-encrypt secrets: " + err.Error())
+		}
+		common.SysLog(fmt.Sprintf("re-encrypted %d secrets", count))
+		return
+	}
+
 	model.CheckSetup()
 
 	// Initialize SQL Database
@@ -77,6 +86,8 @@ func main() {
 	operation_setting.InitModelSettings()
 	// Initialize constants
 	constant.InitEnv()
+	// 连接池设置来自环境变量
+	service.InitHttpClient()
 	// Initialize options
 	model.InitOptionMap()
 
@@ -96,6 +107,12 @@ func main() {
 
 	// 数据看板
 	go model.UpdateQuotaData()
+	// 临时分组升级到期恢复，订阅套餐按周期发放和过期额度
+	if common.IsMasterNode {
+		go model.SyncGroupUpgrades(60)
+		go model.SyncSubscriptions(60)
+		go model.SyncCreditLots(600)
+	}
 
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
@@ -218,6 +218,15 @@ func Distribute() func(c *gin.Context) {
 		}
 		c.Set("group", userGroup)
 
+		routingHints, err := parseRoutingHints(c)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return
+		}
+		if routingHints != nil {
+			c.Set(constant.ContextKeyRoutingHints, routingHints)
+		}
+
 		// Check if the model has a prefix, which is used for routing
 		originalModel := modelRequest.Model
 		prefixedModel, hasPrefixedModel := c.Get("prefixed_model")
@@ -280,12 +289,15 @@ func Distribute() func(c *gin.Context) {
 				// If we have a model prefix, use it to select among specific channels
 				if modelPrefix != "" {
 					channel, err = selectChannelByPrefix(userGroup, modelPrefix, modelRequest.Model)
-				} else {
-					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+				} else if channel = getSessionAffinityChannel(c, userGroup, modelRequest.Model, routingHints); channel == nil {
+					channel, err = model.GetRandomSatisfiedChannelWithHints(userGroup, modelRequest.Model, 0, routingHints)
 				}
 
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, originalModel)
+					if routingHints != nil {
+						message = fmt.Sprintf("当前分组 %s 下对于模型 %s 没有符合路由偏好的可用渠道", userGroup, originalModel)
+					}
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
 					if channel != nil {
 						common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
@@ -408,6 +420,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("channel_type", channel.Type)
 	c.Set("channel_create_time", channel.CreatedTime)
 	c.Set("channel_setting", channel.GetSetting())
+	c.Set("channel_tag", channel.GetTag())
 	c.Set("param_override", channel.GetParamOverride())
 
 	// Set model prefix if available
@@ -424,6 +437,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 
 	// 如果key包含逗号，使用轮询方式选择一个key
 	// 对于渠道类型41，不处理逗号分隔的多key机制
+	c.Set(constant.ContextKeyChannelKeyIndex, 0)
 	if channel.Type == 41 {
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 	} else if strings.Contains(channel.Key, ",") {
@@ -449,12 +463,18 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 			channelKeysHash[channel.Id] = currentHash
 		}
 
+		// 会话绑定了该渠道的某个密钥时继续使用该密钥，不推进轮询
+		if pinned, ok := c.Get(constant.ContextKeyPinnedChannelKey); ok && pinned.([2]int)[0] == channel.Id && pinned.([2]int)[1] < len(keys) {
+			index = pinned.([2]int)[1]
+		} else {
+			// Update index for next use
+			channelKeysIndex[channel.Id] = (index + 1) % len(keys)
+		}
+		channelKeysMutex.Unlock()
+
 		// Select key at current index
 		selectedKey := keys[index]
-
-		// Update index for next use
-		channelKeysIndex[channel.Id] = (index + 1) % len(keys)
-		channelKeysMutex.Unlock()
+		c.Set(constant.ContextKeyChannelKeyIndex, index)
 
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", strings.TrimSpace(selectedKey)))
 	} else {
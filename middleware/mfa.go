@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"veloera/common"
+	"veloera/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SessionKeyMFA        = "mfa"          // 本次登录是否通过了两步验证或通行密钥
+	SessionKeyStepUpTime = "step_up_time" // 最近一次验证身份的时间
+)
+
+// IsAdminMFASatisfied 开启管理员强制两步验证后，管理员会话必须通过两步验证或通行密钥登录
+func IsAdminMFASatisfied(c *gin.Context, role int) bool {
+	if role < common.RoleAdminUser || !system_setting.GetSecuritySettings().AdminRequireMFA {
+		return true
+	}
+	mfa, _ := sessions.Default(c).Get(SessionKeyMFA).(bool)
+	return mfa
+}
+
+// IsStepUpSatisfied 会话是否在有效期内重新验证过身份，使用 access token 的请求不需要重新验证
+func IsStepUpSatisfied(c *gin.Context) bool {
+	setting := system_setting.GetSecuritySettings()
+	if !setting.StepUpEnabled || c.GetBool("use_access_token") {
+		return true
+	}
+	verifiedAt, _ := sessions.Default(c).Get(SessionKeyStepUpTime).(int64)
+	return common.GetTimestamp()-verifiedAt <= int64(setting.StepUpMaxAge)
+}
+
+// StepUpAuth 敏感操作前要求重新验证身份，需放在 UserAuth 等登录校验之后
+func StepUpAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !IsStepUpSatisfied(c) {
+			c.JSON(http.StatusOK, gin.H{
+				"success":          false,
+				"message":          "该操作需要重新验证身份",
+				"step_up_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"veloera/constant"
+	"veloera/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func splitHeaderList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func headerEnabled(value string) bool {
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(value))
+	return enabled
+}
+
+// parseRoutingHints 读取请求头中的路由偏好，管理员未授权给该用户的偏好返回错误，未携带任何偏好时返回 nil
+func parseRoutingHints(c *gin.Context) (*model.ChannelRoutingHints, error) {
+	allowed, _ := c.Get("user_routing_hints")
+	allowedHints, _ := allowed.(map[string]bool)
+	hints := &model.ChannelRoutingHints{}
+	present := false
+	check := func(header string, hint string) (string, error) {
+		value := c.Request.Header.Get(header)
+		if value == "" {
+			return "", nil
+		}
+		if !allowedHints[hint] {
+			return "", fmt.Errorf("该用户无权使用请求头 %s", header)
+		}
+		present = true
+		return value, nil
+	}
+
+	value, err := check(constant.HeaderChannelTags, constant.RoutingHintTags)
+	if err != nil {
+		return nil, err
+	}
+	hints.AllowTags = splitHeaderList(value)
+	if value, err = check(constant.HeaderExcludeChannelTags, constant.RoutingHintTags); err != nil {
+		return nil, err
+	}
+	hints.DenyTags = splitHeaderList(value)
+	if value, err = check(constant.HeaderNoRetry, constant.RoutingHintNoRetry); err != nil {
+		return nil, err
+	}
+	hints.NoRetry = headerEnabled(value)
+	if value, err = check(constant.HeaderMaxPriceRatio, constant.RoutingHintMaxPriceRatio); err != nil {
+		return nil, err
+	}
+	if value != "" {
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || ratio <= 0 {
+			return nil, fmt.Errorf("请求头 %s 的值无效", constant.HeaderMaxPriceRatio)
+		}
+		hints.MaxCostRatio = ratio
+	}
+	if value, err = check(constant.HeaderRegion, constant.RoutingHintRegion); err != nil {
+		return nil, err
+	}
+	hints.PreferTag = strings.TrimSpace(value)
+	if value, err = check(constant.HeaderNoCache, constant.RoutingHintNoCache); err != nil {
+		return nil, err
+	}
+	hints.NoCache = headerEnabled(value)
+
+	if !present {
+		return nil, nil
+	}
+	return hints, nil
+}
+
+// GetRoutingHints 返回当前请求的路由偏好，未携带时返回 nil
+func GetRoutingHints(c *gin.Context) *model.ChannelRoutingHints {
+	value, ok := c.Get(constant.ContextKeyRoutingHints)
+	if !ok {
+		return nil
+	}
+	hints, _ := value.(*model.ChannelRoutingHints)
+	return hints
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/model"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionAffinityRequest struct {
+	User     string          `json:"user"`
+	System   json.RawMessage `json:"system"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// getSessionAffinityKey 依次使用会话请求头、user 字段、消息前缀哈希作为会话标识，无法确定会话时返回空字符串
+func getSessionAffinityKey(c *gin.Context, group string, modelName string) string {
+	setting := operation_setting.GetSessionAffinitySetting()
+	if !setting.Enabled {
+		return ""
+	}
+	session := strings.TrimSpace(c.Request.Header.Get(constant.HeaderSessionId))
+	if session != "" {
+		session = "session:" + session
+	} else if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		var request sessionAffinityRequest
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			return ""
+		}
+		if setting.UseUserField && request.User != "" {
+			session = "user:" + request.User
+		} else if setting.UsePrefixHash && len(request.Messages) > 0 {
+			// 系统提示词和第一条用户消息在多轮对话中保持不变，正好是上游缓存的前缀
+			var prefix strings.Builder
+			prefix.Write(request.System)
+			for _, message := range request.Messages {
+				prefix.WriteString(message.Role)
+				prefix.Write(message.Content)
+				if message.Role == "user" {
+					break
+				}
+			}
+			session = "prefix:" + common.GetMD5Hash(prefix.String())
+		}
+	}
+	if session == "" {
+		return ""
+	}
+	return common.GetMD5Hash(fmt.Sprintf("%d:%s:%s:%s", c.GetInt("id"), group, modelName, session))
+}
+
+// getSessionAffinityChannel 返回会话绑定的渠道，绑定不存在或渠道已不可用时返回 nil，由调用方重新选择
+func getSessionAffinityChannel(c *gin.Context, group string, modelName string, hints *model.ChannelRoutingHints) *model.Channel {
+	key := getSessionAffinityKey(c, group, modelName)
+	if key == "" {
+		return nil
+	}
+	c.Set(constant.ContextKeySessionAffinity, key)
+	affinity, ok := service.GetSessionAffinity(key)
+	if !ok {
+		return nil
+	}
+	channel, err := model.CacheGetChannel(affinity.ChannelId)
+	if err != nil || !model.IsChannelSatisfied(group, modelName, channel, hints) {
+		service.DeleteSessionAffinity(key)
+		return nil
+	}
+	c.Set(constant.ContextKeySessionAffinityHit, true)
+	c.Set(constant.ContextKeyPinnedChannelKey, [2]int{affinity.ChannelId, affinity.KeyIndex})
+	if common.DebugEnabled {
+		common.LogInfo(c, fmt.Sprintf("session affinity hit, channel #%d key #%d", affinity.ChannelId, affinity.KeyIndex))
+	}
+	return channel
+}
@@ -0,0 +1,293 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"veloera/common"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditLog 管理操作的审计记录，Before/After 只保存变化的字段且已屏蔽密钥，
+// Hash = sha256(PrevHash + 记录内容)，任意一条记录被修改或删除都会使后续的哈希校验失败
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64)"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(255)"`
+	Before     string `json:"before" gorm:"type:text"`
+	After      string `json:"after" gorm:"type:text"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent  string `json:"user_agent" gorm:"type:varchar(512)"`
+	PrevHash   string `json:"prev_hash" gorm:"type:char(64)"`
+	Hash       string `json:"hash" gorm:"type:char(64)"`
+}
+
+// AuditChainHead 哈希链的链尾，只有 id 为 1 的一行。写入审计日志时在事务中锁定该行，
+// 多个实例同时写入时也能按顺序追加，不会产生分叉
+type AuditChainHead struct {
+	Id   int    `json:"id"`
+	Hash string `json:"hash" gorm:"type:char(64)"`
+}
+
+const auditMask = "******"
+
+// auditSecretFields 字段名包含这些片段时屏蔽其值
+var auditSecretFields = []string{"key", "secret", "token", "password", "credential", "cookie", "authorization"}
+
+// auditLock 减少同一进程内对链尾的锁竞争
+var auditLock sync.Mutex
+
+func isAuditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range auditSecretFields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditFields 将对象转换为字段集合，非结构体的值作为 value 字段
+func auditFields(v any) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{"value": fmt.Sprint(v)}
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return map[string]any{"value": v}
+	}
+	return fields
+}
+
+// AuditDiff 比较修改前后的对象，返回变化的字段，密钥类字段只记录是否发生变化
+func AuditDiff(before any, after any) (map[string]any, map[string]any) {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	changedBefore := make(map[string]any)
+	changedAfter := make(map[string]any)
+	for name, value := range beforeFields {
+		if newValue, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, newValue) {
+			changedBefore[name] = value
+		}
+	}
+	for name, value := range afterFields {
+		if oldValue, ok := beforeFields[name]; !ok || !reflect.DeepEqual(value, oldValue) {
+			changedAfter[name] = value
+		}
+	}
+	maskAuditFields(changedBefore)
+	maskAuditFields(changedAfter)
+	return changedBefore, changedAfter
+}
+
+func maskAuditFields(fields map[string]any) {
+	for name, value := range fields {
+		fields[name] = maskAuditValue(name, value)
+	}
+}
+
+// maskAuditValue 屏蔽密钥类字段，嵌套对象和 JSON 字符串（如渠道的 setting、param_override）中的字段同样处理
+func maskAuditValue(name string, value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	if isAuditSecretField(name) {
+		return auditMask
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		maskAuditFields(v)
+	case []any:
+		for i, item := range v {
+			v[i] = maskAuditValue("", item)
+		}
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return v
+		}
+		nested := make(map[string]any)
+		if err := json.Unmarshal([]byte(v), &nested); err != nil {
+			return v
+		}
+		maskAuditFields(nested)
+		return common.MapToJsonStr(nested)
+	}
+	return value
+}
+
+func (log *AuditLog) computeHash() string {
+	content := strings.Join([]string{
+		log.PrevHash,
+		fmt.Sprint(log.CreatedAt),
+		fmt.Sprint(log.ActorId),
+		log.ActorName,
+		log.Action,
+		log.TargetType,
+		log.TargetId,
+		log.Before,
+		log.After,
+		log.Ip,
+		log.UserAgent,
+	}, "\n")
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordAudit 记录一次管理操作，before 或 after 为 nil 分别表示新建和删除
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	changedBefore, changedAfter := AuditDiff(before, after)
+	if before != nil && after != nil && len(changedBefore) == 0 && len(changedAfter) == 0 {
+		return
+	}
+	log := &AuditLog{
+		CreatedAt:  common.GetTimestamp(),
+		ActorId:    c.GetInt("id"),
+		ActorName:  c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if before != nil {
+		log.Before = common.MapToJsonStr(changedBefore)
+	}
+	if after != nil {
+		log.After = common.MapToJsonStr(changedAfter)
+	}
+	if len(log.UserAgent) > 512 {
+		log.UserAgent = log.UserAgent[:512]
+	}
+	if err := insertAuditLog(log); err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+// initAuditChainHead 创建链尾记录，升级前已有的审计日志以最后一条的哈希作为链尾
+func initAuditChainHead() error {
+	var count int64
+	if err := DB.Model(&AuditChainHead{}).Where("id = ?", 1).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+	var last AuditLog
+	if err := DB.Select("hash").Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	// 其他实例可能同时创建，主键冲突时忽略
+	DB.Create(&AuditChainHead{Id: 1, Hash: last.Hash})
+	return nil
+}
+
+func insertAuditLog(log *AuditLog) error {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	if err := initAuditChainHead(); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var head AuditChainHead
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&head, "id = ?", 1).Error; err != nil {
+			return err
+		}
+		log.PrevHash = head.Hash
+		log.Hash = log.computeHash()
+		if err := tx.Create(log).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&AuditChainHead{}).Where("id = ? AND hash = ?", 1, head.Hash).Update("hash", log.Hash)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("audit chain head changed concurrently")
+		}
+		return nil
+	})
+}
+
+// AuditLogQuery 审计日志的查询条件，零值表示不限制
+type AuditLogQuery struct {
+	ActorId    int
+	Action     string
+	TargetType string
+	TargetId   string
+	StartTime  int64
+	EndTime    int64
+}
+
+func (q AuditLogQuery) apply() *gorm.DB {
+	tx := DB.Model(&AuditLog{})
+	if q.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", q.ActorId)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		tx = tx.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetId != "" {
+		tx = tx.Where("target_id = ?", q.TargetId)
+	}
+	if q.StartTime != 0 {
+		tx = tx.Where("created_at >= ?", q.StartTime)
+	}
+	if q.EndTime != 0 {
+		tx = tx.Where("created_at <= ?", q.EndTime)
+	}
+	return tx
+}
+
+func GetAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := query.apply()
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// GetAuditLogsForExport 按时间顺序返回所有符合条件的审计日志
+func GetAuditLogsForExport(query AuditLogQuery) (logs []*AuditLog, err error) {
+	err = query.apply().Order("id asc").Find(&logs).Error
+	return logs, err
+}
+
+// VerifyAuditChain 按顺序校验哈希链，返回校验的记录数和第一条异常记录的 ID（0 表示完整）
+func VerifyAuditChain() (checked int, brokenId int, err error) {
+	prevHash := ""
+	lastId := 0
+	for {
+		var logs []*AuditLog
+		if err = DB.Where("id > ?", lastId).Order("id asc").Limit(1000).Find(&logs).Error; err != nil {
+			return checked, 0, err
+		}
+		if len(logs) == 0 {
+			return checked, 0, nil
+		}
+		for _, log := range logs {
+			if log.PrevHash != prevHash || log.computeHash() != log.Hash {
+				return checked, log.Id, nil
+			}
+			prevHash = log.Hash
+			lastId = log.Id
+			checked++
+		}
+	}
+}
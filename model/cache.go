@@ -91,48 +91,45 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 		return nil, errors.New("channel not found")
 	}
 
-	uniquePriorities := make(map[int]bool)
+	return pickChannelByPriority(channels, retry), nil
+}
+
+// pickChannelByPriority 按重试次数选择优先级，再在该优先级内按权重随机选择
+func pickChannelByPriority(channels []*Channel, retry int) *Channel {
+	uniquePriorities := make(map[int64]bool)
 	for _, channel := range channels {
-		uniquePriorities[int(channel.GetPriority())] = true
+		uniquePriorities[channel.GetPriority()] = true
 	}
-	var sortedUniquePriorities []int
+	sortedPriorities := make([]int64, 0, len(uniquePriorities))
 	for priority := range uniquePriorities {
-		sortedUniquePriorities = append(sortedUniquePriorities, priority)
+		sortedPriorities = append(sortedPriorities, priority)
 	}
-	sort.Sort(sort.Reverse(sort.IntSlice(sortedUniquePriorities)))
-
-	if retry >= len(uniquePriorities) {
-		retry = len(uniquePriorities) - 1
+	sort.Slice(sortedPriorities, func(i, j int) bool {
+		return sortedPriorities[i] > sortedPriorities[j]
+	})
+	if retry >= len(sortedPriorities) {
+		retry = len(sortedPriorities) - 1
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
+	targetPriority := sortedPriorities[retry]
 
-	// get the priority for the given retry number
 	var targetChannels []*Channel
+	totalWeight := 0
+	// 平滑系数
+	smoothingFactor := 10
 	for _, channel := range channels {
 		if channel.GetPriority() == targetPriority {
 			targetChannels = append(targetChannels, channel)
+			totalWeight += channel.GetWeight() + smoothingFactor
 		}
 	}
-
-	// 平滑系数
-	smoothingFactor := 10
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
-	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
-	}
-	// Generate a random value in the range [0, totalWeight)
 	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
 	for _, channel := range targetChannels {
 		randomWeight -= channel.GetWeight() + smoothingFactor
 		if randomWeight < 0 {
-			return channel, nil
+			return channel
 		}
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return targetChannels[len(targetChannels)-1]
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 	"veloera/common"
+	"veloera/constant"
 
 	"gorm.io/gorm"
 )
@@ -85,8 +86,138 @@ func (channel *Channel) GetAutoBan() bool {
 	return *channel.AutoBan == 1
 }
 
+// channelSecretSettings 渠道设置中与密钥一样加密保存的字段
+var channelSecretSettings = []string{constant.ChannelSettingClientKey}
+
+// convertSecretSettings 对渠道设置中的密钥类字段执行 fn，没有密钥类字段时原样返回
+func convertSecretSettings(setting *string, fn func(string) (string, error)) (*string, error) {
+	if setting == nil || *setting == "" {
+		return setting, nil
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(*setting), &values); err != nil {
+		return setting, nil
+	}
+	changed := false
+	for _, name := range channelSecretSettings {
+		value, ok := values[name].(string)
+		if !ok || value == "" {
+			continue
+		}
+		converted, err := fn(value)
+		if err != nil {
+			return setting, err
+		}
+		if converted != value {
+			values[name] = converted
+			changed = true
+		}
+	}
+	if !changed {
+		return setting, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return setting, err
+	}
+	return common.GetPointer[string](string(data)), nil
+}
+
+// isChannelSecretSetting 渠道设置中不随配置导出的字段：加密保存的私钥以及名称表明是密钥的字段
+func isChannelSecretSetting(name string) bool {
+	for _, secret := range channelSecretSettings {
+		if name == secret {
+			return true
+		}
+	}
+	return isAuditSecretField(name)
+}
+
+// stripSecretSettings 移除渠道设置中的密钥类字段
+func stripSecretSettings(setting string) string {
+	values := make(map[string]interface{})
+	if setting == "" || json.Unmarshal([]byte(setting), &values) != nil {
+		return setting
+	}
+	stripped := false
+	for name := range values {
+		if isChannelSecretSetting(name) {
+			delete(values, name)
+			stripped = true
+		}
+	}
+	if !stripped {
+		return setting
+	}
+	return common.MapToJsonStr(values)
+}
+
+// keepSecretSettings 新设置中缺少的密钥类字段沿用原设置中的值，用于导入不含密钥的配置
+func keepSecretSettings(setting string, origin string) string {
+	originValues := make(map[string]interface{})
+	if origin == "" || json.Unmarshal([]byte(origin), &originValues) != nil {
+		return setting
+	}
+	values := make(map[string]interface{})
+	if setting != "" && json.Unmarshal([]byte(setting), &values) != nil {
+		return setting
+	}
+	kept := false
+	for name, value := range originValues {
+		if _, ok := values[name]; !ok && isChannelSecretSetting(name) {
+			values[name] = value
+			kept = true
+		}
+	}
+	if !kept {
+		return setting
+	}
+	return common.MapToJsonStr(values)
+}
+
+// AfterFind 渠道密钥和设置中的私钥在数据库中加密保存，只在读取到内存后解密
+func (channel *Channel) AfterFind(tx *gorm.DB) error {
+	key, err := common.DecryptSecret(channel.Key)
+	if err != nil {
+		return err
+	}
+	channel.Key = key
+	channel.Setting, err = convertSecretSettings(channel.Setting, common.DecryptSecret)
+	return err
+}
+
+// encryptSecrets 将密钥和设置中的私钥替换为密文，返回恢复内存中明文的函数
+func (channel *Channel) encryptSecrets() (func(), error) {
+	plaintext, plainSetting := channel.Key, channel.Setting
+	encrypted, err := common.EncryptSecret(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encryptedSetting, err := convertSecretSettings(plainSetting, common.EncryptSecret)
+	if err != nil {
+		return nil, err
+	}
+	channel.Key, channel.Setting = encrypted, encryptedSetting
+	return func() {
+		channel.Key, channel.Setting = plaintext, plainSetting
+	}, nil
+}
+
+// withEncryptedKey 在写入数据库期间将密钥替换为密文，结束后恢复内存中的明文
+func (channel *Channel) withEncryptedKey(fn func() error) error {
+	restore, err := channel.encryptSecrets()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	restore()
+	return err
+}
+
 func (channel *Channel) Save() error {
-	return DB.Save(channel).Error
+	return channel.withEncryptedKey(func() error {
+		return DB.Save(channel).Error
+	})
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Channel, error) {
@@ -134,7 +265,7 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 
 	// 构造WHERE子句
 	var whereClause string
-	var args []interface{}
+	keywordCondition, args := channelKeywordCondition(keyCol, keyword)
 	if group != "" && group != "null" {
 		var groupCondition string
 		if common.UsingMySQL {
@@ -143,11 +274,11 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = keywordCondition + " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = keywordCondition + " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	// 执行查询
@@ -158,6 +289,14 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 	return channels, nil
 }
 
+// channelKeywordCondition 按 id、名称或完整密钥搜索渠道；开启密钥加密后数据库中保存的是密文，不再按密钥匹配
+func channelKeywordCondition(keyCol string, keyword string) (string, []interface{}) {
+	if common.SecretEncryptionEnabled() {
+		return "(id = ? OR name LIKE ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%"}
+	}
+	return "(id = ? OR name LIKE ? OR " + keyCol + " = ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%", keyword}
+}
+
 func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	channel := Channel{Id: id}
 	var err error = nil
@@ -171,6 +310,19 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 
 func BatchInsertChannels(channels []Channel) error {
 	var err error
+	restores := make([]func(), 0, len(channels))
+	defer func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}()
+	for i := range channels {
+		restore, err := channels[i].encryptSecrets()
+		if err != nil {
+			return err
+		}
+		restores = append(restores, restore)
+	}
 	err = DB.Create(&channels).Error
 	if err != nil {
 		return err
@@ -241,7 +393,9 @@ func (channel *Channel) GetStatusCodeMapping() string {
 
 func (channel *Channel) Insert() error {
 	var err error
-	err = DB.Create(channel).Error
+	err = channel.withEncryptedKey(func() error {
+		return DB.Create(channel).Error
+	})
 	if err != nil {
 		return err
 	}
@@ -251,7 +405,9 @@ func (channel *Channel) Insert() error {
 
 func (channel *Channel) Update() error {
 	var err error
-	err = DB.Model(channel).Updates(channel).Error
+	err = channel.withEncryptedKey(func() error {
+		return DB.Model(channel).Updates(channel).Error
+	})
 	if err != nil {
 		return err
 	}
@@ -461,7 +617,7 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 
 	// 构造WHERE子句
 	var whereClause string
-	var args []interface{}
+	keywordCondition, args := channelKeywordCondition(keyCol, keyword)
 	if group != "" && group != "null" {
 		var groupCondition string
 		if common.UsingMySQL {
@@ -470,11 +626,11 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause = keywordCondition + " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause = keywordCondition + " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+)
+
+// ChannelRoutingHints 请求携带的路由偏好，只包含管理员授权给该用户的部分
+type ChannelRoutingHints struct {
+	AllowTags []string
+	DenyTags  []string
+	// PreferTag 优先使用该标签的渠道，没有可用渠道时回退到其他渠道
+	PreferTag string
+	// MaxCostRatio 排除成本倍率高于该值的渠道，0 表示不限制
+	MaxCostRatio float64
+	NoRetry      bool
+	// NoCache 不使用内存中的渠道缓存，直接从数据库读取
+	NoCache bool
+}
+
+// affectsSelection 是否需要按偏好筛选渠道，NoRetry 只影响重试
+func (h *ChannelRoutingHints) affectsSelection() bool {
+	return h != nil && (len(h.AllowTags) > 0 || len(h.DenyTags) > 0 || h.PreferTag != "" || h.MaxCostRatio > 0 || h.NoCache)
+}
+
+func (h *ChannelRoutingHints) accept(channel *Channel) bool {
+	tag := channel.GetTag()
+	if len(h.AllowTags) > 0 && !common.StringsContains(h.AllowTags, tag) {
+		return false
+	}
+	if tag != "" && common.StringsContains(h.DenyTags, tag) {
+		return false
+	}
+	if h.MaxCostRatio > 0 {
+		if costRatio, ok := channel.GetSetting()[constant.ChannelSettingCostRatio].(float64); ok && costRatio > h.MaxCostRatio {
+			return false
+		}
+	}
+	return true
+}
+
+// GetRandomSatisfiedChannelWithHints 按路由偏好筛选后，以与 CacheGetRandomSatisfiedChannel 相同的优先级和权重规则选择渠道
+func GetRandomSatisfiedChannelWithHints(group string, model string, retry int, hints *ChannelRoutingHints) (*Channel, error) {
+	if !hints.affectsSelection() {
+		return CacheGetRandomSatisfiedChannel(group, model, retry)
+	}
+	channels, err := getSatisfiedChannels(group, model, hints.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	accepted := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if hints.accept(channel) {
+			accepted = append(accepted, channel)
+		}
+	}
+	if hints.PreferTag != "" {
+		var preferred []*Channel
+		for _, channel := range accepted {
+			if channel.GetTag() == hints.PreferTag {
+				preferred = append(preferred, channel)
+			}
+		}
+		if len(preferred) > 0 {
+			accepted = preferred
+		}
+	}
+	if len(accepted) == 0 {
+		return nil, errors.New("no channel matches the routing hints")
+	}
+	return pickChannelByPriority(accepted, retry), nil
+}
+
+func getSatisfiedChannels(group string, model string, noCache bool) ([]*Channel, error) {
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		model = "gpt-4-gizmo-*"
+	}
+	if strings.HasPrefix(model, "gpt-4o-gizmo") {
+		model = "gpt-4o-gizmo-*"
+	}
+	if common.MemoryCacheEnabled && !noCache {
+		channelSyncLock.RLock()
+		channels := append([]*Channel(nil), group2model2channels[group][model]...)
+		channelSyncLock.RUnlock()
+		if len(channels) == 0 {
+			return nil, errors.New("channel not found")
+		}
+		return channels, nil
+	}
+
+	var channelIds []int
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = ?", group, model, true).
+		Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channelIds) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	var channels []*Channel
+	err = DB.Where("id in ? and status = ?", channelIds, common.ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("channel not found")
+	}
+	return channels, nil
+}
+
+// IsChannelSatisfied 判断渠道当前是否可用于该分组和模型，并且符合路由偏好，用于校验会话绑定的渠道
+func IsChannelSatisfied(group string, model string, channel *Channel, hints *ChannelRoutingHints) bool {
+	if channel == nil || channel.Status != common.ChannelStatusEnabled {
+		return false
+	}
+	if hints != nil && !hints.accept(channel) {
+		return false
+	}
+	noCache := hints != nil && hints.NoCache
+	channels, err := getSatisfiedChannels(group, model, noCache)
+	if err != nil {
+		return false
+	}
+	for _, satisfied := range channels {
+		if satisfied.Id == channel.Id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,343 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"veloera/common"
+
+	"gorm.io/gorm"
+)
+
+// ConfigBundleVersion 配置文档的格式版本，格式不兼容时递增
+const ConfigBundleVersion = 1
+
+// ChannelSpec 配置文档中的渠道，以名称作为渠道的唯一标识，导入时按名称匹配已有渠道
+type ChannelSpec struct {
+	Name               string `json:"name" yaml:"name"`
+	Type               int    `json:"type" yaml:"type"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`
+	Status             int    `json:"status" yaml:"status"`
+	BaseURL            string `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty" yaml:"openai_organization,omitempty"`
+	TestModel          string `json:"test_model,omitempty" yaml:"test_model,omitempty"`
+	Models             string `json:"models" yaml:"models"`
+	Group              string `json:"group" yaml:"group"`
+	Tag                string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty" yaml:"status_code_mapping,omitempty"`
+	ModelPrefix        string `json:"model_prefix,omitempty" yaml:"model_prefix,omitempty"`
+	Priority           int64  `json:"priority" yaml:"priority"`
+	Weight             uint   `json:"weight" yaml:"weight"`
+	AutoBan            int    `json:"auto_ban" yaml:"auto_ban"`
+	Other              string `json:"other,omitempty" yaml:"other,omitempty"`
+	OtherInfo          string `json:"other_info,omitempty" yaml:"other_info,omitempty"`
+	Setting            string `json:"setting,omitempty" yaml:"setting,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty" yaml:"param_override,omitempty"`
+}
+
+// ConfigBundle 网关的完整声明式配置：渠道（能力表由渠道生成）以及所有系统设置，
+// 模型倍率、分组倍率和 config.GlobalConfig 中注册的设置都保存在 options 中
+type ConfigBundle struct {
+	Version    int               `json:"version" yaml:"version"`
+	ExportedAt int64             `json:"exported_at,omitempty" yaml:"exported_at,omitempty"`
+	Channels   []ChannelSpec     `json:"channels" yaml:"channels"`
+	Options    map[string]string `json:"options" yaml:"options"`
+}
+
+// ConfigChange 导入时的一项变更，Before 和 After 只包含变化的字段，密钥会被掩码
+type ConfigChange struct {
+	Kind   string         `json:"kind"`   // channel 或 option
+	Name   string         `json:"name"`   // 渠道名称或配置项名称
+	Action string         `json:"action"` // create、update 或 delete
+	Before map[string]any `json:"before,omitempty"`
+	After  map[string]any `json:"after,omitempty"`
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func channelToSpec(channel *Channel, includeKey bool) ChannelSpec {
+	spec := ChannelSpec{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Status:             channel.Status,
+		BaseURL:            channel.GetBaseURL(),
+		OpenAIOrganization: stringValue(channel.OpenAIOrganization),
+		TestModel:          stringValue(channel.TestModel),
+		Models:             channel.Models,
+		Group:              channel.Group,
+		Tag:                channel.GetTag(),
+		ModelMapping:       channel.GetModelMapping(),
+		StatusCodeMapping:  channel.GetStatusCodeMapping(),
+		ModelPrefix:        channel.GetModelPrefix(),
+		Priority:           channel.GetPriority(),
+		Weight:             uint(channel.GetWeight()),
+		AutoBan:            1,
+		Other:              channel.Other,
+		OtherInfo:          channel.OtherInfo,
+		Setting:            stringValue(channel.Setting),
+		ParamOverride:      stringValue(channel.ParamOverride),
+	}
+	if channel.AutoBan != nil {
+		spec.AutoBan = *channel.AutoBan
+	}
+	if includeKey {
+		spec.Key = channel.Key
+	} else {
+		spec.Setting = stripSecretSettings(spec.Setting)
+	}
+	return spec
+}
+
+// applyTo 将声明的字段写入渠道，密钥为空时保留原密钥，设置中省略的密钥类字段已在生成变更计划时补全
+func (spec ChannelSpec) applyTo(channel *Channel) {
+	channel.Name = spec.Name
+	channel.Type = spec.Type
+	if spec.Key != "" {
+		channel.Key = spec.Key
+	}
+	channel.Status = spec.Status
+	channel.BaseURL = common.GetPointer(spec.BaseURL)
+	channel.OpenAIOrganization = common.GetPointer(spec.OpenAIOrganization)
+	channel.TestModel = common.GetPointer(spec.TestModel)
+	channel.Models = spec.Models
+	channel.Group = spec.Group
+	channel.Tag = common.GetPointer(spec.Tag)
+	channel.ModelMapping = common.GetPointer(spec.ModelMapping)
+	channel.StatusCodeMapping = common.GetPointer(spec.StatusCodeMapping)
+	channel.ModelPrefix = common.GetPointer(spec.ModelPrefix)
+	channel.Priority = common.GetPointer(spec.Priority)
+	channel.Weight = common.GetPointer(spec.Weight)
+	channel.AutoBan = common.GetPointer(spec.AutoBan)
+	channel.Other = spec.Other
+	channel.OtherInfo = spec.OtherInfo
+	channel.Setting = common.GetPointer(spec.Setting)
+	channel.ParamOverride = common.GetPointer(spec.ParamOverride)
+}
+
+// ExportConfigBundle 导出当前配置，includeSecrets 为 false 时不导出渠道密钥和密钥类配置
+func ExportConfigBundle(includeSecrets bool) (*ConfigBundle, error) {
+	var channels []*Channel
+	if err := DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	bundle := &ConfigBundle{
+		Version:    ConfigBundleVersion,
+		ExportedAt: common.GetTimestamp(),
+		Channels:   make([]ChannelSpec, 0, len(channels)),
+		Options:    make(map[string]string),
+	}
+	for _, channel := range channels {
+		bundle.Channels = append(bundle.Channels, channelToSpec(channel, includeSecrets))
+	}
+	common.OptionMapRWMutex.RLock()
+	for key, value := range common.OptionMap {
+		if !includeSecrets && IsSecretOption(key) {
+			continue
+		}
+		bundle.Options[key] = value
+	}
+	common.OptionMapRWMutex.RUnlock()
+	return bundle, nil
+}
+
+type configPlan struct {
+	changes  []ConfigChange
+	creates  []ChannelSpec
+	updates  map[int]ChannelSpec
+	deletes  []*Channel
+	options  map[string]string
+	affected []string // 需要刷新渠道缓存的分组
+}
+
+// planConfigBundle 对比配置文档和当前配置，prune 为 true 时文档中不存在的渠道会被删除
+func planConfigBundle(bundle *ConfigBundle, prune bool) (*configPlan, error) {
+	if bundle.Version != ConfigBundleVersion {
+		return nil, fmt.Errorf("不支持的配置版本 %d，当前版本为 %d", bundle.Version, ConfigBundleVersion)
+	}
+	var existing []*Channel
+	if err := DB.Order("id asc").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Channel)
+	duplicated := make(map[string]bool)
+	for _, channel := range existing {
+		if _, ok := byName[channel.Name]; ok {
+			duplicated[channel.Name] = true
+		}
+		byName[channel.Name] = channel
+	}
+
+	plan := &configPlan{
+		updates: make(map[int]ChannelSpec),
+		options: make(map[string]string),
+	}
+	declared := make(map[string]bool)
+	for _, spec := range bundle.Channels {
+		spec.Name = strings.TrimSpace(spec.Name)
+		if spec.Name == "" {
+			return nil, errors.New("渠道名称不能为空")
+		}
+		if declared[spec.Name] {
+			return nil, fmt.Errorf("配置中存在重名渠道 %s", spec.Name)
+		}
+		declared[spec.Name] = true
+		if duplicated[spec.Name] {
+			return nil, fmt.Errorf("已有多个名为 %s 的渠道，无法确定要更新的渠道", spec.Name)
+		}
+		if spec.Group == "" {
+			spec.Group = "default"
+		}
+		if spec.Status == common.ChannelStatusUnknown {
+			spec.Status = common.ChannelStatusEnabled
+		}
+		channel, ok := byName[spec.Name]
+		if !ok {
+			if spec.Key == "" {
+				return nil, fmt.Errorf("新渠道 %s 缺少密钥", spec.Name)
+			}
+			_, after := AuditDiff(nil, spec)
+			plan.changes = append(plan.changes, ConfigChange{Kind: "channel", Name: spec.Name, Action: "create", After: after})
+			plan.creates = append(plan.creates, spec)
+			plan.affected = append(plan.affected, spec.Group)
+			continue
+		}
+		current := channelToSpec(channel, true)
+		if spec.Key == "" {
+			spec.Key = current.Key
+		}
+		spec.Setting = keepSecretSettings(spec.Setting, current.Setting)
+		before, after := AuditDiff(current, spec)
+		if len(before) == 0 && len(after) == 0 {
+			continue
+		}
+		plan.changes = append(plan.changes, ConfigChange{Kind: "channel", Name: spec.Name, Action: "update", Before: before, After: after})
+		plan.updates[channel.Id] = spec
+		plan.affected = append(plan.affected, channel.Group, spec.Group)
+	}
+	if prune {
+		for _, channel := range existing {
+			if declared[channel.Name] {
+				continue
+			}
+			plan.changes = append(plan.changes, ConfigChange{Kind: "channel", Name: channel.Name, Action: "delete"})
+			plan.deletes = append(plan.deletes, channel)
+			plan.affected = append(plan.affected, channel.Group)
+		}
+	}
+
+	keys := make([]string, 0, len(bundle.Options))
+	for key := range bundle.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	// 前置条件按导入后的配置检查
+	lookup := func(key string) string {
+		if value, ok := bundle.Options[key]; ok {
+			return value
+		}
+		return common.OptionMap[key]
+	}
+	for _, key := range keys {
+		current, ok := common.OptionMap[key]
+		if !ok {
+			return nil, fmt.Errorf("未知的配置项 %s", key)
+		}
+		value := bundle.Options[key]
+		if current == value {
+			continue
+		}
+		if err := ValidateOption(key, value, lookup); err != nil {
+			return nil, fmt.Errorf("配置项 %s 无效：%v", key, err)
+		}
+		before, after := AuditDiff(map[string]any{key: current}, map[string]any{key: value})
+		plan.changes = append(plan.changes, ConfigChange{Kind: "option", Name: key, Action: "update", Before: before, After: after})
+		plan.options[key] = value
+	}
+	return plan, nil
+}
+
+// ApplyConfigBundle 将配置文档应用到当前实例，结果是幂等的：重复导入同一份文档不会产生变更。
+// 所有变更在同一个事务中写入，任何一项失败都不会留下部分生效的配置，内存中的配置在提交后才更新。
+// dryRun 为 true 时只返回变更列表；返回值中的分组需要刷新渠道缓存
+func ApplyConfigBundle(bundle *ConfigBundle, prune bool, dryRun bool) ([]ConfigChange, []string, error) {
+	plan, err := planConfigBundle(bundle, prune)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dryRun {
+		return plan.changes, nil, nil
+	}
+	keys := make([]string, 0, len(plan.options))
+	for key := range plan.options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	updates := make([]*Channel, 0, len(plan.updates))
+	for id, spec := range plan.updates {
+		channel, err := GetChannelById(id, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		spec.applyTo(channel)
+		updates = append(updates, channel)
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, spec := range plan.creates {
+			channel := Channel{CreatedTime: common.GetTimestamp()}
+			spec.applyTo(&channel)
+			err := channel.withEncryptedKey(func() error {
+				return tx.Create(&channel).Error
+			})
+			if err == nil {
+				err = channel.UpdateAbilities(tx)
+			}
+			if err != nil {
+				return fmt.Errorf("创建渠道 %s 失败：%v", spec.Name, err)
+			}
+		}
+		for _, channel := range updates {
+			err := channel.withEncryptedKey(func() error {
+				return tx.Save(channel).Error
+			})
+			if err == nil {
+				err = channel.UpdateAbilities(tx)
+			}
+			if err != nil {
+				return fmt.Errorf("更新渠道 %s 失败：%v", channel.Name, err)
+			}
+		}
+		for _, channel := range plan.deletes {
+			err := tx.Delete(channel).Error
+			if err == nil {
+				err = tx.Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error
+			}
+			if err != nil {
+				return fmt.Errorf("删除渠道 %s 失败：%v", channel.Name, err)
+			}
+		}
+		for _, key := range keys {
+			if err := saveOption(tx, key, plan.options[key]); err != nil {
+				return fmt.Errorf("更新配置项 %s 失败：%v", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, key := range keys {
+		if err := updateOptionMap(key, plan.options[key]); err != nil {
+			common.SysError(fmt.Sprintf("failed to apply option %s: %s", key, err.Error()))
+		}
+	}
+	return plan.changes, plan.affected, nil
+}
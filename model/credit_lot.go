@@ -0,0 +1,350 @@
+package model
+
+import (
+	"fmt"
+	"time"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	CreditSourceTopUp        = "topup"
+	CreditSourcePromotion    = "promotion"
+	CreditSourceRedemption   = "redemption"
+	CreditSourceGift         = "gift"
+	CreditSourceCheckIn      = "checkin"
+	CreditSourceAffiliate    = "affiliate"
+	CreditSourceSignup       = "signup"
+	CreditSourceSubscription = "subscription"
+)
+
+// CreditLot 用户额度的一笔来源，用户额度中有来源的部分按过期时间先后消耗，
+// 早于本功能存在的额度和管理员直接修改的额度没有对应的批次，最后消耗。
+// Amount = Remaining + Used + Expired + Revoked
+type CreditLot struct {
+	Id          int     `json:"id"`
+	UserId      int     `json:"user_id" gorm:"index"`
+	Source      string  `json:"source" gorm:"type:varchar(32);index"`
+	SourceRef   string  `json:"source_ref" gorm:"type:varchar(64);index"` // 充值订单号、兑换码 ID 等
+	Amount      int     `json:"amount" gorm:"default:0"`
+	Remaining   int     `json:"remaining" gorm:"default:0;index"`
+	Used        int     `json:"used" gorm:"default:0"`
+	Expired     int     `json:"expired" gorm:"default:0"`
+	Revoked     int     `json:"revoked" gorm:"default:0"` // 退款扣回的额度
+	Paid        bool    `json:"paid" gorm:"default:false"`
+	Money       float64 `json:"money" gorm:"default:0"` // 实付金额，只有充值批次有
+	Currency    string  `json:"currency" gorm:"type:varchar(8);default:''"`
+	ExpireTime  int64   `json:"expire_time" gorm:"bigint;index"` // 0 表示永不过期
+	CreatedTime int64   `json:"created_time" gorm:"bigint"`
+}
+
+// creditLotConsumeOrder 先消耗先过期的批次，永不过期的批次最后消耗，同一过期时间按发放顺序
+const creditLotConsumeOrder = "CASE WHEN expire_time = 0 THEN 1 ELSE 0 END, expire_time, id"
+
+// creditLotExpireTime 按来源计算批次的过期时间
+func creditLotExpireTime(source string, now int64) int64 {
+	days := operation_setting.GetCreditSetting().ExpireDays(source)
+	if days <= 0 {
+		return 0
+	}
+	return now + int64(days)*86400
+}
+
+func newCreditLot(userId int, source string, sourceRef string, amount int) *CreditLot {
+	now := common.GetTimestamp()
+	return &CreditLot{
+		UserId:      userId,
+		Source:      source,
+		SourceRef:   sourceRef,
+		Amount:      amount,
+		Remaining:   amount,
+		ExpireTime:  creditLotExpireTime(source, now),
+		CreatedTime: now,
+	}
+}
+
+// createCreditLot 在发放额度的事务中记录批次，tx 为 nil 时使用 DB
+func createCreditLot(tx *gorm.DB, lot *CreditLot) error {
+	if lot.Amount <= 0 {
+		return nil
+	}
+	if tx == nil {
+		tx = DB
+	}
+	return tx.Create(lot).Error
+}
+
+// AddCreditLot 记录一笔额度来源，额度本身由调用方增加，记录失败只影响过期和对账，不影响额度
+func AddCreditLot(userId int, source string, sourceRef string, amount int) {
+	if err := createCreditLot(nil, newCreditLot(userId, source, sourceRef, amount)); err != nil {
+		common.SysError(fmt.Sprintf("failed to record %s credit lot of user %d: %s", source, userId, err.Error()))
+	}
+}
+
+// AddPaidCreditLot 记录在线充值的额度，实付金额用于统计未消耗额度对应的负债
+func AddPaidCreditLot(userId int, tradeNo string, amount int, money float64, currency string) {
+	lot := newCreditLot(userId, CreditSourceTopUp, tradeNo, amount)
+	lot.Paid = true
+	lot.Money = money
+	lot.Currency = currency
+	if err := createCreditLot(nil, lot); err != nil {
+		common.SysError(fmt.Sprintf("failed to record top-up credit lot of user %d: %s", userId, err.Error()))
+	}
+}
+
+// SettleCreditLots 将用户额度的变化同步到批次：delta 为正时按过期顺序消耗，
+// 为负时（退还预扣费、任务失败补偿等）按相反顺序退回到尚未过期的批次
+func SettleCreditLots(userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	now := common.GetTimestamp()
+	// 绝大多数请求的用户没有可结算的批次，先不加锁确认
+	query := DB.Model(&CreditLot{}).Where("user_id = ? AND (expire_time = 0 OR expire_time > ?)", userId, now)
+	if delta > 0 {
+		query = query.Where("remaining > 0")
+	} else {
+		query = query.Where("used > 0")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil || count == 0 {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var lots []*CreditLot
+		query := tx.Set("gorm:query_option", "FOR UPDATE").Where("user_id = ? AND (expire_time = 0 OR expire_time > ?)", userId, now)
+		if delta > 0 {
+			query = query.Where("remaining > 0")
+		} else {
+			query = query.Where("used > 0")
+		}
+		if err := query.Order(creditLotConsumeOrder).Find(&lots).Error; err != nil {
+			return err
+		}
+		if delta < 0 {
+			// 退回时从最后消耗的批次开始
+			for i, j := 0, len(lots)-1; i < j; i, j = i+1, j-1 {
+				lots[i], lots[j] = lots[j], lots[i]
+			}
+		}
+		rest := delta
+		if rest < 0 {
+			rest = -rest
+		}
+		for _, lot := range lots {
+			if rest <= 0 {
+				break
+			}
+			var result *gorm.DB
+			if delta > 0 {
+				amount := min(lot.Remaining, rest)
+				result = tx.Model(&CreditLot{}).Where("id = ? AND remaining >= ?", lot.Id, amount).Updates(map[string]interface{}{
+					"remaining": gorm.Expr("remaining - ?", amount),
+					"used":      gorm.Expr("used + ?", amount),
+				})
+				if result.Error == nil && result.RowsAffected > 0 {
+					rest -= amount
+				}
+			} else {
+				amount := min(lot.Used, rest)
+				result = tx.Model(&CreditLot{}).Where("id = ? AND used >= ?", lot.Id, amount).Updates(map[string]interface{}{
+					"remaining": gorm.Expr("remaining + ?", amount),
+					"used":      gorm.Expr("used - ?", amount),
+				})
+				if result.Error == nil && result.RowsAffected > 0 {
+					rest -= amount
+				}
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		// 剩余部分来自没有批次的额度
+		return nil
+	})
+}
+
+// DeltaSettleCreditLots 在请求计费时结算批次，不阻塞请求：开启批量更新时按用户合并后结算，否则异步结算
+func DeltaSettleCreditLots(userId int, delta int) {
+	if delta == 0 {
+		return
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeCreditLot, userId, delta)
+		return
+	}
+	gopool.Go(func() {
+		if err := SettleCreditLots(userId, delta); err != nil {
+			common.SysError("failed to settle credit lots: " + err.Error())
+		}
+	})
+}
+
+// RevokeCreditLots 退款时从 sourceRef 对应的批次中扣回额度，返回实际从批次中扣回的额度，
+// 已经消耗的部分由调用方从用户的其他额度中扣回
+func RevokeCreditLots(userId int, sourceRef string, amount int) (revoked int, err error) {
+	if amount <= 0 || sourceRef == "" {
+		return 0, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var lots []*CreditLot
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("user_id = ? AND source_ref = ? AND remaining > 0", userId, sourceRef).
+			Order("id asc").Find(&lots).Error
+		if err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			if revoked >= amount {
+				break
+			}
+			n := min(lot.Remaining, amount-revoked)
+			result := tx.Model(&CreditLot{}).Where("id = ? AND remaining >= ?", lot.Id, n).Updates(map[string]interface{}{
+				"remaining": gorm.Expr("remaining - ?", n),
+				"revoked":   gorm.Expr("revoked + ?", n),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				revoked += n
+			}
+		}
+		return nil
+	})
+	return revoked, err
+}
+
+// expireCreditLot 作废批次中 amount 的剩余额度并扣减用户额度，返回实际作废的额度。
+// 用户额度可能因管理员修改等原因少于批次剩余额度，最多扣减到 0
+func expireCreditLot(lot *CreditLot, amount int) (int, error) {
+	amount = min(amount, lot.Remaining)
+	if amount <= 0 {
+		return 0, nil
+	}
+	result := DB.Model(&CreditLot{}).Where("id = ? AND remaining >= ?", lot.Id, amount).Updates(map[string]interface{}{
+		"remaining": gorm.Expr("remaining - ?", amount),
+		"expired":   gorm.Expr("expired + ?", amount),
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return 0, result.Error
+	}
+	quota, err := GetUserQuota(lot.UserId, true)
+	if err != nil {
+		return 0, err
+	}
+	decrease := min(amount, max(quota, 0))
+	if decrease > 0 {
+		if err := DecreaseUserQuota(lot.UserId, decrease); err != nil {
+			return 0, err
+		}
+	}
+	return decrease, nil
+}
+
+// ExpireCreditLots 作废所有已过期批次的剩余额度，订阅额度由订阅周期按结转比例处理
+func ExpireCreditLots() {
+	var lots []*CreditLot
+	err := DB.Where("expire_time > 0 AND expire_time <= ? AND remaining > 0 AND source <> ?", common.GetTimestamp(), CreditSourceSubscription).
+		Order("id asc").Find(&lots).Error
+	if err != nil {
+		common.SysError("failed to query expired credit lots: " + err.Error())
+		return
+	}
+	for _, lot := range lots {
+		expired, err := expireCreditLot(lot, lot.Remaining)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to expire credit lot %d: %s", lot.Id, err.Error()))
+			continue
+		}
+		if expired > 0 {
+			RecordLog(lot.UserId, LogTypeSystem, fmt.Sprintf("%s获得的额度 %s 已过期", creditSourceName(lot.Source), common.LogQuota(expired)))
+		}
+	}
+}
+
+func SyncCreditLots(frequency int) {
+	for {
+		ExpireCreditLots()
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
+
+func creditSourceName(source string) string {
+	switch source {
+	case CreditSourceTopUp:
+		return "在线充值"
+	case CreditSourcePromotion:
+		return "充值赠送"
+	case CreditSourceRedemption:
+		return "兑换码"
+	case CreditSourceGift:
+		return "礼品码"
+	case CreditSourceCheckIn:
+		return "签到"
+	case CreditSourceAffiliate:
+		return "邀请返利"
+	case CreditSourceSignup:
+		return "注册赠送"
+	case CreditSourceSubscription:
+		return "订阅套餐"
+	}
+	return source
+}
+
+// GetUserCreditLots 用户的额度批次，按消耗顺序排列，已用完的批次排在最后
+func GetUserCreditLots(userId int, startIdx int, num int) (lots []*CreditLot, total int64, err error) {
+	tx := DB.Model(&CreditLot{}).Where("user_id = ?", userId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("CASE WHEN remaining > 0 THEN 0 ELSE 1 END").Order(creditLotConsumeOrder).
+		Limit(num).Offset(startIdx).Find(&lots).Error
+	return lots, total, err
+}
+
+// CreditLiability 未过期的付费额度，即已收款但尚未提供服务的部分
+type CreditLiability struct {
+	Quota    int                         `json:"quota"`
+	Amount   float64                     `json:"amount"` // 按额度折算的美元
+	Sources  map[string]int              `json:"sources"`
+	Currency map[string]*CurrencyBalance `json:"currency"`
+}
+
+// CurrencyBalance 按实付币种统计的未消耗金额，按批次剩余比例折算
+type CurrencyBalance struct {
+	Quota int     `json:"quota"`
+	Money float64 `json:"money"`
+}
+
+func GetCreditLiability() (*CreditLiability, error) {
+	var lots []*CreditLot
+	err := DB.Select("source", "amount", "remaining", "money", "currency").
+		Where("paid = ? AND remaining > 0 AND (expire_time = 0 OR expire_time > ?)", true, common.GetTimestamp()).
+		Find(&lots).Error
+	if err != nil {
+		return nil, err
+	}
+	liability := &CreditLiability{
+		Sources:  make(map[string]int),
+		Currency: make(map[string]*CurrencyBalance),
+	}
+	for _, lot := range lots {
+		liability.Quota += lot.Remaining
+		liability.Sources[lot.Source] += lot.Remaining
+		if lot.Money <= 0 || lot.Currency == "" || lot.Amount <= 0 {
+			continue
+		}
+		balance, ok := liability.Currency[lot.Currency]
+		if !ok {
+			balance = &CurrencyBalance{}
+			liability.Currency[lot.Currency] = balance
+		}
+		balance.Quota += lot.Remaining
+		balance.Money += lot.Money * float64(lot.Remaining) / float64(lot.Amount)
+	}
+	liability.Amount = float64(liability.Quota) / common.QuotaPerUnit
+	return liability, nil
+}
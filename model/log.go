@@ -23,6 +23,7 @@ type Log struct {
 	TokenName        string `json:"token_name" gorm:"index;default:''"`
 	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota            int    `json:"quota" gorm:"default:0"`
+	Cost             int    `json:"cost" gorm:"default:0"`
 	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
 	UseTime          int    `json:"use_time" gorm:"default:0"`
@@ -42,11 +43,15 @@ const (
 	LogTypeSystem
 	LogTypeCheckIn
 	LogTypeError
+	LogTypeGuardrail
+	LogTypeSubscription
+	LogTypeRefund
 )
 
 func formatUserLogs(logs []*Log) {
 	for i := range logs {
 		logs[i].ChannelName = ""
+		logs[i].Cost = 0
 		var otherMap map[string]interface{}
 		otherMap = common.StrToMap(logs[i].Other)
 		if otherMap != nil {
@@ -93,6 +98,27 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
+func RecordGuardrailLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int,
+	group string, other map[string]interface{}) {
+	log := &Log{
+		UserId:    userId,
+		Username:  c.GetString("username"),
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeGuardrail,
+		Content:   content,
+		TokenName: tokenName,
+		ModelName: modelName,
+		ChannelId: channelId,
+		TokenId:   tokenId,
+		Group:     group,
+		Other:     common.MapToJsonStr(other),
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		common.LogError(c, "failed to record log: "+err.Error())
+	}
+}
+
 func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string, tokenName string, content string, tokenId int, useTimeSeconds int,
 	isStream bool, group string, other map[string]interface{}) {
 	common.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
@@ -122,12 +148,13 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	}
 }
 
+// RecordConsumeLog 记录消费日志，返回写入的日志，未开启消费日志或写入失败时返回 nil
 func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens int, completionTokens int,
-	modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int,
-	isStream bool, group string, other map[string]interface{}) {
-	common.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	modelName string, tokenName string, quota int, cost int, content string, tokenId int, userQuota int, useTimeSeconds int,
+	isStream bool, group string, other map[string]interface{}) *Log {
+	common.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, cost=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, cost, content))
 	if !common.LogConsumeEnabled {
-		return
+		return nil
 	}
 	username := c.GetString("username")
 	otherStr := common.MapToJsonStr(other)
@@ -142,6 +169,7 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 		TokenName:        tokenName,
 		ModelName:        modelName,
 		Quota:            quota,
+		Cost:             cost,
 		ChannelId:        channelId,
 		TokenId:          tokenId,
 		UseTime:          useTimeSeconds,
@@ -152,12 +180,15 @@ func RecordConsumeLog(c *gin.Context, userId int, channelId int, promptTokens in
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		common.LogError(c, "failed to record log: "+err.Error())
+		log = nil
 	}
-	if common.DataExportEnabled {
-		gopool.Go(func() {
+	gopool.Go(func() {
+		if common.DataExportEnabled {
 			LogQuotaData(userId, username, modelName, quota, common.GetTimestamp(), promptTokens+completionTokens)
-		})
-	}
+		}
+		LogChannelCostData(channelId, modelName, group, quota, cost, common.GetTimestamp(), promptTokens+completionTokens)
+	})
+	return log
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string) (logs []*Log, total int64, err error) {
@@ -247,13 +247,24 @@ func migrateDB() error {
 		&Option{},
 		&Redemption{},
 		&RedemptionLog{},
+		&ModelCredit{},
+		&SubscriptionPlan{},
+		&UserSubscription{},
+		&CreditLot{},
+		&RefundRequest{},
 		&Ability{},
 		&Log{},
 		&Midjourney{},
 		&TopUp{},
 		&QuotaData{},
+		&ChannelCostData{},
 		&Task{},
 		&Setup{},
+		&TwoFA{},
+		&Passkey{},
+		&Role{},
+		&AuditLog{},
+		&AuditChainHead{},
 	}
 
 	for _, model := range modelsToMigrate {
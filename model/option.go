@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -8,6 +9,8 @@ import (
 	"veloera/setting"
 	"veloera/setting/config"
 	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
 )
 
 type Option struct {
@@ -79,6 +82,7 @@ func InitOptionMap() {
 	common.OptionMap["EpayId"] = ""
 	common.OptionMap["EpayKey"] = ""
 	common.OptionMap["Price"] = strconv.FormatFloat(setting.Price, 'f', -1, 64)
+	common.OptionMap["EpayCurrency"] = setting.EpayCurrency
 	common.OptionMap["MinTopUp"] = strconv.Itoa(setting.MinTopUp)
 	common.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	common.OptionMap["Chats"] = setting.Chats2JsonString()
@@ -105,6 +109,7 @@ func InitOptionMap() {
 	common.OptionMap["GroupRatio"] = setting.GroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
 	common.OptionMap["CompletionRatio"] = operation_setting.CompletionRatio2JSONString()
+	common.OptionMap["PricingRules"] = operation_setting.PricingRules2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	//common.OptionMap["ChatLink"] = common.ChatLink
 	//common.OptionMap["ChatLink2"] = common.ChatLink2
@@ -123,9 +128,12 @@ func InitOptionMap() {
 	common.OptionMap["SelfUseModeEnabled"] = strconv.FormatBool(operation_setting.SelfUseModeEnabled)
 	common.OptionMap["ModelRequestRateLimitEnabled"] = strconv.FormatBool(setting.ModelRequestRateLimitEnabled)
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
+	common.OptionMap["CheckSensitiveOnCompletionEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnCompletionEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
 	common.OptionMap["SensitiveWords"] = setting.SensitiveWordsToString()
 	common.OptionMap["StreamCacheQueueLength"] = strconv.Itoa(setting.StreamCacheQueueLength)
+	common.OptionMap["StreamFilterHoldLength"] = strconv.Itoa(setting.StreamFilterHoldLength)
+	common.OptionMap["StreamGuardrailCheckLength"] = strconv.Itoa(setting.StreamGuardrailCheckLength)
 	common.OptionMap["AutomaticDisableKeywords"] = operation_setting.AutomaticDisableKeywordsToString()
 
 	// 自动添加所有注册的模型配置
@@ -138,9 +146,78 @@ func InitOptionMap() {
 	loadOptionsFromDatabase()
 }
 
+// IsSecretOption 判断配置项是否为密钥类配置，这类配置在数据库中加密保存，也不会通过接口返回
+// GetOptionValue 返回配置项当前的值
+func GetOptionValue(key string) string {
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	return common.OptionMap[key]
+}
+
+// ValidateOption 校验配置项的值，设置页面和配置导入共用。
+// lookup 返回其他配置项的值，用于检查启用登录方式等前置条件，导入时应返回导入后的值
+func ValidateOption(key string, value string, lookup func(string) string) error {
+	switch key {
+	case "GitHubOAuthEnabled":
+		if value == "true" && lookup("GitHubClientId") == "" {
+			return errors.New("无法启用 GitHub OAuth，请先填入 GitHub Client Id 以及 GitHub Client Secret！")
+		}
+	case "oidc.enabled":
+		if value == "true" && lookup("oidc.client_id") == "" {
+			return errors.New("无法启用 OIDC 登录，请先填入 OIDC Client Id 以及 OIDC Client Secret！")
+		}
+	case "LinuxDOOAuthEnabled":
+		if value == "true" && lookup("LinuxDOClientId") == "" {
+			return errors.New("无法启用 LinuxDO OAuth，请先填入 LinuxDO Client Id 以及 LinuxDO Client Secret！")
+		}
+	case "EmailDomainRestrictionEnabled":
+		if value == "true" && strings.TrimSpace(lookup("EmailDomainWhitelist")) == "" {
+			return errors.New("无法启用邮箱域名限制，请先填入限制的邮箱域名！")
+		}
+	case "WeChatAuthEnabled":
+		if value == "true" && lookup("WeChatServerAddress") == "" {
+			return errors.New("无法启用微信登录，请先填入微信登录相关配置信息！")
+		}
+	case "TurnstileCheckEnabled":
+		if value == "true" && lookup("TurnstileSiteKey") == "" {
+			return errors.New("无法启用 Turnstile 校验，请先填入 Turnstile 校验相关配置信息！")
+		}
+	case "TelegramOAuthEnabled":
+		if value == "true" && lookup("TelegramBotToken") == "" {
+			return errors.New("无法启用 Telegram OAuth，请先填入 Telegram Bot Token！")
+		}
+	case "GroupRatio":
+		return setting.CheckGroupRatio(value)
+	case "guardrail_setting.policies":
+		return operation_setting.CheckGuardrailPolicies(value)
+	case "pii_redaction_setting.policies":
+		return operation_setting.CheckPIIRedactionPolicies(value)
+	case "hedge_setting.rules":
+		return operation_setting.CheckHedgeRules(value)
+	case "prompt_cache_setting.rules":
+		return operation_setting.CheckPromptCacheRules(value)
+	case "PricingRules":
+		return operation_setting.CheckPricingRules(value)
+	}
+	return nil
+}
+
+func IsSecretOption(key string) bool {
+	return strings.HasSuffix(key, "Token") || strings.HasSuffix(key, "Secret") || strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "_secret") || strings.HasSuffix(key, "_key")
+}
+
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
 	for _, option := range options {
+		if IsSecretOption(option.Key) {
+			value, err := common.DecryptSecret(option.Value)
+			if err != nil {
+				common.SysError("failed to decrypt option " + option.Key + ": " + err.Error())
+				continue
+			}
+			option.Value = value
+		}
 		err := updateOptionMap(option.Key, option.Value)
 		if err != nil {
 			common.SysError("failed to update option map: " + err.Error())
@@ -158,18 +235,32 @@ func SyncOptions(frequency int) {
 
 func UpdateOption(key string, value string) error {
 	// Save to database first
+	if err := saveOption(DB, key, value); err != nil {
+		return err
+	}
+	// Update OptionMap
+	return updateOptionMap(key, value)
+}
+
+// saveOption 只写入数据库，调用方在事务提交后再更新 OptionMap
+func saveOption(tx *gorm.DB, key string, value string) error {
 	option := Option{
 		Key: key,
 	}
 	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
+	tx.FirstOrCreate(&option, Option{Key: key})
 	option.Value = value
+	if IsSecretOption(key) {
+		encrypted, err := common.EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+		option.Value = encrypted
+	}
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+	return tx.Save(&option).Error
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -271,6 +362,8 @@ func updateOptionMap(key string, value string) (err error) {
 			setting.CheckSensitiveOnPromptEnabled = boolValue
 		case "ModelRequestRateLimitEnabled":
 			setting.ModelRequestRateLimitEnabled = boolValue
+		case "CheckSensitiveOnCompletionEnabled":
+			setting.CheckSensitiveOnCompletionEnabled = boolValue
 		case "StopOnSensitiveEnabled":
 			setting.StopOnSensitiveEnabled = boolValue
 		case "SMTPSSLEnabled":
@@ -309,6 +402,8 @@ func updateOptionMap(key string, value string) (err error) {
 		setting.EpayKey = value
 	case "Price":
 		setting.Price, _ = strconv.ParseFloat(value, 64)
+	case "EpayCurrency":
+		setting.EpayCurrency = value
 	case "MinTopUp":
 		setting.MinTopUp, _ = strconv.Atoi(value)
 	case "TopupGroupRatio":
@@ -375,6 +470,8 @@ func updateOptionMap(key string, value string) (err error) {
 		err = operation_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = operation_setting.UpdateCacheRatioByJSONString(value)
+	case "PricingRules":
+		err = operation_setting.UpdatePricingRulesByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	//case "ChatLink":
@@ -391,6 +488,10 @@ func updateOptionMap(key string, value string) (err error) {
 		operation_setting.AutomaticDisableKeywordsFromString(value)
 	case "StreamCacheQueueLength":
 		setting.StreamCacheQueueLength, _ = strconv.Atoi(value)
+	case "StreamFilterHoldLength":
+		setting.StreamFilterHoldLength, _ = strconv.Atoi(value)
+	case "StreamGuardrailCheckLength":
+		setting.StreamGuardrailCheckLength, _ = strconv.Atoi(value)
 	case "RebatePercentage":
 		common.RebatePercentage, _ = strconv.ParseFloat(value, 64)
 	}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"veloera/common"
+)
+
+// Passkey 用户注册的 WebAuthn 通行密钥，PublicKey 为 Base64 编码的 SPKI 公钥
+type Passkey struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"type:varchar(64)"`
+	CredentialId string `json:"credential_id" gorm:"type:varchar(255);uniqueIndex"`
+	PublicKey    string `json:"-" gorm:"type:text"`
+	SignCount    int64  `json:"sign_count" gorm:"bigint"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint"`
+}
+
+func GetPasskeysByUserId(userId int) ([]*Passkey, error) {
+	var passkeys []*Passkey
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&passkeys).Error
+	return passkeys, err
+}
+
+func GetPasskeyByCredentialId(credentialId string) (*Passkey, error) {
+	var passkey Passkey
+	err := DB.Where("credential_id = ?", credentialId).First(&passkey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// HasPasskey 用户是否注册了通行密钥
+func HasPasskey(userId int) bool {
+	var count int64
+	DB.Model(&Passkey{}).Where("user_id = ?", userId).Count(&count)
+	return count > 0
+}
+
+func (passkey *Passkey) Insert() error {
+	passkey.CreatedTime = common.GetTimestamp()
+	return DB.Create(passkey).Error
+}
+
+// UpdateUsage 记录签名计数和最后使用时间
+func (passkey *Passkey) UpdateUsage(signCount int64) error {
+	passkey.SignCount = signCount
+	passkey.LastUsedTime = common.GetTimestamp()
+	return DB.Model(passkey).Select("sign_count", "last_used_time").Updates(passkey).Error
+}
+
+func DeletePasskey(id int, userId int) error {
+	return DB.Where("id = ? AND user_id = ?", id, userId).Delete(&Passkey{}).Error
+}
@@ -15,6 +15,8 @@ type Pricing struct {
 	OwnerBy         string   `json:"owner_by"`
 	CompletionRatio float64  `json:"completion_ratio"`
 	EnableGroup     []string `json:"enable_groups,omitempty"`
+
+	PricingRule *operation_setting.PricingRule `json:"pricing_rule,omitempty"`
 }
 
 var (
@@ -74,6 +76,9 @@ func updatePricing() {
 			pricing.ModelRatio = modelRatio
 			pricing.CompletionRatio = operation_setting.GetCompletionRatio(model)
 			pricing.QuotaType = 0
+			if rule, ok := operation_setting.GetPricingRule(model); ok {
+				pricing.PricingRule = rule
+			}
 		}
 		pricingMap = append(pricingMap, pricing)
 	}
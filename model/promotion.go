@@ -0,0 +1,328 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+// ModelCredit 只能用于指定模型的额度，由模型额度券发放，调用这些模型时优先于用户额度扣除
+type ModelCredit struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	RedemptionId   int    `json:"redemption_id" gorm:"index"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index"` // 订阅套餐发放的模型额度，订阅结束时作废
+	Models         string `json:"models" gorm:"type:text"`
+	Quota          int    `json:"quota" gorm:"default:0"` // 剩余额度
+	TotalQuota     int    `json:"total_quota" gorm:"default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// matchModels 判断模型是否在逗号分隔的模型列表中，以 * 结尾的项按前缀匹配
+func (credit *ModelCredit) matchModels(model string) bool {
+	for _, m := range strings.Split(credit.Models, ",") {
+		m = strings.TrimSpace(m)
+		if m == model || (strings.HasSuffix(m, "*") && strings.HasPrefix(model, strings.TrimSuffix(m, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func GetUserModelCredits(userId int) (credits []*ModelCredit, err error) {
+	err = DB.Where("user_id = ? AND quota > 0", userId).Order("id asc").Find(&credits).Error
+	return credits, err
+}
+
+// GetModelCreditBalance 用户可用于指定模型的剩余模型额度
+func GetModelCreditBalance(userId int, model string) int {
+	credits, err := GetUserModelCredits(userId)
+	if err != nil {
+		return 0
+	}
+	balance := 0
+	for _, credit := range credits {
+		if credit.matchModels(model) {
+			balance += credit.Quota
+		}
+	}
+	return balance
+}
+
+// ConsumeModelCredit 按发放顺序扣除模型额度，返回实际扣除的额度，不足部分由调用方从用户额度扣除
+func ConsumeModelCredit(userId int, model string, quota int) (used int, err error) {
+	// 绝大多数用户没有模型额度，先不加锁确认是否有可用的模型额度
+	if quota <= 0 || GetModelCreditBalance(userId, model) <= 0 {
+		return 0, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var credits []*ModelCredit
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("user_id = ? AND quota > 0", userId).Order("id asc").Find(&credits).Error
+		if err != nil {
+			return err
+		}
+		for _, credit := range credits {
+			if used >= quota {
+				break
+			}
+			if !credit.matchModels(model) {
+				continue
+			}
+			amount := min(credit.Quota, quota-used)
+			result := tx.Model(&ModelCredit{}).Where("id = ? AND quota >= ?", credit.Id, amount).
+				Update("quota", gorm.Expr("quota - ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				used += amount
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// RefundModelCredit 退款时将消费记录中由模型额度抵扣的部分退回模型额度，从最后扣除的模型额度开始，
+// 每个模型额度最多退回到发放时的额度，返回实际退回的额度
+func RefundModelCredit(userId int, model string, quota int) (refunded int, err error) {
+	if quota <= 0 {
+		return 0, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var credits []*ModelCredit
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where("user_id = ? AND quota < total_quota", userId).Order("id desc").Find(&credits).Error
+		if err != nil {
+			return err
+		}
+		for _, credit := range credits {
+			if refunded >= quota {
+				break
+			}
+			if !credit.matchModels(model) {
+				continue
+			}
+			amount := min(credit.TotalQuota-credit.Quota, quota-refunded)
+			result := tx.Model(&ModelCredit{}).Where("id = ? AND quota + ? <= total_quota", credit.Id, amount).
+				Update("quota", gorm.Expr("quota + ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				refunded += amount
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refunded, nil
+}
+
+// applyGroupUpgrade 临时升级用户分组，重复升级到同一分组时顺延有效期，返回升级后的分组
+func applyGroupUpgrade(tx *gorm.DB, userId int, group string, days int) (string, error) {
+	if group == "" || days <= 0 {
+		return "", errors.New("分组升级券配置错误")
+	}
+	user := User{}
+	if err := tx.First(&user, "id = ?", userId).Error; err != nil {
+		return "", err
+	}
+	now := common.GetTimestamp()
+	expireTime := now
+	if user.GroupExpireTime > now && user.Group == group {
+		expireTime = user.GroupExpireTime
+	}
+	if user.BaseGroup == "" && user.Group == group {
+		return "", errors.New("您已经在该分组中")
+	}
+	expireTime += int64(days) * 86400
+	return group, setTemporaryGroup(tx, &user, group, expireTime)
+}
+
+// setTemporaryGroup 将用户切换到 group 直到 expireTime，到期后由 RevertExpiredGroupUpgrades 恢复。
+// 已有升级（包括已到期但尚未恢复的）时保留最初的分组
+func setTemporaryGroup(tx *gorm.DB, user *User, group string, expireTime int64) error {
+	baseGroup := user.BaseGroup
+	if baseGroup == "" {
+		baseGroup = user.Group
+	}
+	return tx.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"group":             group,
+		"base_group":        baseGroup,
+		"group_expire_time": expireTime,
+	}).Error
+}
+
+// RevertExpiredGroupUpgrades 将分组升级已到期的用户恢复到升级前的分组
+func RevertExpiredGroupUpgrades() {
+	var users []*User
+	err := DB.Where("group_expire_time > 0 AND group_expire_time <= ?", common.GetTimestamp()).Find(&users).Error
+	if err != nil {
+		common.SysError("failed to query expired group upgrades: " + err.Error())
+		return
+	}
+	for _, user := range users {
+		baseGroup := user.BaseGroup
+		if baseGroup == "" {
+			baseGroup = "default"
+		}
+		result := DB.Model(&User{}).Where("id = ? AND group_expire_time = ?", user.Id, user.GroupExpireTime).Updates(map[string]interface{}{
+			"group":             baseGroup,
+			"base_group":        "",
+			"group_expire_time": 0,
+		})
+		if result.Error != nil {
+			common.SysError(fmt.Sprintf("failed to revert group upgrade of user %d: %s", user.Id, result.Error.Error()))
+			continue
+		}
+		if result.RowsAffected == 0 {
+			// 期间用户又续期了升级
+			continue
+		}
+		_ = updateUserGroupCache(user.Id, baseGroup)
+		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("分组升级已到期，分组恢复为 %s", baseGroup))
+	}
+}
+
+func SyncGroupUpgrades(frequency int) {
+	for {
+		RevertExpiredGroupUpgrades()
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
+
+// CheckTopUpCoupon 下单时校验充值优惠券是否可用，优惠券在支付成功后才会被使用
+func CheckTopUpCoupon(code string, userId int) (*Redemption, error) {
+	redemption := &Redemption{}
+	if err := DB.Where(keyCol+" = ?", code).First(redemption).Error; err != nil {
+		return nil, errors.New("无效的优惠券")
+	}
+	if redemption.Type != common.RedemptionTypeTopupCoupon {
+		return nil, errors.New("该兑换码不是充值优惠券，请在兑换额度处使用")
+	}
+	if redemption.Status != common.RedemptionCodeStatusEnabled {
+		return nil, errors.New("该优惠券已失效")
+	}
+	if redemption.IsGift {
+		var usageCount int64
+		DB.Model(&RedemptionLog{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&usageCount)
+		if usageCount > 0 {
+			return nil, errors.New("您已经使用过该优惠券")
+		}
+	}
+	if err := checkRedemptionEligibility(DB, redemption, userId); err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// ApplyTopUpPromotions 在线充值成功后按充值赠送、首充赠送和优惠券发放赠送额度，返回赠送的额度。
+// 优惠券在此时才被使用，下单后优惠券失效或已被使用时只发放其余赠送
+func ApplyTopUpPromotions(topUp *TopUp, quota int) (int, error) {
+	promotion := operation_setting.GetPromotionSetting()
+	percent := promotion.TopupBonusPercent
+	if promotion.FirstTopupBonusPercent > 0 {
+		var successCount int64
+		DB.Model(&TopUp{}).Where("user_id = ? AND status = ? AND id <> ?", topUp.UserId, "success", topUp.Id).Count(&successCount)
+		if successCount == 0 {
+			percent += promotion.FirstTopupBonusPercent
+		}
+	}
+	capPercent := func(p int) int {
+		if promotion.MaxBonusPercent > 0 && p > promotion.MaxBonusPercent {
+			return promotion.MaxBonusPercent
+		}
+		return p
+	}
+	basePercent := capPercent(percent)
+	totalPercent := basePercent
+	if topUp.CouponCode != "" {
+		coupon := &Redemption{}
+		if err := DB.Where(keyCol+" = ?", topUp.CouponCode).First(coupon).Error; err == nil && coupon.Type == common.RedemptionTypeTopupCoupon {
+			couponPercent := capPercent(percent+coupon.BonusPercent) - basePercent
+			couponQuota := quota * couponPercent / 100
+			unlock, err := lockRedemption(topUp.CouponCode, topUp.UserId, coupon.Campaign)
+			if err == nil {
+				err = DB.Transaction(func(tx *gorm.DB) error {
+					if err := tx.Set("gorm:query_option", "FOR UPDATE").First(coupon, "id = ?", coupon.Id).Error; err != nil {
+						return err
+					}
+					return useRedemption(tx, coupon, topUp.UserId, couponQuota)
+				})
+				unlock()
+			}
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to use top-up coupon %d for user %d: %s", coupon.Id, topUp.UserId, err.Error()))
+			} else {
+				totalPercent += couponPercent
+			}
+		}
+	}
+	bonus := quota * totalPercent / 100
+	if bonus <= 0 {
+		return 0, nil
+	}
+	if err := IncreaseUserQuota(topUp.UserId, bonus, true); err != nil {
+		return 0, err
+	}
+	AddCreditLot(topUp.UserId, CreditSourcePromotion, topUp.TradeNo, bonus)
+	topUp.BonusQuota = bonus
+	if err := DB.Model(topUp).Update("bonus_quota", bonus).Error; err != nil {
+		common.SysError("failed to save top-up bonus: " + err.Error())
+	}
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("充值活动赠送 %s，赠送比例 %d%%", common.LogQuota(bonus), totalPercent))
+	return bonus, nil
+}
+
+// CampaignStat 按活动名称统计兑换码的发放和使用情况
+type CampaignStat struct {
+	Campaign     string `json:"campaign"`
+	Codes        int64  `json:"codes"`       // 发放的兑换码数量
+	Redemptions  int64  `json:"redemptions"` // 使用次数
+	Users        int64  `json:"users"`       // 参与用户数
+	Quota        int64  `json:"quota"`       // 发放的额度
+	LastUsedTime int64  `json:"last_used_time"`
+}
+
+func GetCampaignStats() ([]*CampaignStat, error) {
+	var stats []*CampaignStat
+	err := DB.Model(&Redemption{}).Select("campaign, count(*) as codes").
+		Where("campaign <> ''").Group("campaign").Order("campaign").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	var usages []*CampaignStat
+	err = DB.Model(&RedemptionLog{}).
+		Select("campaign, count(*) as redemptions, count(distinct user_id) as users, sum(quota) as quota, max(used_time) as last_used_time").
+		Where("campaign <> ''").Group("campaign").Scan(&usages).Error
+	if err != nil {
+		return nil, err
+	}
+	byCampaign := make(map[string]*CampaignStat)
+	for _, stat := range stats {
+		byCampaign[stat.Campaign] = stat
+	}
+	for _, usage := range usages {
+		stat, ok := byCampaign[usage.Campaign]
+		if !ok {
+			// 兑换码已被删除的活动仍然保留使用记录
+			stats = append(stats, usage)
+			continue
+		}
+		stat.Redemptions = usage.Redemptions
+		stat.Users = usage.Users
+		stat.Quota = usage.Quota
+		stat.LastUsedTime = usage.LastUsedTime
+	}
+	return stats, nil
+}
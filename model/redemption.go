@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 	"veloera/common"
 
@@ -27,15 +28,26 @@ type Redemption struct {
 	IsGift       bool           `json:"is_gift" gorm:"default:false"`
 	MaxUses      int            `json:"max_uses" gorm:"default:-1"` // -1 means unlimited
 	UsedCount    int            `json:"used_count" gorm:"default:0"`
+	Type         int            `json:"type" gorm:"default:0"`                             // 兑换码类型，见 common.RedemptionType*
+	Campaign     string         `json:"campaign" gorm:"type:varchar(64);index;default:''"` // 活动名称，同一活动每个用户只能参与一次
+	UserGroups   string         `json:"user_groups" gorm:"type:varchar(255);default:''"`   // 限制可使用的用户分组，逗号分隔，为空不限制
+	NewUserDays  int            `json:"new_user_days" gorm:"default:0"`                    // 仅限注册 N 天内的用户使用，0 不限制
+	BonusPercent int            `json:"bonus_percent" gorm:"default:0"`                    // 充值优惠券的赠送比例
+	UpgradeGroup string         `json:"upgrade_group" gorm:"type:varchar(64);default:''"`  // 分组升级券升级到的分组
+	UpgradeDays  int            `json:"upgrade_days" gorm:"default:0"`                     // 分组升级的天数
+	Models       string         `json:"models" gorm:"type:text"`                           // 模型额度券可用的模型，逗号分隔
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 }
 
-// RedemptionLog 记录礼品码的使用记录
+// RedemptionLog 记录兑换码和优惠券的使用记录，同时用于按活动统计
 type RedemptionLog struct {
-	Id           int   `json:"id"`
-	RedemptionId int   `json:"redemption_id" gorm:"index"`
-	UserId       int   `json:"user_id" gorm:"index"`
-	UsedTime     int64 `json:"used_time" gorm:"bigint"`
+	Id           int    `json:"id"`
+	RedemptionId int    `json:"redemption_id" gorm:"index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	UsedTime     int64  `json:"used_time" gorm:"bigint"`
+	Campaign     string `json:"campaign" gorm:"type:varchar(64);index;default:''"`
+	Type         int    `json:"type" gorm:"default:0"`
+	Quota        int    `json:"quota" gorm:"default:0"` // 发放的额度，充值优惠券为赠送的额度
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -135,113 +147,210 @@ func GetRedemptionByKey(key string) (*Redemption, error) {
 	return &redemption, err
 }
 
-func Redeem(key string, userId int) (quota int, isGift bool, err error) {
+// checkRedemptionEligibility 校验兑换码的有效期、用户分组、新用户时间窗口，以及同一活动只能参与一次
+func checkRedemptionEligibility(tx *gorm.DB, redemption *Redemption, userId int) error {
+	currentTime := common.GetTimestamp()
+	if redemption.ValidFrom > 0 && currentTime < redemption.ValidFrom {
+		return errors.New("兑换码尚未生效")
+	}
+	if redemption.ValidUntil > 0 && currentTime > redemption.ValidUntil {
+		return errors.New("兑换码已过期")
+	}
+	if redemption.UserGroups != "" || redemption.NewUserDays > 0 {
+		user := User{}
+		if err := tx.First(&user, "id = ?", userId).Error; err != nil {
+			return err
+		}
+		if redemption.UserGroups != "" {
+			allowed := false
+			for _, group := range strings.Split(redemption.UserGroups, ",") {
+				if strings.TrimSpace(group) == user.Group {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return errors.New("当前用户分组不能使用该兑换码")
+			}
+		}
+		if redemption.NewUserDays > 0 && (user.CreatedTime == 0 || currentTime-user.CreatedTime > int64(redemption.NewUserDays)*86400) {
+			return fmt.Errorf("该兑换码仅限注册 %d 天内的新用户使用", redemption.NewUserDays)
+		}
+	}
+	if redemption.Campaign != "" {
+		var campaignCount int64
+		err := tx.Model(&RedemptionLog{}).Where("campaign = ? AND user_id = ?", redemption.Campaign, userId).Count(&campaignCount).Error
+		if err != nil {
+			return err
+		}
+		if campaignCount > 0 {
+			return errors.New("您已经参与过该活动")
+		}
+	}
+	return nil
+}
+
+// useRedemption 在事务中校验并记录一次使用，普通兑换码只能使用一次，礼品码每个用户使用一次且受最大次数限制
+func useRedemption(tx *gorm.DB, redemption *Redemption, userId int, quota int) error {
+	if err := checkRedemptionEligibility(tx, redemption, userId); err != nil {
+		return err
+	}
+	if !redemption.IsGift {
+		if redemption.Status != common.RedemptionCodeStatusEnabled {
+			return errors.New("该兑换码已被使用")
+		}
+		redemption.RedeemedTime = common.GetTimestamp()
+		redemption.Status = common.RedemptionCodeStatusUsed
+		redemption.UsedUserId = userId
+	} else {
+		if redemption.Status == common.RedemptionCodeStatusDisabled {
+			return errors.New("该礼品码已被禁用")
+		}
+		if redemption.MaxUses != -1 && redemption.UsedCount >= redemption.MaxUses {
+			return errors.New("该礼品码已达到最大使用次数")
+		}
+		// 检查用户是否已经使用过这个礼品码
+		var usageCount int64
+		err := tx.Model(&RedemptionLog{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&usageCount).Error
+		if err != nil {
+			return err
+		}
+		if usageCount > 0 {
+			return errors.New("您已经使用过这个礼品码")
+		}
+		redemption.UsedCount++
+		if redemption.MaxUses != -1 && redemption.UsedCount >= redemption.MaxUses {
+			redemption.Status = common.RedemptionCodeStatusUsed
+		}
+	}
+	// 记录使用日志
+	log := RedemptionLog{
+		RedemptionId: redemption.Id,
+		UserId:       userId,
+		UsedTime:     common.GetTimestamp(),
+		Campaign:     redemption.Campaign,
+		Type:         redemption.Type,
+		Quota:        quota,
+	}
+	if err := tx.Create(&log).Error; err != nil {
+		return err
+	}
+	return tx.Save(redemption).Error
+}
+
+// lockRedemption 使用 Redis 锁避免同一兑换码并发兑换，返回解锁函数
+func lockRedemption(key string, userId int, campaign string) (func(), error) {
+	if !common.RedisEnabled {
+		return func() {}, nil
+	}
+	lockKeys := []string{"rloc:" + key} // Using a shorter prefix "rloc:" for brevity
+	if campaign != "" {
+		// 同一活动的不同兑换码也需要互斥，否则并发时可能重复参与
+		lockKeys = append(lockKeys, fmt.Sprintf("rcamp:%s:%d", campaign, userId))
+	}
+	var acquired []string
+	unlock := func() {
+		for _, lockKey := range acquired {
+			common.RDB.Del(context.Background(), lockKey)
+		}
+	}
+	for _, lockKey := range lockKeys {
+		locked, redisErr := common.RDB.SetNX(context.Background(), lockKey, "1", 10*time.Second).Result()
+		if redisErr != nil {
+			unlock()
+			common.SysError("Redis lock acquisition error: " + redisErr.Error())
+			return nil, errors.New("系统暂时繁忙，请稍后再试") // System temporarily busy, please try again later
+		}
+		if !locked {
+			unlock()
+			return nil, errors.New("操作过于频繁，请稍后再试") // Operation too frequent, please try again later
+		}
+		acquired = append(acquired, lockKey)
+	}
+	return unlock, nil
+}
+
+// Redeem 兑换码兑换，按类型发放额度、升级分组或发放模型额度，充值优惠券只能在充值时使用
+func Redeem(key string, userId int) (*Redemption, error) {
 	if key == "" {
-		return 0, false, errors.New("未提供兑换码")
+		return nil, errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, false, errors.New("无效的 user id")
+		return nil, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
-
-	keyCol := "`key`"
-	if common.UsingPostgreSQL {
-		keyCol = `"key"`
+	if err := DB.Where(keyCol+" = ?", key).First(redemption).Error; err != nil {
+		return nil, errors.New("兑换失败，无效的兑换码")
 	}
-
-	lockKey := "rloc:" + key // Using a shorter prefix "rloc:" for brevity
-	locked, redisErr := common.RDB.SetNX(context.Background(), lockKey, "1", 10*time.Second).Result()
-	if redisErr != nil {
-		common.SysError("Redis lock acquisition error: " + redisErr.Error())
-		return 0, false, errors.New("系统暂时繁忙，请稍后再试") // System temporarily busy, please try again later
+	if redemption.Type == common.RedemptionTypeTopupCoupon {
+		return nil, errors.New("该兑换码是充值优惠券，请在充值时使用")
 	}
-	if !locked {
-		return 0, false, errors.New("操作过于频繁，请稍后再试") // Operation too frequent, please try again later
+	unlock, err := lockRedemption(key, userId, redemption.Campaign)
+	if err != nil {
+		return nil, err
 	}
-	defer common.RDB.Del(context.Background(), lockKey)
+	defer unlock()
 
+	upgradedGroup := ""
 	err = DB.Transaction(func(tx *gorm.DB) error {
 		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
-
-		// 检查兑换码时间范围
-		currentTime := common.GetTimestamp()
-		if redemption.ValidFrom > 0 && currentTime < redemption.ValidFrom {
-			return errors.New("兑换码尚未生效")
+		quota := 0
+		if redemption.Type == common.RedemptionTypeQuota || redemption.Type == common.RedemptionTypeModelCredit {
+			quota = redemption.Quota
 		}
-		if redemption.ValidUntil > 0 && currentTime > redemption.ValidUntil {
-			return errors.New("兑换码已过期")
+		if err = useRedemption(tx, redemption, userId, quota); err != nil {
+			return err
 		}
-
-		if !redemption.IsGift {
-			// 普通兑换码逻辑
-			if redemption.Status != common.RedemptionCodeStatusEnabled {
-				return errors.New("该兑换码已被使用")
-			}
-			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-			if err != nil {
-				return err
-			}
-			redemption.RedeemedTime = common.GetTimestamp()
-			redemption.Status = common.RedemptionCodeStatusUsed
-			redemption.UsedUserId = userId
-		} else {
-			// 礼品码逻辑
-			if redemption.MaxUses != -1 && redemption.UsedCount >= redemption.MaxUses {
-				return errors.New("该礼品码已达到最大使用次数")
-			}
-			// 检查用户是否已经使用过这个礼品码
-			var usageCount int64
-			err = tx.Model(&RedemptionLog{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&usageCount).Error
-			if err != nil {
-				return err
-			}
-			if usageCount > 0 {
-				return errors.New("您已经使用过这个礼品码")
-			}
-
-			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-			if err != nil {
-				return err
-			}
-
-			// 记录使用日志
-			log := RedemptionLog{
-				RedemptionId: redemption.Id,
+		switch redemption.Type {
+		case common.RedemptionTypeGroupUpgrade:
+			upgradedGroup, err = applyGroupUpgrade(tx, userId, redemption.UpgradeGroup, redemption.UpgradeDays)
+			return err
+		case common.RedemptionTypeModelCredit:
+			return tx.Create(&ModelCredit{
 				UserId:       userId,
-				UsedTime:     common.GetTimestamp(),
-			}
-			if err = tx.Create(&log).Error; err != nil {
+				RedemptionId: redemption.Id,
+				Models:       redemption.Models,
+				Quota:        redemption.Quota,
+				TotalQuota:   redemption.Quota,
+				CreatedTime:  common.GetTimestamp(),
+			}).Error
+		default:
+			if err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error; err != nil {
 				return err
 			}
-
-			redemption.UsedCount++
-			if redemption.MaxUses != -1 && redemption.UsedCount >= redemption.MaxUses {
-				redemption.Status = common.RedemptionCodeStatusUsed
+			source := CreditSourceRedemption
+			if redemption.IsGift {
+				source = CreditSourceGift
 			}
+			return createCreditLot(tx, newCreditLot(userId, source, strconv.Itoa(redemption.Id), redemption.Quota))
 		}
-
-		err = tx.Save(redemption).Error
-		return err
 	})
 	if err != nil {
-		return 0, false, errors.New("兑换失败，" + err.Error())
+		return nil, errors.New("兑换失败，" + err.Error())
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过%s充值 %s，兑换码ID %d",
-		map[bool]string{true: "礼品码", false: "兑换码"}[redemption.IsGift],
-		common.LogQuota(redemption.Quota),
-		redemption.Id))
-
-	// 处理返佣逻辑
-	rebateType := map[bool]string{true: "礼品码", false: "兑换码"}[redemption.IsGift]
-	err = ProcessRebate(userId, redemption.Quota, rebateType)
-	if err != nil {
-		common.SysError("处理兑换码返佣失败: " + err.Error())
+	codeType := map[bool]string{true: "礼品码", false: "兑换码"}[redemption.IsGift]
+	switch redemption.Type {
+	case common.RedemptionTypeGroupUpgrade:
+		_ = updateUserGroupCache(userId, upgradedGroup)
+		RecordLog(userId, LogTypeSystem, fmt.Sprintf("通过%s将分组升级为 %s，有效期 %d 天，兑换码ID %d",
+			codeType, redemption.UpgradeGroup, redemption.UpgradeDays, redemption.Id))
+	case common.RedemptionTypeModelCredit:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过%s获得模型额度 %s，可用模型 %s，兑换码ID %d",
+			codeType, common.LogQuota(redemption.Quota), redemption.Models, redemption.Id))
+	default:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过%s充值 %s，兑换码ID %d",
+			codeType, common.LogQuota(redemption.Quota), redemption.Id))
+
+		// 处理返佣逻辑
+		err = ProcessRebate(userId, redemption.Quota, codeType, strconv.Itoa(userId))
+		if err != nil {
+			common.SysError("处理兑换码返佣失败: " + err.Error())
+		}
 	}
-
-	return redemption.Quota, redemption.IsGift, nil
+	return redemption, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -258,7 +367,8 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "valid_from", "valid_until").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "valid_from", "valid_until",
+		"campaign", "user_groups", "new_user_days", "bonus_percent", "upgrade_group", "upgrade_days", "models").Updates(redemption).Error
 	return err
 }
 
@@ -0,0 +1,350 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"veloera/common"
+	"veloera/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RefundStatusPending  = 1
+	RefundStatusApproved = 2
+	RefundStatusRejected = 3
+)
+
+// RefundRequest 针对单条消费记录的退款申请，命中自动退款规则时直接以已通过的状态创建
+type RefundRequest struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Username      string `json:"username" gorm:"index;default:''"`
+	LogId         int    `json:"log_id" gorm:"uniqueIndex"` // 每条消费记录只能申请一次退款
+	ChannelId     int    `json:"channel_id" gorm:"index"`
+	ModelName     string `json:"model_name" gorm:"default:''"`
+	TokenId       int    `json:"token_id" gorm:"default:0"`
+	TokenName     string `json:"token_name" gorm:"default:''"`
+	Quota         int    `json:"quota" gorm:"default:0"`
+	LogTime       int64  `json:"log_time" gorm:"bigint"` // 消费记录的时间
+	Reason        string `json:"reason" gorm:"type:text"`
+	Auto          bool   `json:"auto" gorm:"default:false"`
+	Status        int    `json:"status" gorm:"default:1;index"`
+	AdminId       int    `json:"admin_id" gorm:"default:0"`
+	Remark        string `json:"remark" gorm:"type:text"` // 审核备注，会展示给用户
+	CreatedTime   int64  `json:"created_time" gorm:"bigint;index"`
+	ProcessedTime int64  `json:"processed_time" gorm:"bigint"`
+}
+
+// findUserConsumeLog 按用户看到的日志 ID 和时间查找消费记录，普通用户看到的日志 ID 经过取模处理
+func findUserConsumeLog(userId int, logId int, createdAt int64) (*Log, error) {
+	var logs []*Log
+	err := LOG_DB.Where("user_id = ? AND type = ? AND created_at = ?", userId, LogTypeConsume, createdAt).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, log := range logs {
+		if log.Id == logId || log.Id%1024 == logId {
+			return log, nil
+		}
+	}
+	return nil, errors.New("消费记录不存在")
+}
+
+func newRefundRequest(log *Log, reason string) *RefundRequest {
+	return &RefundRequest{
+		UserId:      log.UserId,
+		Username:    log.Username,
+		LogId:       log.Id,
+		ChannelId:   log.ChannelId,
+		ModelName:   log.ModelName,
+		TokenId:     log.TokenId,
+		TokenName:   log.TokenName,
+		Quota:       log.Quota,
+		LogTime:     log.CreatedAt,
+		Reason:      reason,
+		Status:      RefundStatusPending,
+		CreatedTime: common.GetTimestamp(),
+	}
+}
+
+// CreateRefundRequest 用户针对自己的消费记录提交退款申请
+func CreateRefundRequest(userId int, logId int, createdAt int64, reason string) (*RefundRequest, error) {
+	setting := operation_setting.GetRefundSetting()
+	if !setting.Enabled {
+		return nil, errors.New("管理员未开启退款申请")
+	}
+	log, err := findUserConsumeLog(userId, logId, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if log.Quota <= 0 {
+		return nil, errors.New("该记录没有产生费用")
+	}
+	if setting.WindowDays > 0 && common.GetTimestamp()-log.CreatedAt > int64(setting.WindowDays)*86400 {
+		return nil, fmt.Errorf("只能对 %d 天内的消费记录申请退款", setting.WindowDays)
+	}
+	var count int64
+	if err := DB.Model(&RefundRequest{}).Where("log_id = ?", log.Id).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("该记录已经申请过退款")
+	}
+	request := newRefundRequest(log, reason)
+	if err := DB.Create(request).Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// AutoRefundConsumeLog 消费记录命中自动退款规则时直接退款
+func AutoRefundConsumeLog(log *Log, reason string) {
+	if log == nil || log.Id == 0 || log.Quota <= 0 {
+		return
+	}
+	request := newRefundRequest(log, reason)
+	request.Auto = true
+	request.Status = RefundStatusApproved
+	request.ProcessedTime = request.CreatedTime
+	if err := DB.Create(request).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to create auto refund for log %d: %s", log.Id, err.Error()))
+		return
+	}
+	if err := refundConsume(request); err != nil {
+		common.SysError(fmt.Sprintf("failed to auto refund log %d: %s", log.Id, err.Error()))
+	}
+}
+
+func GetRefundRequestById(id int) (*RefundRequest, error) {
+	request := RefundRequest{}
+	err := DB.First(&request, "id = ?", id).Error
+	return &request, err
+}
+
+// ProcessRefundRequest 审核退款申请，以状态作为乐观锁，同一申请只会处理一次
+func ProcessRefundRequest(id int, approve bool, adminId int, remark string) (*RefundRequest, error) {
+	request, err := GetRefundRequestById(id)
+	if err != nil {
+		return nil, err
+	}
+	status := RefundStatusRejected
+	if approve {
+		status = RefundStatusApproved
+	}
+	now := common.GetTimestamp()
+	result := DB.Model(&RefundRequest{}).Where("id = ? AND status = ?", id, RefundStatusPending).Updates(map[string]interface{}{
+		"status":         status,
+		"admin_id":       adminId,
+		"remark":         remark,
+		"processed_time": now,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("该申请已经处理过了")
+	}
+	request.Status = status
+	request.AdminId = adminId
+	request.Remark = remark
+	request.ProcessedTime = now
+	if !approve {
+		RecordLog(request.UserId, LogTypeRefund, fmt.Sprintf("消费记录退款申请被拒绝，模型 %s，额度 %s，备注：%s",
+			request.ModelName, common.LogQuota(request.Quota), remark))
+		return request, nil
+	}
+	return request, refundConsume(request)
+}
+
+// refundConsume 将消费记录的额度退还给用户和令牌，由模型额度抵扣的部分退回模型额度，
+// 同时扣回用户和渠道的已用额度，并记录关联原消费记录的退款日志
+func refundConsume(request *RefundRequest) error {
+	log := Log{}
+	logErr := LOG_DB.First(&log, "id = ?", request.LogId).Error
+	other := map[string]interface{}{}
+	if logErr == nil {
+		if m := common.StrToMap(log.Other); m != nil {
+			other = m
+		}
+	}
+	creditQuota := 0
+	if v, ok := other["model_credit_quota"].(float64); ok {
+		creditQuota = min(int(v), request.Quota)
+	}
+	// 模型额度抵扣的部分没有扣除用户和令牌额度
+	userQuota := request.Quota - creditQuota
+	if userQuota > 0 {
+		if err := IncreaseUserQuota(request.UserId, userQuota, true); err != nil {
+			return err
+		}
+		if err := SettleCreditLots(request.UserId, -userQuota); err != nil {
+			common.SysError(fmt.Sprintf("failed to settle credit lots of user %d: %s", request.UserId, err.Error()))
+		}
+		if request.TokenId != 0 {
+			token, err := GetTokenById(request.TokenId)
+			if err == nil && !token.UnlimitedQuota {
+				if err := IncreaseTokenQuota(token.Id, token.Key, userQuota); err != nil {
+					common.SysError(fmt.Sprintf("failed to refund token %d quota: %s", token.Id, err.Error()))
+				}
+			}
+		}
+	}
+	refundedCredit := 0
+	if creditQuota > 0 {
+		var err error
+		refundedCredit, err = RefundModelCredit(request.UserId, request.ModelName, creditQuota)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to refund model credit of user %d: %s", request.UserId, err.Error()))
+		}
+	}
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeUsedQuota, request.UserId, -request.Quota)
+	} else {
+		updateUserUsedQuota(request.UserId, -request.Quota)
+	}
+	UpdateChannelUsedQuota(request.ChannelId, -request.Quota)
+
+	content := fmt.Sprintf("消费记录退款 %s，模型 %s，原因：%s", common.LogQuota(request.Quota), request.ModelName, request.Reason)
+	if creditQuota > 0 {
+		content += fmt.Sprintf("，其中退回模型额度 %s", common.LogQuota(refundedCredit))
+		if refundedCredit < creditQuota {
+			content += fmt.Sprintf("（%s 对应的模型额度已失效，未退回）", common.LogQuota(creditQuota-refundedCredit))
+		}
+	}
+	if request.Remark != "" {
+		content += "，备注：" + request.Remark
+	}
+	refundOther := map[string]interface{}{
+		"refund_request_id": request.Id,
+		"log_id":            request.LogId,
+		"auto":              request.Auto,
+	}
+	if refundedCredit > 0 {
+		refundOther["model_credit_quota"] = refundedCredit
+	}
+	err := LOG_DB.Create(&Log{
+		UserId:    request.UserId,
+		Username:  request.Username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeRefund,
+		Content:   content,
+		TokenName: request.TokenName,
+		ModelName: request.ModelName,
+		Quota:     request.Quota,
+		ChannelId: request.ChannelId,
+		TokenId:   request.TokenId,
+		Other:     common.MapToJsonStr(refundOther),
+	}).Error
+	if err != nil {
+		common.SysError("failed to record refund log: " + err.Error())
+	}
+	// 在原消费记录上标记已退款，供日志页面展示
+	if logErr == nil {
+		other["refunded"] = true
+		other["refund_request_id"] = request.Id
+		LOG_DB.Model(&Log{}).Where("id = ?", log.Id).Update("other", common.MapToJsonStr(other))
+	}
+	return nil
+}
+
+// RefundRequestQuery 退款申请的查询条件，零值表示不限制
+type RefundRequestQuery struct {
+	UserId    int
+	Status    int
+	ChannelId int
+}
+
+func GetRefundRequests(query RefundRequestQuery, startIdx int, num int) (requests []*RefundRequest, total int64, err error) {
+	tx := DB.Model(&RefundRequest{})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Status != 0 {
+		tx = tx.Where("status = ?", query.Status)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&requests).Error
+	return requests, total, err
+}
+
+// RefundChannelStat 按渠道统计的退款情况，用于找出质量较差的上游
+type RefundChannelStat struct {
+	ChannelId     int     `json:"channel_id"`
+	ChannelName   string  `json:"channel_name"`
+	ConsumeCount  int64   `json:"consume_count"` // 同期的消费记录数
+	Requests      int64   `json:"requests"`
+	Approved      int64   `json:"approved"`
+	Rejected      int64   `json:"rejected"`
+	Pending       int64   `json:"pending"`
+	Auto          int64   `json:"auto"`
+	RefundedQuota int64   `json:"refunded_quota"`
+	RefundRate    float64 `json:"refund_rate"` // 退款记录数占消费记录数的比例
+}
+
+// GetRefundChannelStats 按消费记录时间统计各渠道的退款申请
+func GetRefundChannelStats(startTimestamp int64, endTimestamp int64) ([]*RefundChannelStat, error) {
+	filter := func(tx *gorm.DB, column string) *gorm.DB {
+		if startTimestamp != 0 {
+			tx = tx.Where(column+" >= ?", startTimestamp)
+		}
+		if endTimestamp != 0 {
+			tx = tx.Where(column+" <= ?", endTimestamp)
+		}
+		return tx
+	}
+	var stats []*RefundChannelStat
+	err := filter(DB.Model(&RefundRequest{}), "log_time").Select(
+		"channel_id, count(*) as requests, "+
+			"sum(case when status = ? then 1 else 0 end) as approved, "+
+			"sum(case when status = ? then 1 else 0 end) as rejected, "+
+			"sum(case when status = ? then 1 else 0 end) as pending, "+
+			"sum(case when auto = ? then 1 else 0 end) as auto, "+
+			"sum(case when status = ? then quota else 0 end) as refunded_quota",
+		RefundStatusApproved, RefundStatusRejected, RefundStatusPending, true, RefundStatusApproved,
+	).Group("channel_id").Order("approved desc").Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return stats, err
+	}
+	channelIds := make([]int, 0, len(stats))
+	for _, stat := range stats {
+		channelIds = append(channelIds, stat.ChannelId)
+	}
+	var consumeCounts []struct {
+		ChannelId int
+		Count     int64
+	}
+	err = filter(LOG_DB.Model(&Log{}), "created_at").Where("type = ? AND channel_id IN ?", LogTypeConsume, channelIds).
+		Select("channel_id, count(*) as count").Group("channel_id").Scan(&consumeCounts).Error
+	if err != nil {
+		return nil, err
+	}
+	var channels []struct {
+		Id   int
+		Name string
+	}
+	if err := DB.Table("channels").Select("id, name").Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, stat := range stats {
+		for _, c := range consumeCounts {
+			if c.ChannelId == stat.ChannelId {
+				stat.ConsumeCount = c.Count
+			}
+		}
+		for _, channel := range channels {
+			if channel.Id == stat.ChannelId {
+				stat.ChannelName = channel.Name
+			}
+		}
+		if stat.ConsumeCount > 0 {
+			stat.RefundRate = float64(stat.Approved) / float64(stat.ConsumeCount)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+
+	"gorm.io/gorm"
+)
+
+// Role 自定义角色，Permissions 为逗号分隔的权限列表，见 constant.AllPermissions
+type Role struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Permissions string `json:"permissions" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func GetAllRoles() ([]*Role, error) {
+	var roles []*Role
+	err := DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetRoleById(id int) (*Role, error) {
+	var role Role
+	err := DB.First(&role, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// PermissionList 返回去重后的有效权限
+func (role *Role) PermissionList() []string {
+	return ParsePermissions(role.Permissions)
+}
+
+func (role *Role) Insert() error {
+	role.CreatedTime = common.GetTimestamp()
+	return DB.Create(role).Error
+}
+
+func (role *Role) Update() error {
+	if err := DB.Model(role).Select("name", "description", "permissions").Updates(role).Error; err != nil {
+		return err
+	}
+	invalidateRoleUsersPermissionCache(role.Id)
+	return nil
+}
+
+// Delete 删除角色，并取消所有用户对该角色的分配
+func (role *Role) Delete() error {
+	var userIds []int
+	DB.Model(&User{}).Where("custom_role_id = ?", role.Id).Pluck("id", &userIds)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("custom_role_id = ?", role.Id).Update("custom_role_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	for _, userId := range userIds {
+		invalidateUserPermissionCache(userId)
+	}
+	return err
+}
+
+func getUserPermissionCacheKey(userId int) string {
+	return fmt.Sprintf("user_permissions:%d", userId)
+}
+
+func invalidateUserPermissionCache(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(getUserPermissionCacheKey(userId)); err != nil {
+		common.SysError(fmt.Sprintf("failed to invalidate permission cache of user %d: %s", userId, err.Error()))
+	}
+}
+
+func invalidateRoleUsersPermissionCache(roleId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	var userIds []int
+	DB.Model(&User{}).Where("custom_role_id = ?", roleId).Pluck("id", &userIds)
+	for _, userId := range userIds {
+		invalidateUserPermissionCache(userId)
+	}
+}
+
+// getCustomRolePermissions 返回用户自定义角色的权限列表，启用 Redis 时缓存
+func getCustomRolePermissions(userId int) string {
+	if common.RedisEnabled {
+		if permissions, err := common.RedisGet(getUserPermissionCacheKey(userId)); err == nil {
+			return permissions
+		}
+	}
+	var permissions []string
+	err := DB.Table("users").Joins("JOIN roles ON roles.id = users.custom_role_id").
+		Where("users.id = ?", userId).Pluck("roles.permissions", &permissions).Error
+	if err != nil {
+		return ""
+	}
+	result := strings.Join(permissions, ",")
+	if common.RedisEnabled {
+		if err := common.RedisSet(getUserPermissionCacheKey(userId), result, time.Duration(constant.UserId2QuotaCacheSeconds)*time.Second); err != nil {
+			common.SysError("failed to cache user permissions: " + err.Error())
+		}
+	}
+	return result
+}
+
+// ParsePermissions 解析逗号分隔的权限列表，忽略未知权限
+func ParsePermissions(permissions string) []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, permission := range strings.Split(permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" || seen[permission] || !constant.IsValidPermission(permission) {
+			continue
+		}
+		seen[permission] = true
+		result = append(result, permission)
+	}
+	return result
+}
+
+// GetUserPermissions 计算用户的有效权限：内置角色的权限加上自定义角色的权限，
+// scopes 不为空时（使用限定范围的 access token）再与其取交集
+func GetUserPermissions(userId int, role int, scopes string) map[string]bool {
+	permissions := make(map[string]bool)
+	switch {
+	case role >= common.RoleRootUser:
+		for _, permission := range constant.AllPermissions {
+			permissions[permission] = true
+		}
+	case role >= common.RoleAdminUser:
+		for _, permission := range constant.AdminPermissions {
+			permissions[permission] = true
+		}
+	}
+	for _, permission := range ParsePermissions(getCustomRolePermissions(userId)) {
+		// 保留给超级管理员的权限不能通过自定义角色获得
+		if !constant.IsReservedPermission(permission) {
+			permissions[permission] = true
+		}
+	}
+	if scopes != "" {
+		scoped := make(map[string]bool)
+		for _, permission := range ParsePermissions(scopes) {
+			if permissions[permission] {
+				scoped[permission] = true
+			}
+		}
+		return scoped
+	}
+	return permissions
+}
+
+// PermissionNames 将权限集合转换为按 constant.AllPermissions 排序的列表
+func PermissionNames(permissions map[string]bool) []string {
+	names := make([]string, 0, len(permissions))
+	for _, permission := range constant.AllPermissions {
+		if permissions[permission] {
+			names = append(names, permission)
+		}
+	}
+	return names
+}
+
+// AssignUserRole 为用户分配自定义角色，roleId 为 0 表示取消分配
+func AssignUserRole(userId int, roleId int) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("custom_role_id", roleId).Error; err != nil {
+		return err
+	}
+	invalidateUserPermissionCache(userId)
+	return nil
+}
+
+// UpdateUserAccessScopes 更新 access token 的授权范围，为空表示不限制
+func UpdateUserAccessScopes(userId int, scopes string) error {
+	return DB.Model(&User{}).Where("id = ?", userId).Update("access_scopes", scopes).Error
+}
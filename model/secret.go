@@ -0,0 +1,111 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"veloera/common"
+	"veloera/constant"
+)
+
+// secretNeedsRewrite 配置了主密钥时，未加密或由旧主密钥加密的值需要重写；
+// 未配置主密钥时，已加密的值会被解密为明文，用于关闭静态加密
+func secretNeedsRewrite(value string) bool {
+	if common.SecretEncryptionEnabled() {
+		return common.SecretNeedsReencrypt(value)
+	}
+	return common.IsEncryptedSecret(value)
+}
+
+// ReencryptSecrets 使用当前主密钥重新加密渠道密钥、渠道设置中的私钥、密钥类配置和用户的 webhook 密钥，返回重写的记录数
+func ReencryptSecrets() (int, error) {
+	count := 0
+
+	var channels []struct {
+		Id      int
+		Key     string
+		Setting *string
+	}
+	if err := DB.Table("channels").Select("id, " + keyCol + ", setting").Find(&channels).Error; err != nil {
+		return count, err
+	}
+	reencrypt := func(value string) (string, error) {
+		if !secretNeedsRewrite(value) {
+			return value, nil
+		}
+		return common.ReencryptSecret(value)
+	}
+	for _, channel := range channels {
+		updates := make(map[string]interface{})
+		if secretNeedsRewrite(channel.Key) {
+			key, err := common.ReencryptSecret(channel.Key)
+			if err != nil {
+				return count, fmt.Errorf("channel %d: %v", channel.Id, err)
+			}
+			updates["key"] = key
+		}
+		setting, err := convertSecretSettings(channel.Setting, reencrypt)
+		if err != nil {
+			return count, fmt.Errorf("channel %d setting: %v", channel.Id, err)
+		}
+		if setting != channel.Setting {
+			updates["setting"] = *setting
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := DB.Table("channels").Where("id = ?", channel.Id).Updates(updates).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var options []Option
+	if err := DB.Find(&options).Error; err != nil {
+		return count, err
+	}
+	for _, option := range options {
+		if !IsSecretOption(option.Key) || !secretNeedsRewrite(option.Value) {
+			continue
+		}
+		value, err := common.ReencryptSecret(option.Value)
+		if err != nil {
+			return count, fmt.Errorf("option %s: %v", option.Key, err)
+		}
+		if err := DB.Model(&Option{}).Where(keyCol+" = ?", option.Key).Update("value", value).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var users []struct {
+		Id      int
+		Setting string
+	}
+	if err := DB.Table("users").Select("id, setting").Where("setting LIKE ?", "%"+constant.UserSettingWebhookSecret+"%").Find(&users).Error; err != nil {
+		return count, err
+	}
+	for _, user := range users {
+		setting := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(user.Setting), &setting); err != nil {
+			continue
+		}
+		secret, ok := setting[constant.UserSettingWebhookSecret].(string)
+		if !ok || !secretNeedsRewrite(secret) {
+			continue
+		}
+		secret, err := common.ReencryptSecret(secret)
+		if err != nil {
+			return count, fmt.Errorf("user %d: %v", user.Id, err)
+		}
+		setting[constant.UserSettingWebhookSecret] = secret
+		data, err := json.Marshal(setting)
+		if err != nil {
+			return count, err
+		}
+		if err := DB.Table("users").Where("id = ?", user.Id).Update("setting", string(data)).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,393 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"veloera/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusExpired   = "expired"
+	SubscriptionStatusCancelled = "cancelled"
+)
+
+const (
+	SubscriptionPlanStatusEnabled  = 1
+	SubscriptionPlanStatusDisabled = 2
+)
+
+// SubscriptionPlan 订阅套餐，用户通过在线支付按月订阅，每个周期开始时发放额度
+type SubscriptionPlan struct {
+	Id              int     `json:"id"`
+	Name            string  `json:"name" gorm:"type:varchar(64)"`
+	Description     string  `json:"description" gorm:"type:text"`
+	Price           float64 `json:"price" gorm:"default:0"`                   // 每月价格（美元），按支付渠道的单价换算为实付金额
+	Quota           int     `json:"quota" gorm:"default:0"`                   // 每月发放的额度
+	Group           string  `json:"group" gorm:"type:varchar(64);default:''"` // 订阅期间用户所在的分组，留空不修改
+	Models          string  `json:"models" gorm:"type:text"`                  // 限定额度可用的模型，留空表示不限制
+	RolloverPercent int     `json:"rollover_percent" gorm:"default:0"`        // 周期结束时未使用的额度结转到下个周期的比例
+	Status          int     `json:"status" gorm:"default:1"`                  // 1 可订阅，2 停售
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+}
+
+// UserSubscription 用户的订阅，NextGrantTime 为下一个周期的开始时间
+type UserSubscription struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	PlanId         int    `json:"plan_id" gorm:"index"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	StartTime      int64  `json:"start_time" gorm:"bigint"`
+	EndTime        int64  `json:"end_time" gorm:"bigint"`
+	NextGrantTime  int64  `json:"next_grant_time" gorm:"bigint;index"`
+	LastGrantQuota int    `json:"last_grant_quota" gorm:"default:0"` // 本周期发放的额度
+	ModelCreditId  int    `json:"model_credit_id" gorm:"default:0"`  // 限定模型时本周期发放的模型额度
+	CreditLotId    int    `json:"credit_lot_id" gorm:"default:0"`    // 不限定模型时本周期发放的额度批次
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+func GetAllSubscriptionPlans(enabledOnly bool) (plans []*SubscriptionPlan, err error) {
+	tx := DB.Order("id asc")
+	if enabledOnly {
+		tx = tx.Where("status = ?", SubscriptionPlanStatusEnabled)
+	}
+	err = tx.Find(&plans).Error
+	return plans, err
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := SubscriptionPlan{Id: id}
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *SubscriptionPlan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *SubscriptionPlan) Update() error {
+	return DB.Model(plan).Select("name", "description", "price", "quota", "group", "models", "rollover_percent", "status").Updates(plan).Error
+}
+
+func (plan *SubscriptionPlan) Delete() error {
+	var count int64
+	DB.Model(&UserSubscription{}).Where("plan_id = ? AND status = ?", plan.Id, SubscriptionStatusActive).Count(&count)
+	if count > 0 {
+		return errors.New("仍有用户订阅该套餐，请先停售")
+	}
+	return DB.Delete(plan).Error
+}
+
+func GetUserActiveSubscription(userId int) (*UserSubscription, error) {
+	sub := &UserSubscription{}
+	err := DB.Where("user_id = ? AND status = ?", userId, SubscriptionStatusActive).First(sub).Error
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func GetUserSubscriptions(userId int) (subs []*UserSubscription, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&subs).Error
+	return subs, err
+}
+
+// CheckSubscriptionOrder 下单时校验套餐是否可以订阅，订阅期间只能续订同一套餐
+func CheckSubscriptionOrder(userId int, planId int) (*SubscriptionPlan, error) {
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return nil, errors.New("套餐不存在")
+	}
+	if plan.Status != SubscriptionPlanStatusEnabled {
+		return nil, errors.New("该套餐已停售")
+	}
+	if sub, err := GetUserActiveSubscription(userId); err == nil && sub.PlanId != planId {
+		return nil, errors.New("您已订阅其他套餐，请在当前订阅到期后再订阅")
+	}
+	return plan, nil
+}
+
+func addMonths(timestamp int64, months int) int64 {
+	return time.Unix(timestamp, 0).AddDate(0, months, 0).Unix()
+}
+
+// ActivateSubscription 支付成功后开通或续订套餐，新订阅立即发放第一个周期的额度，返回开通或续订的订阅
+func ActivateSubscription(userId int, planId int, months int) (*UserSubscription, error) {
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return nil, err
+	}
+	if months <= 0 {
+		months = 1
+	}
+	now := common.GetTimestamp()
+	sub, err := GetUserActiveSubscription(userId)
+	renew := err == nil && sub.PlanId == planId
+	if !renew {
+		sub = &UserSubscription{
+			UserId:        userId,
+			PlanId:        planId,
+			Status:        SubscriptionStatusActive,
+			StartTime:     now,
+			EndTime:       now,
+			NextGrantTime: now,
+			CreatedTime:   now,
+		}
+	}
+	sub.EndTime = addMonths(sub.EndTime, months)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(sub).Error; err != nil {
+			return err
+		}
+		if plan.Group == "" {
+			return nil
+		}
+		user := User{}
+		if err := tx.First(&user, "id = ?", userId).Error; err != nil {
+			return err
+		}
+		if user.BaseGroup == "" && user.Group == plan.Group {
+			return nil
+		}
+		return setTemporaryGroup(tx, &user, plan.Group, sub.EndTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if plan.Group != "" {
+		_ = updateUserGroupCache(userId, plan.Group)
+	}
+	if renew {
+		RecordLog(userId, LogTypeSubscription, fmt.Sprintf("续订套餐 %s %d 个月，到期时间 %s", plan.Name, months, time.Unix(sub.EndTime, 0).Format("2006-01-02 15:04:05")))
+		return sub, nil
+	}
+	RecordLog(userId, LogTypeSubscription, fmt.Sprintf("订阅套餐 %s %d 个月，到期时间 %s", plan.Name, months, time.Unix(sub.EndTime, 0).Format("2006-01-02 15:04:05")))
+	return sub, processSubscriptionPeriod(sub, plan)
+}
+
+// expireSubscriptionQuota 周期结束时按结转比例作废上个周期未使用的额度。
+// 每个周期发放的额度都有对应的模型额度或额度批次，未使用的部分即其剩余额度；
+// 结转的部分在之后的周期中不再过期，仍属于该订阅，订阅结束时由 expireSubscriptionRemaining 作废
+func expireSubscriptionQuota(sub *UserSubscription, plan *SubscriptionPlan, rolloverPercent int) {
+	if sub.LastGrantQuota <= 0 {
+		return
+	}
+	if sub.ModelCreditId != 0 {
+		credit := ModelCredit{}
+		if err := DB.First(&credit, "id = ?", sub.ModelCreditId).Error; err != nil {
+			return
+		}
+		expired := credit.Quota - credit.Quota*rolloverPercent/100
+		if expired <= 0 {
+			return
+		}
+		result := DB.Model(&ModelCredit{}).Where("id = ? AND quota >= ?", credit.Id, expired).Update("quota", gorm.Expr("quota - ?", expired))
+		if result.Error != nil || result.RowsAffected == 0 {
+			return
+		}
+		RecordLog(sub.UserId, LogTypeSubscription, fmt.Sprintf("套餐 %s 本周期未使用的模型额度 %s 已过期", plan.Name, common.LogQuota(expired)))
+		return
+	}
+	lot := CreditLot{}
+	if sub.CreditLotId == 0 || DB.First(&lot, "id = ?", sub.CreditLotId).Error != nil {
+		return
+	}
+	expired, err := expireCreditLot(&lot, lot.Remaining-lot.Remaining*rolloverPercent/100)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to expire subscription quota of user %d: %s", sub.UserId, err.Error()))
+		return
+	}
+	// 结转的额度按订阅到期时间排序消耗，先于其他不过期的额度
+	if err := DB.Model(&CreditLot{}).Where("id = ?", lot.Id).Update("expire_time", sub.EndTime).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to roll over credit lot %d: %s", lot.Id, err.Error()))
+	}
+	if expired > 0 {
+		RecordLog(sub.UserId, LogTypeSubscription, fmt.Sprintf("套餐 %s 本周期未使用的额度 %s 已过期", plan.Name, common.LogQuota(expired)))
+	}
+}
+
+// expireSubscriptionRemaining 订阅到期或取消时作废该订阅发放的所有未使用额度，包括之前周期结转的额度
+func expireSubscriptionRemaining(sub *UserSubscription, plan *SubscriptionPlan) {
+	expired := 0
+	var credits []*ModelCredit
+	if err := DB.Where("subscription_id = ? AND quota > 0", sub.Id).Find(&credits).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to query model credits of subscription %d: %s", sub.Id, err.Error()))
+	}
+	for _, credit := range credits {
+		result := DB.Model(&ModelCredit{}).Where("id = ? AND quota >= ?", credit.Id, credit.Quota).Update("quota", gorm.Expr("quota - ?", credit.Quota))
+		if result.Error == nil && result.RowsAffected > 0 {
+			expired += credit.Quota
+		}
+	}
+	var lots []*CreditLot
+	err := DB.Where("user_id = ? AND source = ? AND source_ref = ? AND remaining > 0", sub.UserId, CreditSourceSubscription, strconv.Itoa(sub.Id)).
+		Order("id asc").Find(&lots).Error
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to query credit lots of subscription %d: %s", sub.Id, err.Error()))
+	}
+	for _, lot := range lots {
+		n, err := expireCreditLot(lot, lot.Remaining)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to expire subscription quota of user %d: %s", sub.UserId, err.Error()))
+			continue
+		}
+		expired += n
+	}
+	if expired > 0 {
+		RecordLog(sub.UserId, LogTypeSubscription, fmt.Sprintf("套餐 %s 未使用的额度 %s 已过期", plan.Name, common.LogQuota(expired)))
+	}
+}
+
+// processSubscriptionPeriod 处理到达周期边界的订阅：作废上个周期未结转的额度，订阅到期时结束订阅，否则发放新周期的额度
+func processSubscriptionPeriod(sub *UserSubscription, plan *SubscriptionPlan) error {
+	nextGrantTime := addMonths(sub.NextGrantTime, 1)
+	lapsed := sub.NextGrantTime >= sub.EndTime
+	updates := map[string]interface{}{
+		"next_grant_time":  nextGrantTime,
+		"last_grant_quota": 0,
+		"model_credit_id":  0,
+		"credit_lot_id":    0,
+	}
+	if lapsed {
+		updates["status"] = SubscriptionStatusExpired
+	}
+	// 以 next_grant_time 作为乐观锁，同一周期只会处理一次
+	result := DB.Model(&UserSubscription{}).Where("id = ? AND status = ? AND next_grant_time = ?", sub.Id, SubscriptionStatusActive, sub.NextGrantTime).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	if lapsed {
+		expireSubscriptionRemaining(sub, plan)
+		RecordLog(sub.UserId, LogTypeSubscription, fmt.Sprintf("套餐 %s 已到期", plan.Name))
+		return nil
+	}
+	expireSubscriptionQuota(sub, plan, plan.RolloverPercent)
+	if plan.Quota <= 0 {
+		return nil
+	}
+	grant := map[string]interface{}{"last_grant_quota": plan.Quota}
+	if plan.Models != "" {
+		credit := &ModelCredit{
+			UserId:         sub.UserId,
+			SubscriptionId: sub.Id,
+			Models:         plan.Models,
+			Quota:          plan.Quota,
+			TotalQuota:     plan.Quota,
+			CreatedTime:    common.GetTimestamp(),
+		}
+		if err := DB.Create(credit).Error; err != nil {
+			return err
+		}
+		grant["model_credit_id"] = credit.Id
+		if err := DB.Model(&UserSubscription{}).Where("id = ?", sub.Id).Updates(grant).Error; err != nil {
+			return err
+		}
+	} else {
+		// 本周期的额度在周期结束时过期，先于其他不过期的额度消耗。
+		// 额度和批次在同一事务中发放，周期结束时按批次剩余额度计算未使用的部分
+		lot := newCreditLot(sub.UserId, CreditSourceSubscription, strconv.Itoa(sub.Id), plan.Quota)
+		lot.Paid = true
+		lot.ExpireTime = nextGrantTime
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := createCreditLot(tx, lot); err != nil {
+				return err
+			}
+			if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("quota", gorm.Expr("quota + ?", plan.Quota)).Error; err != nil {
+				return err
+			}
+			grant["credit_lot_id"] = lot.Id
+			return tx.Model(&UserSubscription{}).Where("id = ?", sub.Id).Updates(grant).Error
+		})
+		if err != nil {
+			return err
+		}
+		gopool.Go(func() {
+			if err := cacheIncrUserQuota(sub.UserId, int64(plan.Quota)); err != nil {
+				common.SysError("failed to increase user quota: " + err.Error())
+			}
+		})
+	}
+	RecordLog(sub.UserId, LogTypeSubscription, fmt.Sprintf("套餐 %s 发放本周期额度 %s，下次发放时间 %s", plan.Name, common.LogQuota(plan.Quota), time.Unix(nextGrantTime, 0).Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+// CancelSubscription 退款等情况下立即结束订阅，未使用的额度（包括结转的额度）作废，分组随后恢复
+func CancelSubscription(subscriptionId int, reason string) error {
+	sub := &UserSubscription{}
+	if err := DB.First(sub, "id = ? AND status = ?", subscriptionId, SubscriptionStatusActive).Error; err != nil {
+		return nil
+	}
+	userId := sub.UserId
+	plan, err := GetSubscriptionPlanById(sub.PlanId)
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	result := DB.Model(&UserSubscription{}).Where("id = ? AND status = ?", sub.Id, SubscriptionStatusActive).Updates(map[string]interface{}{
+		"status":   SubscriptionStatusCancelled,
+		"end_time": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	expireSubscriptionRemaining(sub, plan)
+	if plan.Group != "" {
+		err = DB.Model(&User{}).Where("id = ? AND group_expire_time = ?", userId, sub.EndTime).Update("group_expire_time", now).Error
+		if err != nil {
+			return err
+		}
+	}
+	RecordLog(userId, LogTypeSubscription, fmt.Sprintf("套餐 %s 已取消：%s", plan.Name, reason))
+	return nil
+}
+
+// ProcessSubscriptions 处理所有到达周期边界的订阅，调度中断后会逐个周期补发
+func ProcessSubscriptions() {
+	now := common.GetTimestamp()
+	var subs []*UserSubscription
+	err := DB.Where("status = ? AND next_grant_time <= ?", SubscriptionStatusActive, now).Find(&subs).Error
+	if err != nil {
+		common.SysError("failed to query subscriptions: " + err.Error())
+		return
+	}
+	plans := make(map[int]*SubscriptionPlan)
+	for _, sub := range subs {
+		plan, ok := plans[sub.PlanId]
+		if !ok {
+			plan, err = GetSubscriptionPlanById(sub.PlanId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to get plan %d of subscription %d: %s", sub.PlanId, sub.Id, err.Error()))
+				continue
+			}
+			plans[sub.PlanId] = plan
+		}
+		for sub.Status == SubscriptionStatusActive && sub.NextGrantTime <= now {
+			if err := processSubscriptionPeriod(sub, plan); err != nil {
+				common.SysError(fmt.Sprintf("failed to process subscription %d: %s", sub.Id, err.Error()))
+				break
+			}
+			if err := DB.First(sub, "id = ?", sub.Id).Error; err != nil {
+				break
+			}
+		}
+	}
+}
+
+func SyncSubscriptions(frequency int) {
+	for {
+		ProcessSubscriptions()
+		time.Sleep(time.Duration(frequency) * time.Second)
+	}
+}
@@ -30,6 +30,7 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	GuardrailPolicy    string         `json:"guardrail_policy" gorm:"type:varchar(64);default:''"`
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -189,7 +190,7 @@ func (token *Token) Update() (err error) {
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
 		"rate_limit_enabled", "rate_limit_period", "rate_limit_count", "rate_limit_success",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "guardrail_policy").Updates(token).Error
 	return err
 }
 
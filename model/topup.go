@@ -1,13 +1,22 @@
 package model
 
 type TopUp struct {
-	Id         int     `json:"id"`
-	UserId     int     `json:"user_id" gorm:"index"`
-	Amount     int64   `json:"amount"`
-	Money      float64 `json:"money"`
-	TradeNo    string  `json:"trade_no"`
-	CreateTime int64   `json:"create_time"`
-	Status     string  `json:"status"`
+	Id             int     `json:"id"`
+	UserId         int     `json:"user_id" gorm:"index"`
+	Amount         int64   `json:"amount"`
+	Money          float64 `json:"money"`
+	TradeNo        string  `json:"trade_no"`
+	CreateTime     int64   `json:"create_time"`
+	Status         string  `json:"status"`
+	CouponCode     string  `json:"coupon_code" gorm:"type:varchar(64);default:''"`         // 下单时使用的充值优惠券
+	BonusQuota     int     `json:"bonus_quota" gorm:"default:0"`                           // 充值活动赠送的额度
+	PaymentMethod  string  `json:"payment_method" gorm:"type:varchar(32);default:'epay'"`  // 支付渠道
+	Currency       string  `json:"currency" gorm:"type:varchar(16);default:''"`            // Money 的币种
+	ProviderRef    string  `json:"provider_ref" gorm:"type:varchar(128);index;default:''"` // 支付渠道的交易号
+	RefundedMoney  float64 `json:"refunded_money" gorm:"default:0"`                        // 累计退款的金额
+	PlanId         int     `json:"plan_id" gorm:"default:0"`                               // 订阅套餐订单的套餐，0 表示充值订单
+	Months         int     `json:"months" gorm:"default:0"`                                // 订阅的月数
+	SubscriptionId int     `json:"subscription_id" gorm:"default:0"`                       // 订阅套餐订单开通或续订的订阅
 }
 
 func (topUp *TopUp) Insert() error {
@@ -41,3 +50,12 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	}
 	return topUp
 }
+
+func GetTopUpByProviderRef(method string, ref string) *TopUp {
+	var topUp *TopUp
+	err := DB.Where("payment_method = ? AND provider_ref = ?", method, ref).First(&topUp).Error
+	if err != nil {
+		return nil
+	}
+	return topUp
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"veloera/common"
+
+	"gorm.io/gorm"
+)
+
+const twoFARecoveryCodeCount = 10
+
+// TwoFA 用户的 TOTP 两步验证配置，恢复码只保存哈希
+type TwoFA struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret        string `json:"-" gorm:"type:varchar(64)"`
+	RecoveryCodes string `json:"-" gorm:"type:text"`
+	Enabled       bool   `json:"enabled"`
+	LastUsedStep  int64  `json:"-" gorm:"bigint"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+func GetTwoFAByUserId(userId int) (*TwoFA, error) {
+	var twoFA TwoFA
+	err := DB.Where("user_id = ?", userId).First(&twoFA).Error
+	if err != nil {
+		return nil, err
+	}
+	return &twoFA, nil
+}
+
+// IsTwoFAEnabled 用户是否已启用两步验证
+func IsTwoFAEnabled(userId int) bool {
+	var count int64
+	DB.Model(&TwoFA{}).Where("user_id = ? AND enabled = ?", userId, true).Count(&count)
+	return count > 0
+}
+
+// SetupTwoFA 为用户生成新的密钥，在验证首个验证码之前保持未启用状态
+func SetupTwoFA(userId int) (*TwoFA, error) {
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	twoFA, err := GetTwoFAByUserId(userId)
+	if err != nil {
+		twoFA = &TwoFA{UserId: userId}
+	}
+	twoFA.Secret = secret
+	twoFA.RecoveryCodes = ""
+	twoFA.Enabled = false
+	twoFA.LastUsedStep = 0
+	twoFA.CreatedTime = common.GetTimestamp()
+	if err := DB.Save(twoFA).Error; err != nil {
+		return nil, err
+	}
+	return twoFA, nil
+}
+
+func DeleteTwoFAByUserId(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&TwoFA{}).Error
+}
+
+// ResetUserMFA 删除用户的两步验证配置和全部通行密钥
+func ResetUserMFA(userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&TwoFA{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&Passkey{}).Error
+	})
+}
+
+// ValidateTOTP 校验 TOTP 验证码，同一时间步的验证码只能使用一次
+func (twoFA *TwoFA) ValidateTOTP(code string) bool {
+	step, ok := common.ValidateTOTP(twoFA.Secret, code)
+	if !ok || step <= twoFA.LastUsedStep {
+		return false
+	}
+	result := DB.Model(&TwoFA{}).Where("id = ? AND last_used_step < ?", twoFA.Id, step).Update("last_used_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	twoFA.LastUsedStep = step
+	return true
+}
+
+// Verify 校验 TOTP 验证码或恢复码，恢复码使用后立即作废
+func (twoFA *TwoFA) Verify(code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return false
+	}
+	if !strings.Contains(code, "-") {
+		return twoFA.ValidateTOTP(code)
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(twoFA.RecoveryCodes), &hashes); err != nil {
+		return false
+	}
+	for i, hash := range hashes {
+		if common.ValidatePasswordAndHash(code, hash) {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			data, _ := json.Marshal(hashes)
+			result := DB.Model(&TwoFA{}).Where("id = ? AND recovery_codes = ?", twoFA.Id, twoFA.RecoveryCodes).
+				Update("recovery_codes", string(data))
+			if result.Error != nil || result.RowsAffected == 0 {
+				return false
+			}
+			twoFA.RecoveryCodes = string(data)
+			return true
+		}
+	}
+	return false
+}
+
+// ResetRecoveryCodes 生成新的恢复码并返回明文，旧的恢复码全部失效
+func (twoFA *TwoFA) ResetRecoveryCodes() ([]string, error) {
+	codes, err := common.GenerateRecoveryCodes(twoFARecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hash, err := common.Password2Hash(code)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	data, _ := json.Marshal(hashes)
+	if err := DB.Model(twoFA).Update("recovery_codes", string(data)).Error; err != nil {
+		return nil, err
+	}
+	twoFA.RecoveryCodes = string(data)
+	return codes, nil
+}
+
+// Enable 启用两步验证并生成恢复码
+func (twoFA *TwoFA) Enable() ([]string, error) {
+	if err := DB.Model(twoFA).Update("enabled", true).Error; err != nil {
+		return nil, err
+	}
+	twoFA.Enabled = true
+	return twoFA.ResetRecoveryCodes()
+}
+
+// RemainingRecoveryCodes 返回未使用的恢复码数量
+func (twoFA *TwoFA) RemainingRecoveryCodes() int {
+	var hashes []string
+	_ = json.Unmarshal([]byte(twoFA.RecoveryCodes), &hashes)
+	return len(hashes)
+}
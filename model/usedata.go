@@ -2,10 +2,12 @@ package model
 
 import (
 	"fmt"
-	"gorm.io/gorm"
+	"strings"
 	"sync"
 	"time"
 	"veloera/common"
+
+	"gorm.io/gorm"
 )
 
 // QuotaData 柱状图数据
@@ -32,6 +34,8 @@ func UpdateQuotaData() {
 			common.SysLog("正在更新数据看板数据...")
 			SaveQuotaDataCache()
 		}
+		// 渠道成本数据用于毛利报表，不受数据看板开关影响
+		SaveChannelCostDataCache()
 		time.Sleep(time.Duration(common.DataExportInterval) * time.Minute)
 	}
 }
@@ -131,3 +135,111 @@ func GetAllQuotaDates(startTime int64, endTime int64, username string) (quotaDat
 	err = DB.Table("quota_data").Select("model_name, sum(count) as count, sum(quota) as quota, sum(token_used) as token_used, created_at").Where("created_at >= ? and created_at <= ?", startTime, endTime).Group("model_name, created_at").Find(&quotaDatas).Error
 	return quotaDatas, err
 }
+
+// ChannelCostData 按渠道、模型、分组汇总的收入与上游成本，精确到小时
+type ChannelCostData struct {
+	Id        int    `json:"id"`
+	ChannelId int    `json:"channel_id" gorm:"index:idx_ccd_channel_model,priority:1"`
+	ModelName string `json:"model_name" gorm:"index:idx_ccd_channel_model,priority:2;size:64;default:''"`
+	Group     string `json:"group" gorm:"size:64;default:''"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	TokenUsed int    `json:"token_used" gorm:"default:0"`
+	Count     int    `json:"count" gorm:"default:0"`
+	Quota     int    `json:"quota" gorm:"default:0"`
+	Cost      int    `json:"cost" gorm:"default:0"`
+}
+
+var CacheChannelCostData = make(map[string]*ChannelCostData)
+var CacheChannelCostDataLock = sync.Mutex{}
+
+func LogChannelCostData(channelId int, modelName string, group string, quota int, cost int, createdAt int64, tokenUsed int) {
+	// 只精确到小时
+	createdAt = createdAt - (createdAt % 3600)
+
+	CacheChannelCostDataLock.Lock()
+	defer CacheChannelCostDataLock.Unlock()
+	key := fmt.Sprintf("%d-%s-%s-%d", channelId, modelName, group, createdAt)
+	costData, ok := CacheChannelCostData[key]
+	if ok {
+		costData.Count += 1
+		costData.Quota += quota
+		costData.Cost += cost
+		costData.TokenUsed += tokenUsed
+	} else {
+		costData = &ChannelCostData{
+			ChannelId: channelId,
+			ModelName: modelName,
+			Group:     group,
+			CreatedAt: createdAt,
+			Count:     1,
+			Quota:     quota,
+			Cost:      cost,
+			TokenUsed: tokenUsed,
+		}
+	}
+	CacheChannelCostData[key] = costData
+}
+
+func SaveChannelCostDataCache() {
+	CacheChannelCostDataLock.Lock()
+	defer CacheChannelCostDataLock.Unlock()
+	for _, costData := range CacheChannelCostData {
+		tx := DB.Model(&ChannelCostData{}).Where("channel_id = ? and model_name = ? and "+groupCol+" = ? and created_at = ?",
+			costData.ChannelId, costData.ModelName, costData.Group, costData.CreatedAt).Updates(map[string]interface{}{
+			"count":      gorm.Expr("count + ?", costData.Count),
+			"quota":      gorm.Expr("quota + ?", costData.Quota),
+			"cost":       gorm.Expr("cost + ?", costData.Cost),
+			"token_used": gorm.Expr("token_used + ?", costData.TokenUsed),
+		})
+		if tx.Error != nil {
+			common.SysLog(fmt.Sprintf("SaveChannelCostDataCache error: %s", tx.Error))
+			continue
+		}
+		if tx.RowsAffected == 0 {
+			DB.Create(costData)
+		}
+	}
+	CacheChannelCostData = make(map[string]*ChannelCostData)
+}
+
+// MarginData 收入、成本与毛利汇总
+type MarginData struct {
+	ChannelId int    `json:"channel_id,omitempty"`
+	ModelName string `json:"model_name,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Day       int64  `json:"day,omitempty"`
+	Count     int    `json:"count"`
+	TokenUsed int    `json:"token_used"`
+	Quota     int    `json:"quota"`
+	Cost      int    `json:"cost"`
+	Margin    int    `json:"margin"`
+}
+
+// GetMarginReport 按 channel、model、group 或 day 维度汇总收入与成本，day 以 UTC 零点为界
+func GetMarginReport(startTime int64, endTime int64, groupBy string) (data []*MarginData, err error) {
+	var dimension string
+	switch groupBy {
+	case "channel":
+		dimension = "channel_id"
+	case "model":
+		dimension = "model_name"
+	case "group":
+		dimension = groupCol + " as " + groupCol
+	case "day":
+		dimension = "created_at - created_at % 86400 as day"
+	default:
+		return nil, fmt.Errorf("unsupported group_by: %s", groupBy)
+	}
+	groupExpr := strings.Split(dimension, " as ")[0]
+	err = DB.Model(&ChannelCostData{}).
+		Select(dimension+", sum(count) as count, sum(token_used) as token_used, sum(quota) as quota, sum(cost) as cost").
+		Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Group(groupExpr).Order(groupExpr).Find(&data).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		d.Margin = d.Quota - d.Cost
+	}
+	return data, nil
+}
@@ -42,17 +42,25 @@ type User struct {
 	LinuxDOId        string         `json:"linux_do_id" gorm:"column:linux_do_id;index"`
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	LastCheckInTime  *time.Time     `json:"last_check_in_time" gorm:"column:last_check_in_time"` // 上次签到时间
+	CustomRoleId     int            `json:"custom_role_id" gorm:"type:int;default:0;index"`      // 自定义角色，0 表示未分配
+	AccessScopes     string         `json:"access_scopes" gorm:"type:text"`                      // access token 的授权范围，为空表示不限制
+	Permissions      []string       `json:"permissions,omitempty" gorm:"-:all"`                  // 有效权限，只用于返回给前端
+	CreatedTime      int64          `json:"created_time" gorm:"bigint;default:0"`                // 注册时间，旧用户为 0
+	BaseGroup        string         `json:"base_group" gorm:"type:varchar(64);default:''"`       // 分组升级前的分组，升级到期后恢复
+	GroupExpireTime  int64          `json:"group_expire_time" gorm:"bigint;default:0"`           // 分组升级的到期时间，0 表示没有升级
+	RoutingHints     string         `json:"routing_hints" gorm:"type:varchar(255);default:''"`   // 令牌可以使用的路由偏好，逗号分隔，只能由管理员设置
 }
 
 func (user *User) ToBaseUser() *UserBase {
 	cache := &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:           user.Id,
+		Group:        user.Group,
+		Quota:        user.Quota,
+		Status:       user.Status,
+		Username:     user.Username,
+		Setting:      user.Setting,
+		Email:        user.Email,
+		RoutingHints: user.RoutingHints,
 	}
 	return cache
 }
@@ -265,8 +273,8 @@ func inviteUser(inviterId int) (err error) {
 	return DB.Save(user).Error
 }
 
-// ProcessRebate 处理返佣逻辑
-func ProcessRebate(userId int, amount int, rebateType string) error {
+// ProcessRebate 处理返佣逻辑，返佣批次以 sourceRef 记录来源，充值订单传入订单号以便退款时扣回
+func ProcessRebate(userId int, amount int, rebateType string, sourceRef string) error {
 	// 检查返佣功能是否启用
 	if !common.RebateEnabled || common.RebatePercentage <= 0 {
 		return nil
@@ -294,6 +302,7 @@ func ProcessRebate(userId int, amount int, rebateType string) error {
 	if err != nil {
 		return err
 	}
+	AddCreditLot(user.InviterId, CreditSourceAffiliate, sourceRef, rebateAmount)
 
 	// 记录返佣日志
 	RecordLog(user.InviterId, LogTypeSystem, fmt.Sprintf("获得%s返佣 %s，返佣比例：%.1f%%",
@@ -304,6 +313,41 @@ func ProcessRebate(userId int, amount int, rebateType string) error {
 	return nil
 }
 
+// GetRebate 返回 sourceRef 给邀请者发放的返佣，没有返佣时 inviterId 为 0
+func GetRebate(sourceRef string) (inviterId int, amount int) {
+	var lots []*CreditLot
+	if err := DB.Where("source = ? AND source_ref = ?", CreditSourceAffiliate, sourceRef).Find(&lots).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to get rebate of %s: %s", sourceRef, err.Error()))
+		return 0, 0
+	}
+	for _, lot := range lots {
+		inviterId = lot.UserId
+		amount += lot.Amount
+	}
+	return inviterId, amount
+}
+
+// RevokeRebate 退款时从邀请者扣回 sourceRef 产生的返佣，优先从对应的返佣批次中扣回，
+// 已经消耗的部分从邀请者的其他额度中扣回
+func RevokeRebate(inviterId int, sourceRef string, amount int) error {
+	if inviterId == 0 || amount <= 0 {
+		return nil
+	}
+	if err := DecreaseUserQuota(inviterId, amount); err != nil {
+		return err
+	}
+	revoked, err := RevokeCreditLots(inviterId, sourceRef, amount)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to revoke rebate credit lots of %s: %s", sourceRef, err.Error()))
+	} else if revoked < amount {
+		if err := SettleCreditLots(inviterId, amount-revoked); err != nil {
+			common.SysError(fmt.Sprintf("failed to settle credit lots of user %d: %s", inviterId, err.Error()))
+		}
+	}
+	RecordLog(inviterId, LogTypeSystem, fmt.Sprintf("邀请用户的充值订单 %s 已退款，扣回返佣 %s", sourceRef, common.LogQuota(amount)))
+	return nil
+}
+
 func (user *User) TransferAffQuotaToQuota(quota int) error {
 	// 检查quota是否小于最小额度
 	if float64(quota) < common.QuotaPerUnit {
@@ -336,6 +380,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := createCreditLot(tx, newCreditLot(user.Id, CreditSourceAffiliate, "", quota)); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -352,16 +399,19 @@ func (user *User) Insert(inviterId int) error {
 	user.Quota = common.QuotaForNewUser
 	//user.SetAccessToken(common.GetUUID())
 	user.AffCode = common.GetRandomString(4)
+	user.CreatedTime = common.GetTimestamp()
 	result := DB.Create(user)
 	if result.Error != nil {
 		return result.Error
 	}
 	if common.QuotaForNewUser > 0 {
+		AddCreditLot(user.Id, CreditSourceSignup, "", common.QuotaForNewUser)
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(common.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
 			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			AddCreditLot(user.Id, CreditSourceSignup, strconv.Itoa(inviterId), common.QuotaForInvitee)
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -402,16 +452,22 @@ func (user *User) Edit(updatePassword bool) error {
 
 	newUser := *user
 	updates := map[string]interface{}{
-		"username":     newUser.Username,
-		"display_name": newUser.DisplayName,
-		"group":        newUser.Group,
-		"quota":        newUser.Quota,
+		"username":      newUser.Username,
+		"display_name":  newUser.DisplayName,
+		"group":         newUser.Group,
+		"quota":         newUser.Quota,
+		"routing_hints": newUser.RoutingHints,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
 	}
 
 	DB.First(&user, user.Id)
+	// 管理员手动修改分组时取消临时分组升级，避免到期后被恢复
+	if user.GroupExpireTime > 0 && user.Group != newUser.Group {
+		updates["base_group"] = ""
+		updates["group_expire_time"] = 0
+	}
 	if err = DB.Model(user).Updates(updates).Error; err != nil {
 		return err
 	}
@@ -944,6 +1000,9 @@ func applyAndSaveCheckIn(tx *gorm.DB, user *User, reward int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := createCreditLot(tx, newCreditLot(user.Id, CreditSourceCheckIn, "", reward)); err != nil {
+		return err
+	}
 
 	// Record this activity in log
 	logErr := tx.Create(&Log{
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"strings"
 	"time"
 	"veloera/common"
 	"veloera/constant"
@@ -13,13 +14,14 @@ import (
 
 // UserBase struct remains the same as it represents the cached data structure
 type UserBase struct {
-	Id       int    `json:"id"`
-	Group    string `json:"group"`
-	Email    string `json:"email"`
-	Quota    int    `json:"quota"`
-	Status   int    `json:"status"`
-	Username string `json:"username"`
-	Setting  string `json:"setting"`
+	Id           int    `json:"id"`
+	Group        string `json:"group"`
+	Email        string `json:"email"`
+	Quota        int    `json:"quota"`
+	Status       int    `json:"status"`
+	Username     string `json:"username"`
+	Setting      string `json:"setting"`
+	RoutingHints string `json:"routing_hints"`
 }
 
 func (user *UserBase) WriteContext(c *gin.Context) {
@@ -38,6 +40,18 @@ func (user *UserBase) GetSetting() map[string]interface{} {
 	return common.StrToMap(user.Setting)
 }
 
+// GetRoutingHintsMap 用户的令牌允许在请求头中使用的路由偏好
+func (user *UserBase) GetRoutingHintsMap() map[string]bool {
+	hints := make(map[string]bool)
+	for _, hint := range strings.Split(user.RoutingHints, ",") {
+		hint = strings.TrimSpace(hint)
+		if hint != "" {
+			hints[hint] = true
+		}
+	}
+	return hints
+}
+
 func (user *UserBase) SetSetting(setting map[string]interface{}) {
 	settingBytes, err := json.Marshal(setting)
 	if err != nil {
@@ -103,13 +117,14 @@ func GetUserCache(userId int) (userCache *UserBase, err error) {
 
 	// Create cache object from user data
 	userCache = &UserBase{
-		Id:       user.Id,
-		Group:    user.Group,
-		Quota:    user.Quota,
-		Status:   user.Status,
-		Username: user.Username,
-		Setting:  user.Setting,
-		Email:    user.Email,
+		Id:           user.Id,
+		Group:        user.Group,
+		Quota:        user.Quota,
+		Status:       user.Status,
+		Username:     user.Username,
+		Setting:      user.Setting,
+		Email:        user.Email,
+		RoutingHints: user.RoutingHints,
 	}
 
 	return userCache, nil
@@ -15,6 +15,7 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeCreditLot
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
@@ -73,6 +74,11 @@ func batchUpdate() {
 				updateUserRequestCount(key, value)
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeCreditLot:
+				err := SettleCreditLots(key, value)
+				if err != nil {
+					common.SysError("failed to batch settle credit lots: " + err.Error())
+				}
 			}
 		}
 	}
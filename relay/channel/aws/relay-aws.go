@@ -11,6 +11,7 @@ import (
 	"veloera/dto"
 	"veloera/relay/channel/claude"
 	relaycommon "veloera/relay/common"
+	"veloera/service"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -167,11 +168,13 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	defer stream.Close()
 
 	claudeInfo := &claude.ClaudeResponseInfo{
-		ResponseId:   fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
-		Created:      common.GetTimestamp(),
-		Model:        info.UpstreamModelName,
-		ResponseText: strings.Builder{},
-		Usage:        &dto.Usage{},
+		ResponseId:    fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+		Created:       common.GetTimestamp(),
+		Model:         info.UpstreamModelName,
+		ResponseText:  strings.Builder{},
+		Usage:         &dto.Usage{},
+		ContentFilter: service.NewStreamContentFilter(c),
+		PIIJoiner:     service.GetPIIVault(c).NewStreamJoiner(),
 	}
 
 	for event := range stream.Events() {
@@ -182,6 +185,10 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			if respErr != nil {
 				return respErr, nil
 			}
+			if claudeInfo.ContentFilter != nil && claudeInfo.ContentFilter.Stopped {
+				claude.HandleStreamFinalResponse(c, info, claudeInfo, RequestModeMessage)
+				return nil, claudeInfo.Usage
+			}
 		case *types.UnknownUnionMember:
 			fmt.Println("unknown tag:", v.Tag)
 			return wrapErr(errors.New("unknown response type")), nil
@@ -58,7 +58,12 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	return RequestOpenAI2ClaudeMessage(*request)
+	claudeRequest, err := RequestOpenAI2ClaudeMessage(*request)
+	if err != nil {
+		return nil, err
+	}
+	ApplyCacheBreakpoints(claudeRequest, info)
+	return claudeRequest, nil
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
@@ -0,0 +1,94 @@
+package claude
+
+import (
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/setting/operation_setting"
+)
+
+// ApplyCacheBreakpoints 按提示词缓存规则在转换后的 Claude 请求上设置 cache_control，
+// 依次为工具定义、系统提示词和最后 N 条消息，总数不超过上游允许的断点数量
+func ApplyCacheBreakpoints(claudeRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) {
+	rule, ok := operation_setting.GetPromptCacheRule(info.Group, info.OriginModelName)
+	if !ok {
+		return
+	}
+	cacheControl := &dto.ClaudeCacheControl{Type: "ephemeral", TTL: rule.TTL}
+	remaining := operation_setting.ClaudeMaxCacheBreakpoints
+
+	if rule.Tools {
+		if tools, ok := claudeRequest.Tools.([]dto.Tool); ok && len(tools) > 0 {
+			tools[len(tools)-1].CacheControl = cacheControl
+			remaining--
+		}
+	}
+	if rule.System && setSystemCacheControl(claudeRequest, cacheControl) {
+		remaining--
+	}
+
+	turns := rule.LastTurns
+	if turns > remaining {
+		turns = remaining
+	}
+	for i := len(claudeRequest.Messages) - 1; i >= 0 && turns > 0; i-- {
+		if setMessageCacheControl(&claudeRequest.Messages[i], cacheControl) {
+			turns--
+		}
+	}
+}
+
+func setSystemCacheControl(claudeRequest *dto.ClaudeRequest, cacheControl *dto.ClaudeCacheControl) bool {
+	if claudeRequest.IsStringSystem() {
+		system := claudeRequest.GetStringSystem()
+		if system == "" {
+			return false
+		}
+		claudeRequest.System = []dto.ClaudeMediaMessage{
+			{
+				Type:         "text",
+				Text:         common.GetPointer[string](system),
+				CacheControl: cacheControl,
+			},
+		}
+		return true
+	}
+	system := claudeRequest.ParseSystem()
+	if len(system) == 0 {
+		return false
+	}
+	system[len(system)-1].CacheControl = cacheControl
+	claudeRequest.System = system
+	return true
+}
+
+// setMessageCacheControl 在消息的最后一个内容块上设置断点，字符串内容先转换为文本块
+func setMessageCacheControl(message *dto.ClaudeMessage, cacheControl *dto.ClaudeCacheControl) bool {
+	if message.IsStringContent() {
+		content := message.GetStringContent()
+		if content == "" {
+			return false
+		}
+		message.Content = []dto.ClaudeMediaMessage{
+			{
+				Type:         "text",
+				Text:         common.GetPointer[string](content),
+				CacheControl: cacheControl,
+			},
+		}
+		return true
+	}
+	contents, ok := message.Content.([]dto.ClaudeMediaMessage)
+	if !ok || len(contents) == 0 {
+		return false
+	}
+	// thinking 块不能设置缓存断点，取最后一个其他类型的块
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Type == "thinking" || contents[i].Type == "redacted_thinking" {
+			continue
+		}
+		contents[i].CacheControl = cacheControl
+		return true
+	}
+	return false
+}
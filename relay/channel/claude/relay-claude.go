@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 	"veloera/common"
+	"veloera/constant"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	"veloera/relay/helper"
@@ -434,6 +435,20 @@ type ClaudeResponseInfo struct {
 	Model        string
 	ResponseText strings.Builder
 	Usage        *dto.Usage
+	// ContentFilter 非空时对流式文本增量执行输出过滤
+	ContentFilter *service.StreamContentFilter
+	// PIIJoiner 非空时等待被拆分到多个文本增量中的脱敏占位符完整后再输出
+	PIIJoiner *service.PIIStreamJoiner
+}
+
+// setOpenAIPromptUsage OpenAI 格式的 prompt_tokens 包含缓存读取和缓存写入的部分，
+// 缓存写入的数量另外记录在 CachedCreationTokens 中用于计费
+func setOpenAIPromptUsage(usage *dto.Usage, claudeUsage *dto.ClaudeUsage) {
+	if claudeUsage.CacheReadInputTokens > 0 || claudeUsage.CacheCreationInputTokens > 0 {
+		usage.PromptTokensDetails.CachedTokens = claudeUsage.CacheReadInputTokens
+		usage.PromptTokensDetails.CachedCreationTokens = claudeUsage.CacheCreationInputTokens
+	}
+	usage.PromptTokens = claudeUsage.InputTokens + usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
 }
 
 func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
@@ -441,7 +456,7 @@ func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeRespons
 		// message_start, 获取usage
 		claudeInfo.ResponseId = claudeResponse.Message.Id
 		claudeInfo.Model = claudeResponse.Message.Model
-		claudeInfo.Usage.PromptTokens = claudeResponse.Message.Usage.InputTokens
+		setOpenAIPromptUsage(claudeInfo.Usage, claudeResponse.Message.Usage)
 	} else if claudeResponse.Type == "content_block_delta" {
 		if claudeResponse.Delta.Text != nil {
 			claudeInfo.ResponseText.WriteString(*claudeResponse.Delta.Text)
@@ -449,7 +464,7 @@ func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeRespons
 	} else if claudeResponse.Type == "message_delta" {
 		claudeInfo.Usage.CompletionTokens = claudeResponse.Usage.OutputTokens
 		if claudeResponse.Usage.InputTokens > 0 {
-			claudeInfo.Usage.PromptTokens = claudeResponse.Usage.InputTokens
+			setOpenAIPromptUsage(claudeInfo.Usage, claudeResponse.Usage)
 		}
 		claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeResponse.Usage.OutputTokens
 	} else if claudeResponse.Type == "content_block_start" {
@@ -481,6 +496,16 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
+	if claudeResponse.Type == "message_delta" && claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
+		info.FinishReason = stopReasonClaude2OpenAI(*claudeResponse.Delta.StopReason)
+	}
+	if claudeInfo.ContentFilter != nil || claudeInfo.PIIJoiner != nil {
+		return filterStreamResponseData(c, info, claudeInfo, &claudeResponse, data, requestMode)
+	}
+	return handleStreamResponse(c, info, claudeInfo, &claudeResponse, data, requestMode)
+}
+
+func handleStreamResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse, data string, requestMode int) *dto.OpenAIErrorWithStatusCode {
 	if info.RelayFormat == relaycommon.RelayFormatClaude {
 		if claudeResponse.Type == "message_start" {
 			// message_start, 获取usage
@@ -499,15 +524,15 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 			claudeInfo.Usage.CompletionTokens = claudeResponse.Usage.OutputTokens
 			claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeInfo.Usage.CompletionTokens
 		}
-		helper.ClaudeChunkData(c, claudeResponse, data)
+		helper.ClaudeChunkData(c, *claudeResponse, data)
 	} else if info.RelayFormat == relaycommon.RelayFormatOpenAI {
-		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse)
+		response := StreamResponseClaude2OpenAI(requestMode, claudeResponse)
 
-		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) {
+		if !FormatClaudeResponseInfo(requestMode, claudeResponse, response, claudeInfo) {
 			return nil
 		}
 
-		err = helper.ObjectData(c, response)
+		err := helper.ObjectData(c, response)
 		if err != nil {
 			common.LogError(c, "send_stream_response_failed: "+err.Error())
 		}
@@ -515,6 +540,90 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	return nil
 }
 
+// filterStreamResponseData 文本增量先拼接完整的脱敏占位符，再经过输出过滤器，文本块结束时补发窗口中剩余的内容，
+// 命中停止规则后结束整个流
+func filterStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse, data string, requestMode int) *dto.OpenAIErrorWithStatusCode {
+	filter := claudeInfo.ContentFilter
+	if filter != nil && filter.Stopped {
+		return nil
+	}
+	push := func(text string) string {
+		if claudeInfo.PIIJoiner != nil {
+			text = claudeInfo.PIIJoiner.Push(text)
+		}
+		if filter != nil {
+			text = filter.Push(text)
+		}
+		return text
+	}
+	switch claudeResponse.Type {
+	case "content_block_delta":
+		if claudeResponse.Delta != nil && claudeResponse.Delta.Text != nil {
+			claudeResponse.Delta.SetText(push(*claudeResponse.Delta.Text))
+			jsonData, err := json.Marshal(claudeResponse)
+			if err != nil {
+				return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+			}
+			data = string(jsonData)
+		}
+	case "content_block_stop":
+		rest := ""
+		if claudeInfo.PIIJoiner != nil {
+			rest = claudeInfo.PIIJoiner.Flush()
+		}
+		if filter != nil {
+			rest = filter.Push(rest) + filter.Flush()
+		}
+		if rest != "" {
+			delta := &dto.ClaudeResponse{
+				Type:  "content_block_delta",
+				Index: claudeResponse.Index,
+				Delta: &dto.ClaudeMediaMessage{Type: "text_delta", Text: &rest},
+			}
+			jsonData, err := json.Marshal(delta)
+			if err != nil {
+				return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+			}
+			if respErr := handleStreamResponse(c, info, claudeInfo, delta, string(jsonData), requestMode); respErr != nil {
+				return respErr
+			}
+		}
+	}
+	if respErr := handleStreamResponse(c, info, claudeInfo, claudeResponse, data, requestMode); respErr != nil {
+		return respErr
+	}
+	if filter != nil && filter.Stopped {
+		stopFilteredStream(c, info, claudeInfo, claudeResponse.Index, claudeResponse.Type == "content_block_stop")
+	}
+	return nil
+}
+
+// stopFilteredStream 按已发送的内容结算用量，并以 content_filter（Claude 格式为 refusal）结束流
+func stopFilteredStream(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, index *int, blockClosed bool) {
+	completionTokens, _ := service.CountTextToken(claudeInfo.ContentFilter.Delivered(), info.UpstreamModelName)
+	claudeInfo.Usage.CompletionTokens = completionTokens
+	claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + completionTokens
+	common.LogWarn(c, fmt.Sprintf("stream stopped by content filter: %s", strings.Join(claudeInfo.ContentFilter.Reasons, ", ")))
+	switch info.RelayFormat {
+	case relaycommon.RelayFormatClaude:
+		if !blockClosed {
+			helper.ClaudeData(c, dto.ClaudeResponse{Type: "content_block_stop", Index: index})
+		}
+		stopReason := "refusal"
+		helper.ClaudeData(c, dto.ClaudeResponse{
+			Type:  "message_delta",
+			Delta: &dto.ClaudeMediaMessage{StopReason: &stopReason},
+			Usage: &dto.ClaudeUsage{OutputTokens: completionTokens},
+		})
+		helper.ClaudeData(c, dto.ClaudeResponse{Type: "message_stop"})
+	case relaycommon.RelayFormatOpenAI:
+		response := helper.GenerateStopResponse(claudeInfo.ResponseId, claudeInfo.Created, claudeInfo.Model, constant.FinishReasonContentFilter)
+		if err := helper.ObjectData(c, response); err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+	}
+}
+
 func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, requestMode int) {
 	if info.RelayFormat == relaycommon.RelayFormatClaude {
 		// 说明流模式建立失败，可能为官方出错
@@ -544,11 +653,13 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 
 func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, requestMode int) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	claudeInfo := &ClaudeResponseInfo{
-		ResponseId:   fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
-		Created:      common.GetTimestamp(),
-		Model:        info.UpstreamModelName,
-		ResponseText: strings.Builder{},
-		Usage:        &dto.Usage{},
+		ResponseId:    fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+		Created:       common.GetTimestamp(),
+		Model:         info.UpstreamModelName,
+		ResponseText:  strings.Builder{},
+		Usage:         &dto.Usage{},
+		ContentFilter: service.NewStreamContentFilter(c),
+		PIIJoiner:     service.GetPIIVault(c).NewStreamJoiner(),
 	}
 	var err *dto.OpenAIErrorWithStatusCode
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
@@ -556,7 +667,8 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		if err != nil {
 			return false
 		}
-		return true
+		// 停止生成后不再读取上游，按已发送的内容计费
+		return claudeInfo.ContentFilter == nil || !claudeInfo.ContentFilter.Stopped
 	})
 	if err != nil {
 		return err, nil
@@ -582,6 +694,7 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 			StatusCode: http.StatusInternalServerError,
 		}
 	}
+	info.FinishReason = stopReasonClaude2OpenAI(claudeResponse.StopReason)
 	claudeInfo.Usage.PromptTokens = claudeResponse.Usage.InputTokens
 	claudeInfo.Usage.CompletionTokens = claudeResponse.Usage.OutputTokens
 	claudeInfo.Usage.TotalTokens = claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens
@@ -590,6 +703,8 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	var responseData []byte
 	switch info.RelayFormat {
 	case relaycommon.RelayFormatOpenAI:
+		setOpenAIPromptUsage(claudeInfo.Usage, claudeResponse.Usage)
+		claudeInfo.Usage.TotalTokens = claudeInfo.Usage.PromptTokens + claudeInfo.Usage.CompletionTokens
 		openaiResponse := ResponseClaude2OpenAI(requestMode, &claudeResponse)
 		openaiResponse.Usage = *claudeInfo.Usage
 		responseData, err = json.Marshal(openaiResponse)
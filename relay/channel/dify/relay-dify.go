@@ -214,6 +214,7 @@ func difyStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 	usage := &dto.Usage{}
 	var nodeToken int
 	helper.SetEventStreamHeaders(c)
+	contentFilters := service.NewChoiceContentFilters(c)
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var difyResponse DifyChunkChatCompletionResponse
 		err := json.Unmarshal([]byte(data), &difyResponse)
@@ -229,6 +230,9 @@ func difyStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 			return false
 		} else {
 			openaiResponse = *streamResponseDify2OpenAI(difyResponse)
+			if contentFilters != nil {
+				contentFilters.Filter(&openaiResponse)
+			}
 			if len(openaiResponse.Choices) != 0 {
 				responseText += openaiResponse.Choices[0].Delta.GetContentString()
 				if openaiResponse.Choices[0].Delta.ReasoningContent != nil {
@@ -240,8 +244,21 @@ func difyStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 		if err != nil {
 			common.SysError(err.Error())
 		}
-		return true
+		// 停止生成后不再读取上游，按已发送的内容计费
+		return contentFilters == nil || !contentFilters.Stopped()
 	})
+	if contentFilters != nil {
+		if response := contentFilters.FlushResponse("", common.GetTimestamp(), "dify"); response != nil {
+			responseText += response.Choices[0].Delta.GetContentString()
+			if err := helper.ObjectData(c, response); err != nil {
+				common.SysError(err.Error())
+			}
+		}
+		if contentFilters.AnyStopped() {
+			common.LogWarn(c, fmt.Sprintf("stream stopped by content filter: %s", strings.Join(contentFilters.Reasons(), ", ")))
+			usage = &dto.Usage{}
+		}
+	}
 	helper.Done(c)
 	err := resp.Body.Close()
 	if err != nil {
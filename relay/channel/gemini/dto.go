@@ -165,3 +165,106 @@ type GeminiEmbeddingResponse struct {
 type ContentEmbedding struct {
 	Values []float64 `json:"values"`
 }
+
+// Gemini Live（BidiGenerateContent）WebSocket 协议
+
+type GeminiLiveClientMessage struct {
+	Setup         *GeminiLiveSetup         `json:"setup,omitempty"`
+	ClientContent *GeminiLiveClientContent `json:"clientContent,omitempty"`
+	RealtimeInput *GeminiLiveRealtimeInput `json:"realtimeInput,omitempty"`
+	ToolResponse  *GeminiLiveToolResponse  `json:"toolResponse,omitempty"`
+}
+
+type GeminiLiveSetup struct {
+	Model                    string                      `json:"model"`
+	GenerationConfig         *GeminiLiveGenerationConfig `json:"generationConfig,omitempty"`
+	SystemInstruction        *GeminiChatContent          `json:"systemInstruction,omitempty"`
+	Tools                    []GeminiChatTool            `json:"tools,omitempty"`
+	InputAudioTranscription  *struct{}                   `json:"inputAudioTranscription,omitempty"`
+	OutputAudioTranscription *struct{}                   `json:"outputAudioTranscription,omitempty"`
+}
+
+type GeminiLiveGenerationConfig struct {
+	ResponseModalities []string                `json:"responseModalities,omitempty"`
+	Temperature        *float64                `json:"temperature,omitempty"`
+	SpeechConfig       *GeminiLiveSpeechConfig `json:"speechConfig,omitempty"`
+}
+
+type GeminiLiveSpeechConfig struct {
+	VoiceConfig GeminiLiveVoiceConfig `json:"voiceConfig"`
+}
+
+type GeminiLiveVoiceConfig struct {
+	PrebuiltVoiceConfig GeminiLivePrebuiltVoiceConfig `json:"prebuiltVoiceConfig"`
+}
+
+type GeminiLivePrebuiltVoiceConfig struct {
+	VoiceName string `json:"voiceName"`
+}
+
+type GeminiLiveClientContent struct {
+	Turns        []GeminiChatContent `json:"turns,omitempty"`
+	TurnComplete bool                `json:"turnComplete"`
+}
+
+type GeminiLiveRealtimeInput struct {
+	Audio          *GeminiInlineData `json:"audio,omitempty"`
+	AudioStreamEnd bool              `json:"audioStreamEnd,omitempty"`
+}
+
+type GeminiLiveToolResponse struct {
+	FunctionResponses []GeminiLiveFunctionResponse `json:"functionResponses"`
+}
+
+type GeminiLiveFunctionResponse struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+}
+
+type GeminiLiveServerMessage struct {
+	SetupComplete *struct{}                `json:"setupComplete,omitempty"`
+	ServerContent *GeminiLiveServerContent `json:"serverContent,omitempty"`
+	ToolCall      *GeminiLiveToolCall      `json:"toolCall,omitempty"`
+	UsageMetadata *GeminiLiveUsageMetadata `json:"usageMetadata,omitempty"`
+	GoAway        *GeminiLiveGoAway        `json:"goAway,omitempty"`
+}
+
+type GeminiLiveServerContent struct {
+	ModelTurn           *GeminiChatContent       `json:"modelTurn,omitempty"`
+	TurnComplete        bool                     `json:"turnComplete,omitempty"`
+	Interrupted         bool                     `json:"interrupted,omitempty"`
+	InputTranscription  *GeminiLiveTranscription `json:"inputTranscription,omitempty"`
+	OutputTranscription *GeminiLiveTranscription `json:"outputTranscription,omitempty"`
+}
+
+type GeminiLiveTranscription struct {
+	Text string `json:"text"`
+}
+
+type GeminiLiveToolCall struct {
+	FunctionCalls []GeminiLiveFunctionCall `json:"functionCalls"`
+}
+
+type GeminiLiveFunctionCall struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Args any    `json:"args"`
+}
+
+type GeminiLiveGoAway struct {
+	TimeLeft string `json:"timeLeft"`
+}
+
+type GeminiLiveUsageMetadata struct {
+	PromptTokenCount      int                        `json:"promptTokenCount"`
+	ResponseTokenCount    int                        `json:"responseTokenCount"`
+	TotalTokenCount       int                        `json:"totalTokenCount"`
+	PromptTokensDetails   []GeminiModalityTokenCount `json:"promptTokensDetails,omitempty"`
+	ResponseTokensDetails []GeminiModalityTokenCount `json:"responseTokensDetails,omitempty"`
+}
+
+type GeminiModalityTokenCount struct {
+	Modality   string `json:"modality"`
+	TokenCount int    `json:"tokenCount"`
+}
@@ -0,0 +1,531 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"veloera/common"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// OpenAI realtime 的 pcm16 为 24kHz 单声道，Gemini Live 会按 rate 参数重采样
+const geminiLiveInputAudioMimeType = "audio/pcm;rate=24000"
+
+// geminiLiveSession 在 OpenAI realtime 事件与 Gemini Live 消息之间转换。
+// 客户端读取协程只写上游，上游读取协程只写客户端，两者共享的状态由 mu 保护
+type geminiLiveSession struct {
+	c      *gin.Context
+	info   *relaycommon.RelayInfo
+	client *helper.RealtimeWriter
+	target *helper.RealtimeWriter
+
+	mu              sync.Mutex
+	session         dto.RealtimeSession
+	setupSent       bool
+	pendingTurns    []GeminiChatContent
+	functionNames   map[string]string
+	responseId      string
+	responseCount   int
+	inputTranscript strings.Builder
+	usage           *GeminiLiveUsageMetadata
+	localUsage      dto.RealtimeUsage
+	sumUsage        dto.RealtimeUsage
+}
+
+func GeminiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid websocket connection"), "invalid_connection", http.StatusBadRequest), nil
+	}
+	info.IsStream = true
+
+	s := &geminiLiveSession{
+		c:             c,
+		info:          info,
+		client:        helper.NewRealtimeWriter(c, info.ClientWs),
+		target:        helper.NewRealtimeWriter(c, info.TargetWs),
+		functionNames: make(map[string]string),
+		session: dto.RealtimeSession{
+			Id:                "sess_" + common.GetUUID(),
+			Model:             info.OriginModelName,
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+		},
+	}
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+	deadline, stopDeadline := helper.RealtimeDeadline()
+	defer stopDeadline()
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.ClientWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from client: %v", err)
+				}
+				close(clientClosed)
+				return
+			}
+			event := &dto.RealtimeEvent{}
+			if err = json.Unmarshal(message, event); err != nil {
+				errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+				return
+			}
+			if setting.ShouldCheckPromptSensitive() {
+				if words, err := service.CheckSensitiveRealtimeEvent(event); err != nil {
+					common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+					s.client.WriteError("sensitive_words_detected", err.Error())
+					continue
+				}
+			}
+			if err = s.handleClientEvent(event); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.TargetWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from target: %v", err)
+				}
+				close(targetClosed)
+				return
+			}
+			info.SetFirstResponseTime()
+			var serverMessage GeminiLiveServerMessage
+			if err = json.Unmarshal(message, &serverMessage); err != nil {
+				errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+				return
+			}
+			if err = s.handleServerMessage(&serverMessage); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		common.LogError(c, "realtime error: "+err.Error())
+		s.client.WriteError("realtime_error", err.Error())
+	case <-deadline:
+		common.LogInfo(c, "realtime session reached the maximum duration")
+		s.client.WriteError("session_duration_exceeded", "realtime session reached the maximum duration")
+	case <-c.Done():
+	}
+
+	// 未完成的回合按已有用量结算
+	s.mu.Lock()
+	_ = s.settleLocked()
+	sumUsage := s.sumUsage
+	s.mu.Unlock()
+	return nil, &sumUsage
+}
+
+func (s *geminiLiveSession) handleClientEvent(event *dto.RealtimeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.Type == dto.RealtimeEventTypeSessionUpdate && event.Session != nil {
+		if s.setupSent {
+			// Gemini Live 只能在连接建立时设置一次会话
+			common.LogWarn(s.c, "gemini live does not support updating session after setup, ignored")
+		} else {
+			s.mergeSession(event.Session)
+		}
+		s.info.RealtimeTools = s.session.Tools
+	}
+	if !s.setupSent {
+		if err := s.sendSetup(); err != nil {
+			return err
+		}
+		if event.Type == dto.RealtimeEventTypeSessionUpdate {
+			return nil
+		}
+	}
+
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		return s.client.WriteObject(dto.RealtimeEvent{
+			EventId: helper.GetLocalRealtimeID(s.c),
+			Type:    dto.RealtimeEventTypeSessionUpdated,
+			Session: &s.session,
+		})
+	case dto.RealtimeEventInputAudioBufferAppend:
+		s.countLocal(event, true)
+		return s.target.WriteObject(GeminiLiveClientMessage{
+			RealtimeInput: &GeminiLiveRealtimeInput{
+				Audio: &GeminiInlineData{MimeType: geminiLiveInputAudioMimeType, Data: event.Audio},
+			},
+		})
+	case dto.RealtimeEventInputAudioBufferCommit:
+		return s.target.WriteObject(GeminiLiveClientMessage{
+			RealtimeInput: &GeminiLiveRealtimeInput{AudioStreamEnd: true},
+		})
+	case dto.RealtimeEventTypeConversationCreate:
+		return s.createItem(event.Item)
+	case dto.RealtimeEventTypeResponseCreate:
+		if len(s.pendingTurns) == 0 {
+			// 语音输入由 Gemini 的语音活动检测自动触发回复
+			return nil
+		}
+		turns := s.pendingTurns
+		s.pendingTurns = nil
+		return s.target.WriteObject(GeminiLiveClientMessage{
+			ClientContent: &GeminiLiveClientContent{Turns: turns, TurnComplete: true},
+		})
+	default:
+		common.LogInfo(s.c, fmt.Sprintf("gemini live ignored client event: %s", event.Type))
+	}
+	return nil
+}
+
+func (s *geminiLiveSession) mergeSession(session *dto.RealtimeSession) {
+	if len(session.Modalities) > 0 {
+		s.session.Modalities = session.Modalities
+	}
+	s.session.Instructions = common.GetStringIfEmpty(session.Instructions, s.session.Instructions)
+	s.session.Voice = common.GetStringIfEmpty(session.Voice, s.session.Voice)
+	if session.Tools != nil {
+		s.session.Tools = session.Tools
+	}
+	if session.Temperature != 0 {
+		s.session.Temperature = session.Temperature
+	}
+	s.session.InputAudioTranscription = session.InputAudioTranscription
+}
+
+func (s *geminiLiveSession) sendSetup() error {
+	s.setupSent = true
+	setup := &GeminiLiveSetup{
+		Model:                    "models/" + s.info.UpstreamModelName,
+		GenerationConfig:         &GeminiLiveGenerationConfig{},
+		InputAudioTranscription:  &struct{}{},
+		OutputAudioTranscription: &struct{}{},
+	}
+	// Gemini Live 每个会话只支持一种输出模态，请求语音时文本由输出转写提供
+	modality := "TEXT"
+	for _, m := range s.session.Modalities {
+		if m == "audio" {
+			modality = "AUDIO"
+		}
+	}
+	setup.GenerationConfig.ResponseModalities = []string{modality}
+	if s.session.Temperature != 0 {
+		temperature := s.session.Temperature
+		setup.GenerationConfig.Temperature = &temperature
+	}
+	if modality == "AUDIO" && s.session.Voice != "" {
+		setup.GenerationConfig.SpeechConfig = &GeminiLiveSpeechConfig{
+			VoiceConfig: GeminiLiveVoiceConfig{
+				PrebuiltVoiceConfig: GeminiLivePrebuiltVoiceConfig{VoiceName: s.session.Voice},
+			},
+		}
+	}
+	if s.session.Instructions != "" {
+		setup.SystemInstruction = &GeminiChatContent{Parts: []GeminiPart{{Text: s.session.Instructions}}}
+	}
+	if len(s.session.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(s.session.Tools))
+		for _, tool := range s.session.Tools {
+			declaration := map[string]any{"name": tool.Name, "description": tool.Description}
+			if tool.Parameters != nil {
+				declaration["parameters"] = tool.Parameters
+			}
+			declarations = append(declarations, declaration)
+		}
+		setup.Tools = []GeminiChatTool{{FunctionDeclarations: declarations}}
+	}
+	return s.target.WriteObject(GeminiLiveClientMessage{Setup: setup})
+}
+
+func (s *geminiLiveSession) createItem(item *dto.RealtimeItem) error {
+	if item == nil {
+		return nil
+	}
+	switch item.Type {
+	case "message":
+		role := "user"
+		if item.Role == "assistant" {
+			role = "model"
+		}
+		content := GeminiChatContent{Role: role}
+		for _, part := range item.Content {
+			text := common.GetStringIfEmpty(part.Text, part.Transcript)
+			if text != "" {
+				content.Parts = append(content.Parts, GeminiPart{Text: text})
+			}
+		}
+		if len(content.Parts) > 0 {
+			s.pendingTurns = append(s.pendingTurns, content)
+		}
+	case "function_call_output":
+		var response any = map[string]any{"output": item.Output}
+		var parsed map[string]any
+		if err := json.Unmarshal([]byte(item.Output), &parsed); err == nil {
+			response = parsed
+		}
+		err := s.target.WriteObject(GeminiLiveClientMessage{
+			ToolResponse: &GeminiLiveToolResponse{
+				FunctionResponses: []GeminiLiveFunctionResponse{{
+					Id:       item.CallId,
+					Name:     s.functionNames[item.CallId],
+					Response: response,
+				}},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.client.WriteObject(dto.RealtimeEvent{
+		EventId: helper.GetLocalRealtimeID(s.c),
+		Type:    dto.RealtimeEventConversationItemCreated,
+		Item:    item,
+	})
+}
+
+func (s *geminiLiveSession) handleServerMessage(message *GeminiLiveServerMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message.UsageMetadata != nil {
+		s.usage = message.UsageMetadata
+	}
+	if message.SetupComplete != nil {
+		return s.emit(dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionCreated, Session: &s.session})
+	}
+	if message.GoAway != nil {
+		common.LogInfo(s.c, "gemini live connection will be closed in "+message.GoAway.TimeLeft)
+	}
+	if message.ToolCall != nil {
+		if err := s.startResponse(); err != nil {
+			return err
+		}
+		for _, call := range message.ToolCall.FunctionCalls {
+			s.functionNames[call.Id] = call.Name
+			arguments, _ := json.Marshal(call.Args)
+			event := dto.RealtimeEvent{
+				Type:       dto.RealtimeEventResponseFunctionCallArgumentsDone,
+				ResponseId: s.responseId,
+				CallId:     call.Id,
+				Name:       call.Name,
+				Arguments:  string(arguments),
+			}
+			if err := s.emit(event); err != nil {
+				return err
+			}
+		}
+		// 等待客户端返回 function_call_output，本次回复到此结束
+		return s.finishResponse("completed")
+	}
+	content := message.ServerContent
+	if content == nil {
+		return nil
+	}
+	if content.InputTranscription != nil && content.InputTranscription.Text != "" {
+		s.inputTranscript.WriteString(content.InputTranscription.Text)
+		event := dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioTranscriptionDelta, Delta: content.InputTranscription.Text}
+		if err := s.emit(event); err != nil {
+			return err
+		}
+	}
+	if content.ModelTurn != nil {
+		for _, part := range content.ModelTurn.Parts {
+			if part.Thought {
+				continue
+			}
+			if part.Text != "" {
+				if err := s.emitDelta(dto.RealtimeEventResponseTextDelta, part.Text); err != nil {
+					return err
+				}
+			}
+			if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+				if err := s.emitDelta(dto.RealtimeEventResponseAudioDelta, part.InlineData.Data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+		if err := s.emitDelta(dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text); err != nil {
+			return err
+		}
+	}
+	if content.Interrupted {
+		return s.finishResponse("cancelled")
+	}
+	if content.TurnComplete {
+		return s.finishResponse("completed")
+	}
+	return nil
+}
+
+func (s *geminiLiveSession) emit(event dto.RealtimeEvent) error {
+	if event.EventId == "" {
+		event.EventId = "event_" + common.GetUUID()
+	}
+	return s.client.WriteObject(event)
+}
+
+func (s *geminiLiveSession) startResponse() error {
+	if s.responseId != "" {
+		return nil
+	}
+	s.responseCount++
+	s.responseId = fmt.Sprintf("resp_%s_%d", s.c.GetString(common.RequestIdKey), s.responseCount)
+	return s.emit(dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeResponseCreated,
+		Response: &dto.RealtimeResponse{
+			Id:     s.responseId,
+			Object: "realtime.response",
+			Status: "in_progress",
+		},
+	})
+}
+
+func (s *geminiLiveSession) emitDelta(eventType string, delta string) error {
+	if err := s.startResponse(); err != nil {
+		return err
+	}
+	event := dto.RealtimeEvent{Type: eventType, ResponseId: s.responseId, Delta: delta}
+	s.countLocal(&event, false)
+	return s.emit(event)
+}
+
+// finishResponse 发送输入转写结果和 response.done，并结算本回合的用量
+func (s *geminiLiveSession) finishResponse(status string) error {
+	if s.inputTranscript.Len() > 0 {
+		event := dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioTranscriptionCompleted, Transcript: s.inputTranscript.String()}
+		s.inputTranscript.Reset()
+		if setting.ShouldCheckPromptSensitive() {
+			// 语音已经发送给上游，只能结束会话
+			if words, err := service.CheckSensitiveRealtimeEvent(&event); err != nil {
+				common.LogWarn(s.c, fmt.Sprintf("user sensitive words detected in transcription: %s", strings.Join(words, ", ")))
+				return fmt.Errorf("sensitive words detected in input audio transcription")
+			}
+		}
+		if err := s.emit(event); err != nil {
+			return err
+		}
+	}
+	if s.responseId == "" {
+		return s.settleLocked()
+	}
+	usage := s.turnUsage()
+	err := s.emit(dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeResponseDone,
+		Response: &dto.RealtimeResponse{
+			Id:     s.responseId,
+			Object: "realtime.response",
+			Status: status,
+			Usage:  &usage,
+		},
+	})
+	s.responseId = ""
+	if err != nil {
+		return err
+	}
+	return s.settleLocked()
+}
+
+// turnUsage 优先使用上游返回的用量，没有时使用本地计算的用量
+func (s *geminiLiveSession) turnUsage() dto.RealtimeUsage {
+	if s.usage == nil {
+		return s.localUsage
+	}
+	usage := dto.RealtimeUsage{
+		InputTokens:  s.usage.PromptTokenCount,
+		OutputTokens: s.usage.ResponseTokenCount,
+		TotalTokens:  s.usage.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	usage.InputTokenDetails.TextTokens, usage.InputTokenDetails.AudioTokens = splitModalityTokens(s.usage.PromptTokensDetails, usage.InputTokens)
+	usage.OutputTokenDetails.TextTokens, usage.OutputTokenDetails.AudioTokens = splitModalityTokens(s.usage.ResponseTokensDetails, usage.OutputTokens)
+	return usage
+}
+
+// splitModalityTokens 按模态拆分 token 数，没有明细时全部计为文本
+func splitModalityTokens(details []GeminiModalityTokenCount, total int) (text int, audio int) {
+	if len(details) == 0 {
+		return total, 0
+	}
+	for _, detail := range details {
+		if detail.Modality == "AUDIO" {
+			audio += detail.TokenCount
+		} else {
+			text += detail.TokenCount
+		}
+	}
+	return text, audio
+}
+
+func (s *geminiLiveSession) settleLocked() error {
+	usage := s.turnUsage()
+	s.usage = nil
+	s.localUsage = dto.RealtimeUsage{}
+	if usage.TotalTokens == 0 {
+		return nil
+	}
+	s.sumUsage.TotalTokens += usage.TotalTokens
+	s.sumUsage.InputTokens += usage.InputTokens
+	s.sumUsage.OutputTokens += usage.OutputTokens
+	s.sumUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	s.sumUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	s.sumUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	s.sumUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	if err := service.PreWssConsumeQuota(s.c, s.info, &usage); err != nil {
+		return fmt.Errorf("error consume usage: %v", err)
+	}
+	return nil
+}
+
+// countLocal 本地估算用量，上游没有返回 usageMetadata 时使用
+func (s *geminiLiveSession) countLocal(event *dto.RealtimeEvent, input bool) {
+	textToken, audioToken, err := service.CountTokenRealtime(s.info, *event, s.info.UpstreamModelName)
+	if err != nil {
+		common.LogError(s.c, fmt.Sprintf("error counting realtime token: %v", err))
+		return
+	}
+	s.localUsage.TotalTokens += textToken + audioToken
+	if input {
+		s.localUsage.InputTokens += textToken + audioToken
+		s.localUsage.InputTokenDetails.TextTokens += textToken
+		s.localUsage.InputTokenDetails.AudioTokens += audioToken
+	} else {
+		s.localUsage.OutputTokens += textToken + audioToken
+		s.localUsage.OutputTokenDetails.TextTokens += textToken
+		s.localUsage.OutputTokenDetails.AudioTokens += audioToken
+	}
+}
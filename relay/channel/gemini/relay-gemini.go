@@ -147,6 +147,7 @@ func extractGeminiOutputContent(info *relaycommon.RelayInfo, response *GeminiCha
 
 		if candidate.FinishReason != nil {
 			info.Other["finish_reason"] = *candidate.FinishReason
+			info.FinishReason = finishReasonGemini2OpenAI(*candidate.FinishReason)
 		}
 	}
 
@@ -738,6 +739,18 @@ func getResponseToolCall(item *GeminiPart) *dto.ToolCallResponse {
 	}
 }
 
+// finishReasonGemini2OpenAI 将 Gemini 的 finishReason 转换为 OpenAI 格式，安全拦截等其他原因均视为 content_filter
+func finishReasonGemini2OpenAI(reason string) string {
+	switch reason {
+	case "STOP":
+		return constant.FinishReasonStop
+	case "MAX_TOKENS":
+		return constant.FinishReasonLength
+	default:
+		return constant.FinishReasonContentFilter
+	}
+}
+
 func responseGeminiChat2OpenAI(response *GeminiChatResponse) *dto.OpenAITextResponse {
 	fullTextResponse := dto.OpenAITextResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
@@ -789,14 +802,7 @@ func responseGeminiChat2OpenAI(response *GeminiChatResponse) *dto.OpenAITextResp
 
 		}
 		if candidate.FinishReason != nil {
-			switch *candidate.FinishReason {
-			case "STOP":
-				choice.FinishReason = constant.FinishReasonStop
-			case "MAX_TOKENS":
-				choice.FinishReason = constant.FinishReasonLength
-			default:
-				choice.FinishReason = constant.FinishReasonContentFilter
-			}
+			choice.FinishReason = finishReasonGemini2OpenAI(*candidate.FinishReason)
 		}
 		if isToolCall {
 			choice.FinishReason = constant.FinishReasonToolCalls
@@ -826,15 +832,8 @@ func streamResponseGeminiChat2OpenAI(geminiResponse *GeminiChatResponse) (*dto.C
 		isTools := false
 		isThought := false
 		if candidate.FinishReason != nil {
-			// p := GeminiConvertFinishReason(*candidate.FinishReason)
-			switch *candidate.FinishReason {
-			case "STOP":
-				choice.FinishReason = &constant.FinishReasonStop
-			case "MAX_TOKENS":
-				choice.FinishReason = &constant.FinishReasonLength
-			default:
-				choice.FinishReason = &constant.FinishReasonContentFilter
-			}
+			finishReason := finishReasonGemini2OpenAI(*candidate.FinishReason)
+			choice.FinishReason = &finishReason
 		}
 		for _, part := range candidate.Content.Parts {
 			if part.InlineData != nil {
@@ -899,6 +898,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 		"audio_count": 0,
 		"file_count":  0,
 	}
+	contentFilters := service.NewChoiceContentFilters(c)
 
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var geminiResponse GeminiChatResponse
@@ -909,6 +909,9 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 		}
 
 		for _, candidate := range geminiResponse.Candidates {
+			if candidate.FinishReason != nil {
+				info.FinishReason = finishReasonGemini2OpenAI(*candidate.FinishReason)
+			}
 			if len(candidate.SafetyRatings) > 0 {
 				for _, rating := range candidate.SafetyRatings {
 					accumulatedSafetyRatings = append(accumulatedSafetyRatings, map[string]interface{}{
@@ -970,16 +973,28 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 			usage.CompletionTokens = geminiResponse.UsageMetadata.CandidatesTokenCount
 			usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
 		}
+		if contentFilters != nil {
+			contentFilters.Filter(response)
+		}
 		err = helper.ObjectData(c, response)
 		if err != nil {
 			common.LogError(c, err.Error())
 		}
 		if isStop {
+			flushGeminiStreamContent(c, contentFilters, id, createAt, info.UpstreamModelName)
 			response := helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, constant.FinishReasonStop)
 			helper.ObjectData(c, response)
 		}
-		return true
+		// 所有候选都停止生成后不再读取上游，按已发送的内容计费
+		return contentFilters == nil || !contentFilters.Stopped()
 	})
+	flushGeminiStreamContent(c, contentFilters, id, createAt, info.UpstreamModelName)
+	if contentFilters != nil && contentFilters.AnyStopped() {
+		common.LogWarn(c, fmt.Sprintf("stream stopped by content filter: %s", strings.Join(contentFilters.Reasons(), ", ")))
+		usage.CompletionTokens, _ = service.CountTextToken(contentFilters.Delivered(), info.UpstreamModelName)
+		usage.CompletionTokenDetails.ReasoningTokens = 0
+		info.FinishReason = constant.FinishReasonContentFilter
+	}
 
 	extractGeminiStreamContent(info, accumulatedContent.String(), accumulatedThinking.String(), accumulatedFunctionCalls, accumulatedSafetyRatings, accumulatedCodeExecutions, multimodalSummary)
 
@@ -1007,6 +1022,18 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 	return nil, usage
 }
 
+// flushGeminiStreamContent 上游输出结束时补发输出过滤器窗口中剩余的文本
+func flushGeminiStreamContent(c *gin.Context, contentFilters *service.ChoiceContentFilters, id string, createAt int64, model string) {
+	if contentFilters == nil {
+		return
+	}
+	if response := contentFilters.FlushResponse(id, createAt, model); response != nil {
+		if err := helper.ObjectData(c, response); err != nil {
+			common.LogError(c, err.Error())
+		}
+	}
+}
+
 func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	extractGeminiInputContent(info)
 
@@ -1047,6 +1074,7 @@ func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 	if geminiResponse.UsageMetadata.ThoughtsTokenCount > 0 {
 		usage.CompletionTokenDetails.ReasoningTokens = geminiResponse.UsageMetadata.ThoughtsTokenCount
 	}
+	filterGeminiTextResponse(c, info, fullTextResponse, usage)
 	fullTextResponse.Usage = *usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
@@ -1058,6 +1086,22 @@ func GeminiChatHandler(c *gin.Context, resp *http.Response, info *relaycommon.Re
 	return nil, usage
 }
 
+// filterGeminiTextResponse 非流式响应经过输出过滤，命中停止规则时按实际返回的内容计费
+func filterGeminiTextResponse(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse, usage *dto.Usage) {
+	if _, stopped := service.FilterTextResponse(c, response); !stopped {
+		return
+	}
+	completionTokens := 0
+	for _, choice := range response.Choices {
+		tokens, _ := service.CountTextToken(choice.Message.StringContent()+choice.Message.ReasoningContent, info.UpstreamModelName)
+		completionTokens += tokens
+	}
+	usage.CompletionTokens = completionTokens
+	usage.CompletionTokenDetails.ReasoningTokens = 0
+	usage.TotalTokens = usage.PromptTokens + completionTokens
+	info.FinishReason = constant.FinishReasonContentFilter
+}
+
 func GeminiEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
 	responseBody, readErr := io.ReadAll(resp.Body)
 	if readErr != nil {
@@ -1120,6 +1164,7 @@ func GeminiChatPseudoStreamHandler(c *gin.Context, resp *http.Response, info *re
 	fullTextResponse := responseGeminiChat2OpenAI(geminiResp)
 	fullTextResponse.Model = info.UpstreamModelName
 	usage := buildGeminiUsage(geminiResp)
+	filterGeminiTextResponse(c, info, fullTextResponse, usage)
 	fullTextResponse.Usage = *usage
 
 	helper.SetEventStreamHeaders(c)
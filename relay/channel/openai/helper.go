@@ -2,6 +2,7 @@ package openai
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 	"veloera/common"
 	"veloera/dto"
@@ -25,6 +26,96 @@ func handleStreamFormat(c *gin.Context, info *relaycommon.RelayInfo, data string
 	return nil
 }
 
+// filterStreamData 将数据块中各 choice 的文本交给对应的输出过滤器，替换为过滤器当前放行的内容
+func filterStreamData(filters *service.ChoiceContentFilters, data string) string {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil || len(streamResponse.Choices) == 0 {
+		return data
+	}
+	filters.Filter(&streamResponse)
+	jsonData, err := json.Marshal(streamResponse)
+	if err != nil {
+		return data
+	}
+	return string(jsonData)
+}
+
+// joinStreamPlaceholders 被拆分到多个数据块的脱敏占位符等待其完整后再输出，还原由 ResponseWriter 完成
+func joinStreamPlaceholders(joiner *service.PIIStreamJoiner, data string) string {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil || len(streamResponse.Choices) == 0 {
+		return data
+	}
+	for i, choice := range streamResponse.Choices {
+		// 其余 choice 只还原完整的占位符
+		if choice.Index != 0 {
+			continue
+		}
+		content := joiner.Push(choice.Delta.GetContentString())
+		if choice.FinishReason != nil {
+			content += joiner.Flush()
+		}
+		streamResponse.Choices[i].Delta.SetContentString(content)
+	}
+	jsonData, err := json.Marshal(streamResponse)
+	if err != nil {
+		return data
+	}
+	return string(jsonData)
+}
+
+// flushStreamContent 上游未发送结束标记时，将缓存中各 choice 剩余的文本补发到最后一个数据块中；
+// 最后一个数据块缺少对应的 choice 时单独发送一个数据块，并返回该数据块用于计费
+func flushStreamContent(c *gin.Context, info *relaycommon.RelayInfo, rest map[int]string, lastStreamData string) (string, string) {
+	if len(rest) == 0 {
+		return lastStreamData, ""
+	}
+	indexes := make([]int, 0, len(rest))
+	for index := range rest {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(lastStreamData, &streamResponse); err == nil && len(streamResponse.Choices) > 0 {
+		positions := make(map[int]int, len(streamResponse.Choices))
+		for i, choice := range streamResponse.Choices {
+			positions[choice.Index] = i
+		}
+		complete := true
+		for _, index := range indexes {
+			if _, ok := positions[index]; !ok {
+				complete = false
+			}
+		}
+		if complete {
+			for _, index := range indexes {
+				delta := &streamResponse.Choices[positions[index]].Delta
+				delta.SetContentString(delta.GetContentString() + rest[index])
+			}
+			if jsonData, err := json.Marshal(streamResponse); err == nil {
+				return string(jsonData), ""
+			}
+		}
+	}
+	response := dto.ChatCompletionsStreamResponse{
+		Id:      streamResponse.Id,
+		Object:  "chat.completion.chunk",
+		Created: streamResponse.Created,
+		Model:   streamResponse.Model,
+	}
+	for _, index := range indexes {
+		choice := dto.ChatCompletionsStreamResponseChoice{Index: index}
+		choice.Delta.SetContentString(rest[index])
+		response.Choices = append(response.Choices, choice)
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return lastStreamData, ""
+	}
+	_ = handleStreamFormat(c, info, string(jsonData), false, false)
+	return lastStreamData, string(jsonData)
+}
+
 func handleClaudeFormat(c *gin.Context, data string, info *relaycommon.RelayInfo) error {
 	var streamResponse dto.ChatCompletionsStreamResponse
 	if err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse); err != nil {
@@ -58,6 +149,22 @@ func ProcessStreamResponse(streamResponse dto.ChatCompletionsStreamResponse, res
 	return nil
 }
 
+// lastStreamFinishReason 返回流式响应最后几个数据块中的 finish_reason，用量可能在其后单独的数据块中返回
+func lastStreamFinishReason(streamItems []string) string {
+	for i := len(streamItems) - 1; i >= 0 && i >= len(streamItems)-3; i-- {
+		var streamResponse dto.ChatCompletionsStreamResponse
+		if err := common.DecodeJsonStr(streamItems[i], &streamResponse); err != nil {
+			continue
+		}
+		for _, choice := range streamResponse.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				return *choice.FinishReason
+			}
+		}
+	}
+	return ""
+}
+
 func processTokens(relayMode int, streamItems []string, responseTextBuilder *strings.Builder, toolCount *int) error {
 	streamResp := "[" + strings.Join(streamItems, ",") + "]"
 
@@ -158,6 +265,37 @@ func handleLastResponse(lastStreamData string, responseId *string, createAt *int
 	return nil
 }
 
+// stitchStreamData 续写渠道的数据块使用首个渠道的响应标识，使用户看到同一个响应
+func stitchStreamData(data string, failover *relaycommon.StreamFailoverInfo) string {
+	if failover.ResponseId == "" {
+		return data
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+		return data
+	}
+	streamResponse.Id = failover.ResponseId
+	streamResponse.Created = failover.Created
+	if failover.Model != "" {
+		streamResponse.Model = failover.Model
+	}
+	stitched, err := json.Marshal(streamResponse)
+	if err != nil {
+		return data
+	}
+	return string(stitched)
+}
+
+func markStreamInterrupted(failover *relaycommon.StreamFailoverInfo, responseText string, responseId string, createAt int64, model string) {
+	failover.Interrupted = true
+	failover.Content += responseText
+	if failover.ResponseId == "" {
+		failover.ResponseId = responseId
+		failover.Created = createAt
+		failover.Model = model
+	}
+}
+
 func handleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStreamData string,
 	responseId string, createAt int64, model string, systemFingerprint string,
 	usage *dto.Usage, containStreamUsage bool) {
@@ -16,6 +16,7 @@ import (
 	relaycommon "veloera/relay/common"
 	"veloera/relay/helper"
 	"veloera/service"
+	"veloera/setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
@@ -134,8 +135,19 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	var (
 		lastStreamData string
 	)
+	contentFilters := service.NewChoiceContentFilters(c)
+	piiJoiner := service.GetPIIVault(c).NewStreamJoiner()
 
-	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+	streamErr := helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		if info.StreamFailover != nil && info.StreamFailover.Attempt > 0 {
+			data = stitchStreamData(data, info.StreamFailover)
+		}
+		if piiJoiner != nil {
+			data = joinStreamPlaceholders(piiJoiner, data)
+		}
+		if contentFilters != nil {
+			data = filterStreamData(contentFilters, data)
+		}
 		if lastStreamData != "" {
 			err := handleStreamFormat(c, info, lastStreamData, forceFormat, thinkToContent)
 			if err != nil {
@@ -144,10 +156,35 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 		lastStreamData = data
 		streamItems = append(streamItems, data)
-		return true
+		// 所有 choice 都停止生成后不再读取上游，按已发送的内容计费
+		return contentFilters == nil || !contentFilters.Stopped()
 	})
 
+	rest := make(map[int]string)
+	if piiJoiner != nil {
+		if text := piiJoiner.Flush(); text != "" {
+			rest[0] = text
+		}
+	}
+	if contentFilters != nil {
+		if contentFilters.AnyStopped() {
+			common.LogWarn(c, fmt.Sprintf("stream stopped by content filter: %s", strings.Join(contentFilters.Reasons(), ", ")))
+		}
+		rest = contentFilters.Flush(rest)
+	}
+	if len(rest) > 0 {
+		var flushed string
+		lastStreamData, flushed = flushStreamContent(c, info, rest, lastStreamData)
+		if len(streamItems) > 0 {
+			streamItems[len(streamItems)-1] = lastStreamData
+		}
+		if flushed != "" {
+			streamItems = append(streamItems, flushed)
+		}
+	}
+
 	shouldSendLastResp := true
+	finished := false
 	var lastStreamResponse dto.ChatCompletionsStreamResponse
 	err := common.DecodeJsonStr(lastStreamData, &lastStreamResponse)
 	if err == nil {
@@ -165,6 +202,7 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		for _, choice := range lastStreamResponse.Choices {
 			if choice.FinishReason != nil {
 				shouldSendLastResp = true
+				finished = true
 			}
 		}
 	}
@@ -178,6 +216,7 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	if err := processTokens(info.RelayMode, streamItems, &responseTextBuilder, &toolCount); err != nil {
 		common.SysError("error processing tokens: " + err.Error())
 	}
+	info.FinishReason = lastStreamFinishReason(streamItems)
 
 	// 检查是否为空回复或只有空格的回复，如果是则不计费
 	responseText := responseTextBuilder.String()
@@ -246,6 +285,14 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 
 	info.Other["output_content"] = responseText // 保存输出内容
 
+	// 上游中途中断时不发送结束标记，由调用方在其他渠道续写
+	interrupted := info.StreamFailover != nil && streamErr != nil && !finished && toolCount == 0 &&
+		(contentFilters == nil || !contentFilters.AnyStopped())
+	if interrupted {
+		common.LogWarn(c, fmt.Sprintf("upstream stream interrupted: %s", streamErr.Error()))
+		markStreamInterrupted(info.StreamFailover, responseText, responseId, createAt, model)
+	}
+
 	if common.IsEmptyOrWhitespace(responseText) && toolCount == 0 {
 		// 空回复或全是空格不计费，返回零使用量（而不是只设置CompletionTokens为0）
 		zeroUsage := &dto.Usage{
@@ -254,7 +301,9 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			TotalTokens:      0,
 		}
 		// 直接返回空使用量，结束处理
-		handleFinalResponse(c, info, lastStreamData, responseId, createAt, model, systemFingerprint, zeroUsage, false)
+		if !interrupted {
+			handleFinalResponse(c, info, lastStreamData, responseId, createAt, model, systemFingerprint, zeroUsage, false)
+		}
 		return nil, zeroUsage
 	}
 
@@ -269,7 +318,9 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 	}
 
-	handleFinalResponse(c, info, lastStreamData, responseId, createAt, model, systemFingerprint, usage, containStreamUsage)
+	if !interrupted {
+		handleFinalResponse(c, info, lastStreamData, responseId, createAt, model, systemFingerprint, usage, containStreamUsage)
+	}
 
 	return nil, usage
 }
@@ -295,6 +346,16 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 		}, nil
 	}
 
+	// 非流模式同样经过输出过滤，命中停止规则时截断内容，并按实际返回的内容计费
+	changed, contentFiltered := service.FilterTextResponse(c, &simpleResponse)
+	if changed {
+		responseBody, err = json.Marshal(simpleResponse)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		resp.Header.Del("Content-Length")
+	}
+
 	// 保存输入输出内容到 info 中，供日志记录使用
 	if info.Other == nil {
 		info.Other = make(map[string]interface{})
@@ -362,6 +423,9 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 	var outputContent string
 	for _, choice := range simpleResponse.Choices {
 		outputContent += choice.Message.StringContent() + choice.Message.ReasoningContent + choice.Message.Reasoning
+		if choice.FinishReason != "" {
+			info.FinishReason = choice.FinishReason
+		}
 	}
 	info.Other["output_content"] = outputContent // 保存输出内容
 
@@ -413,16 +477,20 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayI
 		return nil, zeroUsage
 	}
 
-	if simpleResponse.Usage.TotalTokens == 0 || (simpleResponse.Usage.PromptTokens == 0 && simpleResponse.Usage.CompletionTokens == 0) {
+	if contentFiltered || simpleResponse.Usage.TotalTokens == 0 || (simpleResponse.Usage.PromptTokens == 0 && simpleResponse.Usage.CompletionTokens == 0) {
 		completionTokens := 0
 		for _, choice := range simpleResponse.Choices {
 			ctkm, _ := service.CountTextToken(choice.Message.StringContent()+choice.Message.ReasoningContent+choice.Message.Reasoning, info.UpstreamModelName)
 			completionTokens += ctkm
 		}
+		promptTokens := info.PromptTokens
+		if contentFiltered && simpleResponse.Usage.PromptTokens > 0 {
+			promptTokens = simpleResponse.Usage.PromptTokens
+		}
 		simpleResponse.Usage = dto.Usage{
-			PromptTokens:     info.PromptTokens,
+			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
-			TotalTokens:      info.PromptTokens + completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
 		}
 	}
 	return nil, &simpleResponse.Usage
@@ -659,6 +727,9 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 	usage := &dto.RealtimeUsage{}
 	localUsage := &dto.RealtimeUsage{}
 	sumUsage := &dto.RealtimeUsage{}
+	clientWriter := helper.NewRealtimeWriter(c, clientConn)
+	deadline, stopDeadline := helper.RealtimeDeadline()
+	defer stopDeadline()
 
 	gopool.Go(func() {
 		defer func() {
@@ -687,6 +758,15 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 					return
 				}
 
+				if setting.ShouldCheckPromptSensitive() {
+					if words, err := service.CheckSensitiveRealtimeEvent(realtimeEvent); err != nil {
+						// 含敏感词的输入不转发给上游，会话继续
+						common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+						clientWriter.WriteError("sensitive_words_detected", err.Error())
+						continue
+					}
+				}
+
 				if realtimeEvent.Type == dto.RealtimeEventTypeSessionUpdate {
 					if realtimeEvent.Session != nil {
 						if realtimeEvent.Session.Tools != nil {
@@ -747,6 +827,15 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 					return
 				}
 
+				if realtimeEvent.Type == dto.RealtimeEventInputAudioTranscriptionCompleted && setting.ShouldCheckPromptSensitive() {
+					// 语音已经发送给上游，只能结束会话
+					if words, err := service.CheckSensitiveRealtimeEvent(realtimeEvent); err != nil {
+						common.LogWarn(c, fmt.Sprintf("user sensitive words detected in transcription: %s", strings.Join(words, ", ")))
+						errChan <- fmt.Errorf("sensitive words detected in input audio transcription")
+						return
+					}
+				}
+
 				if realtimeEvent.Type == dto.RealtimeEventTypeResponseDone {
 					realtimeUsage := realtimeEvent.Response.Usage
 					if realtimeUsage != nil {
@@ -812,7 +901,7 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 					localUsage.OutputTokenDetails.AudioTokens += audioToken
 				}
 
-				err = helper.WssString(c, clientConn, string(message))
+				err = clientWriter.WriteString(string(message))
 				if err != nil {
 					errChan <- fmt.Errorf("error writing to client: %v", err)
 					return
@@ -832,6 +921,10 @@ func OpenaiRealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Op
 	case err := <-errChan:
 		//return service.OpenAIErrorWrapper(err, "realtime_error", http.StatusInternalServerError), nil
 		common.LogError(c, "realtime error: "+err.Error())
+		clientWriter.WriteError("realtime_error", err.Error())
+	case <-deadline:
+		common.LogInfo(c, "realtime session reached the maximum duration")
+		clientWriter.WriteError("session_duration_exceeded", "realtime session reached the maximum duration")
 	case <-c.Done():
 	}
 
@@ -3,6 +3,7 @@ package xai
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
@@ -41,6 +42,7 @@ func xAIStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	var containStreamUsage bool
 
 	helper.SetEventStreamHeaders(c)
+	contentFilters := service.NewChoiceContentFilters(c)
 
 	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
 		var xAIResp *dto.ChatCompletionsStreamResponse
@@ -59,14 +61,31 @@ func xAIStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 
 		openaiResponse := streamResponseXAI2OpenAI(xAIResp, usage)
+		if contentFilters != nil {
+			contentFilters.Filter(openaiResponse)
+		}
 		_ = openai.ProcessStreamResponse(*openaiResponse, &responseTextBuilder, &toolCount)
 		err = helper.ObjectData(c, openaiResponse)
 		if err != nil {
 			common.SysError(err.Error())
 		}
-		return true
+		// 所有 choice 都停止生成后不再读取上游，按已发送的内容计费
+		return contentFilters == nil || !contentFilters.Stopped()
 	})
 
+	if contentFilters != nil {
+		if response := contentFilters.FlushResponse(helper.GetResponseID(c), common.GetTimestamp(), info.UpstreamModelName); response != nil {
+			_ = openai.ProcessStreamResponse(*response, &responseTextBuilder, &toolCount)
+			if err := helper.ObjectData(c, response); err != nil {
+				common.SysError(err.Error())
+			}
+		}
+		if contentFilters.AnyStopped() {
+			common.LogWarn(c, fmt.Sprintf("stream stopped by content filter: %s", strings.Join(contentFilters.Reasons(), ", ")))
+			containStreamUsage = false
+		}
+	}
+
 	if !containStreamUsage {
 		usage, _ = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
 		usage.CompletionTokens += toolCount * 7
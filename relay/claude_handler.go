@@ -46,6 +46,12 @@ func ClaudeHelper(c *gin.Context) (claudeError *dto.ClaudeErrorWithStatusCode) {
 		relayInfo.IsStream = true
 	}
 
+	if pipeline := service.NewGuardrailPipeline(c, service.GuardrailDirectionInput); pipeline != nil {
+		if err = pipeline.CheckClaudeMessages(c, textRequest.Messages); err != nil {
+			return service.ClaudeErrorWrapperLocal(err, "guardrail_blocked", http.StatusBadRequest)
+		}
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.ClaudeErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
@@ -43,6 +43,20 @@ type RerankerInfo struct {
 	ReturnDocuments bool
 }
 
+// StreamFailoverInfo 流式响应中途中断后切换渠道续写的状态
+type StreamFailoverInfo struct {
+	// Interrupted 本次上游在结束前中断，需要在其他渠道续写
+	Interrupted bool
+	// Content 已经发送给用户的全部内容，续写时作为 assistant 预填充
+	Content string
+	// 首个渠道的响应标识，续写的数据块会改写为相同的值
+	ResponseId string
+	Created    int64
+	Model      string
+	// Attempt 续写次数，首个渠道为 0
+	Attempt int
+}
+
 type RelayInfo struct {
 	ChannelType       int
 	ChannelId         int
@@ -88,6 +102,8 @@ type RelayInfo struct {
 	RelayFormat          string
 	SendResponseCount    int
 	ChannelCreateTime    int64
+	StreamFailover       *StreamFailoverInfo    // 非 nil 时允许流式响应中断后切换渠道续写
+	ModelCreditQuota     int                    // 本次请求由模型额度抵扣的额度，记录到消费日志中，退款时退回模型额度
 	PromptMessages       interface{}            // 保存请求的消息内容
 	Other                map[string]interface{} // 用于存储额外信息，如输入输出内容
 	ThinkingContentInfo
@@ -2,12 +2,16 @@ package helper
 
 import (
 	"fmt"
-	"github.com/gin-gonic/gin"
+	"time"
 	"veloera/common"
 	constant2 "veloera/constant"
+	"veloera/dto"
 	relaycommon "veloera/relay/common"
 	"veloera/setting"
 	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 type PriceData struct {
@@ -19,6 +23,7 @@ type PriceData struct {
 	UsePrice               bool
 	CacheCreationRatio     float64
 	ShouldPreConsumedQuota int
+	PricingRule            *operation_setting.PricingRule
 }
 
 func (p PriceData) ToSetting() string {
@@ -44,6 +49,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var completionRatio float64
 	var cacheRatio float64
 	var cacheCreationRatio float64
+	var rule *operation_setting.PricingRule
 	if !usePrice {
 		preConsumedTokens := common.PreConsumedQuota
 		if completionTokens != 0 {
@@ -51,6 +57,10 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		}
 		var success bool
 		modelRatio, success = operation_setting.GetModelRatio(modelNameForRatio)
+		pricingRule, hasRule := operation_setting.GetPricingRule(modelNameForRatio)
+		if !success && hasRule && pricingRule.HasBaseRatio() {
+			success = true
+		}
 		if !success {
 			acceptUnsetRatio := false
 			if accept, ok := info.UserSetting[constant2.UserAcceptUnsetRatioModel]; ok {
@@ -67,7 +77,14 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		cacheRatio, _ = operation_setting.GetCacheRatio(modelNameForRatio)
 		cacheCreationRatio, _ = operation_setting.GetCreateCacheRatio(modelNameForRatio)
 		ratio := modelRatio * groupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
+		var fixedFee float64
+		if hasRule {
+			rule = pricingRule
+			applied := pricingRule.Apply(promptTokens, modelRatio, completionRatio, cacheRatio, time.Now())
+			ratio = applied.ModelRatio * groupRatio * applied.Discount
+			fixedFee = applied.FixedFee * common.QuotaPerUnit * groupRatio * applied.Discount
+		}
+		preConsumedQuota = int(float64(preConsumedTokens)*ratio + fixedFee)
 	} else {
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
 	}
@@ -81,6 +98,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheRatio:             cacheRatio,
 		CacheCreationRatio:     cacheCreationRatio,
 		ShouldPreConsumedQuota: preConsumedQuota,
+		PricingRule:            rule,
 	}
 
 	if common.DebugEnabled {
@@ -99,5 +117,56 @@ func ContainPriceOrRatio(modelName string) bool {
 	if ok {
 		return true
 	}
+	if rule, ok := operation_setting.GetPricingRule(modelName); ok && rule.HasBaseRatio() {
+		return true
+	}
 	return false
 }
+
+// ApplyPricingRule 按实际提示词长度命中计费规则，并用档位倍率覆盖 priceData 中的倍率
+func (p *PriceData) ApplyPricingRule(promptTokens int) *operation_setting.AppliedPricingRule {
+	if p.PricingRule == nil || p.UsePrice {
+		return nil
+	}
+	applied := p.PricingRule.Apply(promptTokens, p.ModelRatio, p.CompletionRatio, p.CacheRatio, time.Now())
+	p.ModelRatio = applied.ModelRatio
+	p.CompletionRatio = applied.CompletionRatio
+	p.CacheRatio = applied.CacheRatio
+	return &applied
+}
+
+// PricingRuleQuota 在按 token 计算出的额度上叠加推理/音频/图片 token 的单独倍率、固定费用和时段折扣。
+// quota 为已乘以模型倍率和分组倍率的结果。
+func PricingRuleQuota(applied *operation_setting.AppliedPricingRule, quota decimal.Decimal, usage *dto.Usage, groupRatio float64) decimal.Decimal {
+	if applied == nil {
+		return quota
+	}
+	dCompletionRatio := decimal.NewFromFloat(applied.CompletionRatio)
+	extra := decimal.Zero
+	if applied.ReasoningRatio > 0 {
+		tokens := decimal.NewFromInt(int64(usage.CompletionTokenDetails.ReasoningTokens))
+		extra = extra.Add(tokens.Mul(decimal.NewFromFloat(applied.ReasoningRatio).Sub(dCompletionRatio)))
+	}
+	if applied.AudioOutputRatio > 0 {
+		tokens := decimal.NewFromInt(int64(usage.CompletionTokenDetails.AudioTokens))
+		extra = extra.Add(tokens.Mul(decimal.NewFromFloat(applied.AudioOutputRatio).Sub(dCompletionRatio)))
+	}
+	if applied.ImageOutputRatio > 0 {
+		tokens := decimal.NewFromInt(int64(usage.CompletionTokenDetails.ImageTokens))
+		extra = extra.Add(tokens.Mul(decimal.NewFromFloat(applied.ImageOutputRatio).Sub(dCompletionRatio)))
+	}
+	if applied.AudioInputRatio > 0 {
+		tokens := decimal.NewFromInt(int64(usage.PromptTokensDetails.AudioTokens))
+		extra = extra.Add(tokens.Mul(decimal.NewFromFloat(applied.AudioInputRatio).Sub(decimal.NewFromInt(1))))
+	}
+	dGroupRatio := decimal.NewFromFloat(groupRatio)
+	quota = quota.Add(extra.Mul(decimal.NewFromFloat(applied.ModelRatio)).Mul(dGroupRatio))
+	if applied.FixedFee > 0 {
+		quota = quota.Add(decimal.NewFromFloat(applied.FixedFee).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).Mul(dGroupRatio))
+	}
+	quota = quota.Mul(decimal.NewFromFloat(applied.Discount))
+	if quota.IsNegative() {
+		quota = decimal.Zero
+	}
+	return quota
+}
@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"sync"
+	"time"
+	"veloera/dto"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RealtimeWriter 串行化对同一 WebSocket 连接的写入，gorilla/websocket 不支持并发写
+type RealtimeWriter struct {
+	mu sync.Mutex
+	c  *gin.Context
+	ws *websocket.Conn
+}
+
+func NewRealtimeWriter(c *gin.Context, ws *websocket.Conn) *RealtimeWriter {
+	return &RealtimeWriter{c: c, ws: ws}
+}
+
+func (w *RealtimeWriter) WriteString(str string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WssString(w.c, w.ws, str)
+}
+
+func (w *RealtimeWriter) WriteObject(object interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WssObject(w.c, w.ws, object)
+}
+
+func (w *RealtimeWriter) WriteError(code string, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	WssError(w.c, w.ws, dto.OpenAIError{
+		Message: message,
+		Type:    "veloera_error",
+		Code:    code,
+	})
+}
+
+// RealtimeDeadline 返回会话达到最长时间时触发的通道，未限制时返回 nil，调用方需在结束后执行 stop
+func RealtimeDeadline() (<-chan time.Time, func()) {
+	timeout := operation_setting.GetRealtimeSetting().SessionTimeout()
+	if timeout <= 0 {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(timeout)
+	return timer.C, func() { timer.Stop() }
+}
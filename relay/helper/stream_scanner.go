@@ -3,6 +3,7 @@ package helper
 import (
 	"bufio"
 	"context"
+	"errors"
 	"github.com/bytedance/gopkg/util/gopool"
 	"io"
 	"net/http"
@@ -23,10 +24,14 @@ const (
 	DefaultPingInterval      = 10 * time.Second
 )
 
-func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, dataHandler func(data string) bool) {
+var ErrStreamTimeout = errors.New("streaming timeout")
+
+// StreamScannerHandler 逐行读取上游 SSE 数据交给 dataHandler，上游读取出错或超时时返回错误，
+// 正常结束、dataHandler 主动停止或客户端断开时返回 nil
+func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, dataHandler func(data string) bool) error {
 
 	if resp == nil || dataHandler == nil {
-		return
+		return nil
 	}
 
 	defer resp.Body.Close()
@@ -43,6 +48,8 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		ticker     = time.NewTicker(streamingTimeout)
 		pingTicker *time.Ticker
 		writeMutex sync.Mutex // Mutex to protect concurrent writes
+		stopped    bool       // 返回后不再调用 dataHandler，由 writeMutex 保护
+		scanErr    error      // 由 writeMutex 保护
 	)
 
 	generalSettings := operation_setting.GetGeneralSetting()
@@ -57,6 +64,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	}
 
 	defer func() {
+		writeMutex.Lock()
+		stopped = true
+		writeMutex.Unlock()
 		ticker.Stop()
 		if pingTicker != nil {
 			pingTicker.Stop()
@@ -119,6 +129,10 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			if !strings.HasPrefix(data, "[DONE]") {
 				info.SetFirstResponseTime()
 				writeMutex.Lock() // Lock before writing
+				if stopped {
+					writeMutex.Unlock()
+					return
+				}
 				success := dataHandler(data)
 				writeMutex.Unlock() // Unlock after writing
 				if !success {
@@ -130,6 +144,9 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		if err := scanner.Err(); err != nil {
 			if err != io.EOF {
 				common.LogError(c, "scanner error: "+err.Error())
+				writeMutex.Lock()
+				scanErr = err
+				writeMutex.Unlock()
 			}
 		}
 
@@ -141,8 +158,12 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		// 超时处理逻辑
 		common.LogError(c, "streaming timeout")
 		common.SafeSendBool(stopChan, true)
+		return ErrStreamTimeout
 	case <-stopChan:
 		// 正常结束
 		common.LogInfo(c, "streaming finished")
 	}
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	return scanErr
 }
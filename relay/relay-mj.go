@@ -32,8 +32,9 @@ func RelayMidjourneyImage(c *gin.Context) {
 		})
 		return
 	}
-	resp, err := http.Get(midjourneyTask.ImageUrl)
+	resp, err := service.DoDownloadRequest(midjourneyTask.ImageUrl)
 	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get midjourney image: %s", err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "http_get_image_failed",
 		})
@@ -53,10 +54,23 @@ func RelayMidjourneyImage(c *gin.Context) {
 		// 如果无法确定内容类型，则默认为jpeg
 		contentType = "image/jpeg"
 	}
+	if contentType != "application/octet-stream" && !strings.HasPrefix(contentType, "image/") {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "invalid_image_content_type",
+		})
+		return
+	}
+	maxImageSize := int64(constant.MaxFileDownloadMB * 1024 * 1024)
+	if resp.ContentLength > maxImageSize {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "image_too_large",
+		})
+		return
+	}
 	// 设置响应的内容类型
 	c.Writer.Header().Set("Content-Type", contentType)
 	// 将图片流式传输到响应体
-	_, err = io.Copy(c.Writer, resp.Body)
+	_, err = io.Copy(c.Writer, io.LimitReader(resp.Body, maxImageSize))
 	if err != nil {
 		log.Println("Failed to stream image:", err)
 	}
@@ -208,8 +222,9 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				cost := service.CalculateChannelCost(c, modelName, 0, 0, 0, 0, quota, groupRatio)
 				model.RecordConsumeLog(c, userId, channelId, 0, 0, modelName, tokenName,
-					quota, logContent, tokenId, userQuota, 0, false, group, other)
+					quota, cost, logContent, tokenId, userQuota, 0, false, group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
@@ -510,8 +525,9 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				cost := service.CalculateChannelCost(c, modelName, 0, 0, 0, 0, quota, groupRatio)
 				model.RecordConsumeLog(c, userId, channelId, 0, 0, modelName, tokenName,
-					quota, logContent, tokenId, userQuota, 0, false, group, other)
+					quota, cost, logContent, tokenId, userQuota, 0, false, group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
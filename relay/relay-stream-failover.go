@@ -0,0 +1,205 @@
+package relay
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/middleware"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamFailoverApiTypes 流式响应由 openai.OaiStreamHandler 处理的渠道，只有这些渠道能识别上游中断并拼接续写内容。
+// Claude、Gemini、Vertex、AWS、xAI、Dify 等渠道的流式处理器不报告中断，既不开启续写，也不作为续写渠道
+var streamFailoverApiTypes = map[int]bool{
+	relayconstant.APITypeOpenAI:      true,
+	relayconstant.APITypeOpenRouter:  true,
+	relayconstant.APITypeXinference:  true,
+	relayconstant.APITypeGitHub:      true,
+	relayconstant.APITypeAli:         true,
+	relayconstant.APITypeBaiduV2:     true,
+	relayconstant.APITypeDeepSeek:    true,
+	relayconstant.APITypeMistral:     true,
+	relayconstant.APITypeOllama:      true,
+	relayconstant.APITypePerplexity:  true,
+	relayconstant.APITypeSiliconFlow: true,
+	relayconstant.APITypeVolcEngine:  true,
+	relayconstant.APITypeZhipuV4:     true,
+}
+
+func supportsStreamFailover(channelType int) bool {
+	apiType, _ := relayconstant.ChannelType2APIType(channelType)
+	return streamFailoverApiTypes[apiType]
+}
+
+// shouldEnableStreamFailover 只有 OpenAI 格式的文本流式请求，且渠道使用 OpenAI 兼容的流式处理时支持中断后续写，指定渠道时不切换
+func shouldEnableStreamFailover(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !operation_setting.GetStreamFailoverSetting().Enabled || !info.IsStream {
+		return false
+	}
+	if info.RelayFormat != relaycommon.RelayFormatOpenAI || !streamFailoverApiTypes[info.ApiType] {
+		return false
+	}
+	if info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if hints := middleware.GetRoutingHints(c); hints != nil && hints.NoRetry {
+		return false
+	}
+	return true
+}
+
+// getFailoverChannel 选择一个本次请求尚未使用过、且支持续写的渠道
+func getFailoverChannel(c *gin.Context, group, originalModel string) *model.Channel {
+	used := make(map[int]bool)
+	for _, id := range c.GetStringSlice("use_channel") {
+		if channelId, err := strconv.Atoi(id); err == nil {
+			used[channelId] = true
+		}
+	}
+	hints := middleware.GetRoutingHints(c)
+	for retry := 0; retry <= common.RetryTimes; retry++ {
+		for i := 0; i < 3; i++ {
+			channel, err := model.GetRandomSatisfiedChannelWithHints(group, originalModel, retry, hints)
+			if err != nil {
+				break
+			}
+			if !used[channel.Id] && supportsStreamFailover(channel.Type) {
+				return channel
+			}
+		}
+	}
+	return nil
+}
+
+// buildContinuationRequest 在原请求后追加已发送的内容作为 assistant 预填充，让新渠道接着生成
+func buildContinuationRequest(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo, content string) *dto.GeneralOpenAIRequest {
+	request := *textRequest
+	request.Model = info.UpstreamModelName
+	// 已有的脱敏映射需要继续使用，才能还原续写内容中的占位符
+	vault := service.GetPIIVault(c)
+	if vault != nil {
+		content = vault.Redact(content)
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions:
+		prefill := dto.Message{Role: "assistant"}
+		prefill.SetStringContent(content)
+		request.Messages = append(textRequest.Messages[:len(textRequest.Messages):len(textRequest.Messages)], prefill)
+	case relayconstant.RelayModeCompletions:
+		if prompt, ok := textRequest.Prompt.(string); ok {
+			request.Prompt = prompt + content
+		}
+	}
+	if info.SupportStreamOptions {
+		request.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	} else {
+		request.StreamOptions = nil
+	}
+	if vault == nil {
+		redactRequestPII(c, &request, info)
+	}
+	return &request
+}
+
+// continueInterruptedStream 流式响应中途中断后在其他渠道续写，续写内容拼接到同一个响应中，每次续写单独计费。
+// 无法续写时发送结束标记，用户收到的是截断的回答
+func continueInterruptedStream(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, firstInfo *relaycommon.RelayInfo) {
+	failover := firstInfo.StreamFailover
+	maxAttempts := operation_setting.GetStreamFailoverSetting().MaxAttempts
+	for failover.Interrupted && failover.Attempt < maxAttempts {
+		channel := getFailoverChannel(c, firstInfo.Group, c.GetString("original_model"))
+		if channel == nil {
+			common.LogWarn(c, "no channel available for stream failover")
+			break
+		}
+		failover.Attempt++
+		failover.Interrupted = false
+		common.LogInfo(c, fmt.Sprintf("stream interrupted on channel #%d, continuing on channel #%d", c.GetInt("channel_id"), channel.Id))
+		middleware.SetupContextForSelectedChannel(c, channel, c.GetString("original_model"))
+		c.Set("use_channel", append(c.GetStringSlice("use_channel"), strconv.Itoa(channel.Id)))
+
+		openaiErr := relayStreamContinuation(c, textRequest, firstInfo, failover)
+		if openaiErr != nil {
+			common.LogError(c, fmt.Sprintf("stream failover on channel #%d failed: %s", channel.Id, openaiErr.Error.Message))
+			// 续写请求失败时仍可尝试其他渠道
+			failover.Interrupted = true
+		}
+	}
+	if failover.Interrupted {
+		helper.Done(c)
+	}
+}
+
+func relayStreamContinuation(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, firstInfo *relaycommon.RelayInfo,
+	failover *relaycommon.StreamFailoverInfo) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	info := relaycommon.GenRelayInfo(c)
+	info.IsStream = true
+	info.RelayMode = firstInfo.RelayMode
+	info.ShouldIncludeUsage = firstInfo.ShouldIncludeUsage
+	info.PromptMessages = firstInfo.PromptMessages
+	info.StreamFailover = failover
+	if err := helper.ModelMappedHelper(c, info); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	request := buildContinuationRequest(c, textRequest, info, failover.Content)
+	promptTokens, err := getPromptTokens(request, info)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	priceData, err := helper.ModelPriceHelper(c, info, promptTokens, int(math.Max(float64(request.MaxTokens), float64(request.MaxCompletionTokens))))
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, info)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, info, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", info.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(info)
+	requestBody, openaiErr := convertTextRequestBody(c, adaptor, info, request)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	httpResp, _ := resp.(*http.Response)
+	if httpResp != nil && httpResp.StatusCode != http.StatusOK {
+		return service.RelayErrorHandler(httpResp, false)
+	}
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, info)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	extraContent := fmt.Sprintf("流式响应续写（第 %d 次）", failover.Attempt)
+	if failover.Interrupted {
+		extraContent += "，再次中断"
+	}
+	postConsumeQuota(c, info, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, extraContent)
+	return nil
+}
@@ -0,0 +1,306 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/relay/channel"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/relay/helper"
+	"veloera/service"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const structuredOutputToolName = "structured_output"
+
+// getStructuredOutputMode 请求使用了 response_format 且当前渠道需要模拟时返回模拟方式
+func getStructuredOutputMode(info *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) (string, bool) {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions || textRequest.ResponseFormat == nil {
+		return "", false
+	}
+	format := textRequest.ResponseFormat
+	if format.Type != "json_object" && !(format.Type == "json_schema" && format.JsonSchema != nil) {
+		return "", false
+	}
+	channelMode, _ := info.ChannelSetting[constant.ChannelSettingStructuredOutput].(string)
+	mode := operation_setting.GetStructuredOutputMode(info.ChannelType, channelMode)
+	if mode == operation_setting.StructuredOutputNative {
+		return "", false
+	}
+	// json_object 没有可用作工具参数的 schema，只能通过提示词约束
+	if format.Type == "json_object" {
+		mode = operation_setting.StructuredOutputPrompt
+	}
+	return mode, true
+}
+
+// buildStructuredOutputRequest 去掉 response_format，改为提示词说明或强制调用的工具
+func buildStructuredOutputRequest(textRequest *dto.GeneralOpenAIRequest, mode string) *dto.GeneralOpenAIRequest {
+	request := *textRequest
+	request.ResponseFormat = nil
+	request.Stream = false
+	request.StreamOptions = nil
+	request.Messages = append([]dto.Message(nil), textRequest.Messages...)
+
+	format := textRequest.ResponseFormat
+	if mode == operation_setting.StructuredOutputTool {
+		request.Tools = []dto.ToolCallRequest{
+			{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        structuredOutputToolName,
+					Description: format.JsonSchema.Description,
+					Parameters:  format.JsonSchema.Schema,
+				},
+			},
+		}
+		request.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": structuredOutputToolName},
+		}
+		return &request
+	}
+
+	var instruction string
+	if format.Type == "json_schema" {
+		schema, _ := json.Marshal(format.JsonSchema.Schema)
+		instruction = "You must respond with a single JSON value that conforms to the following JSON Schema. " +
+			"Do not wrap it in markdown code fences and do not add any text before or after it.\n" +
+			"JSON Schema:\n" + string(schema)
+	} else {
+		instruction = "You must respond with a single valid JSON object. " +
+			"Do not wrap it in markdown code fences and do not add any text before or after it."
+	}
+	// 部分上游只接受位于开头的系统消息，已有系统提示词时追加到其后
+	if len(request.Messages) > 0 && request.Messages[0].Role == "system" && request.Messages[0].IsStringContent() {
+		system := request.Messages[0]
+		system.SetStringContent(system.StringContent() + "\n\n" + instruction)
+		request.Messages[0] = system
+	} else {
+		system := dto.Message{Role: "system"}
+		system.SetStringContent(instruction)
+		request.Messages = append([]dto.Message{system}, request.Messages...)
+	}
+	return &request
+}
+
+// extractStructuredOutput 从上游响应中取出 JSON 文本，工具模式优先使用工具调用的参数
+func extractStructuredOutput(response *dto.OpenAITextResponse, mode string) string {
+	if len(response.Choices) == 0 {
+		return ""
+	}
+	message := response.Choices[0].Message
+	if mode == operation_setting.StructuredOutputTool {
+		for _, toolCall := range message.ParseToolCalls() {
+			if toolCall.Function.Arguments != "" {
+				return toolCall.Function.Arguments
+			}
+		}
+	}
+	content := strings.TrimSpace(message.StringContent())
+	// 部分模型仍会输出 ```json 代码块或在 JSON 前后附加说明
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+		content = strings.TrimSpace(content)
+	}
+	if json.Valid([]byte(content)) {
+		return content
+	}
+	start := strings.IndexAny(content, "{[")
+	end := strings.LastIndexAny(content, "}]")
+	if start >= 0 && end > start {
+		return content[start : end+1]
+	}
+	return content
+}
+
+func validateStructuredOutput(content string, format *dto.ResponseFormat) (string, error) {
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return "", fmt.Errorf("output is not valid JSON: %s", err.Error())
+	}
+	if format.Type == "json_object" {
+		if _, ok := value.(map[string]any); !ok {
+			return "", errors.New("output is not a JSON object")
+		}
+	} else if err := service.ValidateJSONSchema(value, format.JsonSchema.Schema); err != nil {
+		return "", err
+	}
+	// 统一输出为紧凑格式
+	compact, _ := json.Marshal(value)
+	return string(compact), nil
+}
+
+// relayStructuredOutput 以非流式请求上游并校验输出，不符合要求时把错误反馈给模型重试，
+// 最终按客户端请求的方式返回标准的 OpenAI 响应，所有尝试的用量累加后计费
+func relayStructuredOutput(c *gin.Context, adaptor channel.Adaptor, info *relaycommon.RelayInfo,
+	textRequest *dto.GeneralOpenAIRequest, mode string) (*dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	clientStream := textRequest.Stream
+	info.IsStream = false
+	request := buildStructuredOutputRequest(textRequest, mode)
+	maxRetries := operation_setting.GetStructuredOutputSetting().MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	totalUsage := &dto.Usage{}
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		response, usage, openaiErr := doStructuredOutputRequest(c, adaptor, info, request)
+		if openaiErr != nil {
+			return nil, openaiErr
+		}
+		if usage != nil {
+			totalUsage.PromptTokens += usage.PromptTokens
+			totalUsage.CompletionTokens += usage.CompletionTokens
+			totalUsage.TotalTokens += usage.TotalTokens
+			totalUsage.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+		}
+
+		raw := extractStructuredOutput(response, mode)
+		content, err := validateStructuredOutput(raw, textRequest.ResponseFormat)
+		if err == nil {
+			writeStructuredOutputResponse(c, info, response, content, totalUsage, clientStream)
+			return totalUsage, nil
+		}
+		lastErr = err
+		common.LogWarn(c, fmt.Sprintf("structured output validation failed (attempt %d): %s", attempt+1, err.Error()))
+
+		assistant := dto.Message{Role: "assistant"}
+		assistant.SetStringContent(raw)
+		feedback := dto.Message{Role: "user"}
+		feedback.SetStringContent("The previous response is invalid: " + err.Error() +
+			". Respond again with only the corrected JSON.")
+		request.Messages = append(request.Messages, assistant, feedback)
+	}
+	return nil, service.OpenAIErrorWrapperLocal(fmt.Errorf("structured output does not match response_format: %s", lastErr.Error()),
+		"structured_output_validation_failed", http.StatusBadGateway)
+}
+
+func doStructuredOutputRequest(c *gin.Context, adaptor channel.Adaptor, info *relaycommon.RelayInfo,
+	request *dto.GeneralOpenAIRequest) (*dto.OpenAITextResponse, *dto.Usage, *dto.OpenAIErrorWithStatusCode) {
+	requestBody, openaiErr := convertTextRequestBody(c, adaptor, info, request)
+	if openaiErr != nil {
+		return nil, nil, openaiErr
+	}
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if err != nil {
+		return nil, nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	httpResp, _ := resp.(*http.Response)
+	if httpResp != nil && httpResp.StatusCode != http.StatusOK {
+		return nil, nil, service.RelayErrorHandler(httpResp, false)
+	}
+
+	// 渠道处理器直接写出响应，这里先写入缓冲区，校验通过后再返回给客户端
+	writer := &bufferedResponseWriter{ResponseWriter: c.Writer, header: make(http.Header)}
+	c.Writer = writer
+	usage, openaiErr := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = writer.ResponseWriter
+	if openaiErr != nil {
+		return nil, nil, openaiErr
+	}
+	var response dto.OpenAITextResponse
+	if err := json.Unmarshal(writer.body.Bytes(), &response); err != nil {
+		return nil, nil, service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return nil, nil, &dto.OpenAIErrorWithStatusCode{Error: *response.Error, StatusCode: http.StatusInternalServerError}
+	}
+	u, _ := usage.(*dto.Usage)
+	return &response, u, nil
+}
+
+func writeStructuredOutputResponse(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse,
+	content string, usage *dto.Usage, stream bool) {
+	if response.Id == "" {
+		response.Id = helper.GetResponseID(c)
+	}
+	if response.Created == 0 {
+		response.Created = common.GetTimestamp()
+	}
+	if response.Model == "" {
+		response.Model = info.UpstreamModelName
+	}
+	if !stream {
+		message := dto.Message{Role: "assistant"}
+		message.SetStringContent(content)
+		response.Object = "chat.completion"
+		response.Choices = []dto.OpenAITextResponseChoice{{Index: 0, Message: message, FinishReason: "stop"}}
+		response.Usage = *usage
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	helper.SetEventStreamHeaders(c)
+	info.SetFirstResponseTime()
+	chunk := dto.ChatCompletionsStreamResponse{
+		Id:      response.Id,
+		Object:  "chat.completion.chunk",
+		Created: response.Created,
+		Model:   response.Model,
+		Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: 0}},
+	}
+	chunk.Choices[0].Delta.Role = "assistant"
+	chunk.Choices[0].Delta.SetContentString(content)
+	_ = helper.ObjectData(c, chunk)
+	_ = helper.ObjectData(c, helper.GenerateStopResponse(response.Id, response.Created, response.Model, "stop"))
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(response.Id, response.Created, response.Model, *usage))
+	}
+	helper.Done(c)
+}
+
+// bufferedResponseWriter 暂存渠道处理器写出的响应头和响应体
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedResponseWriter) Flush() {}
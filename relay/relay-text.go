@@ -14,6 +14,7 @@ import (
 	"veloera/constant"
 	"veloera/dto"
 	"veloera/model"
+	"veloera/relay/channel"
 	gemini "veloera/relay/channel/gemini"
 	openai "veloera/relay/channel/openai"
 	relaycommon "veloera/relay/common"
@@ -99,6 +100,10 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 	}
 
+	if err = checkRequestGuardrail(c, textRequest, relayInfo); err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "guardrail_blocked", http.StatusBadRequest)
+	}
+
 	err = helper.ModelMappedHelper(c, relayInfo)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
@@ -157,6 +162,21 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		relayInfo.ShouldIncludeUsage = true
 	}
 
+	if mode, ok := getStructuredOutputMode(relayInfo, textRequest); ok {
+		return relayStructuredOutputText(c, relayInfo, textRequest, mode, preConsumedQuota, userQuota, priceData)
+	}
+
+	// 模拟工具调用时由 toolEmulation 改写渠道处理器写出的响应
+	var toolEmulation *toolEmulationWriter
+	if shouldEmulateTools(relayInfo, textRequest) {
+		textRequest = buildToolEmulationRequest(textRequest)
+		toolEmulation = newToolEmulationWriter(c.Writer)
+		c.Writer = toolEmulation
+		defer func() {
+			c.Writer = toolEmulation.ResponseWriter
+		}()
+	}
+
 	streamSupport := ""
 	if v, ok := relayInfo.ChannelSetting[constant.ChannelSettingStreamSupport]; ok {
 		if str, ok2 := v.(string); ok2 {
@@ -174,6 +194,10 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		stopHeartbeat = helper.StartWaitingHeartbeat(c, 5*time.Second)
 	}
 
+	if !pseudoStream && toolEmulation == nil && shouldEnableStreamFailover(c, relayInfo) {
+		relayInfo.StreamFailover = &relaycommon.StreamFailoverInfo{}
+	}
+
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
@@ -181,42 +205,20 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
 
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled {
+	// 脱敏策略生效时不能直接透传原始请求体
+	piiVault := redactRequestPII(c, textRequest, relayInfo)
+	defer service.FlushPIIVault(c)
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled && piiVault == nil && toolEmulation == nil {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
-		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
-		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
-		}
-		jsonData, err := json.Marshal(convertedRequest)
-		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
-		}
-
-		// apply param override
-		if len(relayInfo.ParamOverride) > 0 {
-			reqMap := make(map[string]interface{})
-			err = json.Unmarshal(jsonData, &reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
-			}
-			for key, value := range relayInfo.ParamOverride {
-				reqMap[key] = value
-			}
-			jsonData, err = json.Marshal(reqMap)
-			if err != nil {
-				return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
-			}
-		}
-
-		if common.DebugEnabled {
-			println("requestBody: ", string(jsonData))
+		requestBody, openaiErr = convertTextRequestBody(c, adaptor, relayInfo, textRequest)
+		if openaiErr != nil {
+			return openaiErr
 		}
-		requestBody = bytes.NewBuffer(jsonData)
 	}
 
 	var httpResp *http.Response
@@ -265,9 +267,24 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
+	if toolEmulation != nil {
+		toolEmulation.Finish()
+	}
+
+	if service.IsHedgeLoser(c) {
+		// 其他渠道已经返回给用户，本次结果不计费
+		returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		if pseudoStream && stopHeartbeat != nil {
+			stopHeartbeat()
+		}
+		return nil
+	}
 
 	if strings.HasPrefix(relayInfo.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	} else if relayInfo.StreamFailover != nil && relayInfo.StreamFailover.Interrupted {
+		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "流式响应中断，切换渠道续写")
+		continueInterruptedStream(c, textRequest, relayInfo)
 	} else {
 		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	}
@@ -277,6 +294,62 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	return nil
 }
 
+// relayStructuredOutputText 模拟结构化输出的请求不走流式与续写逻辑，校验通过后按所有尝试的用量计费
+func relayStructuredOutputText(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest, mode string,
+	preConsumedQuota int, userQuota int, priceData helper.PriceData) *dto.OpenAIErrorWithStatusCode {
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+	redactRequestPII(c, textRequest, relayInfo)
+	defer service.FlushPIIVault(c)
+	usage, openaiErr := relayStructuredOutput(c, adaptor, relayInfo, textRequest, mode)
+	if openaiErr != nil {
+		service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return openaiErr
+	}
+	if service.IsHedgeLoser(c) {
+		returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		return nil
+	}
+	postConsumeQuota(c, relayInfo, usage, preConsumedQuota, userQuota, priceData, fmt.Sprintf("结构化输出模拟（%s）", mode))
+	return nil
+}
+
+// convertTextRequestBody 将请求转换为渠道格式并应用参数覆盖
+func convertTextRequestBody(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) (io.Reader, *dto.OpenAIErrorWithStatusCode) {
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+
+	// apply param override
+	if len(relayInfo.ParamOverride) > 0 {
+		reqMap := make(map[string]interface{})
+		err = json.Unmarshal(jsonData, &reqMap)
+		if err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
+		}
+		for key, value := range relayInfo.ParamOverride {
+			reqMap[key] = value
+		}
+		jsonData, err = json.Marshal(reqMap)
+		if err != nil {
+			return nil, service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
+		}
+	}
+
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+	return bytes.NewBuffer(jsonData), nil
+}
+
 func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (int, error) {
 	var promptTokens int
 	var err error
@@ -313,6 +386,41 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 	return words, err
 }
 
+// checkRequestGuardrail 对请求执行输入方向的护栏策略，脱敏结果直接写回请求
+func checkRequestGuardrail(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) error {
+	pipeline := service.NewGuardrailPipeline(c, service.GuardrailDirectionInput)
+	if pipeline == nil {
+		return nil
+	}
+	var err error
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions:
+		err = pipeline.CheckMessages(c, textRequest.Messages)
+	case relayconstant.RelayModeCompletions:
+		textRequest.Prompt, err = pipeline.CheckInput(c, textRequest.Prompt)
+	case relayconstant.RelayModeModerations, relayconstant.RelayModeEmbeddings:
+		textRequest.Input, err = pipeline.CheckInput(c, textRequest.Input)
+	}
+	return err
+}
+
+// redactRequestPII 按渠道的脱敏策略将请求中的个人信息替换为占位符，响应中的占位符在写出时还原
+func redactRequestPII(c *gin.Context, textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) *service.PIIVault {
+	vault := service.NewPIIVault(c)
+	if vault != nil {
+		switch info.RelayMode {
+		case relayconstant.RelayModeChatCompletions:
+			vault.RedactMessages(textRequest.Messages)
+		case relayconstant.RelayModeCompletions:
+			textRequest.Prompt = vault.RedactInput(textRequest.Prompt)
+		case relayconstant.RelayModeModerations, relayconstant.RelayModeEmbeddings:
+			textRequest.Input = vault.RedactInput(textRequest.Input)
+		}
+	}
+	service.UsePIIVault(c, vault)
+	return vault
+}
+
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
 	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
@@ -322,6 +430,22 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	if userQuota <= 0 {
 		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	// 额度用尽的令牌不能再使用模型额度
+	if !relayInfo.TokenUnlimited && !relayInfo.IsPlayground && c.GetInt("token_quota") <= 0 {
+		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
+	}
+	// 有可用于该模型的模型额度时，按模型额度抵扣后再检查用户额度；实时会话按用量分段结算，不使用模型额度
+	if creditBalance := model.GetModelCreditBalance(relayInfo.UserId, relayInfo.OriginModelName); creditBalance > 0 && relayInfo.RelayMode != relayconstant.RelayModeRealtime {
+		if creditBalance >= preConsumedQuota {
+			preConsumedQuota = 0
+		} else {
+			preConsumedQuota -= creditBalance
+		}
+		relayInfo.UserQuota = userQuota
+		if preConsumedQuota == 0 {
+			return 0, userQuota, nil
+		}
+	}
 	if userQuota-preConsumedQuota < 0 {
 		return 0, 0, service.OpenAIErrorWrapperLocal(fmt.Errorf("chat pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(preConsumedQuota)), "insufficient_user_quota", http.StatusForbidden)
 	}
@@ -353,6 +477,7 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 		}
+		model.DeltaSettleCreditLots(relayInfo.UserId, preConsumedQuota)
 	}
 	return preConsumedQuota, userQuota, nil
 }
@@ -383,8 +508,12 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	cacheTokens := usage.PromptTokensDetails.CachedTokens
+	// 上游为 Claude 时缓存写入单独计费，promptTokens 同样包含这部分
+	cacheCreationTokens := usage.PromptTokensDetails.CachedCreationTokens
 	completionTokens := usage.CompletionTokens
 	modelName := relayInfo.OriginModelName
+	appliedRule := priceData.ApplyPricingRule(promptTokens)
+	service.RecordSessionAffinity(ctx, relayInfo, promptTokens, cacheTokens)
 
 	tokenName := ctx.GetString("token_name")
 	completionRatio := priceData.CompletionRatio
@@ -396,9 +525,11 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	// Convert values to decimal for precise calculation
 	dPromptTokens := decimal.NewFromInt(int64(promptTokens))
 	dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
+	dCacheCreationTokens := decimal.NewFromInt(int64(cacheCreationTokens))
 	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
 	dCompletionRatio := decimal.NewFromFloat(completionRatio)
 	dCacheRatio := decimal.NewFromFloat(cacheRatio)
+	dCacheCreationRatio := decimal.NewFromFloat(priceData.CacheCreationRatio)
 	dModelRatio := decimal.NewFromFloat(modelRatio)
 	dGroupRatio := decimal.NewFromFloat(groupRatio)
 	dModelPrice := decimal.NewFromFloat(modelPrice)
@@ -408,12 +539,14 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 
 	var quotaCalculateDecimal decimal.Decimal
 	if !priceData.UsePrice {
-		nonCachedTokens := dPromptTokens.Sub(dCacheTokens)
+		nonCachedTokens := dPromptTokens.Sub(dCacheTokens).Sub(dCacheCreationTokens)
 		cachedTokensWithRatio := dCacheTokens.Mul(dCacheRatio)
-		promptQuota := nonCachedTokens.Add(cachedTokensWithRatio)
+		cacheCreationTokensWithRatio := dCacheCreationTokens.Mul(dCacheCreationRatio)
+		promptQuota := nonCachedTokens.Add(cachedTokensWithRatio).Add(cacheCreationTokensWithRatio)
 		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
 
 		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
+		quotaCalculateDecimal = helper.PricingRuleQuota(appliedRule, quotaCalculateDecimal, usage, groupRatio)
 
 		if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
 			quotaCalculateDecimal = decimal.NewFromInt(1)
@@ -445,13 +578,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
 
-	quotaDelta := quota - preConsumedQuota
-	if quotaDelta != 0 {
-		err := service.PostConsumeQuota(relayInfo, quotaDelta, preConsumedQuota, true)
-		if err != nil {
-			common.LogError(ctx, "error consuming token remain quota: "+err.Error())
-		}
-	}
+	service.SettleConsumeQuota(ctx, relayInfo, modelName, quota, preConsumedQuota)
 
 	logModel := modelName
 	if strings.HasPrefix(logModel, "gpt-4-gizmo") {
@@ -466,6 +593,15 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		logContent += ", " + extraContent
 	}
 	other := service.GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, cacheTokens, cacheRatio, modelPrice)
-	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel,
-		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+	if cacheCreationTokens > 0 {
+		other["cache_creation_tokens"] = cacheCreationTokens
+		other["cache_creation_ratio"] = priceData.CacheCreationRatio
+	}
+	if appliedRule != nil {
+		other["pricing_rule"] = appliedRule
+	}
+	cost := service.CalculateChannelCost(ctx, relayInfo.UpstreamModelName, promptTokens-cacheTokens-cacheCreationTokens, cacheTokens, cacheCreationTokens, completionTokens, quota, groupRatio)
+	consumeLog := model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel,
+		tokenName, quota, cost, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+	service.CheckAutoRefund(relayInfo, consumeLog, completionTokens)
 }
@@ -0,0 +1,447 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	toolCallStartTag = "<tool_call>"
+	toolCallEndTag   = "</tool_call>"
+)
+
+// shouldEmulateTools 请求携带工具定义或工具调用历史，且当前渠道需要模拟函数调用
+func shouldEmulateTools(info *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) bool {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions {
+		return false
+	}
+	hasTools := len(textRequest.Tools) > 0
+	for i := range textRequest.Messages {
+		if textRequest.Messages[i].Role == "tool" || textRequest.Messages[i].ToolCalls != nil {
+			hasTools = true
+			break
+		}
+	}
+	if !hasTools {
+		return false
+	}
+	return operation_setting.ShouldEmulateTools(info.ChannelType, info.UpstreamModelName, info.ChannelSetting[constant.ChannelSettingToolEmulation])
+}
+
+type emulatedToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type emulatedTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// buildToolEmulationRequest 把工具定义写入系统提示词，并把历史中的工具调用和工具结果转换为普通文本消息
+func buildToolEmulationRequest(textRequest *dto.GeneralOpenAIRequest) *dto.GeneralOpenAIRequest {
+	request := *textRequest
+	request.Tools = nil
+	request.ToolChoice = nil
+	request.Messages = make([]dto.Message, 0, len(textRequest.Messages)+1)
+
+	toolNames := make(map[string]string)
+	for _, message := range textRequest.Messages {
+		switch {
+		case message.Role == "assistant" && message.ToolCalls != nil:
+			var content strings.Builder
+			content.WriteString(message.StringContent())
+			for _, toolCall := range message.ParseToolCalls() {
+				toolNames[toolCall.ID] = toolCall.Function.Name
+				arguments := json.RawMessage(toolCall.Function.Arguments)
+				if !json.Valid(arguments) {
+					arguments, _ = json.Marshal(toolCall.Function.Arguments)
+				}
+				call, _ := json.Marshal(emulatedToolCall{Name: toolCall.Function.Name, Arguments: arguments})
+				if content.Len() > 0 {
+					content.WriteString("\n")
+				}
+				content.WriteString(toolCallStartTag + "\n" + string(call) + "\n" + toolCallEndTag)
+			}
+			message.ToolCalls = nil
+			message.SetStringContent(content.String())
+			request.Messages = append(request.Messages, message)
+		case message.Role == "tool":
+			response := fmt.Sprintf("<tool_response name=%q>\n%s\n</tool_response>", toolNames[message.ToolCallId], message.StringContent())
+			// 连续的工具结果合并为一条用户消息，避免上游要求消息角色交替
+			if last := len(request.Messages) - 1; last >= 0 && request.Messages[last].Role == "user" &&
+				strings.HasPrefix(request.Messages[last].StringContent(), "<tool_response") {
+				request.Messages[last].SetStringContent(request.Messages[last].StringContent() + "\n" + response)
+				continue
+			}
+			user := dto.Message{Role: "user"}
+			user.SetStringContent(response)
+			request.Messages = append(request.Messages, user)
+		default:
+			request.Messages = append(request.Messages, message)
+		}
+	}
+
+	instruction := buildToolInstruction(textRequest.Tools, textRequest.ToolChoice)
+	if instruction == "" {
+		return &request
+	}
+	if len(request.Messages) > 0 && request.Messages[0].Role == "system" && request.Messages[0].IsStringContent() {
+		request.Messages[0].SetStringContent(request.Messages[0].StringContent() + "\n\n" + instruction)
+	} else {
+		system := dto.Message{Role: "system"}
+		system.SetStringContent(instruction)
+		request.Messages = append([]dto.Message{system}, request.Messages...)
+	}
+	return &request
+}
+
+func buildToolInstruction(tools []dto.ToolCallRequest, toolChoice any) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	var required string
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "none" {
+			return ""
+		}
+		if choice == "required" {
+			required = "You must call at least one tool."
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				required = fmt.Sprintf("You must call the tool %q.", name)
+			}
+		}
+	}
+
+	var instruction strings.Builder
+	instruction.WriteString("You have access to the following tools:\n")
+	for _, tool := range tools {
+		definition, _ := json.Marshal(emulatedTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+		instruction.Write(definition)
+		instruction.WriteString("\n")
+	}
+	instruction.WriteString("\nTo call a tool, reply with one block per call in exactly this format and nothing else:\n" +
+		toolCallStartTag + "\n{\"name\": \"<tool name>\", \"arguments\": {<arguments as a JSON object>}}\n" + toolCallEndTag + "\n" +
+		"The results will be sent back inside <tool_response> blocks. If no tool is needed, answer the user directly.")
+	if required != "" {
+		instruction.WriteString("\n" + required)
+	}
+	return instruction.String()
+}
+
+// parseEmulatedToolCall 解析 <tool_call> 块中的 JSON，失败时返回 false，由调用方按普通文本处理
+func parseEmulatedToolCall(text string, index int) (dto.ToolCallResponse, bool) {
+	var call emulatedToolCall
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &call); err != nil || call.Name == "" {
+		return dto.ToolCallResponse{}, false
+	}
+	arguments := "{}"
+	if len(call.Arguments) > 0 && string(call.Arguments) != "null" {
+		// 部分模型会把参数输出为 JSON 字符串
+		var s string
+		if json.Unmarshal(call.Arguments, &s) == nil {
+			arguments = s
+		} else {
+			arguments = string(call.Arguments)
+		}
+	}
+	toolCall := dto.ToolCallResponse{
+		ID:   fmt.Sprintf("call_%s", common.GetUUID()),
+		Type: "function",
+		Function: dto.FunctionResponse{
+			Name:      call.Name,
+			Arguments: arguments,
+		},
+	}
+	toolCall.SetIndex(index)
+	return toolCall, true
+}
+
+// extractEmulatedToolCalls 从完整的回复中取出所有工具调用，返回剩余的文本
+func extractEmulatedToolCalls(content string) (string, []dto.ToolCallResponse) {
+	var text strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	for {
+		start := strings.Index(content, toolCallStartTag)
+		if start < 0 {
+			text.WriteString(content)
+			break
+		}
+		rest := content[start+len(toolCallStartTag):]
+		end := strings.Index(rest, toolCallEndTag)
+		body := rest
+		if end >= 0 {
+			body = rest[:end]
+		}
+		toolCall, ok := parseEmulatedToolCall(body, len(toolCalls))
+		if !ok {
+			text.WriteString(content)
+			break
+		}
+		text.WriteString(content[:start])
+		toolCalls = append(toolCalls, toolCall)
+		if end < 0 {
+			break
+		}
+		content = rest[end+len(toolCallEndTag):]
+	}
+	return strings.TrimSpace(text.String()), toolCalls
+}
+
+// toolEmulationWriter 改写渠道处理器写出的响应：流式响应逐个改写 SSE 数据块，
+// 非流式响应先缓存，在 Finish 时整体改写后返回
+type toolEmulationWriter struct {
+	gin.ResponseWriter
+	lock   sync.Mutex
+	status int
+	body   bytes.Buffer
+	line   bytes.Buffer
+
+	// 流式解析状态
+	pending    string
+	inToolCall bool
+	toolCalls  int
+}
+
+func newToolEmulationWriter(writer gin.ResponseWriter) *toolEmulationWriter {
+	return &toolEmulationWriter{ResponseWriter: writer}
+}
+
+func (w *toolEmulationWriter) isStream() bool {
+	return strings.HasPrefix(w.ResponseWriter.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *toolEmulationWriter) WriteHeader(code int) {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *toolEmulationWriter) WriteHeaderNow() {
+	if w.isStream() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *toolEmulationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *toolEmulationWriter) Write(data []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.isStream() {
+		return w.body.Write(data)
+	}
+	w.line.Write(data)
+	for {
+		buffered := w.line.Bytes()
+		i := bytes.IndexByte(buffered, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(buffered[:i])
+		w.line.Next(i + 1)
+		if err := w.writeStreamLine(strings.TrimSuffix(line, "\r")); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *toolEmulationWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *toolEmulationWriter) writeStreamLine(line string) error {
+	if !strings.HasPrefix(line, "data:") {
+		_, err := w.ResponseWriter.WriteString(line + "\n")
+		return err
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	var chunk dto.ChatCompletionsStreamResponse
+	if data == "[DONE]" || json.Unmarshal([]byte(data), &chunk) != nil || len(chunk.Choices) == 0 {
+		_, err := w.ResponseWriter.WriteString(line + "\n")
+		return err
+	}
+
+	choice := &chunk.Choices[0]
+	w.pending += choice.Delta.GetContentString()
+	finished := choice.FinishReason != nil && *choice.FinishReason != ""
+	text, toolCalls := w.consume(finished)
+	if w.toolCalls+len(toolCalls) > 0 && strings.TrimSpace(text) == "" {
+		// 已经输出工具调用后，模型附带的空白内容不再返回
+		text = ""
+	}
+	w.toolCalls += len(toolCalls)
+	choice.Delta.Content = nil
+	if finished && w.toolCalls > 0 && *choice.FinishReason == "stop" {
+		*choice.FinishReason = "tool_calls"
+	}
+
+	if len(toolCalls) > 0 {
+		// 工具调用和之前的文本单独作为一个数据块返回，结束原因和用量留在原数据块中
+		callChunk := chunk
+		callChunk.Usage = nil
+		callChunk.Choices = []dto.ChatCompletionsStreamResponseChoice{{Index: choice.Index}}
+		callChunk.Choices[0].Delta.Role = choice.Delta.Role
+		callChunk.Choices[0].Delta.ToolCalls = toolCalls
+		if text != "" {
+			callChunk.Choices[0].Delta.SetContentString(text)
+			text = ""
+		}
+		choice.Delta.Role = ""
+		if err := w.writeStreamChunk(callChunk); err != nil {
+			return err
+		}
+	}
+	if text != "" {
+		choice.Delta.SetContentString(text)
+	}
+	if choice.Delta.Content == nil && choice.Delta.Role == "" && choice.Delta.GetReasoningContent() == "" &&
+		!finished && chunk.Usage == nil {
+		return nil
+	}
+	return w.writeStreamChunk(chunk)
+}
+
+func (w *toolEmulationWriter) writeStreamChunk(chunk dto.ChatCompletionsStreamResponse) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = w.ResponseWriter.WriteString("data: " + string(data) + "\n")
+	return err
+}
+
+// consume 从已接收的文本中取出可以返回的普通文本和完整的工具调用，
+// 可能是工具调用开头的内容暂不返回，finished 时输出全部剩余内容
+func (w *toolEmulationWriter) consume(finished bool) (string, []dto.ToolCallResponse) {
+	var text strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	for {
+		if w.inToolCall {
+			end := strings.Index(w.pending, toolCallEndTag)
+			if end < 0 {
+				if !finished {
+					break
+				}
+				// 模型没有输出结束标签，能解析时仍按工具调用处理
+				if toolCall, ok := parseEmulatedToolCall(w.pending, w.toolCalls+len(toolCalls)); ok {
+					toolCalls = append(toolCalls, toolCall)
+				} else {
+					text.WriteString(toolCallStartTag + w.pending)
+				}
+				w.pending = ""
+				w.inToolCall = false
+				break
+			}
+			if toolCall, ok := parseEmulatedToolCall(w.pending[:end], w.toolCalls+len(toolCalls)); ok {
+				toolCalls = append(toolCalls, toolCall)
+			} else {
+				text.WriteString(toolCallStartTag + w.pending[:end+len(toolCallEndTag)])
+			}
+			w.pending = w.pending[end+len(toolCallEndTag):]
+			w.inToolCall = false
+			continue
+		}
+		start := strings.Index(w.pending, toolCallStartTag)
+		if start >= 0 {
+			text.WriteString(w.pending[:start])
+			w.pending = w.pending[start+len(toolCallStartTag):]
+			w.inToolCall = true
+			continue
+		}
+		if finished {
+			text.WriteString(w.pending)
+			w.pending = ""
+			break
+		}
+		keep := partialTagSuffix(w.pending, toolCallStartTag)
+		text.WriteString(w.pending[:len(w.pending)-keep])
+		w.pending = w.pending[len(w.pending)-keep:]
+		break
+	}
+	return text.String(), toolCalls
+}
+
+// partialTagSuffix 返回 s 末尾可能是 tag 开头部分的长度
+func partialTagSuffix(s string, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// Finish 改写缓存的非流式响应并写回客户端，流式响应已在写出时改写
+func (w *toolEmulationWriter) Finish() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.isStream() || w.body.Len() == 0 {
+		return
+	}
+	body := w.body.Bytes()
+	var response dto.OpenAITextResponse
+	if err := json.Unmarshal(body, &response); err == nil && response.Error == nil && len(response.Choices) > 0 {
+		changed := false
+		for i := range response.Choices {
+			choice := &response.Choices[i]
+			text, toolCalls := extractEmulatedToolCalls(choice.Message.StringContent())
+			if len(toolCalls) == 0 {
+				continue
+			}
+			for j := range toolCalls {
+				toolCalls[j].Index = nil
+			}
+			if text == "" {
+				choice.Message.SetNullContent()
+			} else {
+				choice.Message.SetStringContent(text)
+			}
+			choice.Message.SetToolCalls(toolCalls)
+			choice.FinishReason = "tool_calls"
+			changed = true
+		}
+		if changed {
+			if rewritten, err := json.Marshal(response); err == nil {
+				body = rewritten
+			}
+		}
+	}
+	w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(status)
+	_, _ = w.ResponseWriter.Write(body)
+	w.body.Reset()
+}
@@ -1,7 +1,6 @@
 package relay
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -9,6 +8,7 @@ import (
 	"veloera/common"
 	"veloera/dto"
 	relaycommon "veloera/relay/common"
+	"veloera/relay/helper"
 	"veloera/service"
 	"veloera/setting"
 	"veloera/setting/operation_setting"
@@ -17,58 +17,26 @@ import (
 func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	relayInfo := relaycommon.GenRelayInfoWs(c, ws)
 
-	// get & validate textRequest 获取并验证文本请求
-	//realtimeEvent, err := getAndValidateWssRequest(c, ws)
-	//if err != nil {
-	//	common.LogError(c, fmt.Sprintf("getAndValidateWssRequest failed: %s", err.Error()))
-	//	return service.OpenAIErrorWrapperLocal(err, "invalid_text_request", http.StatusBadRequest)
-	//}
-
 	// map model name
-	modelMapping := c.GetString("model_mapping")
-	//isModelMapped := false
-	if modelMapping != "" && modelMapping != "{}" {
-		modelMap := make(map[string]string)
-		err := json.Unmarshal([]byte(modelMapping), &modelMap)
-		if err != nil {
-			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
-		}
-		if modelMap[relayInfo.OriginModelName] != "" {
-			relayInfo.UpstreamModelName = modelMap[relayInfo.OriginModelName]
-			// set upstream model name
-			//isModelMapped = true
-		}
+	err := helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
 	}
-	//relayInfo.UpstreamModelName = textRequest.Model
 	modelPrice, getModelPriceSuccess := operation_setting.GetModelPrice(relayInfo.UpstreamModelName, false)
 	groupRatio := setting.GetGroupRatio(relayInfo.Group)
 
 	var preConsumedQuota int
-	var ratio float64
+	var reserveQuota int
 	var modelRatio float64
-	//err := service.SensitiveWordsCheck(textRequest)
-
-	//if constant.ShouldCheckPromptSensitive() {
-	//	err = checkRequestSensitive(textRequest, relayInfo)
-	//	if err != nil {
-	//		return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
-	//	}
-	//}
-
-	//promptTokens, err := getWssPromptTokens(realtimeEvent, relayInfo)
-	//// count messages token error 计算promptTokens错误
-	//if err != nil {
-	//	return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
-	//}
-	//
 	if !getModelPriceSuccess {
-		preConsumedTokens := common.PreConsumedQuota
-		//if realtimeEvent.Session.MaxResponseOutputTokens != 0 {
-		//	preConsumedTokens = promptTokens + int(realtimeEvent.Session.MaxResponseOutputTokens)
-		//}
+		// 会话开始时预留一部分额度，之后随 response.done 增量结算
+		reserveTokens := operation_setting.GetRealtimeSetting().ReserveTokens
+		if reserveTokens <= 0 {
+			reserveTokens = common.PreConsumedQuota
+		}
 		modelRatio, _ = operation_setting.GetModelRatio(relayInfo.UpstreamModelName)
-		ratio = modelRatio * groupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
+		reserveQuota = int(float64(reserveTokens) * modelRatio * groupRatio)
+		preConsumedQuota = reserveQuota
 	} else {
 		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
 		relayInfo.UsePrice = true
@@ -80,10 +48,17 @@ func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWi
 		return openaiErr
 	}
 
+	var quotaSession *service.RealtimeQuotaSession
 	defer func() {
-		if openaiErr != nil {
-			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		if openaiErr == nil {
+			return
+		}
+		// 会话开始后预留额度可能已经用于结算或重新预留，只退还当前未使用的预留
+		if quotaSession != nil && !relayInfo.UsePrice {
+			quotaSession.Close()
+			return
 		}
+		returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
 	}()
 
 	adaptor := GetAdaptor(relayInfo.ApiType)
@@ -91,9 +66,6 @@ func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWi
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
 	}
 	adaptor.Init(relayInfo)
-	//var requestBody io.Reader
-	//firstWssRequest, _ := c.Get("first_wss_request")
-	//requestBody = bytes.NewBuffer(firstWssRequest.([]byte))
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, relayInfo, nil)
@@ -106,12 +78,22 @@ func WssHelper(c *gin.Context, ws *websocket.Conn) (openaiErr *dto.OpenAIErrorWi
 		defer relayInfo.TargetWs.Close()
 	}
 
+	quotaSession = service.NewRealtimeQuotaSession(c, relayInfo, preConsumedQuota, reserveQuota)
 	usage, openaiErr := adaptor.DoResponse(c, nil, relayInfo)
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
+	// 退还未用完的预留额度，实际扣费已在会话中增量完成
+	quotaSession.Close()
+	if relayInfo.UsePrice && preConsumedQuota == 0 {
+		// 额度充足时没有预扣，按次计费的模型在会话结束时扣费
+		err = service.PostConsumeQuota(relayInfo, int(modelPrice*common.QuotaPerUnit*groupRatio), 0, false)
+		if err != nil {
+			common.LogError(c, "error consuming realtime quota: "+err.Error())
+		}
+	}
 	service.PostWssConsumeQuota(c, relayInfo, relayInfo.UpstreamModelName, usage.(*dto.RealtimeUsage), preConsumedQuota,
 		userQuota, modelRatio, groupRatio, modelPrice, getModelPriceSuccess, "")
 	return nil
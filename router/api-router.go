@@ -1,6 +1,7 @@
 package router
 
 import (
+	"veloera/constant"
 	"veloera/controller"
 	"veloera/middleware"
 
@@ -40,9 +41,13 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.Login2FA)
+			userRoute.POST("/passkey/login/begin", middleware.CriticalRateLimit(), controller.PasskeyLoginBegin)
+			userRoute.POST("/passkey/login/finish", middleware.CriticalRateLimit(), controller.PasskeyLoginFinish)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
+			userRoute.POST("/stripe/webhook", controller.StripeWebhook)
 			userRoute.GET("/groups", controller.GetUserGroups)
 
 			selfRoute := userRoute.Group("/")
@@ -53,60 +58,114 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
-				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/token", middleware.StepUpAuth(), controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
-				selfRoute.POST("/pay", controller.RequestEpay)
+				selfRoute.GET("/model_credits", controller.GetSelfModelCredits)
+				selfRoute.GET("/credit_lots", controller.GetSelfCreditLots)
+				selfRoute.POST("/refund", controller.CreateRefundRequest)
+				selfRoute.GET("/refunds", controller.GetSelfRefundRequests)
+				selfRoute.GET("/subscriptions", controller.GetSelfSubscriptions)
+				selfRoute.GET("/subscription_plans", controller.GetAvailableSubscriptionPlans)
+				selfRoute.POST("/pay", controller.RequestPayment)
 				selfRoute.POST("/amount", controller.RequestAmount)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 				selfRoute.GET("/check_in_status", controller.CheckInStatus)
 				selfRoute.POST("/check_in", controller.CheckIn)
+				selfRoute.POST("/step_up", middleware.CriticalRateLimit(), controller.StepUp)
+				selfRoute.GET("/2fa", controller.GetTwoFAStatus)
+				selfRoute.POST("/2fa/setup", middleware.StepUpAuth(), controller.SetupTwoFA)
+				selfRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFA)
+				selfRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFA)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.ResetTwoFARecoveryCodes)
+				selfRoute.GET("/passkey", controller.GetPasskeys)
+				selfRoute.POST("/passkey/register/begin", middleware.StepUpAuth(), controller.PasskeyRegisterBegin)
+				selfRoute.POST("/passkey/register/finish", controller.PasskeyRegisterFinish)
+				selfRoute.DELETE("/passkey/:id", middleware.StepUpAuth(), controller.DeletePasskey)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				adminRoute.GET("/", middleware.PermissionAuth(constant.PermissionUsersRead), controller.GetAllUsers)
+				adminRoute.GET("/search", middleware.PermissionAuth(constant.PermissionUsersRead), controller.SearchUsers)
+				adminRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionUsersRead), controller.GetUser)
+				adminRoute.GET("/:id/credit_lots", middleware.PermissionAuth(constant.PermissionUsersRead), controller.GetUserCreditLots)
+				adminRoute.POST("/", middleware.PermissionAuth(constant.PermissionUsersManage), controller.CreateUser)
+				adminRoute.POST("/manage", middleware.PermissionAuth(constant.PermissionUsersManage), controller.ManageUser)
+				adminRoute.PUT("/", middleware.PermissionAuth(constant.PermissionUsersManage), controller.UpdateUser)
+				adminRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionUsersManage), controller.DeleteUser)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
+			optionRoute.GET("/", middleware.PermissionAuth(constant.PermissionOptionsRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.UpdateOption)
+			optionRoute.POST("/rest_model_ratio", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.ResetModelRatio)
+		}
+		configRoute := apiRouter.Group("/config")
+		{
+			configRoute.GET("/export", middleware.PermissionAuth(constant.PermissionOptionsRead), controller.ExportConfig)
+			configRoute.POST("/import", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.ImportConfig)
+		}
+		subscriptionPlanRoute := apiRouter.Group("/subscription_plan")
+		{
+			subscriptionPlanRoute.GET("/", middleware.PermissionAuth(constant.PermissionOptionsRead), controller.GetSubscriptionPlans)
+			subscriptionPlanRoute.POST("/", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.AddSubscriptionPlan)
+			subscriptionPlanRoute.PUT("/", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.UpdateSubscriptionPlan)
+			subscriptionPlanRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionOptionsWrite), middleware.StepUpAuth(), controller.DeleteSubscriptionPlan)
+		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(constant.PermissionRolesManage))
+		{
+			roleRoute.GET("/", controller.GetRoles)
+			roleRoute.GET("/permissions", controller.GetPermissions)
+			roleRoute.POST("/", middleware.StepUpAuth(), controller.AddRole)
+			roleRoute.PUT("/", middleware.StepUpAuth(), controller.UpdateRole)
+			roleRoute.DELETE("/:id", middleware.StepUpAuth(), controller.DeleteRole)
+			roleRoute.POST("/assign", middleware.StepUpAuth(), controller.AssignRole)
+		}
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.PermissionAuth(constant.PermissionAuditRead))
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+			auditRoute.GET("/verify", controller.VerifyAuditLogs)
+		}
+		refundRoute := apiRouter.Group("/refund")
+		refundRoute.Use(middleware.PermissionAuth(constant.PermissionRefundsManage))
+		{
+			refundRoute.GET("/", controller.GetRefundRequests)
+			refundRoute.GET("/channel_stats", controller.GetRefundChannelStats)
+			refundRoute.POST("/:id/approve", controller.ApproveRefundRequest)
+			refundRoute.POST("/:id/reject", controller.RejectRefundRequest)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+			channelRoute.GET("/", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.GetAllChannels)
+			channelRoute.GET("/search", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.SearchChannels)
+			channelRoute.GET("/models", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.EnabledListModels)
+			channelRoute.GET("/cache_stats", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.GetChannelCacheStats)
+			channelRoute.DELETE("/cache_stats", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.ResetChannelCacheStats)
+			channelRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.GetChannel)
+			channelRoute.GET("/:id/key", middleware.PermissionAuth(constant.PermissionChannelsKeys), middleware.StepUpAuth(), controller.GetChannelKey)
+			channelRoute.GET("/test", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.AddChannel)
+			channelRoute.PUT("/", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.FetchModels)
+			channelRoute.POST("/batch/tag", middleware.PermissionAuth(constant.PermissionChannelsWrite), controller.BatchSetChannelTag)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -119,31 +178,33 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/count-by-name", controller.CountRedemptionsByName)
-			redemptionRoute.DELETE("/delete-by-name", controller.DeleteRedemptionsByName)
-			redemptionRoute.PUT("/batch-disable", controller.BatchDisableRedemptions)
-			redemptionRoute.DELETE("/delete-disabled", controller.DeleteDisabledRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.SearchRedemptions)
+			redemptionRoute.GET("/campaigns", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.GetCampaignStats)
+			redemptionRoute.GET("/count-by-name", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.CountRedemptionsByName)
+			redemptionRoute.DELETE("/delete-by-name", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.DeleteRedemptionsByName)
+			redemptionRoute.PUT("/batch-disable", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.BatchDisableRedemptions)
+			redemptionRoute.DELETE("/delete-disabled", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.DeleteDisabledRedemptions)
+			redemptionRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.GetRedemption)
+			redemptionRoute.POST("/", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.AddRedemption)
+			redemptionRoute.PUT("/", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(constant.PermissionLogsDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", middleware.PermissionAuth(constant.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(constant.PermissionDataRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
+		dataRoute.GET("/margin", middleware.PermissionAuth(constant.PermissionDataRead), controller.GetMarginReport)
+		dataRoute.GET("/credit_liability", middleware.PermissionAuth(constant.PermissionDataRead), controller.GetCreditLiability)
 
 		logRoute.Use(middleware.CORS())
 		{
@@ -151,18 +212,18 @@ func SetApiRouter(router *gin.Engine) {
 
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(constant.PermissionGroupsRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllTask)
 		}
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"veloera/common"
 	"veloera/setting"
@@ -42,7 +43,15 @@ func DoWorkerRequest(req *WorkerRequest) (*http.Response, error) {
 	return http.Post(workerUrl, "application/json", bytes.NewBuffer(workerPayload))
 }
 
+// DoDownloadRequest 下载用户提供的 URL，地址需通过 ValidateFetchURL 的检查，重定向和 DNS 解析结果同样会被检查
 func DoDownloadRequest(originUrl string) (resp *http.Response, err error) {
+	u, err := url.Parse(originUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateFetchURL(u); err != nil {
+		return nil, err
+	}
 	if setting.EnableWorker() {
 		common.SysLog(fmt.Sprintf("downloading file from worker: %s", originUrl))
 		req := &WorkerRequest{
@@ -52,6 +61,6 @@ func DoDownloadRequest(originUrl string) (resp *http.Response, err error) {
 		return DoWorkerRequest(req)
 	} else {
 		common.SysLog(fmt.Sprintf("downloading from origin: %s", originUrl))
-		return http.Get(originUrl)
+		return GetSafeFetchClient().Get(originUrl)
 	}
 }
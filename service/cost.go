@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// ChannelCostPrice 渠道上游的模型成本价格，单位为美元
+type ChannelCostPrice struct {
+	// 每百万输入 token 的价格
+	Input float64 `json:"input"`
+	// 每百万输出 token 的价格
+	Output float64 `json:"output"`
+	// 每次请求的固定价格
+	Request float64 `json:"request"`
+	// 每百万缓存读取 token 的价格，未配置时按输入价格乘以模型的缓存倍率计算
+	CacheRead float64 `json:"cache_read"`
+	// 每百万缓存写入 token 的价格，未配置时按输入价格乘以模型的缓存创建倍率计算
+	CacheWrite float64 `json:"cache_write"`
+}
+
+func getChannelCostPrice(channelSetting map[string]interface{}, modelName string) (*ChannelCostPrice, bool) {
+	raw, ok := channelSetting[constant.ChannelSettingCostPrice]
+	if !ok {
+		return nil, false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+	prices := make(map[string]ChannelCostPrice)
+	if err = json.Unmarshal(data, &prices); err != nil {
+		common.SysError("failed to unmarshal channel cost price: " + err.Error())
+		return nil, false
+	}
+	price, ok := prices[modelName]
+	if !ok {
+		return nil, false
+	}
+	return &price, true
+}
+
+// CalculateChannelCost 计算本次请求在当前渠道上的上游成本（以额度为单位）。
+// promptTokens 为不含缓存读取和缓存写入的输入 token 数。
+// 优先使用渠道的模型价格表，其次使用成本倍率（作用于去掉分组倍率后的额度），都未配置时返回 0。
+func CalculateChannelCost(c *gin.Context, modelName string, promptTokens int, cacheTokens int, cacheCreationTokens int, completionTokens int, quota int, groupRatio float64) int {
+	channelSetting := c.GetStringMap("channel_setting")
+	if len(channelSetting) == 0 {
+		return 0
+	}
+	quotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	if price, ok := getChannelCostPrice(channelSetting, modelName); ok {
+		cacheRead := price.CacheRead
+		if cacheRead == 0 {
+			cacheRatio, _ := operation_setting.GetCacheRatio(modelName)
+			cacheRead = price.Input * cacheRatio
+		}
+		cacheWrite := price.CacheWrite
+		if cacheWrite == 0 {
+			cacheCreationRatio, _ := operation_setting.GetCreateCacheRatio(modelName)
+			cacheWrite = price.Input * cacheCreationRatio
+		}
+		million := decimal.NewFromInt(1000000)
+		cost := decimal.NewFromInt(int64(promptTokens)).Mul(decimal.NewFromFloat(price.Input))
+		cost = cost.Add(decimal.NewFromInt(int64(cacheTokens)).Mul(decimal.NewFromFloat(cacheRead)))
+		cost = cost.Add(decimal.NewFromInt(int64(cacheCreationTokens)).Mul(decimal.NewFromFloat(cacheWrite)))
+		cost = cost.Add(decimal.NewFromInt(int64(completionTokens)).Mul(decimal.NewFromFloat(price.Output))).Div(million)
+		cost = cost.Add(decimal.NewFromFloat(price.Request))
+		return int(cost.Mul(quotaPerUnit).Round(0).IntPart())
+	}
+	if v, ok := channelSetting[constant.ChannelSettingCostRatio]; ok {
+		costRatio, ok := v.(float64)
+		if !ok || costRatio <= 0 || groupRatio <= 0 {
+			return 0
+		}
+		cost := decimal.NewFromInt(int64(quota)).Div(decimal.NewFromFloat(groupRatio)).Mul(decimal.NewFromFloat(costRatio))
+		return int(cost.Round(0).IntPart())
+	}
+	return 0
+}
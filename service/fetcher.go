@@ -0,0 +1,254 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"veloera/constant"
+	"veloera/setting/system_setting"
+)
+
+// ErrFetchForbidden 下载地址被安全策略拒绝
+var ErrFetchForbidden = errors.New("fetch url is not allowed")
+
+const (
+	fetchCacheMaxEntriesPerHost = 32
+	fetchCacheMaxBytes          = 64 * 1024 * 1024
+)
+
+// blockedIPNets 在 net.IP 自带判断之外，额外覆盖 CGNAT、基准测试、保留地址等不应从公网访问的网段
+var blockedIPNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+	} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// IsPrivateIP 判断是否为内网、回环、链路本地等地址
+func IsPrivateIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, ipNet := range blockedIPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeDialControl 在 DNS 解析之后、建立连接之前检查目标地址，防止通过域名解析或重定向访问内网
+func safeDialControl(network, address string, _ syscall.RawConn) error {
+	if system_setting.GetFetchSettings().AllowPrivateIp {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || IsPrivateIP(ip) {
+		return fmt.Errorf("%w: address %s is private", ErrFetchForbidden, host)
+	}
+	return nil
+}
+
+// ValidateFetchURL 检查协议和域名黑白名单，直接使用 IP 的地址同时检查是否为内网地址
+func ValidateFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrFetchForbidden, u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrFetchForbidden)
+	}
+	settings := system_setting.GetFetchSettings()
+	if !settings.IsHostAllowed(host) {
+		return fmt.Errorf("%w: host %s", ErrFetchForbidden, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !settings.AllowPrivateIp && IsPrivateIP(ip) {
+		return fmt.Errorf("%w: address %s is private", ErrFetchForbidden, host)
+	}
+	return nil
+}
+
+var safeFetchClient = &http.Client{
+	Transport: &http.Transport{
+		// 不使用环境变量中的代理，否则连接目标变为代理地址，无法检查真实地址
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   safeDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	Timeout: 2 * time.Minute,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > system_setting.GetFetchSettings().MaxRedirects {
+			return fmt.Errorf("%w: too many redirects", ErrFetchForbidden)
+		}
+		return ValidateFetchURL(req.URL)
+	},
+}
+
+// GetSafeFetchClient 返回用于下载用户提供 URL 的 HTTP 客户端
+func GetSafeFetchClient() *http.Client {
+	return safeFetchClient
+}
+
+// DownloadedFile 下载得到的内容
+type DownloadedFile struct {
+	Data        []byte
+	ContentType string
+}
+
+// DownloadFile 下载 URL 内容并限制大小，accept 用于校验 Content-Type；结果按域名短时缓存，
+// 多轮对话中重复出现的图片不会被重复下载
+func DownloadFile(originUrl string, accept func(contentType string) bool) (*DownloadedFile, error) {
+	u, err := url.Parse(originUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateFetchURL(u); err != nil {
+		return nil, err
+	}
+	file, ok := fetchCache.get(u)
+	if !ok {
+		file, err = downloadFile(originUrl)
+		if err != nil {
+			return nil, err
+		}
+		fetchCache.set(u, file)
+	}
+	if accept != nil && !accept(file.ContentType) {
+		return nil, fmt.Errorf("invalid content type: %s", file.ContentType)
+	}
+	return file, nil
+}
+
+func downloadFile(originUrl string) (*DownloadedFile, error) {
+	resp, err := DoDownloadRequest(originUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response status: %s", resp.Status)
+	}
+	maxSize := int64(constant.MaxFileDownloadMB * 1024 * 1024)
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("file size %d exceeds maximum allowed size of %d bytes", resp.ContentLength, maxSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file size exceeds maximum allowed size: %dMB", constant.MaxFileDownloadMB)
+	}
+	return &DownloadedFile{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+func isImageContentType(contentType string) bool {
+	return contentType == "application/octet-stream" || strings.HasPrefix(contentType, "image/")
+}
+
+type fetchCacheEntry struct {
+	file     *DownloadedFile
+	expireAt time.Time
+}
+
+// downloadCache 按域名分组的下载缓存，每个域名的条目数和总大小都有上限
+type downloadCache struct {
+	mu    sync.Mutex
+	hosts map[string]map[string]fetchCacheEntry
+	size  int
+}
+
+var fetchCache = &downloadCache{hosts: make(map[string]map[string]fetchCacheEntry)}
+
+func (d *downloadCache) get(u *url.URL) (*DownloadedFile, bool) {
+	if system_setting.GetFetchSettings().CacheSeconds <= 0 {
+		return nil, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.hosts[u.Host][u.String()]
+	if !ok || time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+	return entry.file, true
+}
+
+func (d *downloadCache) set(u *url.URL, file *DownloadedFile) {
+	ttl := system_setting.GetFetchSettings().CacheSeconds
+	if ttl <= 0 || len(file.Data) > fetchCacheMaxBytes/4 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.evictExpired(now)
+	entries := d.hosts[u.Host]
+	if entries == nil {
+		entries = make(map[string]fetchCacheEntry)
+		d.hosts[u.Host] = entries
+	}
+	// 单个域名条目过多时移除最早过期的
+	for len(entries) >= fetchCacheMaxEntriesPerHost {
+		oldestKey := ""
+		for key, entry := range entries {
+			if oldestKey == "" || entry.expireAt.Before(entries[oldestKey].expireAt) {
+				oldestKey = key
+			}
+		}
+		d.size -= len(entries[oldestKey].file.Data)
+		delete(entries, oldestKey)
+	}
+	if d.size+len(file.Data) > fetchCacheMaxBytes {
+		return
+	}
+	entries[u.String()] = fetchCacheEntry{file: file, expireAt: now.Add(time.Duration(ttl) * time.Second)}
+	d.size += len(file.Data)
+}
+
+func (d *downloadCache) evictExpired(now time.Time) {
+	for host, entries := range d.hosts {
+		for key, entry := range entries {
+			if now.After(entry.expireAt) {
+				d.size -= len(entry.file.Data)
+				delete(entries, key)
+			}
+		}
+		if len(entries) == 0 {
+			delete(d.hosts, host)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"veloera/common"
+	"veloera/dto"
+	"veloera/model"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	GuardrailDirectionInput  = "input"
+	GuardrailDirectionOutput = "output"
+)
+
+// GuardrailCheckResult 单个检查器的结果，Redacted 为空表示不修改文本
+type GuardrailCheckResult struct {
+	Flagged  bool
+	Reasons  []string
+	Redacted string
+}
+
+// GuardrailChecker 护栏检查器，新的检查类型实现该接口并通过 RegisterGuardrailChecker 注册
+type GuardrailChecker interface {
+	Check(c *gin.Context, direction string, text string) (*GuardrailCheckResult, error)
+}
+
+type GuardrailCheckerFactory func(stage operation_setting.GuardrailStage) (GuardrailChecker, error)
+
+var guardrailCheckerFactories = map[string]GuardrailCheckerFactory{
+	operation_setting.GuardrailTypeKeyword:    newKeywordChecker,
+	operation_setting.GuardrailTypePII:        newPIIChecker,
+	operation_setting.GuardrailTypeModeration: newModerationChecker,
+	operation_setting.GuardrailTypeHTTP:       newHTTPChecker,
+}
+
+func RegisterGuardrailChecker(stageType string, factory GuardrailCheckerFactory) {
+	guardrailCheckerFactories[stageType] = factory
+}
+
+// GuardrailBlockedError 被 block 阶段拦截时返回
+type GuardrailBlockedError struct {
+	Policy  string
+	Stage   string
+	Reasons []string
+}
+
+func (e *GuardrailBlockedError) Error() string {
+	return fmt.Sprintf("content blocked by guardrail %s/%s: %s", e.Policy, e.Stage, strings.Join(e.Reasons, ", "))
+}
+
+type guardrailStep struct {
+	stage   operation_setting.GuardrailStage
+	checker GuardrailChecker
+}
+
+type GuardrailPipeline struct {
+	Policy    string
+	Direction string
+	steps     []guardrailStep
+}
+
+// NewGuardrailPipeline 根据令牌和分组确定的策略构建指定方向的流水线，没有生效策略时返回 nil
+func NewGuardrailPipeline(c *gin.Context, direction string) *GuardrailPipeline {
+	name, policy, ok := operation_setting.ResolveGuardrailPolicy(c.GetString("group"), c.GetString("token_guardrail_policy"))
+	if !ok {
+		return nil
+	}
+	stages := policy.Input
+	if direction == GuardrailDirectionOutput {
+		stages = policy.Output
+	}
+	if len(stages) == 0 {
+		return nil
+	}
+	pipeline := &GuardrailPipeline{
+		Policy:    name,
+		Direction: direction,
+	}
+	for _, stage := range stages {
+		factory, ok := guardrailCheckerFactories[stage.Type]
+		if !ok {
+			common.LogWarn(c, fmt.Sprintf("unknown guardrail stage type: %s", stage.Type))
+			continue
+		}
+		checker, err := factory(stage)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("failed to build guardrail stage %s: %s", stage.Type, err.Error()))
+			continue
+		}
+		pipeline.steps = append(pipeline.steps, guardrailStep{stage: stage, checker: checker})
+	}
+	return pipeline
+}
+
+// isRemoteGuardrailStage 审核模型与自定义服务需要发起网络请求
+func isRemoteGuardrailStage(stage operation_setting.GuardrailStage) bool {
+	return stage.Type == operation_setting.GuardrailTypeModeration || stage.Type == operation_setting.GuardrailTypeHTTP
+}
+
+// SplitRemote 将流水线拆分为本地检查与远程检查两部分，没有对应阶段的部分为 nil
+func (p *GuardrailPipeline) SplitRemote() (local *GuardrailPipeline, remote *GuardrailPipeline) {
+	if p == nil {
+		return nil, nil
+	}
+	for _, step := range p.steps {
+		target := &local
+		if isRemoteGuardrailStage(step.stage) {
+			target = &remote
+		}
+		if *target == nil {
+			*target = &GuardrailPipeline{Policy: p.Policy, Direction: p.Direction}
+		}
+		(*target).steps = append((*target).steps, step)
+	}
+	return local, remote
+}
+
+func guardrailStageName(stage operation_setting.GuardrailStage) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return stage.Type
+}
+
+// Check 依次执行各阶段，返回（可能被脱敏的）文本；检查器自身出错时放行并记录日志
+func (p *GuardrailPipeline) Check(c *gin.Context, text string) (string, error) {
+	if p == nil || common.IsEmptyOrWhitespace(text) {
+		return text, nil
+	}
+	for _, step := range p.steps {
+		result, err := step.checker.Check(c, p.Direction, text)
+		if err != nil {
+			common.LogError(c, fmt.Sprintf("guardrail stage %s failed: %s", guardrailStageName(step.stage), err.Error()))
+			continue
+		}
+		if result == nil || !result.Flagged {
+			continue
+		}
+		p.recordViolation(c, step.stage, result)
+		switch step.stage.Action {
+		case operation_setting.GuardrailActionBlock:
+			return text, &GuardrailBlockedError{
+				Policy:  p.Policy,
+				Stage:   guardrailStageName(step.stage),
+				Reasons: result.Reasons,
+			}
+		case operation_setting.GuardrailActionRedact:
+			if result.Redacted != "" {
+				text = result.Redacted
+			}
+		}
+	}
+	return text, nil
+}
+
+// CheckMessages 检查并在需要时改写消息中的文本内容
+func (p *GuardrailPipeline) CheckMessages(c *gin.Context, messages []dto.Message) error {
+	if p == nil {
+		return nil
+	}
+	for i := range messages {
+		if messages[i].IsStringContent() {
+			text := messages[i].StringContent()
+			checked, err := p.Check(c, text)
+			if err != nil {
+				return err
+			}
+			if checked != text {
+				messages[i].SetStringContent(checked)
+			}
+			continue
+		}
+		contents := messages[i].ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeText || contents[j].Text == "" {
+				continue
+			}
+			checked, err := p.Check(c, contents[j].Text)
+			if err != nil {
+				return err
+			}
+			if checked != contents[j].Text {
+				contents[j].Text = checked
+				changed = true
+			}
+		}
+		if changed {
+			messages[i].SetMediaContent(contents)
+		}
+	}
+	return nil
+}
+
+// CheckClaudeMessages 检查 Claude 格式消息中的文本块
+func (p *GuardrailPipeline) CheckClaudeMessages(c *gin.Context, messages []dto.ClaudeMessage) error {
+	if p == nil {
+		return nil
+	}
+	for i := range messages {
+		if messages[i].IsStringContent() {
+			text := messages[i].GetStringContent()
+			checked, err := p.Check(c, text)
+			if err != nil {
+				return err
+			}
+			if checked != text {
+				messages[i].SetStringContent(checked)
+			}
+			continue
+		}
+		blocks, ok := messages[i].Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, block := range blocks {
+			blockMap, ok := block.(map[string]any)
+			if !ok || blockMap["type"] != "text" {
+				continue
+			}
+			text, ok := blockMap["text"].(string)
+			if !ok {
+				continue
+			}
+			checked, err := p.Check(c, text)
+			if err != nil {
+				return err
+			}
+			blockMap["text"] = checked
+		}
+	}
+	return nil
+}
+
+// CheckInput 检查 prompt / input 这类字符串或字符串数组字段
+func (p *GuardrailPipeline) CheckInput(c *gin.Context, input any) (any, error) {
+	if p == nil {
+		return input, nil
+	}
+	switch v := input.(type) {
+	case string:
+		return p.Check(c, v)
+	case []any:
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				checked, err := p.Check(c, s)
+				if err != nil {
+					return input, err
+				}
+				v[i] = checked
+			}
+		}
+		return v, nil
+	case []string:
+		for i, s := range v {
+			checked, err := p.Check(c, s)
+			if err != nil {
+				return input, err
+			}
+			v[i] = checked
+		}
+		return v, nil
+	}
+	return input, nil
+}
+
+func (p *GuardrailPipeline) recordViolation(c *gin.Context, stage operation_setting.GuardrailStage, result *GuardrailCheckResult) {
+	stageName := guardrailStageName(stage)
+	common.LogWarn(c, fmt.Sprintf("guardrail %s/%s flagged %s: %s", p.Policy, stageName, p.Direction, strings.Join(result.Reasons, ", ")))
+	other := map[string]interface{}{
+		"guardrail_policy": p.Policy,
+		"direction":        p.Direction,
+		"stage":            stageName,
+		"stage_type":       stage.Type,
+		"action":           stage.Action,
+		"reasons":          result.Reasons,
+	}
+	content := fmt.Sprintf("护栏策略 %s 的 %s 阶段在%s中检测到违规内容（%s），处理方式：%s",
+		p.Policy, stageName, guardrailDirectionText(p.Direction), strings.Join(result.Reasons, ", "), stage.Action)
+	model.RecordGuardrailLog(c, c.GetInt("id"), c.GetInt("channel_id"), c.GetString("original_model"), c.GetString("token_name"),
+		content, c.GetInt("token_id"), c.GetString("group"), other)
+}
+
+func guardrailDirectionText(direction string) string {
+	if direction == GuardrailDirectionOutput {
+		return "输出"
+	}
+	return "输入"
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/model"
+	"veloera/setting"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const guardrailMask = "**###**"
+
+// keywordChecker 屏蔽词与正则检查
+type keywordChecker struct {
+	words             *regexp.Regexp
+	regexes           []*regexp.Regexp
+	useSensitiveWords bool
+}
+
+func newKeywordChecker(stage operation_setting.GuardrailStage) (GuardrailChecker, error) {
+	checker := &keywordChecker{
+		words:             setting.CompileKeywords(stage.Words),
+		useSensitiveWords: stage.UseSensitiveWords,
+	}
+	for _, pattern := range stage.Regexes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		checker.regexes = append(checker.regexes, re)
+	}
+	return checker, nil
+}
+
+func (k *keywordChecker) Check(c *gin.Context, direction string, text string) (*GuardrailCheckResult, error) {
+	patterns := make([]*regexp.Regexp, 0, len(k.regexes)+2)
+	if k.words != nil {
+		patterns = append(patterns, k.words)
+	}
+	patterns = append(patterns, k.regexes...)
+	if k.useSensitiveWords {
+		if re := setting.GetSensitiveWordsPattern(); re != nil {
+			patterns = append(patterns, re)
+		}
+		patterns = append(patterns, setting.GetRegexSensitiveWords()...)
+	}
+	result := &GuardrailCheckResult{}
+	redacted := text
+	for _, re := range patterns {
+		matches := re.FindAllString(redacted, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		result.Flagged = true
+		result.Reasons = append(result.Reasons, matches...)
+		redacted = re.ReplaceAllLiteralString(redacted, guardrailMask)
+	}
+	if result.Flagged {
+		result.Reasons = RemoveDuplicate(result.Reasons)
+		result.Redacted = redacted
+	}
+	return result, nil
+}
+
+// piiChecker 个人信息检测，脱敏时替换为类型占位符
+type piiChecker struct {
+	detectors []string
+}
+
+func newPIIChecker(stage operation_setting.GuardrailStage) (GuardrailChecker, error) {
+	return &piiChecker{detectors: stage.Detectors}, nil
+}
+
+func (p *piiChecker) Check(c *gin.Context, direction string, text string) (*GuardrailCheckResult, error) {
+	matches := FindPII(text, p.detectors)
+	if len(matches) == 0 {
+		return &GuardrailCheckResult{}, nil
+	}
+	var reasons []string
+	for _, m := range matches {
+		reasons = append(reasons, m.Type)
+	}
+	return &GuardrailCheckResult{
+		Flagged: true,
+		Reasons: RemoveDuplicate(reasons),
+		Redacted: ReplacePII(text, matches, func(m PIIMatch) string {
+			return "[" + strings.ToUpper(m.Type) + "]"
+		}),
+	}, nil
+}
+
+// moderationChecker 通过现有渠道调用 /v1/moderations
+type moderationChecker struct {
+	model     string
+	threshold float64
+	timeout   time.Duration
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func newModerationChecker(stage operation_setting.GuardrailStage) (GuardrailChecker, error) {
+	return &moderationChecker{
+		model:     stage.Model,
+		threshold: stage.Threshold,
+		timeout:   guardrailTimeout(stage),
+	}, nil
+}
+
+func guardrailTimeout(stage operation_setting.GuardrailStage) time.Duration {
+	if stage.Timeout > 0 {
+		return time.Duration(stage.Timeout) * time.Second
+	}
+	return 10 * time.Second
+}
+
+func (m *moderationChecker) Check(c *gin.Context, direction string, text string) (*GuardrailCheckResult, error) {
+	channel, err := model.CacheGetRandomSatisfiedChannel(c.GetString("group"), m.model, 0)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("no available channel for moderation model %s", m.model)
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = common.ChannelBaseURLs[channel.Type]
+	}
+	key := strings.TrimSpace(strings.Split(channel.Key, "\n")[0])
+	body, err := json.Marshal(map[string]any{
+		"model": m.model,
+		"input": text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), m.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var moderation moderationResponse
+	if err = json.NewDecoder(resp.Body).Decode(&moderation); err != nil {
+		return nil, err
+	}
+	if moderation.Error != nil {
+		return nil, errors.New(moderation.Error.Message)
+	}
+	result := &GuardrailCheckResult{}
+	for _, r := range moderation.Results {
+		if m.threshold > 0 {
+			for category, score := range r.CategoryScores {
+				if score >= m.threshold {
+					result.Flagged = true
+					result.Reasons = append(result.Reasons, category)
+				}
+			}
+			continue
+		}
+		if r.Flagged {
+			result.Flagged = true
+			for category, hit := range r.Categories {
+				if hit {
+					result.Reasons = append(result.Reasons, category)
+				}
+			}
+		}
+	}
+	sort.Strings(result.Reasons)
+	result.Reasons = RemoveDuplicate(result.Reasons)
+	return result, nil
+}
+
+// httpChecker 调用自定义检查服务，请求体为 {"direction","text","model","group"}，
+// 响应体为 {"flagged","reason","redacted"}
+type httpChecker struct {
+	url     string
+	headers map[string]string
+	timeout time.Duration
+}
+
+type httpCheckerResponse struct {
+	Flagged  bool   `json:"flagged"`
+	Reason   string `json:"reason"`
+	Redacted string `json:"redacted"`
+}
+
+func newHTTPChecker(stage operation_setting.GuardrailStage) (GuardrailChecker, error) {
+	return &httpChecker{
+		url:     stage.Url,
+		headers: stage.Headers,
+		timeout: guardrailTimeout(stage),
+	}, nil
+}
+
+func (h *httpChecker) Check(c *gin.Context, direction string, text string) (*GuardrailCheckResult, error) {
+	body, err := json.Marshal(map[string]any{
+		"direction": direction,
+		"text":      text,
+		"model":     c.GetString("original_model"),
+		"group":     c.GetString("group"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("guardrail http checker returned status %d", resp.StatusCode)
+	}
+	var checkResp httpCheckerResponse
+	if err = json.NewDecoder(resp.Body).Decode(&checkResp); err != nil {
+		return nil, err
+	}
+	result := &GuardrailCheckResult{
+		Flagged:  checkResp.Flagged,
+		Redacted: checkResp.Redacted,
+	}
+	if checkResp.Reason != "" {
+		result.Reasons = []string{checkResp.Reason}
+	}
+	return result, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const hedgeAttemptKey = "hedge_attempt"
+
+var ErrHedgeLost = errors.New("hedged request lost the race")
+
+// HedgeRace 同一请求发往多个渠道时的竞争状态，最先写出响应的尝试获胜，其余尝试被取消
+type HedgeRace struct {
+	mu       sync.Mutex
+	writer   gin.ResponseWriter
+	winner   int
+	attempts []*hedgeAttempt
+}
+
+type hedgeAttempt struct {
+	race   *HedgeRace
+	id     int
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewHedgeRace(c *gin.Context) *HedgeRace {
+	return &HedgeRace{writer: c.Writer}
+}
+
+// NewAttempt 复制请求上下文，返回的上下文拥有独立的请求、可取消的上游连接和受竞争控制的 ResponseWriter
+func (r *HedgeRace) NewAttempt(c *gin.Context) *gin.Context {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	r.mu.Lock()
+	attempt := &hedgeAttempt{race: r, id: len(r.attempts) + 1, ctx: ctx, cancel: cancel}
+	r.attempts = append(r.attempts, attempt)
+	r.mu.Unlock()
+
+	cp := c.Copy()
+	cp.Request = c.Request.Clone(ctx)
+	cp.Writer = &hedgeWriter{ResponseWriter: r.writer, attempt: attempt, header: make(http.Header)}
+	cp.Set(hedgeAttemptKey, attempt)
+	return cp
+}
+
+// Winner 返回获胜尝试的序号，从 1 开始，尚未决出时返回 0
+func (r *HedgeRace) Winner() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// Close 取消所有尝试的上游连接
+func (r *HedgeRace) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, attempt := range r.attempts {
+		attempt.cancel()
+	}
+}
+
+func (r *HedgeRace) claim(a *hedgeAttempt, w *hedgeWriter) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner == 0 {
+		r.winner = a.id
+		for k, v := range w.header {
+			r.writer.Header()[k] = v
+		}
+		if w.status != 0 {
+			r.writer.WriteHeader(w.status)
+		}
+		for _, other := range r.attempts {
+			if other != a {
+				other.cancel()
+			}
+		}
+	}
+	return r.winner == a.id
+}
+
+func getHedgeAttempt(c *gin.Context) *hedgeAttempt {
+	value, ok := c.Get(hedgeAttemptKey)
+	if !ok {
+		return nil
+	}
+	attempt, _ := value.(*hedgeAttempt)
+	return attempt
+}
+
+// IsHedgeAttempt 当前请求是否为对冲请求中的一个尝试
+func IsHedgeAttempt(c *gin.Context) bool {
+	return getHedgeAttempt(c) != nil
+}
+
+// IsHedgeLoser 其他尝试已经获胜，当前尝试的结果不会返回给用户，也不应计费
+func IsHedgeLoser(c *gin.Context) bool {
+	attempt := getHedgeAttempt(c)
+	if attempt == nil {
+		return false
+	}
+	winner := attempt.race.Winner()
+	return winner != 0 && winner != attempt.id
+}
+
+// UpstreamContext 上游请求使用的 context，对冲请求的尝试落败时会被取消
+func UpstreamContext(c *gin.Context) context.Context {
+	if attempt := getHedgeAttempt(c); attempt != nil {
+		return attempt.ctx
+	}
+	return context.Background()
+}
+
+// hedgeWriter 在尝试获胜前缓存状态码与响应头，首次写出内容时参与竞争，落败的尝试无法写出任何内容
+type hedgeWriter struct {
+	gin.ResponseWriter
+	attempt *hedgeAttempt
+	header  http.Header
+	status  int
+}
+
+func (w *hedgeWriter) won() bool {
+	return w.attempt.race.Winner() == w.attempt.id
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.won() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.won() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.attempt.race.claim(w.attempt, w) {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.attempt.race.claim(w.attempt, w) {
+		return 0, ErrHedgeLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.won() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.won() {
+		return w.ResponseWriter.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.won() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.won() && w.ResponseWriter.Written()
+}
@@ -2,25 +2,39 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"golang.org/x/net/proxy"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 	"veloera/common"
+	"veloera/constant"
 )
 
 var httpClient *http.Client
 var impatientHTTPClient *http.Client
 
+// 未使用的连接池在超过该时间后关闭并移除
+const channelClientIdleExpire = 30 * time.Minute
+
 func init() {
-	if common.RelayTimeout == 0 {
-		httpClient = &http.Client{}
-	} else {
-		httpClient = &http.Client{
-			Timeout: time.Duration(common.RelayTimeout) * time.Second,
-		}
+	InitHttpClient()
+}
+
+// InitHttpClient 根据环境变量重新创建共享的 HTTP 客户端，需在 constant.InitEnv 之后调用
+func InitHttpClient() {
+	transport, _ := newTransport(HttpClientOptions{})
+	httpClient = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(common.RelayTimeout) * time.Second,
 	}
 
 	impatientHTTPClient = &http.Client{
@@ -36,24 +50,197 @@ func GetImpatientHttpClient() *http.Client {
 	return impatientHTTPClient
 }
 
-// NewProxyHttpClient 创建支持代理的 HTTP 客户端
+// HttpClientOptions 渠道级别的连接设置，零值表示使用全局配置
+type HttpClientOptions struct {
+	BaseURL               string
+	Proxy                 string
+	HTTP2                 *bool
+	MaxConnsPerHost       int
+	MaxIdleConnsPerHost   int
+	ResponseHeaderTimeout int
+	CACert                string
+	ClientCert            string
+	ClientKey             string
+}
+
+// NewChannelHttpClientOptions 从渠道额外设置中读取连接设置
+func NewChannelHttpClientOptions(baseURL string, setting map[string]interface{}) HttpClientOptions {
+	opts := HttpClientOptions{BaseURL: baseURL}
+	opts.Proxy, _ = setting[constant.ChanelSettingProxy].(string)
+	if http2, ok := setting[constant.ChannelSettingHTTP2].(bool); ok {
+		opts.HTTP2 = &http2
+	}
+	if v, ok := setting[constant.ChannelSettingMaxConnsPerHost].(float64); ok {
+		opts.MaxConnsPerHost = int(v)
+	}
+	if v, ok := setting[constant.ChannelSettingMaxIdleConns].(float64); ok {
+		opts.MaxIdleConnsPerHost = int(v)
+	}
+	if v, ok := setting[constant.ChannelSettingResponseTimeout].(float64); ok {
+		opts.ResponseHeaderTimeout = int(v)
+	}
+	opts.CACert, _ = setting[constant.ChannelSettingCACert].(string)
+	opts.ClientCert, _ = setting[constant.ChannelSettingClientCert].(string)
+	opts.ClientKey, _ = setting[constant.ChannelSettingClientKey].(string)
+	return opts
+}
+
+func (o HttpClientOptions) isDefault() bool {
+	return o.Proxy == "" && o.HTTP2 == nil && o.MaxConnsPerHost == 0 && o.MaxIdleConnsPerHost == 0 &&
+		o.ResponseHeaderTimeout == 0 && o.CACert == "" && o.ClientCert == "" && o.ClientKey == ""
+}
+
+// cacheKey 证书内容较长，只使用摘要作为缓存键的一部分
+func (o HttpClientOptions) cacheKey() string {
+	http2 := "default"
+	if o.HTTP2 != nil {
+		http2 = fmt.Sprintf("%t", *o.HTTP2)
+	}
+	certs := sha256.Sum256([]byte(o.CACert + "\x00" + o.ClientCert + "\x00" + o.ClientKey))
+	return strings.Join([]string{
+		o.BaseURL, o.Proxy, http2,
+		fmt.Sprintf("%d/%d/%d", o.MaxConnsPerHost, o.MaxIdleConnsPerHost, o.ResponseHeaderTimeout),
+		hex.EncodeToString(certs[:]),
+	}, "|")
+}
+
+type channelClientEntry struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+var (
+	channelClients     = make(map[string]*channelClientEntry)
+	channelClientsLock sync.Mutex
+	channelClientSweep time.Time
+)
+
+// GetChannelHttpClient 返回按 上游地址 + 代理 + 连接设置 缓存的客户端，相同渠道的请求复用同一个连接池
+func GetChannelHttpClient(opts HttpClientOptions) (*http.Client, error) {
+	if opts.isDefault() {
+		return httpClient, nil
+	}
+	key := opts.cacheKey()
+	now := time.Now()
+	channelClientsLock.Lock()
+	defer channelClientsLock.Unlock()
+	if now.Sub(channelClientSweep) > time.Minute {
+		channelClientSweep = now
+		for k, entry := range channelClients {
+			if now.Sub(entry.lastUsed) > channelClientIdleExpire {
+				entry.client.CloseIdleConnections()
+				delete(channelClients, k)
+			}
+		}
+	}
+	if entry, ok := channelClients[key]; ok {
+		entry.lastUsed = now
+		return entry.client, nil
+	}
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(common.RelayTimeout) * time.Second,
+	}
+	channelClients[key] = &channelClientEntry{client: client, lastUsed: now}
+	return client, nil
+}
+
+// NewProxyHttpClient 创建支持代理的 HTTP 客户端，相同代理复用同一个连接池
 func NewProxyHttpClient(proxyURL string) (*http.Client, error) {
-	if proxyURL == "" {
-		return http.DefaultClient, nil
+	return GetChannelHttpClient(HttpClientOptions{Proxy: proxyURL})
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+func newTransport(opts HttpClientOptions) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   seconds(constant.RelayDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	http2 := constant.RelayHTTP2Enabled
+	if opts.HTTP2 != nil {
+		http2 = *opts.HTTP2
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          constant.RelayMaxIdleConns,
+		MaxIdleConnsPerHost:   constant.RelayMaxIdleConnsPerHost,
+		MaxConnsPerHost:       constant.RelayMaxConnsPerHost,
+		IdleConnTimeout:       seconds(constant.RelayIdleConnTimeout),
+		TLSHandshakeTimeout:   seconds(constant.RelayTLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(constant.RelayResponseHeaderTimeout),
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     http2,
+	}
+	if !http2 {
+		// TLSNextProto 非 nil 且为空时不会协商 HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
 	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = seconds(opts.ResponseHeaderTimeout)
+	}
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	if opts.Proxy != "" {
+		if err = setupProxy(transport, dialer, opts.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	return transport, nil
+}
 
+// newTLSConfig 自定义 CA 与 mTLS 客户端证书，均未配置时返回 nil 使用系统默认配置
+func newTLSConfig(opts HttpClientOptions) (*tls.Config, error) {
+	if opts.CACert == "" && opts.ClientCert == "" && opts.ClientKey == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(opts.CACert)) {
+			return nil, errors.New("invalid ca_cert: no certificate found in PEM data")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(opts.ClientCert), []byte(opts.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client_cert or client_key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func setupProxy(transport *http.Transport, dialer *net.Dialer, proxyURL string) error {
 	parsedURL, err := url.Parse(proxyURL)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	switch parsedURL.Scheme {
 	case "http", "https":
-		return &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(parsedURL),
-			},
-		}, nil
+		transport.Proxy = http.ProxyURL(parsedURL)
+		return nil
 
 	case "socks5":
 		// 获取认证信息
@@ -69,20 +256,22 @@ func NewProxyHttpClient(proxyURL string) (*http.Client, error) {
 		}
 
 		// 创建 SOCKS5 代理拨号器
-		dialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, proxy.Direct)
+		socksDialer, err := proxy.SOCKS5("tcp", parsedURL.Host, auth, dialer)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		return &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return dialer.Dial(network, addr)
-				},
-			},
-		}, nil
+		transport.Proxy = nil
+		if contextDialer, ok := socksDialer.(proxy.ContextDialer); ok {
+			transport.DialContext = contextDialer.DialContext
+		} else {
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return socksDialer.Dial(network, addr)
+			}
+		}
+		return nil
 
 	default:
-		return nil, fmt.Errorf("unsupported proxy scheme: %s", parsedURL.Scheme)
+		return fmt.Errorf("unsupported proxy scheme: %s", parsedURL.Scheme)
 	}
 }
@@ -7,10 +7,8 @@ import (
 	"fmt"
 	"image"
 	"io"
-	"net/http"
 	"strings"
 	"veloera/common"
-	"veloera/constant"
 
 	"golang.org/x/image/webp"
 )
@@ -61,42 +59,13 @@ func DecodeBase64FileData(base64String string) (string, string, error) {
 
 // GetImageFromUrl 获取图片的类型和base64编码的数据
 func GetImageFromUrl(url string) (mimeType string, data string, err error) {
-	resp, err := DoDownloadRequest(url)
+	file, err := DownloadFile(url, isImageContentType)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to download image: %w", err)
 	}
-	defer resp.Body.Close()
 
-	// Check HTTP status code
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("failed to download image: HTTP %d", resp.StatusCode)
-	}
-
-	contentType := resp.Header.Get("Content-Type")
-	if contentType != "application/octet-stream" && !strings.HasPrefix(contentType, "image/") {
-		return "", "", fmt.Errorf("invalid content type: %s, required image/*", contentType)
-	}
-	maxImageSize := int64(constant.MaxFileDownloadMB * 1024 * 1024)
-
-	// Check Content-Length if available
-	if resp.ContentLength > maxImageSize {
-		return "", "", fmt.Errorf("image size %d exceeds maximum allowed size of %d bytes", resp.ContentLength, maxImageSize)
-	}
-
-	// Use LimitReader to prevent reading oversized images
-	limitReader := io.LimitReader(resp.Body, maxImageSize)
-	buffer := &bytes.Buffer{}
-
-	written, err := io.Copy(buffer, limitReader)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read image data: %w", err)
-	}
-	if written >= maxImageSize {
-		return "", "", fmt.Errorf("image size exceeds maximum allowed size of %d bytes", maxImageSize)
-	}
-
-	data = base64.StdEncoding.EncodeToString(buffer.Bytes())
-	mimeType = contentType
+	data = base64.StdEncoding.EncodeToString(file.Data)
+	mimeType = file.ContentType
 
 	// Handle application/octet-stream type
 	if mimeType == "application/octet-stream" {
@@ -111,45 +80,13 @@ func GetImageFromUrl(url string) (mimeType string, data string, err error) {
 }
 
 func DecodeUrlImageData(imageUrl string) (image.Config, string, error) {
-	response, err := DoDownloadRequest(imageUrl)
+	// 完整下载并缓存，之后转换请求时再次获取同一图片不会重复下载
+	file, err := DownloadFile(imageUrl, isImageContentType)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("fail to get image from url: %s", err.Error()))
 		return image.Config{}, "", err
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		err = errors.New(fmt.Sprintf("fail to get image from url: %s", response.Status))
-		return image.Config{}, "", err
-	}
-
-	mimeType := response.Header.Get("Content-Type")
-
-	if mimeType != "application/octet-stream" && !strings.HasPrefix(mimeType, "image/") {
-		return image.Config{}, "", fmt.Errorf("invalid content type: %s, required image/*", mimeType)
-	}
-
-	var readData []byte
-	for _, limit := range []int64{1024 * 8, 1024 * 24, 1024 * 64} {
-		common.SysLog(fmt.Sprintf("try to decode image config with limit: %d", limit))
-
-		// 从response.Body读取更多的数据直到达到当前的限制
-		additionalData := make([]byte, limit-int64(len(readData)))
-		n, _ := io.ReadFull(response.Body, additionalData)
-		readData = append(readData, additionalData[:n]...)
-
-		// 使用io.MultiReader组合已经读取的数据和response.Body
-		limitReader := io.MultiReader(bytes.NewReader(readData), response.Body)
-
-		var config image.Config
-		var format string
-		config, format, err = getImageConfig(limitReader)
-		if err == nil {
-			return config, format, nil
-		}
-	}
-
-	return image.Config{}, "", err // 返回最后一个错误
+	return getImageConfig(bytes.NewReader(file.Data))
 }
 
 func getImageConfig(reader io.Reader) (image.Config, string, error) {
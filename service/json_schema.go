@@ -0,0 +1,319 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateJSONSchema 按 JSON Schema 校验数据，支持结构化输出常用的关键字：
+// type、properties、required、additionalProperties、items、enum、const、anyOf、oneOf、allOf、
+// 数值与长度范围、pattern，以及指向 $defs / definitions 的 $ref
+func ValidateJSONSchema(data any, schema any) error {
+	root, _ := schema.(map[string]any)
+	v := &schemaValidator{root: root}
+	return v.validate(data, schema, "$")
+}
+
+type schemaValidator struct {
+	root  map[string]any
+	depth int
+}
+
+func (v *schemaValidator) validate(data any, schema any, path string) error {
+	if b, ok := schema.(bool); ok {
+		if !b {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		resolved, err := v.resolveRef(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.depth++
+		defer func() { v.depth-- }()
+		if v.depth > 64 {
+			return fmt.Errorf("%s: $ref nesting too deep", path)
+		}
+		return v.validate(data, resolved, path)
+	}
+
+	if t, ok := s["type"]; ok && !matchSchemaType(data, t) {
+		return fmt.Errorf("%s: expected type %v, got %s", path, t, jsonTypeName(data))
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, item := range enum {
+			if jsonEqual(item, data) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of %v", path, enum)
+		}
+	}
+	if constant, ok := s["const"]; ok && !jsonEqual(constant, data) {
+		return fmt.Errorf("%s: value must be %v", path, constant)
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if err := v.validate(data, sub, path); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		var firstErr error
+		matched := false
+		for _, sub := range anyOf {
+			err := v.validate(data, sub, path)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: does not match any schema in anyOf (%v)", path, firstErr)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if v.validate(data, sub, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: must match exactly one schema in oneOf, matched %d", path, matches)
+		}
+	}
+
+	switch value := data.(type) {
+	case map[string]any:
+		return v.validateObject(value, s, path)
+	case []any:
+		return v.validateArray(value, s, path)
+	case string:
+		return validateString(value, s, path)
+	case float64:
+		return validateNumber(value, s, path)
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateObject(value map[string]any, s map[string]any, path string) error {
+	if required, ok := s["required"].([]any); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, exists := value[key]; !exists {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+	}
+	properties, _ := s["properties"].(map[string]any)
+	for key, item := range value {
+		childPath := path + "." + key
+		if propSchema, ok := properties[key]; ok {
+			if err := v.validate(item, propSchema, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if additional, ok := s["additionalProperties"]; ok {
+			if b, isBool := additional.(bool); isBool && !b {
+				return fmt.Errorf("%s: additional property %q is not allowed", path, key)
+			}
+			if err := v.validate(item, additional, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	if n, ok := schemaNumber(s, "minProperties"); ok && float64(len(value)) < n {
+		return fmt.Errorf("%s: must have at least %v properties", path, n)
+	}
+	if n, ok := schemaNumber(s, "maxProperties"); ok && float64(len(value)) > n {
+		return fmt.Errorf("%s: must have at most %v properties", path, n)
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateArray(value []any, s map[string]any, path string) error {
+	if n, ok := schemaNumber(s, "minItems"); ok && float64(len(value)) < n {
+		return fmt.Errorf("%s: must have at least %v items", path, n)
+	}
+	if n, ok := schemaNumber(s, "maxItems"); ok && float64(len(value)) > n {
+		return fmt.Errorf("%s: must have at most %v items", path, n)
+	}
+	prefixItems, _ := s["prefixItems"].([]any)
+	for i, item := range value {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefixItems) {
+			if err := v.validate(item, prefixItems[i], childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if items, ok := s["items"]; ok {
+			if err := v.validate(item, items, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	if unique, ok := s["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if jsonEqual(value[i], value[j]) {
+					return fmt.Errorf("%s: items must be unique", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(value string, s map[string]any, path string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if n, ok := schemaNumber(s, "minLength"); ok && length < n {
+		return fmt.Errorf("%s: length must be at least %v", path, n)
+	}
+	if n, ok := schemaNumber(s, "maxLength"); ok && length > n {
+		return fmt.Errorf("%s: length must be at most %v", path, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(value) {
+			return fmt.Errorf("%s: does not match pattern %q", path, pattern)
+		}
+	}
+	return nil
+}
+
+func validateNumber(value float64, s map[string]any, path string) error {
+	if n, ok := schemaNumber(s, "minimum"); ok && value < n {
+		return fmt.Errorf("%s: must be >= %v", path, n)
+	}
+	if n, ok := schemaNumber(s, "maximum"); ok && value > n {
+		return fmt.Errorf("%s: must be <= %v", path, n)
+	}
+	if n, ok := schemaNumber(s, "exclusiveMinimum"); ok && value <= n {
+		return fmt.Errorf("%s: must be > %v", path, n)
+	}
+	if n, ok := schemaNumber(s, "exclusiveMaximum"); ok && value >= n {
+		return fmt.Errorf("%s: must be < %v", path, n)
+	}
+	if n, ok := schemaNumber(s, "multipleOf"); ok && n > 0 {
+		if q := value / n; math.Abs(q-math.Round(q)) > 1e-9 {
+			return fmt.Errorf("%s: must be a multiple of %v", path, n)
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) resolveRef(ref string) (any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var current any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = m[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func matchSchemaType(data any, t any) bool {
+	switch types := t.(type) {
+	case string:
+		return matchSingleType(data, types)
+	case []any:
+		for _, item := range types {
+			if name, ok := item.(string); ok && matchSingleType(data, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchSingleType(data any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := data.(map[string]any)
+		return ok
+	case "array":
+		_, ok := data.([]any)
+		return ok
+	case "string":
+		_, ok := data.(string)
+		return ok
+	case "number":
+		_, ok := data.(float64)
+		return ok
+	case "integer":
+		n, ok := data.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := data.(bool)
+		return ok
+	case "null":
+		return data == nil
+	}
+	return true
+}
+
+func jsonTypeName(data any) string {
+	switch value := data.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+func schemaNumber(s map[string]any, key string) (float64, bool) {
+	n, ok := s[key].(float64)
+	return n, ok
+}
+
+func jsonEqual(a, b any) bool {
+	ja, err1 := json.Marshal(a)
+	jb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ja) == string(jb)
+}
@@ -39,6 +39,13 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		}
 	}
 
+	if IsHedgeAttempt(ctx) {
+		other["hedged"] = true
+	}
+	if relayInfo.ModelCreditQuota > 0 {
+		other["model_credit_quota"] = relayInfo.ModelCreditQuota
+	}
+
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
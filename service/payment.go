@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http"
+)
+
+// PaymentProvider 在线充值的支付渠道，每个渠道有独立的币种和单价
+type PaymentProvider interface {
+	// Name 渠道名称，保存在订单的 payment_method 中
+	Name() string
+	Enabled() bool
+	// Currency 支付使用的币种
+	Currency() string
+	// UnitPrice 每单位额度（美元）的价格，以 Currency 计价
+	UnitPrice() float64
+	// Purchase 创建支付订单，返回用户跳转支付的地址
+	Purchase(args *PaymentPurchaseArgs) (*PaymentPurchaseResult, error)
+	// ParseNotify 校验并解析支付渠道的异步通知
+	ParseNotify(req *http.Request) (*PaymentEvent, error)
+	// NotifyResponse 异步通知的响应，ok 为 false 时支付渠道会重试
+	NotifyResponse(ok bool) (int, string)
+}
+
+type PaymentPurchaseArgs struct {
+	TradeNo   string
+	Method    string // 前端选择的支付方式，例如易支付的 zfb、wx
+	Name      string // 商品名称
+	Money     float64
+	NotifyUrl string
+	ReturnUrl string
+}
+
+type PaymentPurchaseResult struct {
+	Url         string
+	Params      map[string]string // 需要以表单提交到 Url 的参数，为空时直接跳转
+	ProviderRef string            // 支付渠道的订单号
+}
+
+type PaymentEventType int
+
+const (
+	PaymentEventIgnored PaymentEventType = iota
+	PaymentEventPaid
+	PaymentEventRefunded
+)
+
+// PaymentEvent 支付渠道通知的订单状态变化
+type PaymentEvent struct {
+	Type          PaymentEventType
+	TradeNo       string // 本站订单号，退款通知中可能为空
+	ProviderRef   string // 支付渠道的交易号
+	Currency      string
+	Money         float64 // 实际支付的金额
+	RefundedMoney float64 // 累计退款的金额
+}
+
+var paymentProviders = map[string]PaymentProvider{
+	"epay":   &epayProvider{},
+	"stripe": &stripeProvider{},
+}
+
+// GetPaymentProvider 根据渠道名称获取支付渠道，易支付的 zfb、wx 等支付方式均属于 epay
+func GetPaymentProvider(name string) PaymentProvider {
+	if provider, ok := paymentProviders[name]; ok {
+		return provider
+	}
+	return paymentProviders["epay"]
+}
+
+// GetPaymentProviders 返回所有已启用的支付渠道
+func GetPaymentProviders() []PaymentProvider {
+	providers := make([]PaymentProvider, 0, len(paymentProviders))
+	for _, name := range []string{"epay", "stripe"} {
+		if provider := paymentProviders[name]; provider.Enabled() {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"veloera/setting"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/samber/lo"
+)
+
+type epayProvider struct{}
+
+func GetEpayClient() *epay.Client {
+	if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
+		return nil
+	}
+	withUrl, err := epay.NewClient(&epay.Config{
+		PartnerID: setting.EpayId,
+		Key:       setting.EpayKey,
+	}, setting.PayAddress)
+	if err != nil {
+		return nil
+	}
+	return withUrl
+}
+
+func (p *epayProvider) Name() string {
+	return "epay"
+}
+
+func (p *epayProvider) Enabled() bool {
+	return setting.PayAddress != "" && setting.EpayId != "" && setting.EpayKey != ""
+}
+
+func (p *epayProvider) Currency() string {
+	return setting.EpayCurrency
+}
+
+func (p *epayProvider) UnitPrice() float64 {
+	return setting.Price
+}
+
+func (p *epayProvider) Purchase(args *PaymentPurchaseArgs) (*PaymentPurchaseResult, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	payType := "wxpay"
+	if args.Method == "zfb" {
+		payType = "alipay"
+	}
+	notifyUrl, _ := url.Parse(args.NotifyUrl)
+	returnUrl, _ := url.Parse(args.ReturnUrl)
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           payType,
+		ServiceTradeNo: args.TradeNo,
+		Name:           args.Name,
+		Money:          strconv.FormatFloat(args.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentPurchaseResult{Url: uri, Params: params}, nil
+}
+
+func (p *epayProvider) ParseNotify(req *http.Request) (*PaymentEvent, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("未找到易支付配置信息")
+	}
+	query := req.URL.Query()
+	params := lo.Reduce(lo.Keys(query), func(r map[string]string, t string, i int) map[string]string {
+		r[t] = query.Get(t)
+		return r
+	}, map[string]string{})
+	verifyInfo, err := client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, errors.New("易支付回调签名验证失败")
+	}
+	event := &PaymentEvent{
+		TradeNo:     verifyInfo.ServiceTradeNo,
+		ProviderRef: verifyInfo.TradeNo,
+		Currency:    setting.EpayCurrency,
+	}
+	event.Money, _ = strconv.ParseFloat(verifyInfo.Money, 64)
+	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
+		event.Type = PaymentEventPaid
+	}
+	return event, nil
+}
+
+func (p *epayProvider) NotifyResponse(ok bool) (int, string) {
+	if ok {
+		return http.StatusOK, "success"
+	}
+	return http.StatusOK, "fail"
+}
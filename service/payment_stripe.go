@@ -0,0 +1,244 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"veloera/common"
+	"veloera/setting/system_setting"
+)
+
+// stripeSignatureTolerance webhook 签名时间戳允许的误差，防止重放
+const stripeSignatureTolerance = 5 * time.Minute
+
+// stripeZeroDecimalCurrencies 最小单位即为元的币种，其余币种以分为单位
+var stripeZeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+type stripeProvider struct{}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeCheckoutSession struct {
+	Id                string            `json:"id"`
+	Url               string            `json:"url"`
+	ClientReferenceId string            `json:"client_reference_id"`
+	PaymentIntent     string            `json:"payment_intent"`
+	PaymentStatus     string            `json:"payment_status"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripeCharge struct {
+	Id             string            `json:"id"`
+	PaymentIntent  string            `json:"payment_intent"`
+	Amount         int64             `json:"amount"`
+	AmountRefunded int64             `json:"amount_refunded"`
+	Currency       string            `json:"currency"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+type stripeError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *stripeProvider) Name() string {
+	return "stripe"
+}
+
+func (p *stripeProvider) Enabled() bool {
+	settings := system_setting.GetStripeSettings()
+	return settings.Enabled && settings.SecretKey != "" && settings.WebhookSecret != ""
+}
+
+func (p *stripeProvider) Currency() string {
+	return strings.ToLower(system_setting.GetStripeSettings().Currency)
+}
+
+func (p *stripeProvider) UnitPrice() float64 {
+	return system_setting.GetStripeSettings().UnitPrice
+}
+
+func stripeMinorUnits(currency string) float64 {
+	if stripeZeroDecimalCurrencies[strings.ToLower(currency)] {
+		return 1
+	}
+	return 100
+}
+
+// Purchase 创建 Stripe Checkout 会话，用户跳转到会话的 url 完成支付
+func (p *stripeProvider) Purchase(args *PaymentPurchaseArgs) (*PaymentPurchaseResult, error) {
+	settings := system_setting.GetStripeSettings()
+	if settings.SecretKey == "" {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	currency := p.Currency()
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", args.ReturnUrl)
+	form.Set("cancel_url", args.ReturnUrl)
+	form.Set("client_reference_id", args.TradeNo)
+	form.Set("metadata[trade_no]", args.TradeNo)
+	form.Set("payment_intent_data[metadata][trade_no]", args.TradeNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", currency)
+	form.Set("line_items[0][price_data][product_data][name]", args.Name)
+	unitAmount := int64(math.Round(args.Money * stripeMinorUnits(currency)))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(unitAmount, 10))
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(settings.ApiBase, "/")+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+settings.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// 重复提交同一订单时 Stripe 返回同一个会话
+	req.Header.Set("Idempotency-Key", args.TradeNo)
+	resp, err := GetImpatientHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr stripeError
+		_ = json.Unmarshal(body, &stripeErr)
+		return nil, fmt.Errorf("stripe: status code %d: %s", resp.StatusCode, stripeErr.Error.Message)
+	}
+	var session stripeCheckoutSession
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, err
+	}
+	if session.Url == "" {
+		return nil, errors.New("stripe: checkout session has no url")
+	}
+	return &PaymentPurchaseResult{Url: session.Url, ProviderRef: session.Id}, nil
+}
+
+// verifyStripeSignature 校验 Stripe-Signature 头，格式为 t=<时间戳>,v1=<签名>[,v1=<签名>]
+func verifyStripeSignature(payload []byte, header string, secret string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("stripe: invalid signature header")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("stripe: invalid signature timestamp")
+	}
+	if diff := time.Since(time.Unix(ts, 0)); diff > stripeSignatureTolerance || diff < -stripeSignatureTolerance {
+		return errors.New("stripe: signature timestamp outside the tolerance zone")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		actual, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return errors.New("stripe: signature mismatch")
+}
+
+// ParseNotify 处理 Stripe webhook，支付完成对应 checkout.session.completed 和
+// checkout.session.async_payment_succeeded，退款对应 charge.refunded
+func (p *stripeProvider) ParseNotify(req *http.Request) (*PaymentEvent, error) {
+	settings := system_setting.GetStripeSettings()
+	if settings.WebhookSecret == "" {
+		return nil, errors.New("未找到 Stripe 配置信息")
+	}
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyStripeSignature(payload, req.Header.Get("Stripe-Signature"), settings.WebhookSecret); err != nil {
+		return nil, err
+	}
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, err
+		}
+		result := &PaymentEvent{
+			TradeNo:     session.ClientReferenceId,
+			ProviderRef: session.PaymentIntent,
+			Currency:    session.Currency,
+			Money:       float64(session.AmountTotal) / stripeMinorUnits(session.Currency),
+		}
+		if result.TradeNo == "" {
+			result.TradeNo = session.Metadata["trade_no"]
+		}
+		// 异步支付方式在 completed 时尚未到账，等待 async_payment_succeeded
+		if session.PaymentStatus == "paid" {
+			result.Type = PaymentEventPaid
+		}
+		return result, nil
+	case "charge.refunded":
+		var charge stripeCharge
+		if err := json.Unmarshal(event.Data.Object, &charge); err != nil {
+			return nil, err
+		}
+		return &PaymentEvent{
+			Type:          PaymentEventRefunded,
+			TradeNo:       charge.Metadata["trade_no"],
+			ProviderRef:   charge.PaymentIntent,
+			Currency:      charge.Currency,
+			Money:         float64(charge.Amount) / stripeMinorUnits(charge.Currency),
+			RefundedMoney: float64(charge.AmountRefunded) / stripeMinorUnits(charge.Currency),
+		}, nil
+	}
+	if common.DebugEnabled {
+		common.SysLog(fmt.Sprintf("ignored stripe event %s: %s", event.Id, event.Type))
+	}
+	return &PaymentEvent{Type: PaymentEventIgnored}, nil
+}
+
+func (p *stripeProvider) NotifyResponse(ok bool) (int, string) {
+	if ok {
+		return http.StatusOK, `{"received":true}`
+	}
+	return http.StatusBadRequest, `{"received":false}`
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"veloera/setting/system_setting"
+)
+
+func signStripePayload(payload []byte, secret string, ts time.Time) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"checkout.session.completed"}`)
+	secret := "whsec_test"
+	now := time.Now()
+	cases := []struct {
+		name    string
+		header  string
+		payload []byte
+		ok      bool
+	}{
+		{"valid", signStripePayload(payload, secret, now), payload, true},
+		{"rotated secret", signStripePayload(payload, "whsec_old", now) + "," + signStripePayload(payload, secret, now), payload, true},
+		{"wrong secret", signStripePayload(payload, "whsec_other", now), payload, false},
+		{"tampered payload", signStripePayload(payload, secret, now), []byte(`{"id":"evt_2"}`), false},
+		{"expired", signStripePayload(payload, secret, now.Add(-10*time.Minute)), payload, false},
+		{"missing signature", "t=" + strconv.FormatInt(now.Unix(), 10), payload, false},
+		{"empty", "", payload, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyStripeSignature(tc.payload, tc.header, secret)
+			if (err == nil) != tc.ok {
+				t.Fatalf("verifyStripeSignature() error = %v, want ok = %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestStripePurchase(t *testing.T) {
+	var form map[string]string
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions" || r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		_ = r.ParseForm()
+		form = map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		form["Idempotency-Key"] = r.Header.Get("Idempotency-Key")
+		_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.test/cs_test_1"}`))
+	}))
+	defer stub.Close()
+
+	settings := system_setting.GetStripeSettings()
+	saved := *settings
+	defer func() { *settings = saved }()
+	settings.SecretKey = "sk_test"
+	settings.ApiBase = stub.URL
+	settings.Currency = "JPY"
+
+	provider := GetPaymentProvider("stripe")
+	result, err := provider.Purchase(&PaymentPurchaseArgs{TradeNo: "USR1NOtest", Name: "TUC10", Money: 1500})
+	if err != nil {
+		t.Fatalf("Purchase() error = %v", err)
+	}
+	if result.Url != "https://checkout.stripe.test/cs_test_1" || result.ProviderRef != "cs_test_1" {
+		t.Fatalf("Purchase() = %+v", result)
+	}
+	// 日元没有小数单位，金额不乘 100
+	if form["line_items[0][price_data][unit_amount]"] != "1500" || form["line_items[0][price_data][currency]"] != "jpy" {
+		t.Fatalf("unexpected line item: %v", form)
+	}
+	if form["client_reference_id"] != "USR1NOtest" || form["Idempotency-Key"] != "USR1NOtest" {
+		t.Fatalf("unexpected order reference: %v", form)
+	}
+
+	settings.SecretKey = "sk_wrong"
+	if _, err := provider.Purchase(&PaymentPurchaseArgs{TradeNo: "USR1NOtest2", Name: "TUC10", Money: 10}); err == nil {
+		t.Fatal("Purchase() with an invalid key should fail")
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+)
+
+const (
+	PIITypeEmail      = "email"
+	PIITypePhone      = "phone"
+	PIITypeCreditCard = "credit_card"
+	PIITypeIdCard     = "id_card"
+	PIITypeAPIKey     = "api_key"
+	PIITypeIP         = "ip"
+	PIITypeCustom     = "custom"
+)
+
+var piiPatterns = map[string]*regexp.Regexp{
+	PIITypeEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	PIITypePhone:      regexp.MustCompile(`(?:\+?86[\- ]?)?1[3-9]\d{9}\b|\+?\d{1,3}[\- .]?\(?\d{3}\)?[\- .]\d{3}[\- .]\d{4}\b`),
+	PIITypeCreditCard: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+	PIITypeIdCard:     regexp.MustCompile(`\b\d{17}[\dXx]\b|\b\d{3}-\d{2}-\d{4}\b`),
+	PIITypeAPIKey:     regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{30,}\b|\bxox[abpr]-[A-Za-z0-9\-]{10,}|\bAIza[0-9A-Za-z_\-]{35}`),
+	PIITypeIP:         regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`),
+}
+
+// 匹配时的检测顺序，信用卡号需在手机号之前，避免长数字被拆分
+var piiOrder = []string{PIITypeEmail, PIITypeAPIKey, PIITypeCreditCard, PIITypeIdCard, PIITypeIP, PIITypePhone}
+
+// DefaultPIIDetectors 未指定检测器时使用的检测器
+var DefaultPIIDetectors = []string{PIITypeEmail, PIITypePhone, PIITypeCreditCard, PIITypeIdCard}
+
+// PIIMatch 文本中的一处个人信息，Start/End 为字节偏移
+type PIIMatch struct {
+	Type  string
+	Value string
+	Start int
+	End   int
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	digits := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		ch := number[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		d := int(ch - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// FindPII 查找文本中的个人信息，detectors 为空时使用 DefaultPIIDetectors，结果按位置排序且互不重叠
+func FindPII(text string, detectors []string) []PIIMatch {
+	return findPII(text, detectors, nil)
+}
+
+func findPII(text string, detectors []string, custom []*regexp.Regexp) []PIIMatch {
+	if len(detectors) == 0 {
+		detectors = DefaultPIIDetectors
+	}
+	enabled := make(map[string]bool)
+	for _, d := range detectors {
+		enabled[d] = true
+	}
+	var matches []PIIMatch
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.End && end > m.Start {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(t string, re *regexp.Regexp) {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			value := text[loc[0]:loc[1]]
+			if loc[0] == loc[1] {
+				continue
+			}
+			if t == PIITypeCreditCard && !luhnValid(value) {
+				continue
+			}
+			if overlaps(loc[0], loc[1]) {
+				continue
+			}
+			matches = append(matches, PIIMatch{Type: t, Value: value, Start: loc[0], End: loc[1]})
+		}
+	}
+	for _, re := range custom {
+		add(PIITypeCustom, re)
+	}
+	for _, t := range piiOrder {
+		if enabled[t] {
+			add(t, piiPatterns[t])
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Start < matches[j].Start
+	})
+	return matches
+}
+
+// ReplacePII 使用 replace 返回的内容替换文本中的个人信息
+func ReplacePII(text string, matches []PIIMatch, replace func(m PIIMatch) string) string {
+	if len(matches) == 0 {
+		return text
+	}
+	result := make([]byte, 0, len(text))
+	last := 0
+	for _, m := range matches {
+		result = append(result, text[last:m.Start]...)
+		result = append(result, replace(m)...)
+		last = m.End
+	}
+	result = append(result, text[last:]...)
+	return string(result)
+}
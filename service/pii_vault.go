@@ -0,0 +1,275 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	piiPlaceholderPrefix = "[["
+	piiPlaceholderSuffix = "]]"
+	// 占位符的最大长度，流式还原时用于判断是否需要等待后续数据
+	piiPlaceholderMaxLen = 32
+)
+
+// PIIVault 保存一次请求中个人信息与占位符的对应关系，转发前脱敏，返回时还原
+type PIIVault struct {
+	detectors    []string
+	custom       []*regexp.Regexp
+	placeholders map[string]string
+	originals    map[string]string
+	counters     map[string]int
+	replacer     *strings.Replacer
+	jsonReplacer *strings.Replacer
+}
+
+// NewPIIVault 根据当前渠道的设置或标签确定脱敏策略，未配置时返回 nil
+func NewPIIVault(c *gin.Context) *PIIVault {
+	channelPolicy, _ := c.GetStringMap("channel_setting")[constant.ChannelSettingPIIRedaction].(string)
+	policy, ok := operation_setting.ResolvePIIRedactionPolicy(channelPolicy, c.GetString("channel_tag"))
+	if !ok {
+		return nil
+	}
+	vault := &PIIVault{
+		detectors:    policy.Detectors,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counters:     make(map[string]int),
+	}
+	if len(vault.detectors) == 0 {
+		vault.detectors = piiOrder
+	}
+	for _, pattern := range policy.Regexes {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("invalid pii redaction regex %q: %s", pattern, err.Error()))
+			continue
+		}
+		vault.custom = append(vault.custom, re)
+	}
+	return vault
+}
+
+// Empty 没有替换任何内容时无需还原响应
+func (v *PIIVault) Empty() bool {
+	return v == nil || len(v.originals) == 0
+}
+
+func (v *PIIVault) placeholder(m PIIMatch) string {
+	if p, ok := v.placeholders[m.Value]; ok {
+		return p
+	}
+	v.counters[m.Type]++
+	p := fmt.Sprintf("%s%s_%d%s", piiPlaceholderPrefix, strings.ToUpper(m.Type), v.counters[m.Type], piiPlaceholderSuffix)
+	v.placeholders[m.Value] = p
+	v.originals[p] = m.Value
+	v.replacer = nil
+	v.jsonReplacer = nil
+	return p
+}
+
+// Redact 将文本中的个人信息替换为占位符，相同的内容使用相同的占位符
+func (v *PIIVault) Redact(text string) string {
+	if v == nil || text == "" {
+		return text
+	}
+	return ReplacePII(text, findPII(text, v.detectors, v.custom), v.placeholder)
+}
+
+func (v *PIIVault) RedactMessages(messages []dto.Message) {
+	if v == nil {
+		return
+	}
+	for i := range messages {
+		if messages[i].IsStringContent() {
+			text := messages[i].StringContent()
+			if redacted := v.Redact(text); redacted != text {
+				messages[i].SetStringContent(redacted)
+			}
+			continue
+		}
+		contents := messages[i].ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeText {
+				continue
+			}
+			if redacted := v.Redact(contents[j].Text); redacted != contents[j].Text {
+				contents[j].Text = redacted
+				changed = true
+			}
+		}
+		if changed {
+			messages[i].SetMediaContent(contents)
+		}
+	}
+}
+
+// RedactInput 处理 prompt / input 这类字符串或字符串数组字段
+func (v *PIIVault) RedactInput(input any) any {
+	if v == nil {
+		return input
+	}
+	switch value := input.(type) {
+	case string:
+		return v.Redact(value)
+	case []any:
+		for i, item := range value {
+			if s, ok := item.(string); ok {
+				value[i] = v.Redact(s)
+			}
+		}
+	case []string:
+		for i, s := range value {
+			value[i] = v.Redact(s)
+		}
+	}
+	return input
+}
+
+// Restore 将文本中的占位符还原为原始内容
+func (v *PIIVault) Restore(text string) string {
+	if v.Empty() || !strings.Contains(text, piiPlaceholderPrefix) {
+		return text
+	}
+	if v.replacer == nil {
+		pairs := make([]string, 0, len(v.originals)*2)
+		for p, original := range v.originals {
+			pairs = append(pairs, p, original)
+		}
+		v.replacer = strings.NewReplacer(pairs...)
+	}
+	return v.replacer.Replace(text)
+}
+
+// RestoreJSON 还原 JSON 字符串字面量中的占位符，原始内容会按 JSON 规则转义
+func (v *PIIVault) RestoreJSON(data string) string {
+	if v.Empty() || !strings.Contains(data, piiPlaceholderPrefix) {
+		return data
+	}
+	if v.jsonReplacer == nil {
+		pairs := make([]string, 0, len(v.originals)*2)
+		for p, original := range v.originals {
+			escaped, _ := json.Marshal(original)
+			pairs = append(pairs, p, string(escaped[1:len(escaped)-1]))
+		}
+		v.jsonReplacer = strings.NewReplacer(pairs...)
+	}
+	return v.jsonReplacer.Replace(data)
+}
+
+// splitPartialPlaceholder 拆出末尾可能是不完整占位符的部分
+func splitPartialPlaceholder(text string) (string, string) {
+	idx := strings.LastIndex(text, piiPlaceholderPrefix[:1])
+	if idx > 0 && text[idx-1] == piiPlaceholderPrefix[0] {
+		idx--
+	}
+	if idx >= 0 && len(text)-idx < piiPlaceholderMaxLen && !strings.Contains(text[idx:], piiPlaceholderSuffix) {
+		return text[:idx], text[idx:]
+	}
+	return text, ""
+}
+
+// PIIStreamJoiner 流式输出时将被拆分到多个数据块中的占位符拼接完整后再输出，
+// 占位符本身由写出响应时的 ResponseWriter 统一还原
+type PIIStreamJoiner struct {
+	pending string
+}
+
+func (v *PIIVault) NewStreamJoiner() *PIIStreamJoiner {
+	if v.Empty() {
+		return nil
+	}
+	return &PIIStreamJoiner{}
+}
+
+func (r *PIIStreamJoiner) Push(text string) string {
+	text, r.pending = splitPartialPlaceholder(r.pending + text)
+	return text
+}
+
+func (r *PIIStreamJoiner) Flush() string {
+	rest := r.pending
+	r.pending = ""
+	return rest
+}
+
+// piiRestoreWriter 在写出响应时还原占位符，覆盖所有渠道的非流式与流式响应。
+// 透传等场景下同一段内容可能分多次写出，末尾不完整的占位符会等到下一次写出时再还原
+type piiRestoreWriter struct {
+	gin.ResponseWriter
+	vault   *PIIVault
+	pending string
+}
+
+func (w *piiRestoreWriter) WriteHeader(code int) {
+	// 还原后的内容长度会变化
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *piiRestoreWriter) Write(data []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	text, pending := splitPartialPlaceholder(w.pending + string(data))
+	w.pending = pending
+	if text != "" {
+		if _, err := w.ResponseWriter.Write([]byte(w.vault.RestoreJSON(text))); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// release 写出暂存的内容，响应结束时调用
+func (w *piiRestoreWriter) release() {
+	if w.pending == "" {
+		return
+	}
+	rest := w.pending
+	w.pending = ""
+	_, _ = w.ResponseWriter.Write([]byte(w.vault.RestoreJSON(rest)))
+}
+
+func (w *piiRestoreWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// UsePIIVault 为当前请求启用脱敏还原：保存到上下文供流式处理使用，并安装还原占位符的 ResponseWriter。
+// 重试时会先移除上一次安装的 ResponseWriter
+func UsePIIVault(c *gin.Context, vault *PIIVault) {
+	if w, ok := c.Writer.(*piiRestoreWriter); ok {
+		w.pending = ""
+		c.Writer = w.ResponseWriter
+	}
+	c.Set("pii_vault", vault)
+	if vault.Empty() {
+		return
+	}
+	c.Writer = &piiRestoreWriter{ResponseWriter: c.Writer, vault: vault}
+}
+
+// FlushPIIVault 响应写出结束或请求出错后写出还原 ResponseWriter 中暂存的内容并将其移除，
+// 之后由调用方写出的错误信息不再经过还原
+func FlushPIIVault(c *gin.Context) {
+	if w, ok := c.Writer.(*piiRestoreWriter); ok {
+		w.release()
+		if w.Written() {
+			w.ResponseWriter.Flush()
+		}
+		c.Writer = w.ResponseWriter
+	}
+}
+
+func GetPIIVault(c *gin.Context) *PIIVault {
+	vault, _ := c.Get("pii_vault")
+	v, _ := vault.(*PIIVault)
+	return v
+}
@@ -74,44 +74,79 @@ func calculateAudioQuota(info QuotaInfo) int {
 	return int(quota.Round(0).IntPart())
 }
 
+// applyAudioPricingRule 使用计费规则覆盖后的音频倍率重新计算额度，并叠加固定费用和时段折扣
+func applyAudioPricingRule(applied *operation_setting.AppliedPricingRule, info QuotaInfo, usage *dto.Usage,
+	completionRatio, audioRatio, audioCompletionRatio decimal.Decimal) int {
+	quota := decimal.NewFromInt(int64(info.InputDetails.TextTokens))
+	quota = quota.Add(decimal.NewFromInt(int64(info.OutputDetails.TextTokens)).Mul(completionRatio))
+	quota = quota.Add(decimal.NewFromInt(int64(info.InputDetails.AudioTokens)).Mul(audioRatio))
+	quota = quota.Add(decimal.NewFromInt(int64(info.OutputDetails.AudioTokens)).Mul(audioRatio).Mul(audioCompletionRatio))
+	quota = quota.Mul(decimal.NewFromFloat(info.ModelRatio)).Mul(decimal.NewFromFloat(info.GroupRatio))
+
+	// 音频倍率已在上面计算，这里只叠加推理、图片、固定费用和折扣
+	rest := *applied
+	rest.AudioInputRatio = 0
+	rest.AudioOutputRatio = 0
+	quota = helper.PricingRuleQuota(&rest, quota, usage, info.GroupRatio)
+	if info.ModelRatio != 0 && quota.LessThanOrEqual(decimal.Zero) {
+		quota = decimal.NewFromInt(1)
+	}
+	return int(quota.Round(0).IntPart())
+}
+
 func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) error {
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
-	if err != nil {
+	quota := realtimeUsageQuota(relayInfo, usage)
+	if session := GetRealtimeQuotaSession(ctx); session != nil {
+		return session.Settle(quota)
+	}
+	if err := checkRealtimeBalance(relayInfo, quota); err != nil {
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimLeft(relayInfo.TokenKey, "sk-"), false)
+	err := PostConsumeQuota(relayInfo, quota, 0, false)
 	if err != nil {
 		return err
 	}
+	common.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
+	return nil
+}
 
+func realtimeUsageQuota(relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) int {
 	modelName := relayInfo.OriginModelName
-	textInputTokens := usage.InputTokenDetails.TextTokens
-	textOutTokens := usage.OutputTokenDetails.TextTokens
-	audioInputTokens := usage.InputTokenDetails.AudioTokens
-	audioOutTokens := usage.OutputTokenDetails.AudioTokens
 	groupRatio := setting.GetGroupRatio(relayInfo.Group)
 	modelRatio, _ := operation_setting.GetModelRatio(modelName)
 
 	quotaInfo := QuotaInfo{
 		InputDetails: TokenDetails{
-			TextTokens:  textInputTokens,
-			AudioTokens: audioInputTokens,
+			TextTokens:  usage.InputTokenDetails.TextTokens,
+			AudioTokens: usage.InputTokenDetails.AudioTokens,
 		},
 		OutputDetails: TokenDetails{
-			TextTokens:  textOutTokens,
-			AudioTokens: audioOutTokens,
+			TextTokens:  usage.OutputTokenDetails.TextTokens,
+			AudioTokens: usage.OutputTokenDetails.AudioTokens,
 		},
 		ModelName:  modelName,
 		UsePrice:   relayInfo.UsePrice,
 		ModelRatio: modelRatio,
 		GroupRatio: groupRatio,
 	}
+	return calculateAudioQuota(quotaInfo)
+}
 
-	quota := calculateAudioQuota(quotaInfo)
+// checkRealtimeBalance 检查用户和令牌的剩余额度是否足够
+func checkRealtimeBalance(relayInfo *relaycommon.RelayInfo, quota int) error {
+	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	if err != nil {
+		return err
+	}
+
+	token, err := model.GetTokenByKey(strings.TrimLeft(relayInfo.TokenKey, "sk-"), false)
+	if err != nil {
+		return err
+	}
 
 	if userQuota < quota {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(quota))
@@ -120,12 +155,6 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
 	}
-
-	err = PostConsumeQuota(relayInfo, quota, 0, false)
-	if err != nil {
-		return err
-	}
-	common.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
 	return nil
 }
 
@@ -190,8 +219,9 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	}
 	other := GenerateWssOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice)
+	cost := CalculateChannelCost(ctx, relayInfo.UpstreamModelName, usage.InputTokens, 0, 0, usage.OutputTokens, quota, groupRatio)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, usage.InputTokens, usage.OutputTokens, logModel,
-		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+		tokenName, quota, cost, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
 }
 
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
@@ -201,6 +231,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 	modelName := relayInfo.OriginModelName
+	appliedRule := priceData.ApplyPricingRule(promptTokens + usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens)
 
 	tokenName := ctx.GetString("token_name")
 	completionRatio := priceData.CompletionRatio
@@ -213,6 +244,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 
 	cacheCreationRatio := priceData.CacheCreationRatio
 	cacheCreationTokens := usage.PromptTokensDetails.CachedCreationTokens
+	RecordSessionAffinity(ctx, relayInfo, promptTokens+cacheTokens+cacheCreationTokens, cacheTokens)
 
 	calculateQuota := 0.0
 	if !priceData.UsePrice {
@@ -221,6 +253,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		calculateQuota += float64(cacheCreationTokens) * cacheCreationRatio
 		calculateQuota += float64(completionTokens) * completionRatio
 		calculateQuota = calculateQuota * groupRatio * modelRatio
+		calculateQuota = helper.PricingRuleQuota(appliedRule, decimal.NewFromFloat(calculateQuota), usage, groupRatio).InexactFloat64()
 	} else {
 		calculateQuota = modelPrice * common.QuotaPerUnit * groupRatio
 	}
@@ -247,18 +280,17 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
 
-	quotaDelta := quota - preConsumedQuota
-	if quotaDelta != 0 {
-		err := PostConsumeQuota(relayInfo, quotaDelta, preConsumedQuota, true)
-		if err != nil {
-			common.LogError(ctx, "error consuming token remain quota: "+err.Error())
-		}
-	}
+	SettleConsumeQuota(ctx, relayInfo, modelName, quota, preConsumedQuota)
 
 	other := GenerateClaudeOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio,
 		cacheTokens, cacheRatio, cacheCreationTokens, cacheCreationRatio, modelPrice)
-	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, modelName,
-		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+	if appliedRule != nil {
+		other["pricing_rule"] = appliedRule
+	}
+	cost := CalculateChannelCost(ctx, relayInfo.UpstreamModelName, promptTokens, cacheTokens, cacheCreationTokens, completionTokens, quota, groupRatio)
+	consumeLog := model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, modelName,
+		tokenName, quota, cost, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+	CheckAutoRefund(relayInfo, consumeLog, completionTokens)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
@@ -276,6 +308,16 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	audioRatio := decimal.NewFromFloat(operation_setting.GetAudioRatio(relayInfo.OriginModelName))
 	audioCompletionRatio := decimal.NewFromFloat(operation_setting.GetAudioCompletionRatio(relayInfo.OriginModelName))
 
+	appliedRule := priceData.ApplyPricingRule(usage.PromptTokens)
+	if appliedRule != nil {
+		completionRatio = decimal.NewFromFloat(appliedRule.CompletionRatio)
+		if appliedRule.AudioInputRatio > 0 {
+			audioRatio = decimal.NewFromFloat(appliedRule.AudioInputRatio)
+		}
+		if appliedRule.AudioOutputRatio > 0 && !audioRatio.IsZero() {
+			audioCompletionRatio = decimal.NewFromFloat(appliedRule.AudioOutputRatio).Div(audioRatio)
+		}
+	}
 	modelRatio := priceData.ModelRatio
 	groupRatio := priceData.GroupRatio
 	modelPrice := priceData.ModelPrice
@@ -297,6 +339,9 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	}
 
 	quota := calculateAudioQuota(quotaInfo)
+	if appliedRule != nil {
+		quota = applyAudioPricingRule(appliedRule, quotaInfo, usage, completionRatio, audioRatio, audioCompletionRatio)
+	}
 
 	totalTokens := usage.TotalTokens
 	var logContent string
@@ -320,13 +365,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
 
-	quotaDelta := quota - preConsumedQuota
-	if quotaDelta != 0 {
-		err := PostConsumeQuota(relayInfo, quotaDelta, preConsumedQuota, true)
-		if err != nil {
-			common.LogError(ctx, "error consuming token remain quota: "+err.Error())
-		}
-	}
+	SettleConsumeQuota(ctx, relayInfo, relayInfo.OriginModelName, quota, preConsumedQuota)
 
 	logModel := relayInfo.OriginModelName
 	if extraContent != "" {
@@ -334,8 +373,34 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	}
 	other := GenerateAudioOtherInfo(ctx, relayInfo, usage, modelRatio, groupRatio,
 		completionRatio.InexactFloat64(), audioRatio.InexactFloat64(), audioCompletionRatio.InexactFloat64(), modelPrice)
+	if appliedRule != nil {
+		other["pricing_rule"] = appliedRule
+	}
+	cost := CalculateChannelCost(ctx, relayInfo.UpstreamModelName, usage.PromptTokens, 0, 0, usage.CompletionTokens, quota, groupRatio)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, usage.PromptTokens, usage.CompletionTokens, logModel,
-		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+		tokenName, quota, cost, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, relayInfo.Group, other)
+}
+
+// SettleConsumeQuota 按实际用量结算：模型额度券发放的额度优先于用户额度扣除，剩余部分与预扣费的差额从用户和令牌额度结算。
+// 由模型额度抵扣的部分保存到 relayInfo.ModelCreditQuota，生成日志信息时记录为 model_credit_quota
+func SettleConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string, quota int, preConsumedQuota int) {
+	creditQuota := 0
+	if quota > 0 && !relayInfo.IsPlayground {
+		var err error
+		creditQuota, err = model.ConsumeModelCredit(relayInfo.UserId, modelName, quota)
+		if err != nil {
+			common.LogError(ctx, "error consuming model credit: "+err.Error())
+		}
+	}
+	relayInfo.ModelCreditQuota = creditQuota
+
+	quotaDelta := quota - creditQuota - preConsumedQuota
+	if quotaDelta != 0 {
+		err := PostConsumeQuota(relayInfo, quotaDelta, preConsumedQuota, true)
+		if err != nil {
+			common.LogError(ctx, "error consuming token remain quota: "+err.Error())
+		}
+	}
 }
 
 func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
@@ -372,6 +437,8 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 	if err != nil {
 		return err
 	}
+	// 预扣费在扣减用户额度时已经结算，这里只结算本次的差额
+	model.DeltaSettleCreditLots(relayInfo.UserId, quota)
 
 	if !relayInfo.IsPlayground {
 		if quota > 0 {
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"veloera/common"
+	relaycommon "veloera/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RealtimeQuotaSession 实时会话的额度预留与增量结算。
+// 会话开始时预扣一部分额度，每次收到用量后先从预留中扣减，预留不足时扣除超出部分并重新预留，
+// 余额不足以继续预留时返回错误以结束会话；会话结束时退还未使用的预留。
+type RealtimeQuotaSession struct {
+	mu          sync.Mutex
+	ctx         *gin.Context
+	info        *relaycommon.RelayInfo
+	reserved    int
+	reserveUnit int
+	consumed    int
+}
+
+// NewRealtimeQuotaSession reserved 为已经预扣的额度，reserveUnit 为之后每次补充预留的额度
+func NewRealtimeQuotaSession(c *gin.Context, info *relaycommon.RelayInfo, reserved int, reserveUnit int) *RealtimeQuotaSession {
+	session := &RealtimeQuotaSession{
+		ctx:         c,
+		info:        info,
+		reserved:    reserved,
+		reserveUnit: reserveUnit,
+	}
+	c.Set("realtime_quota_session", session)
+	return session
+}
+
+func GetRealtimeQuotaSession(c *gin.Context) *RealtimeQuotaSession {
+	session, ok := c.Get("realtime_quota_session")
+	if !ok {
+		return nil
+	}
+	s, _ := session.(*RealtimeQuotaSession)
+	return s
+}
+
+// Settle 结算一次用量
+func (s *RealtimeQuotaSession) Settle(quota int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consumed += quota
+	if quota <= s.reserved {
+		s.reserved -= quota
+		return nil
+	}
+	quota -= s.reserved
+	s.reserved = 0
+	if err := checkRealtimeBalance(s.info, quota+s.reserveUnit); err != nil {
+		// 已产生的用量照常扣除，余额不足以继续预留时结束会话
+		if consumeErr := PostConsumeQuota(s.info, quota, 0, false); consumeErr != nil {
+			common.LogError(s.ctx, "error consuming realtime quota: "+consumeErr.Error())
+		}
+		return err
+	}
+	if err := PostConsumeQuota(s.info, quota+s.reserveUnit, 0, false); err != nil {
+		return err
+	}
+	s.reserved = s.reserveUnit
+	common.LogInfo(s.ctx, fmt.Sprintf("realtime session consumed quota %d, reserved %d", quota, s.reserveUnit))
+	return nil
+}
+
+// Consumed 返回会话中已结算的额度
+func (s *RealtimeQuotaSession) Consumed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consumed
+}
+
+// Close 退还未使用的预留额度，按次计费的模型不退还
+func (s *RealtimeQuotaSession) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info.UsePrice || s.reserved <= 0 {
+		return
+	}
+	if err := PostConsumeQuota(s.info, -s.reserved, 0, false); err != nil {
+		common.SysError("error return realtime reserved quota: " + err.Error())
+	}
+	s.reserved = 0
+}
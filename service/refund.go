@@ -0,0 +1,43 @@
+package service
+
+import (
+	"fmt"
+	"veloera/model"
+	relaycommon "veloera/relay/common"
+	relayconstant "veloera/relay/constant"
+	"veloera/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// autoRefundReason 判断已计费的对话请求是否命中自动退款规则，返回退款原因。
+// finish_reason 由 OpenAI 兼容、Claude 和 Gemini 渠道的响应处理记录，均转换为 OpenAI 格式，
+// 其他渠道的 info.FinishReason 为空，只适用空回复规则
+func autoRefundReason(info *relaycommon.RelayInfo, completionTokens int) string {
+	if info.RelayFormat != relaycommon.RelayFormatClaude &&
+		info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+		return ""
+	}
+	setting := operation_setting.GetRefundSetting()
+	if setting.IsAutoRefundFinishReason(info.FinishReason) {
+		return fmt.Sprintf("自动退款：上游返回 finish_reason %s", info.FinishReason)
+	}
+	if setting.AutoRefundEmptyResponse && completionTokens == 0 {
+		return "自动退款：上游未返回任何内容"
+	}
+	return ""
+}
+
+// CheckAutoRefund 消费记录写入后按自动退款规则退款，消费日志未开启时无法关联退款记录，不会自动退款
+func CheckAutoRefund(info *relaycommon.RelayInfo, consumeLog *model.Log, completionTokens int) {
+	if consumeLog == nil || consumeLog.Quota <= 0 {
+		return
+	}
+	reason := autoRefundReason(info, completionTokens)
+	if reason == "" {
+		return
+	}
+	gopool.Go(func() {
+		model.AutoRefundConsumeLog(consumeLog, reason)
+	})
+}
@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 	"veloera/dto"
 	"veloera/setting"
@@ -40,6 +39,29 @@ func CheckSensitiveText(text string) ([]string, error) {
 	return nil, nil
 }
 
+// CheckSensitiveRealtimeEvent 检查实时会话中的用户输入：会话指令、文本消息和语音转写
+func CheckSensitiveRealtimeEvent(event *dto.RealtimeEvent) ([]string, error) {
+	var texts []string
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session != nil {
+			texts = append(texts, event.Session.Instructions)
+		}
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item != nil {
+			for _, content := range event.Item.Content {
+				texts = append(texts, content.Text, content.Transcript)
+			}
+		}
+	case dto.RealtimeEventInputAudioTranscriptionCompleted:
+		texts = append(texts, event.Transcript)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return CheckSensitiveText(strings.Join(texts, "\n"))
+}
+
 func CheckSensitiveInput(input any) ([]string, error) {
 	switch v := input.(type) {
 	case string:
@@ -65,9 +87,9 @@ func SensitiveWordContains(text string) (bool, []string) {
 	checkText := strings.ToLower(text)
 
 	// First check regular expressions
-	for _, pattern := range setting.RegexSensitiveWords {
-		if matched, err := regexp.MatchString(pattern, checkText); err == nil && matched {
-			return true, []string{pattern}
+	for _, re := range setting.GetRegexSensitiveWords() {
+		if re.MatchString(checkText) {
+			return true, []string{strings.TrimPrefix(re.String(), "(?i)")}
 		}
 	}
 
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+	"veloera/common"
+	"veloera/constant"
+	relaycommon "veloera/relay/common"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sessionAffinityKeyPrefix = "session_affinity:"
+
+// SessionAffinity 会话绑定的渠道和密钥序号
+type SessionAffinity struct {
+	ChannelId int `json:"channel_id"`
+	KeyIndex  int `json:"key_index"`
+}
+
+type sessionAffinityEntry struct {
+	affinity  SessionAffinity
+	expiresAt time.Time
+}
+
+var (
+	sessionAffinityLock    sync.Mutex
+	sessionAffinities      = make(map[string]sessionAffinityEntry)
+	sessionAffinityCleanAt time.Time
+)
+
+func sessionAffinityTTL() time.Duration {
+	ttl := operation_setting.GetSessionAffinitySetting().TTLSeconds
+	if ttl <= 0 {
+		ttl = 600
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// GetSessionAffinity 读取会话绑定，启用 Redis 时多个实例共享绑定
+func GetSessionAffinity(key string) (*SessionAffinity, bool) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(sessionAffinityKeyPrefix + key)
+		if err != nil {
+			return nil, false
+		}
+		var affinity SessionAffinity
+		if err := json.Unmarshal([]byte(value), &affinity); err != nil {
+			return nil, false
+		}
+		return &affinity, true
+	}
+	sessionAffinityLock.Lock()
+	defer sessionAffinityLock.Unlock()
+	entry, ok := sessionAffinities[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	affinity := entry.affinity
+	return &affinity, true
+}
+
+// SetSessionAffinity 保存会话绑定并刷新有效期
+func SetSessionAffinity(key string, affinity SessionAffinity) {
+	ttl := sessionAffinityTTL()
+	if common.RedisEnabled {
+		value, _ := json.Marshal(affinity)
+		if err := common.RedisSet(sessionAffinityKeyPrefix+key, string(value), ttl); err != nil {
+			common.SysError("failed to save session affinity: " + err.Error())
+		}
+		return
+	}
+	now := time.Now()
+	sessionAffinityLock.Lock()
+	defer sessionAffinityLock.Unlock()
+	sessionAffinities[key] = sessionAffinityEntry{affinity: affinity, expiresAt: now.Add(ttl)}
+	// 定期清理过期的绑定，避免内存持续增长
+	if now.Sub(sessionAffinityCleanAt) > time.Minute {
+		sessionAffinityCleanAt = now
+		for k, entry := range sessionAffinities {
+			if now.After(entry.expiresAt) {
+				delete(sessionAffinities, k)
+			}
+		}
+	}
+}
+
+// DeleteSessionAffinity 绑定的渠道不可用时删除绑定，下次请求重新选择渠道
+func DeleteSessionAffinity(key string) {
+	if common.RedisEnabled {
+		_ = common.RedisDel(sessionAffinityKeyPrefix + key)
+		return
+	}
+	sessionAffinityLock.Lock()
+	delete(sessionAffinities, key)
+	sessionAffinityLock.Unlock()
+}
+
+// ChannelCacheStats 渠道的提示词缓存命中统计，只统计当前实例启动以来的请求
+type ChannelCacheStats struct {
+	ChannelId        int     `json:"channel_id"`
+	Requests         int64   `json:"requests"`
+	AffinityRequests int64   `json:"affinity_requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	CacheHitRate     float64 `json:"cache_hit_rate"`
+}
+
+var (
+	channelCacheStatsLock sync.Mutex
+	channelCacheStats     = make(map[int]*ChannelCacheStats)
+)
+
+// RecordSessionAffinity 请求成功后记录会话绑定和渠道的缓存命中情况，promptTokens 包含缓存命中的部分
+func RecordSessionAffinity(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int, cachedTokens int) {
+	if key := c.GetString(constant.ContextKeySessionAffinity); key != "" {
+		SetSessionAffinity(key, SessionAffinity{
+			ChannelId: relayInfo.ChannelId,
+			KeyIndex:  c.GetInt(constant.ContextKeyChannelKeyIndex),
+		})
+	}
+
+	channelCacheStatsLock.Lock()
+	defer channelCacheStatsLock.Unlock()
+	stats, ok := channelCacheStats[relayInfo.ChannelId]
+	if !ok {
+		stats = &ChannelCacheStats{ChannelId: relayInfo.ChannelId}
+		channelCacheStats[relayInfo.ChannelId] = stats
+	}
+	stats.Requests++
+	if c.GetBool(constant.ContextKeySessionAffinityHit) {
+		stats.AffinityRequests++
+	}
+	stats.PromptTokens += int64(promptTokens)
+	stats.CachedTokens += int64(cachedTokens)
+}
+
+// GetChannelCacheStats 返回各渠道的缓存命中统计，按渠道 ID 排序
+func GetChannelCacheStats() []ChannelCacheStats {
+	channelCacheStatsLock.Lock()
+	defer channelCacheStatsLock.Unlock()
+	result := make([]ChannelCacheStats, 0, len(channelCacheStats))
+	for _, stats := range channelCacheStats {
+		item := *stats
+		if item.PromptTokens > 0 {
+			item.CacheHitRate = float64(item.CachedTokens) / float64(item.PromptTokens)
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ChannelId < result[j].ChannelId
+	})
+	return result
+}
+
+// ResetChannelCacheStats 清空缓存命中统计
+func ResetChannelCacheStats() {
+	channelCacheStatsLock.Lock()
+	channelCacheStats = make(map[int]*ChannelCacheStats)
+	channelCacheStatsLock.Unlock()
+}
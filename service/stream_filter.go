@@ -0,0 +1,394 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"veloera/common"
+	"veloera/constant"
+	"veloera/dto"
+	"veloera/setting"
+	"veloera/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamContentFilter 流式输出内容过滤器。
+// 尚未发送的文本保存在滑动窗口中，窗口至少保留最长屏蔽词长度减一个字符，有正则或个人信息检查时至少保留
+// StreamFilterHoldLength 个字符，以及最近 StreamCacheQueueLength 个数据块，这样跨越数据块边界的内容也能在发送前被替换或截断。
+// 审核模型与自定义服务等远程护栏按 StreamGuardrailCheckLength 个字符或整句批量检查，检查前的文本不会发送。
+type StreamContentFilter struct {
+	c               *gin.Context
+	guardrail       *GuardrailPipeline
+	remote          *GuardrailPipeline
+	patterns        []*regexp.Regexp
+	stopOnSensitive bool
+	minHold         int
+	queueLength     int
+	remoteBatch     int
+	pending         []rune
+	chunkLens       []int
+	remoteFrom      int // pending 中尚未经过远程护栏检查的起始位置
+	unchecked       int
+	delivered       strings.Builder
+	// Stopped 为 true 表示命中了需要停止生成的规则，之后的内容都会被丢弃
+	Stopped bool
+	Reasons []string
+}
+
+// NewStreamContentFilter 未开启输出屏蔽词检查且没有输出护栏策略时返回 nil
+func NewStreamContentFilter(c *gin.Context) *StreamContentFilter {
+	guardrail := NewGuardrailPipeline(c, GuardrailDirectionOutput)
+	checkSensitive := setting.ShouldCheckCompletionSensitive()
+	if guardrail == nil && !checkSensitive {
+		return nil
+	}
+	local, remote := guardrail.SplitRemote()
+	f := &StreamContentFilter{
+		c:               c,
+		guardrail:       local,
+		remote:          remote,
+		stopOnSensitive: setting.StopOnSensitiveEnabled,
+		queueLength:     setting.StreamCacheQueueLength,
+		remoteBatch:     setting.StreamGuardrailCheckLength,
+	}
+	if checkSensitive {
+		if re := setting.GetSensitiveWordsPattern(); re != nil {
+			f.patterns = append(f.patterns, re)
+		}
+		regexes := setting.GetRegexSensitiveWords()
+		if len(regexes) > 0 {
+			f.patterns = append(f.patterns, regexes...)
+			f.holdPattern()
+		}
+		f.holdWords(setting.SensitiveWords)
+	}
+	if local != nil {
+		for _, step := range local.steps {
+			switch step.stage.Type {
+			case operation_setting.GuardrailTypeKeyword:
+				f.holdWords(step.stage.Words)
+				if step.stage.UseSensitiveWords {
+					f.holdWords(setting.SensitiveWords)
+					if len(setting.RegexSensitiveWords) > 0 {
+						f.holdPattern()
+					}
+				}
+				if len(step.stage.Regexes) > 0 {
+					f.holdPattern()
+				}
+			case operation_setting.GuardrailTypePII:
+				f.holdPattern()
+			}
+		}
+	}
+	return f
+}
+
+// holdPattern 正则和个人信息的匹配长度无法预知，保留固定长度的窗口
+func (f *StreamContentFilter) holdPattern() {
+	if setting.StreamFilterHoldLength > f.minHold {
+		f.minHold = setting.StreamFilterHoldLength
+	}
+}
+
+func (f *StreamContentFilter) holdWords(words []string) {
+	for _, word := range words {
+		if n := utf8.RuneCountInString(word) - 1; n > f.minHold {
+			f.minHold = n
+		}
+	}
+}
+
+func (f *StreamContentFilter) holdLength() int {
+	hold := f.minHold
+	if f.queueLength > 0 {
+		queued := 0
+		for i := len(f.chunkLens) - 1; i >= 0 && i >= len(f.chunkLens)-f.queueLength; i-- {
+			queued += f.chunkLens[i]
+		}
+		if queued > hold {
+			hold = queued
+		}
+	}
+	return hold
+}
+
+// Push 追加一段上游输出，返回当前可以发送给客户端的文本
+func (f *StreamContentFilter) Push(text string) string {
+	if f.Stopped || text == "" {
+		return ""
+	}
+	n := utf8.RuneCountInString(text)
+	f.pending = append(f.pending, []rune(text)...)
+	f.chunkLens = append(f.chunkLens, n)
+	f.unchecked += n
+	if len(f.pending) <= f.holdLength() {
+		return ""
+	}
+	if f.remote != nil && !f.remoteDue(text) {
+		return ""
+	}
+	if !f.check() {
+		return f.stop()
+	}
+	return f.release(len(f.pending) - f.holdLength())
+}
+
+// remoteDue 未检查的文本达到批量长度或以句末标点结尾时进行远程检查
+func (f *StreamContentFilter) remoteDue(text string) bool {
+	if f.unchecked >= f.remoteBatch {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRight(text, " "))
+	return strings.ContainsRune(".!?。！？\n", last)
+}
+
+// Flush 在上游输出结束时检查并返回窗口中剩余的文本
+func (f *StreamContentFilter) Flush() string {
+	if f.Stopped || len(f.pending) == 0 {
+		return ""
+	}
+	if !f.check() {
+		return f.stop()
+	}
+	return f.release(len(f.pending))
+}
+
+// Delivered 返回实际发送给客户端的文本，用于停止生成后的计费
+func (f *StreamContentFilter) Delivered() string {
+	return f.delivered.String()
+}
+
+// check 检查窗口中的文本并就地替换，需要停止生成时截断窗口并返回 false
+func (f *StreamContentFilter) check() bool {
+	origin := string(f.pending)
+	text := origin
+	for _, re := range f.patterns {
+		loc := re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		f.Reasons = append(f.Reasons, text[loc[0]:loc[1]])
+		common.LogWarn(f.c, fmt.Sprintf("sensitive words detected in completion: %s", text[loc[0]:loc[1]]))
+		if f.stopOnSensitive {
+			f.pending = []rune(text[:loc[0]])
+			return false
+		}
+		text = re.ReplaceAllLiteralString(text, guardrailMask)
+	}
+	if f.guardrail != nil {
+		checked, err := f.guardrail.Check(f.c, text)
+		if err != nil {
+			// 护栏拦截时没有匹配位置，窗口内的文本全部丢弃
+			f.Reasons = append(f.Reasons, err.Error())
+			f.pending = nil
+			return false
+		}
+		text = checked
+	}
+	if f.remote != nil {
+		// 只检查新增的文本，避免保留在窗口中的内容被重复检查和记录
+		runes := []rune(text)
+		from := min(f.remoteFrom, len(runes))
+		checked, err := f.remote.Check(f.c, string(runes[from:]))
+		if err != nil {
+			f.Reasons = append(f.Reasons, err.Error())
+			f.pending = runes[:from]
+			return false
+		}
+		text = string(runes[:from]) + checked
+		f.unchecked = 0
+		f.remoteFrom = utf8.RuneCountInString(text)
+	}
+	if text != origin {
+		delta := utf8.RuneCountInString(text) - len(f.pending)
+		f.pending = []rune(text)
+		if last := len(f.chunkLens) - 1; last >= 0 {
+			f.chunkLens[last] += delta
+			if f.chunkLens[last] < 0 {
+				f.chunkLens[last] = 0
+			}
+		}
+	}
+	return true
+}
+
+func (f *StreamContentFilter) release(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	out := string(f.pending[:n])
+	f.pending = f.pending[n:]
+	f.remoteFrom = max(f.remoteFrom-n, 0)
+	for n > 0 && len(f.chunkLens) > 0 {
+		if f.chunkLens[0] > n {
+			f.chunkLens[0] -= n
+			break
+		}
+		n -= f.chunkLens[0]
+		f.chunkLens = f.chunkLens[1:]
+	}
+	f.delivered.WriteString(out)
+	return out
+}
+
+func (f *StreamContentFilter) stop() string {
+	f.Stopped = true
+	out := string(f.pending)
+	f.pending = nil
+	f.chunkLens = nil
+	f.delivered.WriteString(out)
+	return out
+}
+
+// ChoiceContentFilters 为 OpenAI 格式流式响应中的每个 choice 保存一个输出过滤器，n>1 时各 choice 的内容分别检查
+type ChoiceContentFilters struct {
+	c       *gin.Context
+	filters map[int]*StreamContentFilter
+}
+
+// NewChoiceContentFilters 未开启输出屏蔽词检查且没有输出护栏策略时返回 nil
+func NewChoiceContentFilters(c *gin.Context) *ChoiceContentFilters {
+	first := NewStreamContentFilter(c)
+	if first == nil {
+		return nil
+	}
+	return &ChoiceContentFilters{c: c, filters: map[int]*StreamContentFilter{0: first}}
+}
+
+func (s *ChoiceContentFilters) get(index int) *StreamContentFilter {
+	f, ok := s.filters[index]
+	if !ok {
+		f = NewStreamContentFilter(s.c)
+		s.filters[index] = f
+	}
+	return f
+}
+
+// Filter 将数据块中每个 choice 的文本替换为对应过滤器当前放行的内容，遇到结束标记时清空窗口；
+// 刚停止生成的 choice 将 finish_reason 设为 content_filter，之前已经停止的 choice 从数据块中移除
+func (s *ChoiceContentFilters) Filter(response *dto.ChatCompletionsStreamResponse) {
+	choices := response.Choices[:0]
+	for _, choice := range response.Choices {
+		f := s.get(choice.Index)
+		if f.Stopped {
+			continue
+		}
+		content := f.Push(choice.Delta.GetContentString())
+		if choice.FinishReason != nil {
+			content += f.Flush()
+		}
+		if choice.Delta.Content != nil || content != "" {
+			choice.Delta.SetContentString(content)
+		}
+		if f.Stopped {
+			finishReason := constant.FinishReasonContentFilter
+			choice.FinishReason = &finishReason
+			choice.Delta.ToolCalls = nil
+		}
+		choices = append(choices, choice)
+	}
+	response.Choices = choices
+}
+
+// Flush 在上游输出结束时检查各 choice 窗口中剩余的文本，rest 为需要先追加到对应 choice 的文本，返回可以补发的内容
+func (s *ChoiceContentFilters) Flush(rest map[int]string) map[int]string {
+	for index := range rest {
+		s.get(index)
+	}
+	out := make(map[int]string)
+	for index, f := range s.filters {
+		if text := f.Push(rest[index]) + f.Flush(); text != "" {
+			out[index] = text
+		}
+	}
+	return out
+}
+
+// FlushResponse 将各 choice 窗口中剩余的文本组成一个数据块，没有剩余内容时返回 nil
+func (s *ChoiceContentFilters) FlushResponse(id string, created int64, model string) *dto.ChatCompletionsStreamResponse {
+	rest := s.Flush(nil)
+	if len(rest) == 0 {
+		return nil
+	}
+	response := &dto.ChatCompletionsStreamResponse{
+		Id:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+	}
+	for index := range s.filters {
+		if text, ok := rest[index]; ok {
+			choice := dto.ChatCompletionsStreamResponseChoice{Index: index}
+			choice.Delta.SetContentString(text)
+			response.Choices = append(response.Choices, choice)
+		}
+	}
+	sort.Slice(response.Choices, func(i, j int) bool {
+		return response.Choices[i].Index < response.Choices[j].Index
+	})
+	return response
+}
+
+// Stopped 所有 choice 都停止生成后不再需要读取上游
+func (s *ChoiceContentFilters) Stopped() bool {
+	for _, f := range s.filters {
+		if !f.Stopped {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyStopped 是否有 choice 命中了停止生成的规则
+func (s *ChoiceContentFilters) AnyStopped() bool {
+	for _, f := range s.filters {
+		if f.Stopped {
+			return true
+		}
+	}
+	return false
+}
+
+// Reasons 返回各 choice 命中的规则
+func (s *ChoiceContentFilters) Reasons() []string {
+	var reasons []string
+	for _, f := range s.filters {
+		reasons = append(reasons, f.Reasons...)
+	}
+	return reasons
+}
+
+// Delivered 返回各 choice 实际发送给客户端的文本，用于停止生成后的计费
+func (s *ChoiceContentFilters) Delivered() string {
+	var delivered strings.Builder
+	for _, f := range s.filters {
+		delivered.WriteString(f.Delivered())
+	}
+	return delivered.String()
+}
+
+// FilterTextResponse 非流式响应的每个 choice 分别经过输出过滤，命中停止规则时截断内容并将 finish_reason 设为 content_filter，
+// 返回内容是否被修改以及是否有 choice 被截断
+func FilterTextResponse(c *gin.Context, response *dto.OpenAITextResponse) (changed bool, stopped bool) {
+	for i, choice := range response.Choices {
+		filter := NewStreamContentFilter(c)
+		if filter == nil {
+			return false, false
+		}
+		content := choice.Message.StringContent()
+		checked := filter.Push(content) + filter.Flush()
+		if filter.Stopped {
+			response.Choices[i].FinishReason = constant.FinishReasonContentFilter
+			stopped = true
+		}
+		if checked != content || filter.Stopped {
+			response.Choices[i].Message.SetStringContent(checked)
+			changed = true
+		}
+	}
+	return changed, stopped
+}
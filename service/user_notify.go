@@ -60,6 +60,11 @@ func NotifyUser(userId int, userEmail string, userSetting map[string]interface{}
 		var webhookSecret string
 		if secret, ok := userSetting[constant.UserSettingWebhookSecret]; ok {
 			webhookSecret, _ = secret.(string)
+			var err error
+			webhookSecret, err = common.DecryptSecret(webhookSecret)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt webhook secret: %v", err)
+			}
 		}
 
 		return SendWebhookNotify(webhookURLStr, webhookSecret, data)
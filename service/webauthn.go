@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"veloera/setting/system_setting"
+)
+
+const (
+	WebAuthnTypeCreate = "webauthn.create"
+	WebAuthnTypeGet    = "webauthn.get"
+
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+)
+
+// WebAuthnAssertion 浏览器 navigator.credentials.get 返回的断言，二进制字段均为 Base64URL 编码
+type WebAuthnAssertion struct {
+	Id                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"user_handle"`
+}
+
+// WebAuthnAttestation 浏览器 navigator.credentials.create 返回的凭据，公钥取自 getPublicKey() 的 SPKI 编码
+type WebAuthnAttestation struct {
+	Id                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	PublicKey         string `json:"public_key"`
+}
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// NewWebAuthnChallenge 生成 Base64URL 编码的随机挑战
+func NewWebAuthnChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(challenge), nil
+}
+
+// decodeWebAuthnBase64 兼容浏览器和第三方库常用的几种 Base64 编码
+func decodeWebAuthnBase64(s string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.StdEncoding, base64.RawStdEncoding} {
+		if data, err := encoding.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("invalid base64 data")
+}
+
+func verifyWebAuthnClientData(clientDataJSON []byte, expectedType string, challenge string) error {
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return errors.New("无效的 clientDataJSON")
+	}
+	if clientData.Type != expectedType {
+		return errors.New("通行密钥操作类型不匹配")
+	}
+	if challenge == "" || clientData.Challenge != challenge {
+		return errors.New("通行密钥挑战已失效，请重试")
+	}
+	if !system_setting.IsWebAuthnOriginAllowed(clientData.Origin) {
+		return errors.New("通行密钥请求来源不被允许：" + clientData.Origin)
+	}
+	return nil
+}
+
+// verifyWebAuthnAuthenticatorData 校验域名哈希、用户在场和用户验证标志，返回签名计数。
+// 通行密钥会作为两步验证和重新验证身份使用，必须经过 PIN 或生物识别等用户验证
+func verifyWebAuthnAuthenticatorData(authData []byte) (uint32, error) {
+	if len(authData) < 37 {
+		return 0, errors.New("无效的 authenticatorData")
+	}
+	rpIdHash := sha256.Sum256([]byte(system_setting.GetWebAuthnRPID()))
+	if !bytes.Equal(authData[:32], rpIdHash[:]) {
+		return 0, errors.New("通行密钥域名不匹配")
+	}
+	if authData[32]&webAuthnFlagUserPresent == 0 {
+		return 0, errors.New("通行密钥验证未确认用户在场")
+	}
+	if authData[32]&webAuthnFlagUserVerified == 0 {
+		return 0, errors.New("通行密钥验证未经过 PIN 或生物识别等用户验证")
+	}
+	return binary.BigEndian.Uint32(authData[33:37]), nil
+}
+
+// VerifyWebAuthnAttestation 校验注册请求，返回凭据 ID、Base64 编码的公钥和签名计数
+// 只接受 attestation 为 none 的注册，不校验认证器的厂商证明
+func VerifyWebAuthnAttestation(attestation WebAuthnAttestation, challenge string) (string, string, uint32, error) {
+	clientDataJSON, err := decodeWebAuthnBase64(attestation.ClientDataJSON)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if err := verifyWebAuthnClientData(clientDataJSON, WebAuthnTypeCreate, challenge); err != nil {
+		return "", "", 0, err
+	}
+	authData, err := decodeWebAuthnBase64(attestation.AuthenticatorData)
+	if err != nil {
+		return "", "", 0, err
+	}
+	signCount, err := verifyWebAuthnAuthenticatorData(authData)
+	if err != nil {
+		return "", "", 0, err
+	}
+	publicKey, err := decodeWebAuthnBase64(attestation.PublicKey)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if _, err := parseWebAuthnPublicKey(publicKey); err != nil {
+		return "", "", 0, err
+	}
+	credentialId, err := decodeWebAuthnBase64(attestation.Id)
+	if err != nil || len(credentialId) == 0 {
+		return "", "", 0, errors.New("无效的凭据 ID")
+	}
+	return base64.RawURLEncoding.EncodeToString(credentialId), base64.StdEncoding.EncodeToString(publicKey), signCount, nil
+}
+
+// VerifyWebAuthnAssertion 使用保存的公钥校验登录断言，返回新的签名计数
+func VerifyWebAuthnAssertion(assertion WebAuthnAssertion, challenge string, publicKey string, storedSignCount int64) (int64, error) {
+	clientDataJSON, err := decodeWebAuthnBase64(assertion.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyWebAuthnClientData(clientDataJSON, WebAuthnTypeGet, challenge); err != nil {
+		return 0, err
+	}
+	authData, err := decodeWebAuthnBase64(assertion.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	signCount, err := verifyWebAuthnAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := decodeWebAuthnBase64(assertion.Signature)
+	if err != nil {
+		return 0, err
+	}
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	key, err := parseWebAuthnPublicKey(der)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(append([]byte{}, authData...), clientDataHash[:]...)
+	if !verifyWebAuthnSignature(key, message, signature) {
+		return 0, errors.New("通行密钥签名校验失败")
+	}
+	// 签名计数没有增长说明凭据可能被克隆，不支持计数的认证器始终为 0
+	if (signCount != 0 || storedSignCount != 0) && int64(signCount) <= storedSignCount {
+		return 0, errors.New("通行密钥签名计数异常")
+	}
+	return int64(signCount), nil
+}
+
+func parseWebAuthnPublicKey(der []byte) (crypto.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("无效的通行密钥公钥")
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errors.New("不支持的通行密钥算法")
+}
+
+func verifyWebAuthnSignature(key crypto.PublicKey, message []byte, signature []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			digest := sha512.Sum384(message)
+			return ecdsa.VerifyASN1(k, digest[:], signature)
+		case elliptic.P521():
+			digest := sha512.Sum512(message)
+			return ecdsa.VerifyASN1(k, digest[:], signature)
+		}
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, message, signature)
+	}
+	return false
+}
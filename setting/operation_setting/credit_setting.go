@@ -0,0 +1,45 @@
+package operation_setting
+
+import "veloera/setting/config"
+
+// CreditSetting 各来源额度的有效天数，0 表示永不过期，修改只影响之后发放的额度
+type CreditSetting struct {
+	TopUpExpireDays      int `json:"topup_expire_days"`
+	PromotionExpireDays  int `json:"promotion_expire_days"`
+	RedemptionExpireDays int `json:"redemption_expire_days"`
+	GiftExpireDays       int `json:"gift_expire_days"`
+	CheckInExpireDays    int `json:"checkin_expire_days"`
+	AffiliateExpireDays  int `json:"affiliate_expire_days"`
+	SignupExpireDays     int `json:"signup_expire_days"`
+}
+
+var creditSetting = CreditSetting{}
+
+func init() {
+	config.GlobalConfig.Register("credit", &creditSetting)
+}
+
+func GetCreditSetting() *CreditSetting {
+	return &creditSetting
+}
+
+// ExpireDays 返回来源对应的有效天数，订阅额度按订阅周期过期，不在此配置
+func (s *CreditSetting) ExpireDays(source string) int {
+	switch source {
+	case "topup":
+		return s.TopUpExpireDays
+	case "promotion":
+		return s.PromotionExpireDays
+	case "redemption":
+		return s.RedemptionExpireDays
+	case "gift":
+		return s.GiftExpireDays
+	case "checkin":
+		return s.CheckInExpireDays
+	case "affiliate":
+		return s.AffiliateExpireDays
+	case "signup":
+		return s.SignupExpireDays
+	}
+	return 0
+}
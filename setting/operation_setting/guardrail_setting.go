@@ -0,0 +1,147 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"veloera/setting/config"
+)
+
+const (
+	GuardrailTypeKeyword    = "keyword"
+	GuardrailTypePII        = "pii"
+	GuardrailTypeModeration = "moderation"
+	GuardrailTypeHTTP       = "http"
+)
+
+const (
+	GuardrailActionBlock  = "block"
+	GuardrailActionRedact = "redact"
+	GuardrailActionLog    = "log"
+)
+
+// GuardrailStage 护栏流水线中的一个检查阶段
+type GuardrailStage struct {
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	// keyword 类型：额外的屏蔽词与正则，可选复用全局屏蔽词
+	Words             []string `json:"words,omitempty"`
+	Regexes           []string `json:"regexes,omitempty"`
+	UseSensitiveWords bool     `json:"use_sensitive_words,omitempty"`
+	// pii 类型：启用的检测器，email / phone / credit_card / id_card，留空表示全部
+	Detectors []string `json:"detectors,omitempty"`
+	// moderation 类型：通过现有渠道调用的审核模型及分数阈值
+	Model     string  `json:"model,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	// http 类型：自定义检查服务
+	Url     string            `json:"url,omitempty"`
+	Timeout int               `json:"timeout,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// GuardrailPolicy 一组分别作用于输入和输出的检查阶段
+type GuardrailPolicy struct {
+	Input  []GuardrailStage `json:"input"`
+	Output []GuardrailStage `json:"output"`
+}
+
+type GuardrailSetting struct {
+	Enabled       bool                       `json:"enabled"`
+	DefaultPolicy string                     `json:"default_policy"`
+	Policies      map[string]GuardrailPolicy `json:"policies"`
+	// GroupPolicies 分组到策略名的映射，令牌上设置的策略在分组策略之后追加
+	GroupPolicies map[string]string `json:"group_policies"`
+}
+
+// 默认配置
+var guardrailSetting = GuardrailSetting{
+	Enabled:       false,
+	DefaultPolicy: "",
+	Policies:      map[string]GuardrailPolicy{},
+	GroupPolicies: map[string]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// ResolveGuardrailPolicy 确定生效的策略：分组策略优先于默认策略，是管理员设置的基础策略；
+// 令牌上设置的策略由令牌所有者选择，只在基础策略之后追加检查阶段，不能替换或削弱基础策略
+func ResolveGuardrailPolicy(group string, tokenPolicy string) (string, *GuardrailPolicy, bool) {
+	if !guardrailSetting.Enabled {
+		return "", nil, false
+	}
+	name := guardrailSetting.GroupPolicies[group]
+	if name == "" {
+		name = guardrailSetting.DefaultPolicy
+	}
+	base, hasBase := guardrailSetting.Policies[name]
+	extra, hasExtra := guardrailSetting.Policies[tokenPolicy]
+	if !hasExtra || tokenPolicy == name {
+		if !hasBase {
+			return "", nil, false
+		}
+		return name, &base, true
+	}
+	if !hasBase {
+		return tokenPolicy, &extra, true
+	}
+	policy := GuardrailPolicy{
+		Input:  append(append([]GuardrailStage{}, base.Input...), extra.Input...),
+		Output: append(append([]GuardrailStage{}, base.Output...), extra.Output...),
+	}
+	return name + "+" + tokenPolicy, &policy, true
+}
+
+func checkGuardrailStage(stage GuardrailStage) error {
+	switch stage.Type {
+	case GuardrailTypeKeyword:
+		for _, pattern := range stage.Regexes {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid regex %q: %s", pattern, err.Error())
+			}
+		}
+	case GuardrailTypePII:
+	case GuardrailTypeModeration:
+		if stage.Model == "" {
+			return fmt.Errorf("moderation stage requires model")
+		}
+	case GuardrailTypeHTTP:
+		if stage.Url == "" {
+			return fmt.Errorf("http stage requires url")
+		}
+	default:
+		return fmt.Errorf("unknown stage type %q", stage.Type)
+	}
+	switch stage.Action {
+	case GuardrailActionBlock, GuardrailActionRedact, GuardrailActionLog:
+	default:
+		return fmt.Errorf("unknown stage action %q", stage.Action)
+	}
+	if stage.Action == GuardrailActionRedact && stage.Type == GuardrailTypeModeration {
+		return fmt.Errorf("moderation stage does not support redact")
+	}
+	return nil
+}
+
+// CheckGuardrailPolicies 校验策略配置
+func CheckGuardrailPolicies(jsonStr string) error {
+	policies := make(map[string]GuardrailPolicy)
+	if err := json.Unmarshal([]byte(jsonStr), &policies); err != nil {
+		return err
+	}
+	for name, policy := range policies {
+		for _, stage := range append(policy.Input, policy.Output...) {
+			if err := checkGuardrailStage(stage); err != nil {
+				return fmt.Errorf("policy %s: %s", name, err.Error())
+			}
+		}
+	}
+	return nil
+}
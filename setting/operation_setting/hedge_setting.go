@@ -0,0 +1,82 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"veloera/setting/config"
+)
+
+// HedgeRule 对冲请求规则，Models / Groups 为空表示匹配全部，模型名支持以 * 结尾的前缀匹配
+type HedgeRule struct {
+	Models []string `json:"models"`
+	Groups []string `json:"groups"`
+	// DelayMs 首个渠道在该时间内没有返回首字节时，向第二个渠道发起相同的请求，0 表示不对冲
+	DelayMs int `json:"delay_ms"`
+}
+
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// Rules 按顺序匹配，使用第一条匹配的规则
+	Rules []HedgeRule `json:"rules"`
+}
+
+// 默认配置
+var hedgeSetting = HedgeSetting{
+	Enabled: false,
+	Rules:   []HedgeRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+func matchRulePatterns(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == value || pattern == "*" {
+			return true
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHedgeDelay 返回模型在分组下的对冲延迟，未启用或未匹配时返回 false
+func GetHedgeDelay(group string, modelName string) (time.Duration, bool) {
+	if !hedgeSetting.Enabled {
+		return 0, false
+	}
+	for _, rule := range hedgeSetting.Rules {
+		if matchRulePatterns(rule.Models, modelName) && matchRulePatterns(rule.Groups, group) {
+			if rule.DelayMs <= 0 {
+				return 0, false
+			}
+			return time.Duration(rule.DelayMs) * time.Millisecond, true
+		}
+	}
+	return 0, false
+}
+
+func CheckHedgeRules(jsonStr string) error {
+	var rules []HedgeRule
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		if rule.DelayMs < 0 {
+			return fmt.Errorf("rule %d: delay_ms must not be negative", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"veloera/setting/config"
+)
+
+// PIIRedactionPolicy 转发到上游前的个人信息脱敏策略
+type PIIRedactionPolicy struct {
+	// Detectors 启用的检测器：email / phone / credit_card / id_card / api_key / ip，留空表示全部
+	Detectors []string `json:"detectors,omitempty"`
+	// Regexes 自定义正则，命中内容同样会被替换为占位符
+	Regexes []string `json:"regexes,omitempty"`
+}
+
+type PIIRedactionSetting struct {
+	Policies map[string]PIIRedactionPolicy `json:"policies"`
+	// TagPolicies 渠道标签到策略名的映射，渠道设置中的 pii_redaction 优先
+	TagPolicies map[string]string `json:"tag_policies"`
+}
+
+// 默认配置
+var piiRedactionSetting = PIIRedactionSetting{
+	Policies:    map[string]PIIRedactionPolicy{},
+	TagPolicies: map[string]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// ResolvePIIRedactionPolicy 按 渠道设置 > 渠道标签 的顺序确定生效的策略
+func ResolvePIIRedactionPolicy(channelPolicy string, channelTag string) (*PIIRedactionPolicy, bool) {
+	name := channelPolicy
+	if name == "" && channelTag != "" {
+		name = piiRedactionSetting.TagPolicies[channelTag]
+	}
+	if name == "" {
+		return nil, false
+	}
+	policy, ok := piiRedactionSetting.Policies[name]
+	if !ok {
+		return nil, false
+	}
+	return &policy, true
+}
+
+// CheckPIIRedactionPolicies 校验策略配置
+func CheckPIIRedactionPolicies(jsonStr string) error {
+	policies := make(map[string]PIIRedactionPolicy)
+	if err := json.Unmarshal([]byte(jsonStr), &policies); err != nil {
+		return err
+	}
+	for name, policy := range policies {
+		for _, pattern := range policy.Regexes {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("policy %s: invalid regex %q: %s", name, pattern, err.Error())
+			}
+		}
+	}
+	return nil
+}
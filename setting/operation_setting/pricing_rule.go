@@ -0,0 +1,210 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"veloera/common"
+)
+
+// PricingTier 按提示词长度划分的计费档位
+type PricingTier struct {
+	// 提示词 token 数大于等于该值时命中此档位
+	MinPromptTokens int     `json:"min_prompt_tokens"`
+	ModelRatio      float64 `json:"model_ratio"`
+	// 为 0 时沿用模型默认的补全倍率
+	CompletionRatio float64 `json:"completion_ratio,omitempty"`
+	// 为 nil 时沿用模型默认的缓存倍率
+	CacheRatio *float64 `json:"cache_ratio,omitempty"`
+}
+
+// TimeDiscount 分时段折扣，时间为服务器本地时间，格式 HH:MM，支持跨零点
+type TimeDiscount struct {
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Discount float64 `json:"discount"`
+}
+
+// PricingRule 单个模型的计费规则，各项倍率均相对于模型倍率
+type PricingRule struct {
+	Tiers []PricingTier `json:"tiers,omitempty"`
+	// 推理 token 的倍率，为 0 时按补全倍率计费
+	ReasoningRatio float64 `json:"reasoning_ratio,omitempty"`
+	// 音频输入 token 的倍率，为 0 时按文本输入计费
+	AudioInputRatio float64 `json:"audio_input_ratio,omitempty"`
+	// 音频输出 token 的倍率，为 0 时按补全倍率计费
+	AudioOutputRatio float64 `json:"audio_output_ratio,omitempty"`
+	// 图片输出 token 的倍率，为 0 时按补全倍率计费
+	ImageOutputRatio float64 `json:"image_output_ratio,omitempty"`
+	// 每次请求额外收取的固定费用，单位为美元
+	FixedFee      float64        `json:"fixed_fee,omitempty"`
+	TimeDiscounts []TimeDiscount `json:"time_discounts,omitempty"`
+}
+
+// AppliedPricingRule 一次请求实际命中的计费规则
+type AppliedPricingRule struct {
+	Tier             int     `json:"tier"`
+	MinPromptTokens  int     `json:"min_prompt_tokens"`
+	ModelRatio       float64 `json:"model_ratio"`
+	CompletionRatio  float64 `json:"completion_ratio"`
+	CacheRatio       float64 `json:"cache_ratio"`
+	ReasoningRatio   float64 `json:"reasoning_ratio,omitempty"`
+	AudioInputRatio  float64 `json:"audio_input_ratio,omitempty"`
+	AudioOutputRatio float64 `json:"audio_output_ratio,omitempty"`
+	ImageOutputRatio float64 `json:"image_output_ratio,omitempty"`
+	FixedFee         float64 `json:"fixed_fee,omitempty"`
+	Discount         float64 `json:"discount"`
+	DiscountWindow   string  `json:"discount_window,omitempty"`
+}
+
+var pricingRuleMap = map[string]PricingRule{}
+var pricingRuleMapMutex sync.RWMutex
+
+func PricingRules2JSONString() string {
+	pricingRuleMapMutex.RLock()
+	defer pricingRuleMapMutex.RUnlock()
+	jsonBytes, err := json.Marshal(pricingRuleMap)
+	if err != nil {
+		common.SysError("error marshalling pricing rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePricingRulesByJSONString(jsonStr string) error {
+	rules, err := parsePricingRules(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingRuleMapMutex.Lock()
+	defer pricingRuleMapMutex.Unlock()
+	pricingRuleMap = rules
+	return nil
+}
+
+// CheckPricingRules 校验计费规则 JSON 是否合法
+func CheckPricingRules(jsonStr string) error {
+	_, err := parsePricingRules(jsonStr)
+	return err
+}
+
+func parsePricingRules(jsonStr string) (map[string]PricingRule, error) {
+	rules := make(map[string]PricingRule)
+	if jsonStr == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, err
+	}
+	for name, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("模型 %s 计费规则无效: %s", name, err.Error())
+		}
+		sort.SliceStable(rule.Tiers, func(i, j int) bool {
+			return rule.Tiers[i].MinPromptTokens < rule.Tiers[j].MinPromptTokens
+		})
+		rules[name] = rule
+	}
+	return rules, nil
+}
+
+func (r *PricingRule) validate() error {
+	for _, tier := range r.Tiers {
+		if tier.MinPromptTokens < 0 {
+			return errors.New("min_prompt_tokens 不能为负数")
+		}
+		if tier.ModelRatio < 0 || tier.CompletionRatio < 0 || (tier.CacheRatio != nil && *tier.CacheRatio < 0) {
+			return errors.New("档位倍率不能为负数")
+		}
+	}
+	if r.ReasoningRatio < 0 || r.AudioInputRatio < 0 || r.AudioOutputRatio < 0 || r.ImageOutputRatio < 0 || r.FixedFee < 0 {
+		return errors.New("倍率和固定费用不能为负数")
+	}
+	for _, d := range r.TimeDiscounts {
+		if _, err := parseClock(d.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(d.End); err != nil {
+			return err
+		}
+		if d.Discount <= 0 {
+			return errors.New("discount 必须大于 0")
+		}
+	}
+	return nil
+}
+
+// parseClock 将 HH:MM 解析为当天的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func GetPricingRule(name string) (*PricingRule, bool) {
+	pricingRuleMapMutex.RLock()
+	defer pricingRuleMapMutex.RUnlock()
+	rule, ok := pricingRuleMap[name]
+	if !ok {
+		return nil, false
+	}
+	return &rule, true
+}
+
+// Apply 根据提示词长度和当前时间计算生效的倍率，base 倍率在规则未覆盖时使用
+func (r *PricingRule) Apply(promptTokens int, modelRatio, completionRatio, cacheRatio float64, now time.Time) AppliedPricingRule {
+	applied := AppliedPricingRule{
+		Tier:             -1,
+		ModelRatio:       modelRatio,
+		CompletionRatio:  completionRatio,
+		CacheRatio:       cacheRatio,
+		ReasoningRatio:   r.ReasoningRatio,
+		AudioInputRatio:  r.AudioInputRatio,
+		AudioOutputRatio: r.AudioOutputRatio,
+		ImageOutputRatio: r.ImageOutputRatio,
+		FixedFee:         r.FixedFee,
+		Discount:         1,
+	}
+	for i, tier := range r.Tiers {
+		if promptTokens < tier.MinPromptTokens {
+			break
+		}
+		applied.Tier = i
+		applied.MinPromptTokens = tier.MinPromptTokens
+		applied.ModelRatio = tier.ModelRatio
+		applied.CompletionRatio = completionRatio
+		if tier.CompletionRatio != 0 {
+			applied.CompletionRatio = tier.CompletionRatio
+		}
+		applied.CacheRatio = cacheRatio
+		if tier.CacheRatio != nil {
+			applied.CacheRatio = *tier.CacheRatio
+		}
+	}
+	minute := now.Hour()*60 + now.Minute()
+	for _, d := range r.TimeDiscounts {
+		start, _ := parseClock(d.Start)
+		end, _ := parseClock(d.End)
+		var hit bool
+		if start <= end {
+			hit = minute >= start && minute < end
+		} else {
+			hit = minute >= start || minute < end
+		}
+		if hit {
+			applied.Discount = d.Discount
+			applied.DiscountWindow = d.Start + "-" + d.End
+			break
+		}
+	}
+	return applied
+}
+
+// HasBaseRatio 存在从 0 开始的档位时，即使未设置模型倍率也可以计费
+func (r *PricingRule) HasBaseRatio() bool {
+	return len(r.Tiers) > 0 && r.Tiers[0].MinPromptTokens == 0
+}
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "veloera/setting/config"
+
+// PromotionSetting 在线充值的赠送活动，赠送比例为百分比，多项活动叠加计算
+type PromotionSetting struct {
+	// TopupBonusPercent 每次在线充值赠送的比例
+	TopupBonusPercent int `json:"topup_bonus_percent"`
+	// FirstTopupBonusPercent 用户首次在线充值额外赠送的比例
+	FirstTopupBonusPercent int `json:"first_topup_bonus_percent"`
+	// MaxBonusPercent 单笔充值赠送比例的上限，包括优惠券，0 表示不限制
+	MaxBonusPercent int `json:"max_bonus_percent"`
+}
+
+var promotionSetting = PromotionSetting{
+	TopupBonusPercent:      0,
+	FirstTopupBonusPercent: 0,
+	MaxBonusPercent:        0,
+}
+
+func init() {
+	config.GlobalConfig.Register("promotion", &promotionSetting)
+}
+
+func GetPromotionSetting() *PromotionSetting {
+	return &promotionSetting
+}
@@ -0,0 +1,79 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"veloera/setting/config"
+)
+
+// ClaudeMaxCacheBreakpoints Anthropic 每个请求最多允许的缓存断点数量
+const ClaudeMaxCacheBreakpoints = 4
+
+// PromptCacheRule 自动插入提示词缓存断点的规则，Models / Groups 为空表示匹配全部，模型名支持以 * 结尾的前缀匹配
+type PromptCacheRule struct {
+	Models []string `json:"models"`
+	Groups []string `json:"groups"`
+	// System 在系统提示词末尾设置断点
+	System bool `json:"system"`
+	// Tools 在工具定义末尾设置断点
+	Tools bool `json:"tools"`
+	// LastTurns 在最后 N 条消息末尾设置断点，断点总数超过上限时优先保留靠后的消息
+	LastTurns int `json:"last_turns"`
+	// TTL 缓存有效期，留空使用上游默认的 5 分钟
+	TTL string `json:"ttl"`
+}
+
+// PromptCacheSetting OpenAI 格式的请求转换为 Claude 请求时自动设置 cache_control
+type PromptCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// Rules 按顺序匹配，使用第一条匹配的规则
+	Rules []PromptCacheRule `json:"rules"`
+}
+
+// 默认配置
+var promptCacheSetting = PromptCacheSetting{
+	Enabled: false,
+	Rules:   []PromptCacheRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("prompt_cache_setting", &promptCacheSetting)
+}
+
+func GetPromptCacheSetting() *PromptCacheSetting {
+	return &promptCacheSetting
+}
+
+// GetPromptCacheRule 返回模型在分组下的缓存断点规则，未启用或未匹配时返回 false
+func GetPromptCacheRule(group string, modelName string) (*PromptCacheRule, bool) {
+	if !promptCacheSetting.Enabled {
+		return nil, false
+	}
+	for i := range promptCacheSetting.Rules {
+		rule := &promptCacheSetting.Rules[i]
+		if matchRulePatterns(rule.Models, modelName) && matchRulePatterns(rule.Groups, group) {
+			if !rule.System && !rule.Tools && rule.LastTurns <= 0 {
+				return nil, false
+			}
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func CheckPromptCacheRules(jsonStr string) error {
+	var rules []PromptCacheRule
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		if rule.LastTurns < 0 || rule.LastTurns > ClaudeMaxCacheBreakpoints {
+			return fmt.Errorf("rule %d: last_turns must be between 0 and %d", i+1, ClaudeMaxCacheBreakpoints)
+		}
+		if rule.TTL != "" && rule.TTL != "5m" && rule.TTL != "1h" {
+			return fmt.Errorf("rule %d: ttl must be 5m or 1h", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package operation_setting
+
+import (
+	"time"
+	"veloera/setting/config"
+)
+
+// RealtimeSetting 实时语音会话设置
+type RealtimeSetting struct {
+	// MaxSessionSeconds 单个会话的最长时间，0 表示不限制
+	MaxSessionSeconds int `json:"max_session_seconds"`
+	// ReserveTokens 会话开始及每次预留用尽时预留的 token 数，按模型倍率和分组倍率换算为额度，0 表示使用预扣费额度
+	ReserveTokens int `json:"reserve_tokens"`
+}
+
+// 默认配置
+var realtimeSetting = RealtimeSetting{
+	MaxSessionSeconds: 1800,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("realtime_setting", &realtimeSetting)
+}
+
+func GetRealtimeSetting() *RealtimeSetting {
+	return &realtimeSetting
+}
+
+func (s *RealtimeSetting) SessionTimeout() time.Duration {
+	return time.Duration(s.MaxSessionSeconds) * time.Second
+}
@@ -0,0 +1,44 @@
+package operation_setting
+
+import "veloera/setting/config"
+
+// RefundSetting 消费记录的退款设置
+type RefundSetting struct {
+	// Enabled 允许用户针对消费记录提交退款申请
+	Enabled bool `json:"enabled"`
+	// WindowDays 消费后可以申请退款的天数
+	WindowDays int `json:"window_days"`
+	// AutoRefundEmptyResponse 对话请求已计费但上游没有返回任何内容时自动退款
+	AutoRefundEmptyResponse bool `json:"auto_refund_empty_response"`
+	// AutoRefundFinishReasons 上游返回这些 finish_reason（OpenAI 格式）时自动退款，例如 error、content_filter，
+	// 只对 OpenAI 兼容、Claude 和 Gemini 渠道生效
+	AutoRefundFinishReasons []string `json:"auto_refund_finish_reasons"`
+}
+
+var refundSetting = RefundSetting{
+	Enabled:                 false,
+	WindowDays:              7,
+	AutoRefundEmptyResponse: false,
+	AutoRefundFinishReasons: []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("refund", &refundSetting)
+}
+
+func GetRefundSetting() *RefundSetting {
+	return &refundSetting
+}
+
+// IsAutoRefundFinishReason 判断 finish_reason 是否命中自动退款规则
+func (s *RefundSetting) IsAutoRefundFinishReason(reason string) bool {
+	if reason == "" {
+		return false
+	}
+	for _, r := range s.AutoRefundFinishReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "veloera/setting/config"
+
+// SessionAffinitySetting 会话亲和路由设置，同一会话的连续请求尽量发往同一渠道和密钥，以便命中上游的提示词缓存
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// TTLSeconds 会话与渠道绑定的有效期，每次成功请求后刷新
+	TTLSeconds int `json:"ttl_seconds"`
+	// UseUserField 没有会话请求头时，使用请求体中的 user 字段作为会话标识
+	UseUserField bool `json:"use_user_field"`
+	// UsePrefixHash 以上都没有时，使用系统提示词和第一条用户消息的哈希作为会话标识
+	UsePrefixHash bool `json:"use_prefix_hash"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:       false,
+	TTLSeconds:    600,
+	UseUserField:  true,
+	UsePrefixHash: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
@@ -0,0 +1,25 @@
+package operation_setting
+
+import "veloera/setting/config"
+
+// StreamFailoverSetting 流式响应中途中断时切换渠道续写的设置，仅对使用 OpenAI 兼容流式处理的渠道生效
+type StreamFailoverSetting struct {
+	Enabled bool `json:"enabled"`
+	// MaxAttempts 单个请求最多续写的次数
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// 默认配置
+var streamFailoverSetting = StreamFailoverSetting{
+	Enabled:     false,
+	MaxAttempts: 2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("stream_failover_setting", &streamFailoverSetting)
+}
+
+func GetStreamFailoverSetting() *StreamFailoverSetting {
+	return &streamFailoverSetting
+}
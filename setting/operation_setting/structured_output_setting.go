@@ -0,0 +1,69 @@
+package operation_setting
+
+import (
+	"veloera/common"
+	"veloera/setting/config"
+)
+
+const (
+	StructuredOutputNative = "native" // 原样转发 response_format
+	StructuredOutputPrompt = "prompt" // 在系统提示词中注入 JSON Schema 说明
+	StructuredOutputTool   = "tool"   // 将 JSON Schema 作为强制调用的工具参数
+)
+
+// StructuredOutputSetting 上游不支持 response_format 时由网关模拟结构化输出
+type StructuredOutputSetting struct {
+	Enabled bool `json:"enabled"`
+	// ChannelTypes 需要模拟的渠道类型，渠道设置中的 structured_output 优先
+	ChannelTypes []int `json:"channel_types"`
+	// Mode 默认的模拟方式，prompt 或 tool
+	Mode string `json:"mode"`
+	// MaxRetries 返回内容不符合 JSON Schema 时重新请求的次数
+	MaxRetries int `json:"max_retries"`
+}
+
+// 默认配置
+var structuredOutputSetting = StructuredOutputSetting{
+	Enabled: false,
+	ChannelTypes: []int{
+		common.ChannelTypeOllama,
+		common.ChannelTypeBaidu,
+		common.ChannelTypeBaiduV2,
+		common.ChannelTypeZhipu,
+		common.ChannelTypeXunfei,
+		common.ChannelTypeTencent,
+		common.ChannelTypeCohere,
+		common.ChannelTypeDify,
+	},
+	Mode:       StructuredOutputPrompt,
+	MaxRetries: 1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("structured_output_setting", &structuredOutputSetting)
+}
+
+func GetStructuredOutputSetting() *StructuredOutputSetting {
+	return &structuredOutputSetting
+}
+
+// GetStructuredOutputMode 返回渠道的结构化输出处理方式，channelMode 为渠道设置中的值
+func GetStructuredOutputMode(channelType int, channelMode string) string {
+	switch channelMode {
+	case StructuredOutputNative, StructuredOutputPrompt, StructuredOutputTool:
+		return channelMode
+	}
+	if !structuredOutputSetting.Enabled {
+		return StructuredOutputNative
+	}
+	for _, t := range structuredOutputSetting.ChannelTypes {
+		if t == channelType {
+			if structuredOutputSetting.Mode == StructuredOutputTool {
+				return StructuredOutputTool
+			}
+			return StructuredOutputPrompt
+		}
+	}
+	return StructuredOutputNative
+}
@@ -0,0 +1,51 @@
+package operation_setting
+
+import (
+	"veloera/common"
+	"veloera/setting/config"
+)
+
+// ToolEmulationSetting 上游不支持函数调用时，由网关把工具定义写入提示词并从模型输出中解析工具调用
+type ToolEmulationSetting struct {
+	Enabled bool `json:"enabled"`
+	// ChannelTypes 需要模拟的渠道类型
+	ChannelTypes []int `json:"channel_types"`
+	// Models 需要模拟的模型，支持以 * 结尾的前缀匹配，与渠道类型满足其一即可
+	Models []string `json:"models"`
+}
+
+// 默认配置
+var toolEmulationSetting = ToolEmulationSetting{
+	Enabled: false,
+	ChannelTypes: []int{
+		common.ChannelTypeOllama,
+		common.ChannelTypeXinference,
+		common.ChannelCloudflare,
+	},
+	Models: []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("tool_emulation_setting", &toolEmulationSetting)
+}
+
+func GetToolEmulationSetting() *ToolEmulationSetting {
+	return &toolEmulationSetting
+}
+
+// ShouldEmulateTools 判断渠道是否需要模拟工具调用，channelSetting 为渠道设置中的值，优先于全局配置
+func ShouldEmulateTools(channelType int, modelName string, channelSetting any) bool {
+	if enabled, ok := channelSetting.(bool); ok {
+		return enabled
+	}
+	if !toolEmulationSetting.Enabled {
+		return false
+	}
+	for _, t := range toolEmulationSetting.ChannelTypes {
+		if t == channelType {
+			return true
+		}
+	}
+	return len(toolEmulationSetting.Models) > 0 && matchRulePatterns(toolEmulationSetting.Models, modelName)
+}
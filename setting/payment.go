@@ -5,4 +5,5 @@ var CustomCallbackAddress = ""
 var EpayId = ""
 var EpayKey = ""
 var Price = 7.3
+var EpayCurrency = "CNY"
 var MinTopUp = 1
@@ -2,13 +2,15 @@ package setting
 
 import (
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
 var CheckSensitiveEnabled = true
 var CheckSensitiveOnPromptEnabled = true
 
-//var CheckSensitiveOnCompletionEnabled = true
+var CheckSensitiveOnCompletionEnabled = false
 
 // StopOnSensitiveEnabled 如果检测到敏感词，是否立刻停止生成，否则替换敏感词
 var StopOnSensitiveEnabled = true
@@ -16,6 +18,12 @@ var StopOnSensitiveEnabled = true
 // StreamCacheQueueLength 流模式缓存队列长度，0表示无缓存
 var StreamCacheQueueLength = 0
 
+// StreamFilterHoldLength 存在正则或个人信息检查时，流模式至少保留未发送的字符数，用于匹配跨数据块的内容
+var StreamFilterHoldLength = 64
+
+// StreamGuardrailCheckLength 流模式下审核模型与自定义服务等远程护栏每累积多少字符检查一次，遇到句末标点时提前检查
+var StreamGuardrailCheckLength = 200
+
 // SensitiveWords 普通屏蔽词
 var SensitiveWords = []string{
 	"test_sensitive",
@@ -30,6 +38,64 @@ func isValidRegex(pattern string) bool {
 	return err == nil
 }
 
+// 屏蔽词在设置变更时编译一次，流式过滤等逐块检查直接复用
+var (
+	sensitiveWordsMutex         sync.RWMutex
+	sensitiveWordsPattern       *regexp.Regexp
+	compiledRegexSensitiveWords []*regexp.Regexp
+)
+
+func init() {
+	compileSensitiveWords()
+}
+
+// CompileKeywords 将屏蔽词编译为不区分大小写的正则，长词优先，保证替换时覆盖完整的词，没有屏蔽词时返回 nil
+func CompileKeywords(words []string) *regexp.Regexp {
+	var quoted []string
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	sort.Slice(quoted, func(i, j int) bool {
+		return len(quoted[i]) > len(quoted[j])
+	})
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+func compileSensitiveWords() {
+	pattern := CompileKeywords(SensitiveWords)
+	// 正则屏蔽词与普通屏蔽词一致不区分大小写
+	regexes := make([]*regexp.Regexp, 0, len(RegexSensitiveWords))
+	for _, p := range RegexSensitiveWords {
+		if re, err := regexp.Compile("(?i)" + p); err == nil {
+			regexes = append(regexes, re)
+		}
+	}
+	sensitiveWordsMutex.Lock()
+	defer sensitiveWordsMutex.Unlock()
+	sensitiveWordsPattern = pattern
+	compiledRegexSensitiveWords = regexes
+}
+
+// GetSensitiveWordsPattern 编译后的普通屏蔽词，没有屏蔽词时返回 nil
+func GetSensitiveWordsPattern() *regexp.Regexp {
+	sensitiveWordsMutex.RLock()
+	defer sensitiveWordsMutex.RUnlock()
+	return sensitiveWordsPattern
+}
+
+// GetRegexSensitiveWords 编译后的正则屏蔽词
+func GetRegexSensitiveWords() []*regexp.Regexp {
+	sensitiveWordsMutex.RLock()
+	defer sensitiveWordsMutex.RUnlock()
+	return compiledRegexSensitiveWords
+}
+
 func SensitiveWordsToString() string {
 	var builder strings.Builder
 
@@ -70,12 +136,13 @@ func SensitiveWordsFromString(s string) {
 			SensitiveWords = append(SensitiveWords, line)
 		}
 	}
+	compileSensitiveWords()
 }
 
 func ShouldCheckPromptSensitive() bool {
 	return CheckSensitiveEnabled && CheckSensitiveOnPromptEnabled
 }
 
-//func ShouldCheckCompletionSensitive() bool {
-//	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
-//}
+func ShouldCheckCompletionSensitive() bool {
+	return CheckSensitiveEnabled && CheckSensitiveOnCompletionEnabled
+}
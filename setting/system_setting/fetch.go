@@ -0,0 +1,90 @@
+package system_setting
+
+import (
+	"net"
+	"strings"
+	"veloera/setting/config"
+)
+
+// FetchSettings 下载用户提供的图片、文件 URL 时的安全限制
+type FetchSettings struct {
+	// AllowPrivateIp 允许访问内网、回环、链路本地等地址，仅在可信环境中开启
+	AllowPrivateIp bool `json:"allow_private_ip"`
+	// AllowedHosts 非空时只允许下载这些域名，支持 *.example.com 形式匹配子域名
+	AllowedHosts []string `json:"allowed_hosts"`
+	DeniedHosts  []string `json:"denied_hosts"`
+	// AllowedFileTypes 文件允许的 Content-Type 前缀，留空不限制；图片始终要求 image/*
+	AllowedFileTypes []string `json:"allowed_file_types"`
+	MaxRedirects     int      `json:"max_redirects"`
+	// CacheSeconds 下载内容的缓存时间，0 表示不缓存
+	CacheSeconds int `json:"cache_seconds"`
+}
+
+// 默认配置
+var defaultFetchSettings = FetchSettings{
+	AllowedHosts:     []string{},
+	DeniedHosts:      []string{},
+	AllowedFileTypes: []string{},
+	MaxRedirects:     3,
+	CacheSeconds:     60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("fetch_setting", &defaultFetchSettings)
+}
+
+func GetFetchSettings() *FetchSettings {
+	return &defaultFetchSettings
+}
+
+func matchHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+		// 支持 CIDR 形式的 IP 段
+		if _, ipNet, err := net.ParseCIDR(pattern); err == nil {
+			if ip := net.ParseIP(host); ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsHostAllowed 黑名单优先于白名单
+func (s *FetchSettings) IsHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if matchHost(host, s.DeniedHosts) {
+		return false
+	}
+	if len(s.AllowedHosts) > 0 {
+		return matchHost(host, s.AllowedHosts)
+	}
+	return true
+}
+
+// IsFileTypeAllowed 判断文件的 Content-Type 是否在允许的范围内
+func (s *FetchSettings) IsFileTypeAllowed(contentType string) bool {
+	if len(s.AllowedFileTypes) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range s.AllowedFileTypes {
+		if prefix != "" && strings.HasPrefix(contentType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package system_setting
+
+import (
+	"net/url"
+	"strings"
+	"veloera/setting"
+	"veloera/setting/config"
+)
+
+type SecuritySettings struct {
+	// AdminRequireMFA 管理员和超级管理员必须通过两步验证或通行密钥登录后才能使用管理接口
+	AdminRequireMFA bool `json:"admin_require_mfa"`
+	// PasskeyLoginEnabled 是否允许使用通行密钥登录
+	PasskeyLoginEnabled bool `json:"passkey_login_enabled"`
+	// StepUpEnabled 查看渠道密钥、修改系统设置等敏感操作前需要重新验证身份
+	StepUpEnabled bool `json:"step_up_enabled"`
+	// StepUpMaxAge 重新验证身份后的有效秒数
+	StepUpMaxAge int `json:"step_up_max_age"`
+	// WebAuthnRPID 通行密钥绑定的域名，为空时使用服务器地址的域名
+	WebAuthnRPID string `json:"webauthn_rp_id"`
+	// WebAuthnOrigins 允许的来源，为空时使用服务器地址
+	WebAuthnOrigins []string `json:"webauthn_origins"`
+}
+
+// 默认配置
+var defaultSecuritySettings = SecuritySettings{
+	AdminRequireMFA:     false,
+	PasskeyLoginEnabled: false,
+	StepUpEnabled:       false,
+	StepUpMaxAge:        300,
+	WebAuthnOrigins:     []string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("security", &defaultSecuritySettings)
+}
+
+func GetSecuritySettings() *SecuritySettings {
+	return &defaultSecuritySettings
+}
+
+// GetWebAuthnRPID 返回通行密钥绑定的域名
+func GetWebAuthnRPID() string {
+	if defaultSecuritySettings.WebAuthnRPID != "" {
+		return defaultSecuritySettings.WebAuthnRPID
+	}
+	if u, err := url.Parse(setting.ServerAddress); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// IsWebAuthnOriginAllowed 校验浏览器上报的来源
+func IsWebAuthnOriginAllowed(origin string) bool {
+	origins := defaultSecuritySettings.WebAuthnOrigins
+	if len(origins) == 0 {
+		origins = []string{setting.ServerAddress}
+	}
+	for _, allowed := range origins {
+		if strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package system_setting
+
+import "veloera/setting/config"
+
+// StripeSettings Stripe Checkout 在线充值，ApiBase 可指向兼容 Stripe API 的服务（例如本地模拟服务）
+type StripeSettings struct {
+	Enabled       bool    `json:"enabled"`
+	SecretKey     string  `json:"secret_key"`
+	WebhookSecret string  `json:"webhook_secret"`
+	ApiBase       string  `json:"api_base"`
+	Currency      string  `json:"currency"`
+	UnitPrice     float64 `json:"unit_price"` // 每单位额度（美元）的价格，以 Currency 计价
+}
+
+var defaultStripeSettings = StripeSettings{
+	ApiBase:   "https://api.stripe.com",
+	Currency:  "usd",
+	UnitPrice: 1,
+}
+
+func init() {
+	config.GlobalConfig.Register("stripe", &defaultStripeSettings)
+}
+
+func GetStripeSettings() *StripeSettings {
+	return &defaultStripeSettings
+}
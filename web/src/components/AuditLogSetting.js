@@ -0,0 +1,201 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Banner,
+  Button,
+  Card,
+  Input,
+  Space,
+  Table,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, showError, timestamp2string } from '../helpers';
+import { ITEMS_PER_PAGE } from '../constants';
+
+// AuditLogSetting 管理操作审计日志的查询、导出和哈希链校验
+const AuditLogSetting = () => {
+  const { t } = useTranslation();
+  const [logs, setLogs] = useState([]);
+  const [total, setTotal] = useState(0);
+  const [loading, setLoading] = useState(false);
+  const [activePage, setActivePage] = useState(1);
+  const [filters, setFilters] = useState({
+    action: '',
+    target_type: '',
+    target_id: '',
+    actor_id: '',
+  });
+  const [verifyResult, setVerifyResult] = useState(null);
+
+  const buildQuery = () => {
+    const params = new URLSearchParams();
+    Object.entries(filters).forEach(([key, value]) => {
+      if (value !== '') {
+        params.set(key, value);
+      }
+    });
+    return params;
+  };
+
+  const loadLogs = async (page) => {
+    setLoading(true);
+    const params = buildQuery();
+    params.set('p', page);
+    params.set('page_size', ITEMS_PER_PAGE);
+    const res = await API.get(`/api/audit/?${params.toString()}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setLogs(data.items || []);
+      setTotal(data.total);
+      setActivePage(data.page);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  useEffect(() => {
+    loadLogs(1).then();
+  }, []);
+
+  const exportLogs = async (format) => {
+    const params = buildQuery();
+    params.set('format', format);
+    const res = await API.get(`/api/audit/export?${params.toString()}`, {
+      responseType: 'blob',
+    });
+    const url = URL.createObjectURL(res.data);
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = `audit-${Date.now()}.${format}`;
+    link.click();
+    URL.revokeObjectURL(url);
+  };
+
+  const verifyChain = async () => {
+    const res = await API.get('/api/audit/verify');
+    const { success, message, data } = res.data;
+    if (success) {
+      setVerifyResult(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  const columns = [
+    {
+      title: t('时间'),
+      dataIndex: 'created_at',
+      render: (text) => timestamp2string(text),
+    },
+    {
+      title: t('操作人'),
+      dataIndex: 'actor_name',
+      render: (text, record) => `${text} (${record.actor_id})`,
+    },
+    {
+      title: t('操作'),
+      dataIndex: 'action',
+    },
+    {
+      title: t('对象'),
+      dataIndex: 'target_id',
+      render: (text, record) => `${record.target_type}: ${text}`,
+    },
+    {
+      title: t('修改前'),
+      dataIndex: 'before',
+      render: (text) => (
+        <Typography.Text ellipsis={{ showTooltip: true }} style={{ width: 200 }}>
+          {text}
+        </Typography.Text>
+      ),
+    },
+    {
+      title: t('修改后'),
+      dataIndex: 'after',
+      render: (text) => (
+        <Typography.Text ellipsis={{ showTooltip: true }} style={{ width: 200 }}>
+          {text}
+        </Typography.Text>
+      ),
+    },
+    {
+      title: 'IP',
+      dataIndex: 'ip',
+      render: (text, record) => (
+        <Typography.Text ellipsis={{ showTooltip: true }} style={{ width: 120 }}>
+          {text} {record.user_agent}
+        </Typography.Text>
+      ),
+    },
+  ];
+
+  return (
+    <Card style={{ marginTop: '10px' }}>
+      <Space vertical align='start' style={{ width: '100%' }}>
+        {verifyResult &&
+          (verifyResult.intact ? (
+            <Banner
+              type='success'
+              description={t('哈希链完整，共校验 {{count}} 条记录', {
+                count: verifyResult.checked,
+              })}
+            />
+          ) : (
+            <Banner
+              type='danger'
+              description={t('哈希链在记录 {{id}} 处断裂，审计日志可能被篡改', {
+                id: verifyResult.broken_id,
+              })}
+            />
+          ))}
+        <Space wrap>
+          <Input
+            placeholder={t('操作，如 channel.update')}
+            value={filters.action}
+            onChange={(value) => setFilters({ ...filters, action: value })}
+          />
+          <Input
+            placeholder={t('对象类型，如 channel')}
+            value={filters.target_type}
+            onChange={(value) => setFilters({ ...filters, target_type: value })}
+          />
+          <Input
+            placeholder={t('对象 ID')}
+            value={filters.target_id}
+            onChange={(value) => setFilters({ ...filters, target_id: value })}
+          />
+          <Input
+            placeholder={t('操作人 ID')}
+            value={filters.actor_id}
+            onChange={(value) => setFilters({ ...filters, actor_id: value })}
+          />
+          <Button type='primary' onClick={() => loadLogs(1)}>
+            {t('查询')}
+          </Button>
+          <Button onClick={() => exportLogs('json')}>{t('导出 JSON')}</Button>
+          <Button onClick={() => exportLogs('csv')}>{t('导出 CSV')}</Button>
+          <Button type='warning' onClick={verifyChain}>
+            {t('校验完整性')}
+          </Button>
+        </Space>
+        <Table
+          style={{ width: '100%' }}
+          columns={columns}
+          dataSource={logs}
+          rowKey='id'
+          loading={loading}
+          pagination={{
+            currentPage: activePage,
+            pageSize: ITEMS_PER_PAGE,
+            total: total,
+            onPageChange: (page) => loadLogs(page),
+          }}
+        />
+      </Space>
+    </Card>
+  );
+};
+
+export default AuditLogSetting;
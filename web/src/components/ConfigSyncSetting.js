@@ -0,0 +1,201 @@
+import React, { useState } from 'react';
+import {
+  Button,
+  Card,
+  Checkbox,
+  Space,
+  Table,
+  TextArea,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, hasPermission, showError, showSuccess } from '../helpers';
+
+// ConfigSyncSetting 导出和导入渠道、系统设置的声明式配置，导入前可预览变更
+const ConfigSyncSetting = () => {
+  const { t } = useTranslation();
+  const [includeSecrets, setIncludeSecrets] = useState(false);
+  const [configText, setConfigText] = useState('');
+  const [prune, setPrune] = useState(false);
+  const [changes, setChanges] = useState(null);
+  const [loading, setLoading] = useState(false);
+
+  const exportConfig = async (format) => {
+    const params = new URLSearchParams();
+    params.set('format', format);
+    if (includeSecrets) {
+      params.set('include_secrets', 'true');
+    }
+    const res = await API.get(`/api/config/export?${params.toString()}`, {
+      responseType: 'blob',
+    });
+    // 失败时接口返回 { success: false, message }，导出的 JSON 配置不包含 success 字段
+    if (res.data.type.startsWith('application/json')) {
+      const data = JSON.parse(await res.data.text());
+      if (data.success === false) {
+        showError(data.message);
+        return;
+      }
+    }
+    const url = URL.createObjectURL(res.data);
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = `veloera-config-${Date.now()}.${format}`;
+    link.click();
+    URL.revokeObjectURL(url);
+  };
+
+  const loadFile = (event) => {
+    const file = event.target.files[0];
+    if (!file) {
+      return;
+    }
+    file.text().then((text) => {
+      setConfigText(text);
+      setChanges(null);
+    });
+    event.target.value = '';
+  };
+
+  const importConfig = async (dryRun) => {
+    if (configText.trim() === '') {
+      showError(t('请先粘贴或选择配置文档'));
+      return;
+    }
+    setLoading(true);
+    const params = new URLSearchParams();
+    params.set('dry_run', dryRun ? 'true' : 'false');
+    if (prune) {
+      params.set('prune', 'true');
+    }
+    const res = await API.post(
+      `/api/config/import?${params.toString()}`,
+      configText,
+      { headers: { 'Content-Type': 'text/plain' } },
+    );
+    const { success, message, data } = res.data;
+    if (success) {
+      setChanges(data.changes);
+      if (!dryRun) {
+        showSuccess(
+          t('配置已应用，共 {{count}} 项变更', { count: data.changes.length }),
+        );
+      }
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const columns = [
+    {
+      title: t('类型'),
+      dataIndex: 'kind',
+      render: (text) => (text === 'channel' ? t('渠道') : t('配置项')),
+    },
+    {
+      title: t('名称'),
+      dataIndex: 'name',
+    },
+    {
+      title: t('操作'),
+      dataIndex: 'action',
+      render: (text) =>
+        ({ create: t('新增'), update: t('修改'), delete: t('删除') })[text] ||
+        text,
+    },
+    {
+      title: t('修改前'),
+      dataIndex: 'before',
+      render: (value) => (
+        <Typography.Text ellipsis={{ showTooltip: true }} style={{ width: 240 }}>
+          {value ? JSON.stringify(value) : ''}
+        </Typography.Text>
+      ),
+    },
+    {
+      title: t('修改后'),
+      dataIndex: 'after',
+      render: (value) => (
+        <Typography.Text ellipsis={{ showTooltip: true }} style={{ width: 240 }}>
+          {value ? JSON.stringify(value) : ''}
+        </Typography.Text>
+      ),
+    },
+  ];
+
+  return (
+    <Card style={{ marginTop: '10px' }}>
+      <Space vertical align='start' style={{ width: '100%' }}>
+        <Typography.Title heading={6}>{t('导出配置')}</Typography.Title>
+        <Space wrap>
+          {hasPermission('channels:keys') && (
+            <Checkbox
+              checked={includeSecrets}
+              onChange={(e) => setIncludeSecrets(e.target.checked)}
+            >
+              {t('包含渠道密钥和密钥类配置')}
+            </Checkbox>
+          )}
+          <Button onClick={() => exportConfig('yaml')}>{t('导出 YAML')}</Button>
+          <Button onClick={() => exportConfig('json')}>{t('导出 JSON')}</Button>
+        </Space>
+        <Typography.Title heading={6} style={{ marginTop: 10 }}>
+          {t('导入配置')}
+        </Typography.Title>
+        <Typography.Text type='tertiary'>
+          {t(
+            '按渠道名称匹配已有渠道，留空的渠道密钥和文档中未出现的配置项保持不变，重复导入同一份文档不会产生变更',
+          )}
+        </Typography.Text>
+        <input type='file' accept='.yaml,.yml,.json' onChange={loadFile} />
+        <TextArea
+          value={configText}
+          onChange={(value) => {
+            setConfigText(value);
+            setChanges(null);
+          }}
+          autosize={{ minRows: 8, maxRows: 20 }}
+          placeholder={t('粘贴 YAML 或 JSON 格式的配置文档')}
+          style={{ fontFamily: 'monospace' }}
+        />
+        <Space wrap>
+          {hasPermission('channels:write') && (
+            <Checkbox
+              checked={prune}
+              onChange={(e) => {
+                setPrune(e.target.checked);
+                setChanges(null);
+              }}
+            >
+              {t('删除文档中不存在的渠道')}
+            </Checkbox>
+          )}
+          <Button loading={loading} onClick={() => importConfig(true)}>
+            {t('预览变更')}
+          </Button>
+          <Button
+            type='danger'
+            loading={loading}
+            disabled={changes === null}
+            onClick={() => importConfig(false)}
+          >
+            {t('应用配置')}
+          </Button>
+        </Space>
+        {changes !== null && (
+          <Table
+            style={{ width: '100%' }}
+            columns={columns}
+            dataSource={changes}
+            rowKey={(record) => `${record.kind}-${record.name}`}
+            pagination={false}
+            empty={t('没有需要应用的变更')}
+          />
+        )}
+      </Space>
+    </Card>
+  );
+};
+
+export default ConfigSyncSetting;
@@ -4,6 +4,8 @@ import { UserContext } from '../context/User';
 import {
   API,
   getLogo,
+  getPasskeyAssertion,
+  isPasskeySupported,
   showError,
   showInfo,
   showSuccess,
@@ -40,6 +42,7 @@ const LoginForm = () => {
     username: '',
     password: '',
     wechat_verification_code: '',
+    two_fa_code: '',
   });
   const [searchParams, setSearchParams] = useSearchParams();
   const [submitted, setSubmitted] = useState(false);
@@ -51,6 +54,7 @@ const LoginForm = () => {
   let navigate = useNavigate();
   const [status, setStatus] = useState({});
   const [showWeChatLoginModal, setShowWeChatLoginModal] = useState(false);
+  const [showTwoFAModal, setShowTwoFAModal] = useState(false);
   const { t } = useTranslation();
 
   const logo = getLogo();
@@ -64,6 +68,10 @@ const LoginForm = () => {
     if (searchParams.get('expired')) {
       showError(t('未登录或登录已过期，请重新登录'));
     }
+    // 第三方登录回调发现需要两步验证时跳转回登录页
+    if (searchParams.get('require_2fa')) {
+      setShowTwoFAModal(true);
+    }
     let status = localStorage.getItem('status');
     if (status) {
       status = JSON.parse(status);
@@ -89,13 +97,17 @@ const LoginForm = () => {
     );
     const { success, message, data } = res.data;
     if (success) {
+      setShowWeChatLoginModal(false);
+      if (data && data.require_2fa) {
+        setShowTwoFAModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       setUserData(data);
       updateAPI();
       navigate(searchParams.get('returnTo') || '/');
       showSuccess('登录成功！');
-      setShowWeChatLoginModal(false);
     } else {
       showError(message);
     }
@@ -121,6 +133,10 @@ const LoginForm = () => {
       );
       const { success, message, data } = res.data;
       if (success) {
+        if (data && data.require_2fa) {
+          setShowTwoFAModal(true);
+          return;
+        }
         userDispatch({ type: 'login', payload: data });
         setUserData(data);
         updateAPI();
@@ -162,6 +178,10 @@ const LoginForm = () => {
     const res = await API.get(`/api/oauth/telegram/login`, { params });
     const { success, message, data } = res.data;
     if (success) {
+      if (data && data.require_2fa) {
+        setShowTwoFAModal(true);
+        return;
+      }
       userDispatch({ type: 'login', payload: data });
       localStorage.setItem('user', JSON.stringify(data));
       showSuccess('登录成功！');
@@ -173,6 +193,51 @@ const LoginForm = () => {
     }
   };
 
+  const completeLogin = (data) => {
+    userDispatch({ type: 'login', payload: data });
+    localStorage.setItem('user', JSON.stringify(data));
+    setUserData(data);
+    updateAPI();
+    showSuccess('登录成功！');
+    navigate(searchParams.get('returnTo') || '/token');
+  };
+
+  const onSubmitTwoFACode = async () => {
+    const res = await API.post('/api/user/login/2fa', {
+      code: inputs.two_fa_code,
+    });
+    const { success, message, data } = res.data;
+    if (success) {
+      setShowTwoFAModal(false);
+      completeLogin(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  const onPasskeyLoginClicked = async () => {
+    try {
+      const res = await API.post('/api/user/passkey/login/begin');
+      if (!res.data.success) {
+        showError(res.data.message);
+        return;
+      }
+      const assertion = await getPasskeyAssertion(res.data.data);
+      const finish = await API.post(
+        '/api/user/passkey/login/finish',
+        assertion,
+      );
+      const { success, message, data } = finish.data;
+      if (success) {
+        completeLogin(data);
+      } else {
+        showError(message);
+      }
+    } catch (error) {
+      showError(error.message || error);
+    }
+  };
+
   return (
     <div>
       <Layout>
@@ -217,6 +282,17 @@ const LoginForm = () => {
                   >
                     {t('登录')}
                   </Button>
+                  {status.passkey_login_enabled && isPasskeySupported() ? (
+                    <Button
+                      style={{ width: '100%', marginTop: 10 }}
+                      size='large'
+                      onClick={onPasskeyLoginClicked}
+                    >
+                      {t('使用通行密钥登录')}
+                    </Button>
+                  ) : (
+                    <></>
+                  )}
                 </Form>
                 <div
                   style={{
@@ -355,6 +431,27 @@ const LoginForm = () => {
                     />
                   </Form>
                 </Modal>
+                <Modal
+                  title={t('两步验证')}
+                  visible={showTwoFAModal}
+                  maskClosable={false}
+                  onOk={onSubmitTwoFACode}
+                  onCancel={() => setShowTwoFAModal(false)}
+                  okText={t('验证')}
+                  size={'small'}
+                  centered={true}
+                >
+                  <p>{t('请输入验证器应用中的 6 位验证码，或一个未使用的恢复码')}</p>
+                  <Form size='large'>
+                    <Form.Input
+                      field={'two_fa_code'}
+                      placeholder={t('验证码或恢复码')}
+                      label={t('验证码')}
+                      value={inputs.two_fa_code}
+                      onChange={(value) => handleChange('two_fa_code', value)}
+                    />
+                  </Form>
+                </Modal>
               </Card>
               {turnstileEnabled ? (
                 <div
@@ -4,7 +4,8 @@ import {
   API,
   copy,
   getTodayStartTimestamp,
-  isAdmin,
+  getUserIdFromLocalStorage,
+  hasPermission,
   showError,
   showSuccess,
   timestamp2string,
@@ -25,6 +26,7 @@ import {
   Tag,
   Tooltip,
   Checkbox,
+  TextArea,
 } from '@douyinfe/semi-ui';
 import { ITEMS_PER_PAGE } from '../constants';
 import {
@@ -115,6 +117,24 @@ const LogsTable = () => {
             {t('错误')}
           </Tag>
         );
+      case 7:
+        return (
+          <Tag color='amber' size='large'>
+            {t('护栏')}
+          </Tag>
+        );
+      case 8:
+        return (
+          <Tag color='violet' size='large'>
+            {t('订阅')}
+          </Tag>
+        );
+      case 9:
+        return (
+          <Tag color='teal' size='large'>
+            {t('退款')}
+          </Tag>
+        );
       default:
         return (
           <Tag color='grey' size='large'>
@@ -382,7 +402,7 @@ const LogsTable = () => {
       key: COLUMN_KEYS.CHANNEL,
       title: t('渠道'),
       dataIndex: 'channel',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         return isAdminUser ? (
           record.type === 0 || record.type === 2 || record.type === 6 ? (
@@ -409,7 +429,7 @@ const LogsTable = () => {
       key: COLUMN_KEYS.USERNAME,
       title: t('用户'),
       dataIndex: 'username',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         return isAdminUser ? (
           <div>
@@ -566,7 +586,18 @@ const LogsTable = () => {
       dataIndex: 'quota',
       render: (text, record, index) => {
         return record.type === 0 || record.type === 2 || record.type === 6 ? (
-          <>{renderQuota(text, 6)}</>
+          <>
+            {renderQuota(text, 6)}
+            {isAdminUser && record.cost > 0 && (
+              <div>
+                <span
+                  style={{ color: 'var(--semi-color-text-2)', fontSize: 12 }}
+                >
+                  {t('成本')}：{renderQuota(record.cost, 6)}
+                </span>
+              </div>
+            )}
+          </>
         ) : (
           <></>
         );
@@ -576,7 +607,7 @@ const LogsTable = () => {
       key: COLUMN_KEYS.RETRY,
       title: t('重试'),
       dataIndex: 'retry',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         let content = t('渠道') + `：${record.channel}`;
         if (record.other !== '') {
@@ -623,7 +654,8 @@ const LogsTable = () => {
           );
         }
 
-        let content = other?.claude
+        let content =
+          other?.claude || other?.cache_creation_tokens > 0
           ? renderClaudeModelPriceSimple(
               other.model_ratio,
               other.model_price,
@@ -641,14 +673,17 @@ const LogsTable = () => {
               other.cache_ratio || 1.0,
             );
         return (
-          <Paragraph
-            ellipsis={{
-              rows: 2,
-            }}
-            style={{ maxWidth: 240 }}
-          >
-            {content}
-          </Paragraph>
+          <>
+            <Paragraph
+              ellipsis={{
+                rows: 2,
+              }}
+              style={{ maxWidth: 240 }}
+            >
+              {content}
+            </Paragraph>
+            {renderRefundAction(record, other)}
+          </>
         );
       },
     },
@@ -754,7 +789,7 @@ const LogsTable = () => {
   const [logCount, setLogCount] = useState(ITEMS_PER_PAGE);
   const [pageSize, setPageSize] = useState(ITEMS_PER_PAGE);
   const [logType, setLogType] = useState(0);
-  const isAdminUser = isAdmin();
+  const isAdminUser = hasPermission('logs:read');
   let now = new Date();
   // 初始化start_timestamp为今天0点
   const [inputs, setInputs] = useState({
@@ -785,6 +820,74 @@ const LogsTable = () => {
     setInputs((inputs) => ({ ...inputs, [name]: value }));
   };
 
+  // 消费记录退款申请
+  const [refundLog, setRefundLog] = useState(null);
+  const [refundReason, setRefundReason] = useState('');
+  const [showRefunds, setShowRefunds] = useState(false);
+  const [refunds, setRefunds] = useState([]);
+  const refundEnabled = (() => {
+    const status = localStorage.getItem('status');
+    return status ? !!JSON.parse(status).refund_enabled : false;
+  })();
+
+  const renderRefundAction = (record, other) => {
+    if (other?.refunded) {
+      return <Tag color='teal'>{t('已退款')}</Tag>;
+    }
+    if (
+      !refundEnabled ||
+      record.quota <= 0 ||
+      record.user_id !== getUserIdFromLocalStorage()
+    ) {
+      return null;
+    }
+    return (
+      <Button
+        size='small'
+        theme='borderless'
+        onClick={(e) => {
+          e.stopPropagation();
+          setRefundReason('');
+          setRefundLog(record);
+        }}
+      >
+        {t('申请退款')}
+      </Button>
+    );
+  };
+
+  const submitRefund = async () => {
+    const res = await API.post('/api/user/refund', {
+      log_id: refundLog.id,
+      created_at: refundLog.created_at,
+      reason: refundReason,
+    });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('退款申请已提交，请等待管理员审核'));
+      setRefundLog(null);
+    } else {
+      showError(message);
+    }
+  };
+
+  const loadRefunds = async () => {
+    const res = await API.get('/api/user/self/refunds?p=1&page_size=50');
+    const { success, message, data } = res.data;
+    if (success) {
+      setRefunds(data.items || []);
+      setShowRefunds(true);
+    } else {
+      showError(message);
+    }
+  };
+
+  const refundStatusTags = {
+    1: <Tag color='orange'>{t('待审核')}</Tag>,
+    2: <Tag color='green'>{t('已退款')}</Tag>,
+    3: <Tag color='red'>{t('已拒绝')}</Tag>,
+  };
+
   const getLogSelfStat = async () => {
     let localStartTimestamp = Date.parse(start_timestamp) / 1000;
     let localEndTimestamp = Date.parse(end_timestamp) / 1000;
@@ -881,7 +984,7 @@ const LogsTable = () => {
       }
       
       let expandDataLocal = [];
-      if (isAdmin()) {
+      if (hasPermission('logs:read')) {
         // let content = '渠道：' + logs[i].channel;
         // if (other.admin_info !== undefined) {
         //   if (
@@ -939,7 +1042,8 @@ const LogsTable = () => {
       if (logs[i].type === 2) {
         expandDataLocal.push({
           key: t('日志详情'),
-          value: other?.claude
+          value:
+            other?.claude || other?.cache_creation_tokens > 0
             ? renderClaudeLogContent(
                 other?.model_ratio,
                 other.completion_ratio,
@@ -989,9 +1093,14 @@ const LogsTable = () => {
             other?.cache_tokens || 0,
             other?.cache_ratio || 1.0,
           );
-        } else if (other?.claude) {
+        } else if (other?.claude || other?.cache_creation_tokens > 0) {
+          // OpenAI 格式的提示 tokens 包含缓存读取和写入的部分
           content = renderClaudeModelPrice(
-            logs[i].prompt_tokens,
+            other?.claude
+              ? logs[i].prompt_tokens
+              : logs[i].prompt_tokens -
+                  (other.cache_tokens || 0) -
+                  other.cache_creation_tokens,
             logs[i].completion_tokens,
             other.model_ratio,
             other.model_price,
@@ -1519,6 +1628,9 @@ const LogsTable = () => {
             <Select.Option value='4'>{t('系统')}</Select.Option>
             <Select.Option value='5'>{t('签到')}</Select.Option> {/* 添加签到选项 */}
             <Select.Option value='6'>{t('错误')}</Select.Option>
+            <Select.Option value='7'>{t('护栏')}</Select.Option>
+            <Select.Option value='8'>{t('订阅')}</Select.Option>
+            <Select.Option value='9'>{t('退款')}</Select.Option>
           </Select>
           <Button
             theme='light'
@@ -1529,7 +1641,76 @@ const LogsTable = () => {
           >
             {t('列设置')}
           </Button>
+          {refundEnabled && (
+            <Button
+              theme='light'
+              type='tertiary'
+              onClick={loadRefunds}
+              style={{ marginLeft: 8 }}
+            >
+              {t('我的退款申请')}
+            </Button>
+          )}
         </div>
+        <Modal
+          title={t('申请退款')}
+          visible={refundLog !== null}
+          onOk={submitRefund}
+          onCancel={() => setRefundLog(null)}
+        >
+          {refundLog && (
+            <>
+              <p>
+                {t('模型')}：{refundLog.model_name}，{t('花费')}：
+                {renderQuota(refundLog.quota, 6)}
+              </p>
+              <TextArea
+                placeholder={t('请说明退款原因，例如上游返回空内容或错误')}
+                value={refundReason}
+                maxCount={500}
+                onChange={(value) => setRefundReason(value)}
+              />
+            </>
+          )}
+        </Modal>
+        <Modal
+          title={t('我的退款申请')}
+          visible={showRefunds}
+          footer={null}
+          width={800}
+          onCancel={() => setShowRefunds(false)}
+        >
+          <Table
+            size='small'
+            rowKey='id'
+            dataSource={refunds}
+            pagination={false}
+            columns={[
+              {
+                title: t('申请时间'),
+                dataIndex: 'created_time',
+                render: (text) => renderTimestamp(text),
+              },
+              { title: t('模型'), dataIndex: 'model_name' },
+              {
+                title: t('额度'),
+                dataIndex: 'quota',
+                render: (text) => renderQuota(text, 6),
+              },
+              { title: t('原因'), dataIndex: 'reason' },
+              {
+                title: t('状态'),
+                dataIndex: 'status',
+                render: (text) => refundStatusTags[text],
+              },
+              {
+                title: t('备注'),
+                dataIndex: 'remark',
+                render: (text) => text || '-',
+              },
+            ]}
+          />
+        </Modal>
         <Table
           style={{ marginTop: 5 }}
           columns={getVisibleColumns()}
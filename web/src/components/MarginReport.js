@@ -0,0 +1,144 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Button,
+  Card,
+  DatePicker,
+  Select,
+  Space,
+  Table,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, showError, timestamp2string } from '../helpers';
+import { renderQuota } from '../helpers/render';
+
+// MarginReport 按渠道、模型、分组或日期汇总收入、上游成本和毛利，数据来自渠道成本统计
+const MarginReport = () => {
+  const { t } = useTranslation();
+  const now = new Date();
+  const [range, setRange] = useState([
+    new Date(now.getTime() - 7 * 86400 * 1000),
+    now,
+  ]);
+  const [groupBy, setGroupBy] = useState('channel');
+  const [data, setData] = useState([]);
+  const [loading, setLoading] = useState(false);
+
+  const loadReport = async () => {
+    if (!Array.isArray(range) || range.length !== 2) {
+      return;
+    }
+    setLoading(true);
+    const params = new URLSearchParams();
+    params.set('start_timestamp', Math.floor(range[0].getTime() / 1000));
+    params.set('end_timestamp', Math.floor(range[1].getTime() / 1000));
+    params.set('group_by', groupBy);
+    const res = await API.get(`/api/data/margin?${params.toString()}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setData(data || []);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  useEffect(() => {
+    loadReport().then();
+  }, [groupBy]);
+
+  const marginRate = (record) =>
+    record.quota > 0
+      ? ((record.margin / record.quota) * 100).toFixed(2) + '%'
+      : '-';
+
+  const dimensionColumns = {
+    channel: { title: t('渠道'), dataIndex: 'channel_id' },
+    model: { title: t('模型'), dataIndex: 'model_name' },
+    group: { title: t('分组'), dataIndex: 'group' },
+    day: {
+      title: t('日期'),
+      dataIndex: 'day',
+      render: (text) => timestamp2string(text).slice(0, 10),
+    },
+  };
+
+  const columns = [
+    dimensionColumns[groupBy],
+    { title: t('请求次数'), dataIndex: 'count' },
+    { title: t('Tokens'), dataIndex: 'token_used' },
+    {
+      title: t('收入'),
+      dataIndex: 'quota',
+      render: (text) => renderQuota(text, 6),
+    },
+    {
+      title: t('成本'),
+      dataIndex: 'cost',
+      render: (text) => renderQuota(text, 6),
+    },
+    {
+      title: t('毛利'),
+      dataIndex: 'margin',
+      render: (text) => (
+        <Typography.Text type={text < 0 ? 'danger' : undefined}>
+          {renderQuota(text, 6)}
+        </Typography.Text>
+      ),
+    },
+    {
+      title: t('毛利率'),
+      dataIndex: 'margin_rate',
+      render: (text, record) => marginRate(record),
+    },
+  ];
+
+  const total = data.reduce(
+    (sum, record) => ({
+      count: sum.count + record.count,
+      quota: sum.quota + record.quota,
+      cost: sum.cost + record.cost,
+      margin: sum.margin + record.margin,
+    }),
+    { count: 0, quota: 0, cost: 0, margin: 0 },
+  );
+
+  return (
+    <Card style={{ marginTop: 10 }}>
+      <Typography.Title heading={5}>{t('毛利报表')}</Typography.Title>
+      <Typography.Text type='tertiary'>
+        {t('未配置成本价格或成本倍率的渠道成本记为 0，日期按 UTC 零点划分')}
+      </Typography.Text>
+      <Space style={{ marginTop: 10, marginBottom: 10 }} wrap>
+        <DatePicker
+          type='dateTimeRange'
+          value={range}
+          onChange={(value) => setRange(value)}
+        />
+        <Select value={groupBy} onChange={setGroupBy} style={{ width: 140 }}>
+          <Select.Option value='channel'>{t('按渠道')}</Select.Option>
+          <Select.Option value='model'>{t('按模型')}</Select.Option>
+          <Select.Option value='group'>{t('按分组')}</Select.Option>
+          <Select.Option value='day'>{t('按日期')}</Select.Option>
+        </Select>
+        <Button onClick={loadReport}>{t('查询')}</Button>
+      </Space>
+      <Typography.Paragraph>
+        {t('收入')}：{renderQuota(total.quota, 6)}，{t('成本')}：
+        {renderQuota(total.cost, 6)}，{t('毛利')}：
+        {renderQuota(total.margin, 6)}，{t('毛利率')}：{marginRate(total)}
+      </Typography.Paragraph>
+      <Table
+        columns={columns}
+        dataSource={data}
+        loading={loading}
+        rowKey={(record) =>
+          `${record.channel_id}-${record.model_name}-${record.group}-${record.day}`
+        }
+        pagination={{ pageSize: 20 }}
+      />
+    </Card>
+  );
+};
+
+export default MarginReport;
@@ -2,7 +2,7 @@ import React, { useEffect, useState } from 'react';
 import {
   API,
   copy,
-  isAdmin,
+  hasPermission,
   showError,
   showSuccess,
   timestamp2string,
@@ -282,7 +282,7 @@ const LogsTable = () => {
     {
       title: t('渠道'),
       dataIndex: 'channel_id',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         return (
           <div>
@@ -317,7 +317,7 @@ const LogsTable = () => {
     {
       title: t('提交结果'),
       dataIndex: 'code',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         return <div>{renderCode(text)}</div>;
       },
@@ -325,7 +325,7 @@ const LogsTable = () => {
     {
       title: t('任务状态'),
       dataIndex: 'status',
-      className: isAdmin() ? 'tableShow' : 'tableHiddle',
+      className: hasPermission('logs:read') ? 'tableShow' : 'tableHiddle',
       render: (text, record, index) => {
         return <div>{renderStatus(text)}</div>;
       },
@@ -448,7 +448,7 @@ const LogsTable = () => {
   const [activePage, setActivePage] = useState(1);
   const [logCount, setLogCount] = useState(ITEMS_PER_PAGE);
   const [logType, setLogType] = useState(0);
-  const isAdminUser = isAdmin();
+  const isAdminUser = hasPermission('logs:read');
   const [isModalOpenurl, setIsModalOpenurl] = useState(false);
   const [showBanner, setShowBanner] = useState(false);
 
@@ -101,6 +101,45 @@ const ModelPricing = () => {
     );
   }
 
+  function renderPricingRule(rule) {
+    return (
+      <>
+        {(rule.tiers || []).map((tier) => (
+          <div key={tier.min_prompt_tokens}>
+            <Text type='tertiary'>
+              {t('提示词')} ≥ {tier.min_prompt_tokens}：{t('模型倍率')}{' '}
+              {tier.model_ratio}
+              {tier.completion_ratio
+                ? `，${t('补全倍率')} ${tier.completion_ratio}`
+                : ''}
+            </Text>
+          </div>
+        ))}
+        {rule.reasoning_ratio > 0 && (
+          <div>
+            <Text type='tertiary'>
+              {t('推理倍率')}：{rule.reasoning_ratio}
+            </Text>
+          </div>
+        )}
+        {rule.fixed_fee > 0 && (
+          <div>
+            <Text type='tertiary'>
+              {t('每次请求固定费用')}：${rule.fixed_fee}
+            </Text>
+          </div>
+        )}
+        {(rule.time_discounts || []).map((d) => (
+          <div key={d.start + d.end}>
+            <Text type='tertiary'>
+              {d.start}-{d.end}：{t('折扣')} {d.discount}
+            </Text>
+          </div>
+        ))}
+      </>
+    );
+  }
+
   const columns = [
     {
       title: t('可用性'),
@@ -229,6 +268,7 @@ const ModelPricing = () => {
             <Text>
               {t('分组倍率')}：{groupRatio[selectedGroup]}
             </Text>
+            {record.pricing_rule && renderPricingRule(record.pricing_rule)}
           </>
         );
         return <div>{content}</div>;
@@ -23,6 +23,8 @@ const OAuth2Callback = (props) => {
       if (message === 'bind') {
         showSuccess('绑定成功！');
         navigate('/setting');
+      } else if (data && data.require_2fa) {
+        navigate('/login?require_2fa=1');
       } else {
         userDispatch({ type: 'login', payload: data });
         localStorage.setItem('user', JSON.stringify(data));
@@ -3,12 +3,23 @@ import { Card, Spin, Tabs } from '@douyinfe/semi-ui';
 import SettingsGeneral from '../pages/Setting/Operation/SettingsGeneral.js';
 import SettingsDrawing from '../pages/Setting/Operation/SettingsDrawing.js';
 import SettingsSensitiveWords from '../pages/Setting/Operation/SettingsSensitiveWords.js';
+import SettingsGuardrail from '../pages/Setting/Operation/SettingsGuardrail.js';
+import SettingsPIIRedaction from '../pages/Setting/Operation/SettingsPIIRedaction.js';
 import SettingsLog from '../pages/Setting/Operation/SettingsLog.js';
 import SettingsDataDashboard from '../pages/Setting/Operation/SettingsDataDashboard.js';
 import SettingsMonitoring from '../pages/Setting/Operation/SettingsMonitoring.js';
 import SettingsCheckIn from '../pages/Setting/Operation/SettingsCheckIn.js';
 import SettingsCreditLimit from '../pages/Setting/Operation/SettingsCreditLimit.js';
+import SettingsRealtime from '../pages/Setting/Operation/SettingsRealtime.js';
+import SettingsHedge from '../pages/Setting/Operation/SettingsHedge.js';
+import SettingsSessionAffinity from '../pages/Setting/Operation/SettingsSessionAffinity.js';
+import SettingsPromptCache from '../pages/Setting/Operation/SettingsPromptCache.js';
+import SettingsStructuredOutput from '../pages/Setting/Operation/SettingsStructuredOutput.js';
+import SettingsToolEmulation from '../pages/Setting/Operation/SettingsToolEmulation.js';
 import SettingsRebate from '../pages/Setting/Operation/SettingsRebate.js';
+import SettingsPromotion from '../pages/Setting/Operation/SettingsPromotion.js';
+import SettingsCredit from '../pages/Setting/Operation/SettingsCredit.js';
+import SettingsRefund from '../pages/Setting/Operation/SettingsRefund.js';
 import ModelSettingsVisualEditor from '../pages/Setting/Operation/ModelSettingsVisualEditor.js';
 import GroupRatioSettings from '../pages/Setting/Operation/GroupRatioSettings.js';
 import ModelRatioSettings from '../pages/Setting/Operation/ModelRatioSettings.js';
@@ -27,10 +38,13 @@ const OperationSetting = () => {
     QuotaRemindThreshold: 0,
     PreConsumedQuota: 0,
     StreamCacheQueueLength: 0,
+    StreamFilterHoldLength: 64,
+    StreamGuardrailCheckLength: 200,
     ModelRatio: '',
     CacheRatio: '',
     CompletionRatio: '',
     ModelPrice: '',
+    PricingRules: '',
     GroupRatio: '',
     UserUsableGroups: '',
     TopUpLink: '',
@@ -50,6 +64,31 @@ const OperationSetting = () => {
     CheckSensitiveOnCompletionEnabled: '',
     StopOnSensitiveEnabled: '',
     SensitiveWords: '',
+    'guardrail_setting.enabled': false,
+    'guardrail_setting.default_policy': '',
+    'guardrail_setting.policies': '',
+    'guardrail_setting.group_policies': '',
+    'pii_redaction_setting.policies': '',
+    'pii_redaction_setting.tag_policies': '',
+    'realtime_setting.max_session_seconds': 0,
+    'realtime_setting.reserve_tokens': 0,
+    'hedge_setting.enabled': false,
+    'hedge_setting.rules': '',
+    'stream_failover_setting.enabled': false,
+    'stream_failover_setting.max_attempts': 2,
+    'session_affinity_setting.enabled': false,
+    'session_affinity_setting.ttl_seconds': 600,
+    'session_affinity_setting.use_user_field': true,
+    'session_affinity_setting.use_prefix_hash': true,
+    'prompt_cache_setting.enabled': false,
+    'prompt_cache_setting.rules': '',
+    'structured_output_setting.enabled': false,
+    'structured_output_setting.mode': 'prompt',
+    'structured_output_setting.max_retries': 1,
+    'structured_output_setting.channel_types': '',
+    'tool_emulation_setting.enabled': false,
+    'tool_emulation_setting.channel_types': '',
+    'tool_emulation_setting.models': '',
     MjNotifyEnabled: false,
     MjAccountFilterEnabled: false,
     MjModeClearEnabled: false,
@@ -70,6 +109,20 @@ const OperationSetting = () => {
     CheckInMaxQuota: '',
     RebateEnabled: false,
     RebatePercentage: 0,
+    'promotion.topup_bonus_percent': 0,
+    'promotion.first_topup_bonus_percent': 0,
+    'promotion.max_bonus_percent': 0,
+    'credit.topup_expire_days': 0,
+    'credit.promotion_expire_days': 0,
+    'credit.redemption_expire_days': 0,
+    'credit.gift_expire_days': 0,
+    'credit.checkin_expire_days': 0,
+    'credit.affiliate_expire_days': 0,
+    'credit.signup_expire_days': 0,
+    'refund.enabled': false,
+    'refund.window_days': 7,
+    'refund.auto_refund_empty_response': false,
+    'refund.auto_refund_finish_reasons': '[]',
   });
 
   let [loading, setLoading] = useState(false);
@@ -86,13 +139,26 @@ const OperationSetting = () => {
           item.key === 'UserUsableGroups' ||
           item.key === 'CompletionRatio' ||
           item.key === 'ModelPrice' ||
-          item.key === 'CacheRatio'
+          item.key === 'CacheRatio' ||
+          item.key === 'PricingRules' ||
+          item.key === 'guardrail_setting.policies' ||
+          item.key === 'guardrail_setting.group_policies' ||
+          item.key === 'pii_redaction_setting.policies' ||
+          item.key === 'pii_redaction_setting.tag_policies' ||
+          item.key === 'hedge_setting.rules' ||
+          item.key === 'prompt_cache_setting.rules'
         ) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
         if (
           item.key.endsWith('Enabled') ||
-          ['DefaultCollapseSidebar'].includes(item.key)
+          item.key.endsWith('.enabled') ||
+          [
+            'DefaultCollapseSidebar',
+            'session_affinity_setting.use_user_field',
+            'session_affinity_setting.use_prefix_hash',
+            'refund.auto_refund_empty_response',
+          ].includes(item.key)
         ) {
           newInputs[item.key] = item.value === 'true' ? true : false;
         } else {
@@ -136,6 +202,14 @@ const OperationSetting = () => {
         <Card style={{ marginTop: '10px' }}>
           <SettingsSensitiveWords options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 内容护栏设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsGuardrail options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 个人信息脱敏设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsPIIRedaction options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 日志设置 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsLog options={inputs} refresh={onRefresh} />
@@ -156,10 +230,46 @@ const OperationSetting = () => {
         <Card style={{ marginTop: '10px' }}>
           <SettingsCreditLimit options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 实时语音设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsRealtime options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 渠道容错设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsHedge options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 会话亲和设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsSessionAffinity options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 提示词缓存设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsPromptCache options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 结构化输出模拟 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsStructuredOutput options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 工具调用模拟 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsToolEmulation options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 返佣设置 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsRebate options={inputs} refresh={onRefresh} />
         </Card>
+        {/* 充值活动设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsPromotion options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 额度有效期设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsCredit options={inputs} refresh={onRefresh} />
+        </Card>
+        {/* 消费退款设置 */}
+        <Card style={{ marginTop: '10px' }}>
+          <SettingsRefund options={inputs} refresh={onRefresh} />
+        </Card>
         {/* 聊天设置 */}
         <Card style={{ marginTop: '10px' }}>
           <SettingsChats options={inputs} refresh={onRefresh} />
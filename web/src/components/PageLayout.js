@@ -3,6 +3,7 @@ import { Layout } from '@douyinfe/semi-ui';
 import SiderBar from './SiderBar.js';
 import App from '../App.js';
 import FooterBar from './Footer.js';
+import StepUpModal from './StepUpModal.js';
 import { ToastContainer } from 'react-toastify';
 import React, { useContext, useEffect } from 'react';
 import { StyleContext } from '../context/Style/index.js';
@@ -157,6 +158,7 @@ const PageLayout = () => {
         </Layout>
       </Layout>
       <ToastContainer />
+      <StepUpModal />
     </Layout>
   );
 };
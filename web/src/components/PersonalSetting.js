@@ -45,6 +45,7 @@ import {
   stringToColor,
 } from '../helpers/render';
 import TelegramLoginButton from 'react-telegram-login';
+import SecuritySetting from './SecuritySetting';
 import { useTranslation } from 'react-i18next';
 
 const PersonalSetting = () => {
@@ -61,6 +62,7 @@ const PersonalSetting = () => {
     set_new_password_confirmation: '',
   });
   const [status, setStatus] = useState({});
+  const [tokenScopes, setTokenScopes] = useState([]);
   const [showChangePasswordModal, setShowChangePasswordModal] = useState(false);
   const [showWeChatBindModal, setShowWeChatBindModal] = useState(false);
   const [showEmailBindModal, setShowEmailBindModal] = useState(false);
@@ -160,7 +162,9 @@ const PersonalSetting = () => {
   };
 
   const generateAccessToken = async () => {
-    const res = await API.get('/api/user/token');
+    const res = await API.get('/api/user/token', {
+      params: { scopes: tokenScopes.join(',') },
+    });
     const { success, message, data } = res.data;
     if (success) {
       setSystemToken(data);
@@ -840,6 +844,20 @@ const PersonalSetting = () => {
                 </div>
               </div>
               <div style={{ marginTop: 10 }}>
+                {userState?.user?.permissions?.length > 0 && (
+                  <Select
+                    multiple
+                    style={{ width: '100%', marginBottom: 10 }}
+                    placeholder={t(
+                      '系统访问令牌的授权范围，留空表示拥有账户的全部权限',
+                    )}
+                    value={tokenScopes}
+                    onChange={(value) => setTokenScopes(value)}
+                    optionList={userState.user.permissions.map(
+                      (permission) => ({ label: permission, value: permission }),
+                    )}
+                  />
+                )}
                 <Space>
                   <Button onClick={generateAccessToken}>
                     {t('生成系统访问令牌')}
@@ -894,6 +912,7 @@ const PersonalSetting = () => {
                 </Modal>
               </div>
             </Card>
+            <SecuritySetting />
             <Card style={{ marginTop: 10 }}>
               <Tabs type="line" defaultActiveKey="notification">
                 <TabPane tab={t('通知设置')} itemKey="notification">
@@ -26,6 +26,64 @@ function renderTimestamp(timestamp) {
   return <>{timestamp2string(timestamp)}</>;
 }
 
+// 活动统计模态框组件
+const CampaignStatsModal = ({ visible, onClose }) => {
+  const { t } = useTranslation();
+  const [stats, setStats] = useState([]);
+  const [loading, setLoading] = useState(false);
+
+  useEffect(() => {
+    if (!visible) {
+      return;
+    }
+    setLoading(true);
+    API.get('/api/redemption/campaigns').then((res) => {
+      const { success, message, data } = res.data;
+      if (success) {
+        setStats(data || []);
+      } else {
+        showError(message);
+      }
+      setLoading(false);
+    });
+  }, [visible]);
+
+  const columns = [
+    { title: t('活动名称'), dataIndex: 'campaign' },
+    { title: t('兑换码数量'), dataIndex: 'codes' },
+    { title: t('使用次数'), dataIndex: 'redemptions' },
+    { title: t('参与用户数'), dataIndex: 'users' },
+    {
+      title: t('发放额度'),
+      dataIndex: 'quota',
+      render: (text) => renderQuota(parseInt(text)),
+    },
+    {
+      title: t('最后使用时间'),
+      dataIndex: 'last_used_time',
+      render: (text) => (text ? renderTimestamp(text) : '-'),
+    },
+  ];
+
+  return (
+    <Modal
+      title={t('活动统计')}
+      visible={visible}
+      onCancel={onClose}
+      footer={null}
+      width={800}
+    >
+      <Table
+        columns={columns}
+        dataSource={stats}
+        rowKey='campaign'
+        loading={loading}
+        pagination={false}
+      />
+    </Modal>
+  );
+};
+
 // 批量删除兑换码模态框组件
 const BatchDeleteByNameModal = ({ visible, onClose, onConfirm }) => {
   const { t } = useTranslation();
@@ -180,6 +238,38 @@ const RedemptionsTable = () => {
     return maxUses === -1 ? t('无限制') : maxUses;
   };
 
+  const renderPromotion = (record) => {
+    switch (record.type) {
+      case 1:
+        return (
+          <Tag color='orange' size='large'>
+            {t('充值赠送 {{percent}}%', { percent: record.bonus_percent })}
+          </Tag>
+        );
+      case 2:
+        return (
+          <Tag color='purple' size='large'>
+            {t('升级到 {{group}} {{days}} 天', {
+              group: record.upgrade_group,
+              days: record.upgrade_days,
+            })}
+          </Tag>
+        );
+      case 3:
+        return (
+          <Tag color='cyan' size='large'>
+            {t('模型额度')}
+          </Tag>
+        );
+      default:
+        return (
+          <Tag color='grey' size='large'>
+            {t('额度')}
+          </Tag>
+        );
+    }
+  };
+
   const columns = [
     {
       title: t('ID'),
@@ -197,6 +287,16 @@ const RedemptionsTable = () => {
         return <div>{renderStatus(text)}</div>;
       },
     },
+    {
+      title: t('优惠类型'),
+      dataIndex: 'type',
+      render: (text, record) => renderPromotion(record),
+    },
+    {
+      title: t('活动'),
+      dataIndex: 'campaign',
+      render: (text) => text || '-',
+    },
     {
       title: t('额度'),
       dataIndex: 'quota',
@@ -322,6 +422,7 @@ const RedemptionsTable = () => {
   });
   const [showEdit, setShowEdit] = useState(false);
   const [showBatchDeleteByName, setShowBatchDeleteByName] = useState(false);
+  const [showCampaignStats, setShowCampaignStats] = useState(false);
   
   const closeEdit = () => {
     setShowEdit(false);
@@ -557,6 +658,11 @@ const RedemptionsTable = () => {
         onClose={() => setShowBatchDeleteByName(false)} 
         onConfirm={refresh}
       />
+
+      <CampaignStatsModal
+        visible={showCampaignStats}
+        onClose={() => setShowCampaignStats(false)}
+      />
       
       <Form
         onSubmit={() => {
@@ -624,10 +730,14 @@ const RedemptionsTable = () => {
         </Button>
         <Button
           type='danger'
+          style={{ marginRight: 8 }}
           onClick={deleteAllDisabledRedemptions}
         >
           {t('删除所有已禁用的兑换码')}
         </Button>
+        <Button theme='light' onClick={() => setShowCampaignStats(true)}>
+          {t('活动统计')}
+        </Button>
       </div>
 
       <Table
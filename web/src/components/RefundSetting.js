@@ -0,0 +1,287 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Button,
+  Card,
+  Input,
+  Modal,
+  Select,
+  Space,
+  Table,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
+import { renderQuota } from '../helpers/render';
+import { ITEMS_PER_PAGE } from '../constants';
+
+// RefundSetting 审核用户针对消费记录提交的退款申请，并按渠道统计退款情况
+const RefundSetting = () => {
+  const { t } = useTranslation();
+  const [requests, setRequests] = useState([]);
+  const [total, setTotal] = useState(0);
+  const [loading, setLoading] = useState(false);
+  const [activePage, setActivePage] = useState(1);
+  const [status, setStatus] = useState('1');
+  const [channel, setChannel] = useState('');
+  const [processing, setProcessing] = useState(null);
+  const [remark, setRemark] = useState('');
+  const [stats, setStats] = useState([]);
+
+  const statusTags = {
+    1: <Tag color='orange'>{t('待审核')}</Tag>,
+    2: <Tag color='green'>{t('已退款')}</Tag>,
+    3: <Tag color='red'>{t('已拒绝')}</Tag>,
+  };
+
+  const loadRequests = async (page) => {
+    setLoading(true);
+    const params = new URLSearchParams();
+    params.set('p', page);
+    params.set('page_size', ITEMS_PER_PAGE);
+    params.set('status', status);
+    if (channel !== '') {
+      params.set('channel', channel);
+    }
+    const res = await API.get(`/api/refund/?${params.toString()}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setRequests(data.items || []);
+      setTotal(data.total);
+      setActivePage(data.page);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const loadStats = async () => {
+    const res = await API.get('/api/refund/channel_stats');
+    const { success, message, data } = res.data;
+    if (success) {
+      setStats(data || []);
+    } else {
+      showError(message);
+    }
+  };
+
+  useEffect(() => {
+    loadRequests(1).then();
+  }, [status]);
+
+  useEffect(() => {
+    loadStats().then();
+  }, []);
+
+  const processRequest = async () => {
+    const res = await API.post(
+      `/api/refund/${processing.request.id}/${processing.action}`,
+      { remark },
+    );
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('操作成功完成！'));
+      setProcessing(null);
+      await loadRequests(activePage);
+      await loadStats();
+    } else {
+      showError(message);
+    }
+  };
+
+  const openProcess = (request, action) => {
+    setRemark('');
+    setProcessing({ request, action });
+  };
+
+  const columns = [
+    {
+      title: t('申请时间'),
+      dataIndex: 'created_time',
+      render: (text) => timestamp2string(text),
+    },
+    {
+      title: t('用户'),
+      dataIndex: 'username',
+      render: (text, record) => text || record.user_id,
+    },
+    {
+      title: t('渠道'),
+      dataIndex: 'channel_id',
+    },
+    {
+      title: t('模型'),
+      dataIndex: 'model_name',
+    },
+    {
+      title: t('额度'),
+      dataIndex: 'quota',
+      render: (text) => renderQuota(text, 6),
+    },
+    {
+      title: t('消费时间'),
+      dataIndex: 'log_time',
+      render: (text) => timestamp2string(text),
+    },
+    {
+      title: t('原因'),
+      dataIndex: 'reason',
+      render: (text, record) => (
+        <>
+          {record.auto && <Tag color='blue'>{t('自动')}</Tag>} {text}
+        </>
+      ),
+    },
+    {
+      title: t('状态'),
+      dataIndex: 'status',
+      render: (text, record) => (
+        <>
+          {statusTags[text]}
+          {record.remark && (
+            <Typography.Text type='tertiary'> {record.remark}</Typography.Text>
+          )}
+        </>
+      ),
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record) =>
+        record.status === 1 && (
+          <Space>
+            <Button
+              theme='light'
+              type='primary'
+              onClick={() => openProcess(record, 'approve')}
+            >
+              {t('通过')}
+            </Button>
+            <Button
+              theme='light'
+              type='danger'
+              onClick={() => openProcess(record, 'reject')}
+            >
+              {t('拒绝')}
+            </Button>
+          </Space>
+        ),
+    },
+  ];
+
+  const statColumns = [
+    {
+      title: t('渠道'),
+      dataIndex: 'channel_id',
+      render: (text, record) =>
+        record.channel_name ? `${record.channel_name} (#${text})` : `#${text}`,
+    },
+    {
+      title: t('消费记录数'),
+      dataIndex: 'consume_count',
+    },
+    {
+      title: t('退款申请'),
+      dataIndex: 'requests',
+    },
+    {
+      title: t('已退款'),
+      dataIndex: 'approved',
+      render: (text, record) => `${text}（${t('自动')} ${record.auto}）`,
+    },
+    {
+      title: t('已拒绝'),
+      dataIndex: 'rejected',
+    },
+    {
+      title: t('待审核'),
+      dataIndex: 'pending',
+    },
+    {
+      title: t('退款额度'),
+      dataIndex: 'refunded_quota',
+      render: (text) => renderQuota(text, 6),
+    },
+    {
+      title: t('退款率'),
+      dataIndex: 'refund_rate',
+      render: (text) => (text * 100).toFixed(2) + '%',
+    },
+  ];
+
+  return (
+    <>
+      <Card style={{ marginTop: '10px' }}>
+        <Space style={{ marginBottom: 10 }}>
+          <Select value={status} style={{ width: 120 }} onChange={setStatus}>
+            <Select.Option value='0'>{t('全部')}</Select.Option>
+            <Select.Option value='1'>{t('待审核')}</Select.Option>
+            <Select.Option value='2'>{t('已退款')}</Select.Option>
+            <Select.Option value='3'>{t('已拒绝')}</Select.Option>
+          </Select>
+          <Input
+            placeholder={t('渠道 ID')}
+            value={channel}
+            style={{ width: 120 }}
+            onChange={setChannel}
+          />
+          <Button onClick={() => loadRequests(1)}>{t('查询')}</Button>
+        </Space>
+        <Table
+          columns={columns}
+          dataSource={requests}
+          rowKey='id'
+          loading={loading}
+          pagination={{
+            currentPage: activePage,
+            pageSize: ITEMS_PER_PAGE,
+            total: total,
+            onPageChange: (page) => loadRequests(page),
+          }}
+        />
+      </Card>
+      <Card style={{ marginTop: '10px' }}>
+        <Typography.Title heading={6}>{t('渠道退款统计')}</Typography.Title>
+        <Typography.Text type='tertiary'>
+          {t('退款率较高的渠道可能存在上游返回空内容或错误的问题')}
+        </Typography.Text>
+        <Table
+          style={{ marginTop: 10 }}
+          columns={statColumns}
+          dataSource={stats}
+          rowKey='channel_id'
+          pagination={false}
+        />
+      </Card>
+      <Modal
+        title={
+          processing && processing.action === 'approve'
+            ? t('通过退款申请')
+            : t('拒绝退款申请')
+        }
+        visible={processing !== null}
+        onOk={processRequest}
+        onCancel={() => setProcessing(null)}
+      >
+        {processing && (
+          <Space vertical align='start' style={{ width: '100%' }}>
+            <Typography.Text>
+              {processing.action === 'approve'
+                ? t('额度 {{quota}} 将退还给用户和对应的令牌', {
+                    quota: renderQuota(processing.request.quota, 6),
+                  })
+                : t('拒绝后用户无法再次申请该记录的退款')}
+            </Typography.Text>
+            <Input
+              placeholder={t('备注，会展示给用户')}
+              value={remark}
+              onChange={setRemark}
+            />
+          </Space>
+        )}
+      </Modal>
+    </>
+  );
+};
+
+export default RefundSetting;
@@ -0,0 +1,203 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Button,
+  Card,
+  Input,
+  Modal,
+  Popconfirm,
+  Select,
+  Space,
+  Table,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
+
+const emptyRole = { id: 0, name: '', description: '', permissions: [] };
+
+// RoleSetting 自定义角色及其权限管理，角色在用户管理中分配给用户
+const RoleSetting = () => {
+  const { t } = useTranslation();
+  const [roles, setRoles] = useState([]);
+  const [permissions, setPermissions] = useState([]);
+  const [loading, setLoading] = useState(false);
+  const [editingRole, setEditingRole] = useState(null);
+
+  const loadRoles = async () => {
+    setLoading(true);
+    const res = await API.get('/api/role/');
+    const { success, message, data } = res.data;
+    if (success) {
+      setRoles(data || []);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const loadPermissions = async () => {
+    const res = await API.get('/api/role/permissions');
+    if (res && res.data.success) {
+      setPermissions(res.data.data || []);
+    }
+  };
+
+  useEffect(() => {
+    loadRoles().then();
+    loadPermissions().then();
+  }, []);
+
+  const splitPermissions = (value) =>
+    value ? value.split(',').filter((permission) => permission !== '') : [];
+
+  const saveRole = async () => {
+    const payload = {
+      id: editingRole.id,
+      name: editingRole.name,
+      description: editingRole.description,
+      permissions: editingRole.permissions.join(','),
+    };
+    const res = editingRole.id
+      ? await API.put('/api/role/', payload)
+      : await API.post('/api/role/', payload);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('保存成功'));
+      setEditingRole(null);
+      await loadRoles();
+    } else {
+      showError(message);
+    }
+  };
+
+  const deleteRole = async (id) => {
+    const res = await API.delete(`/api/role/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('删除成功'));
+      await loadRoles();
+    } else {
+      showError(message);
+    }
+  };
+
+  const columns = [
+    {
+      title: t('名称'),
+      dataIndex: 'name',
+    },
+    {
+      title: t('描述'),
+      dataIndex: 'description',
+    },
+    {
+      title: t('权限'),
+      dataIndex: 'permissions',
+      render: (text) => (
+        <Space wrap>
+          {splitPermissions(text).map((permission) => (
+            <Tag key={permission}>{permission}</Tag>
+          ))}
+        </Space>
+      ),
+    },
+    {
+      title: t('创建时间'),
+      dataIndex: 'created_time',
+      render: (text) => timestamp2string(text),
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record) => (
+        <Space>
+          <Button
+            theme='light'
+            type='tertiary'
+            onClick={() =>
+              setEditingRole({
+                ...record,
+                permissions: splitPermissions(record.permissions),
+              })
+            }
+          >
+            {t('编辑')}
+          </Button>
+          <Popconfirm
+            title={t('确定要删除该角色吗？已分配该角色的用户会失去对应权限')}
+            okType={'danger'}
+            onConfirm={() => deleteRole(record.id)}
+          >
+            <Button theme='light' type='danger'>
+              {t('删除')}
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  return (
+    <Card style={{ marginTop: '10px' }}>
+      <Space vertical align='start' style={{ width: '100%' }}>
+        <Typography.Text type='tertiary'>
+          {t(
+            '自定义角色授予普通用户细粒度的管理权限，内置管理员和超级管理员的权限不受影响',
+          )}
+        </Typography.Text>
+        <Button type='primary' onClick={() => setEditingRole({ ...emptyRole })}>
+          {t('新建角色')}
+        </Button>
+        <Table
+          style={{ width: '100%' }}
+          columns={columns}
+          dataSource={roles}
+          rowKey='id'
+          loading={loading}
+          pagination={false}
+        />
+      </Space>
+      <Modal
+        title={editingRole && editingRole.id ? t('编辑角色') : t('新建角色')}
+        visible={editingRole !== null}
+        onOk={saveRole}
+        onCancel={() => setEditingRole(null)}
+      >
+        {editingRole && (
+          <Space vertical align='start' style={{ width: '100%' }}>
+            <Typography.Text>{t('名称')}</Typography.Text>
+            <Input
+              value={editingRole.name}
+              onChange={(value) =>
+                setEditingRole({ ...editingRole, name: value })
+              }
+            />
+            <Typography.Text>{t('描述')}</Typography.Text>
+            <Input
+              value={editingRole.description}
+              onChange={(value) =>
+                setEditingRole({ ...editingRole, description: value })
+              }
+            />
+            <Typography.Text>{t('权限')}</Typography.Text>
+            <Select
+              multiple
+              style={{ width: '100%' }}
+              value={editingRole.permissions}
+              onChange={(value) =>
+                setEditingRole({ ...editingRole, permissions: value })
+              }
+              optionList={permissions.map((permission) => ({
+                label: permission,
+                value: permission,
+              }))}
+            />
+          </Space>
+        )}
+      </Modal>
+    </Card>
+  );
+};
+
+export default RoleSetting;
@@ -0,0 +1,303 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Button,
+  Card,
+  Input,
+  Modal,
+  Space,
+  Table,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  API,
+  copy,
+  createPasskey,
+  isPasskeySupported,
+  showError,
+  showSuccess,
+  timestamp2string,
+} from '../helpers';
+
+// SecuritySetting 个人设置中的两步验证与通行密钥管理
+const SecuritySetting = () => {
+  const { t } = useTranslation();
+  const [status, setStatus] = useState({
+    enabled: false,
+    recovery_codes_remaining: 0,
+  });
+  const [passkeys, setPasskeys] = useState([]);
+  const [setup, setSetup] = useState(null);
+  const [code, setCode] = useState('');
+  const [codeAction, setCodeAction] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState([]);
+  const [passkeyName, setPasskeyName] = useState('');
+
+  const loadStatus = async () => {
+    const res = await API.get('/api/user/2fa');
+    if (res && res.data.success) {
+      setStatus(res.data.data);
+    }
+  };
+
+  const loadPasskeys = async () => {
+    const res = await API.get('/api/user/passkey');
+    if (res && res.data.success) {
+      setPasskeys(res.data.data || []);
+    }
+  };
+
+  useEffect(() => {
+    loadStatus().then();
+    loadPasskeys().then();
+  }, []);
+
+  const startSetup = async () => {
+    const res = await API.post('/api/user/2fa/setup');
+    const { success, message, data } = res.data;
+    if (success) {
+      setCode('');
+      setSetup(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  const enableTwoFA = async () => {
+    const res = await API.post('/api/user/2fa/enable', { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      setSetup(null);
+      setRecoveryCodes(data.recovery_codes);
+      showSuccess(t('两步验证已启用'));
+      loadStatus().then();
+    } else {
+      showError(message);
+    }
+  };
+
+  // 关闭两步验证和重新生成恢复码都需要输入当前的验证码
+  const submitCodeAction = async () => {
+    const url =
+      codeAction === 'disable'
+        ? '/api/user/2fa/disable'
+        : '/api/user/2fa/recovery_codes';
+    const res = await API.post(url, { code });
+    const { success, message, data } = res.data;
+    if (success) {
+      if (codeAction === 'disable') {
+        showSuccess(t('两步验证已关闭'));
+      } else {
+        setRecoveryCodes(data.recovery_codes);
+      }
+      setCodeAction('');
+      loadStatus().then();
+    } else {
+      showError(message);
+    }
+  };
+
+  const registerPasskey = async () => {
+    try {
+      const res = await API.post('/api/user/passkey/register/begin');
+      if (!res.data.success) {
+        if (!res.data.step_up_required) {
+          showError(res.data.message);
+        }
+        return;
+      }
+      const credential = await createPasskey(res.data.data);
+      const finish = await API.post('/api/user/passkey/register/finish', {
+        name: passkeyName,
+        credential,
+      });
+      if (finish.data.success) {
+        showSuccess(t('通行密钥已添加'));
+        setPasskeyName('');
+        loadPasskeys().then();
+        loadStatus().then();
+      } else {
+        showError(finish.data.message);
+      }
+    } catch (error) {
+      showError(error.message || error);
+    }
+  };
+
+  const deletePasskey = async (id) => {
+    const res = await API.delete(`/api/user/passkey/${id}`);
+    if (res.data.success) {
+      showSuccess(t('通行密钥已删除'));
+      loadPasskeys().then();
+    } else if (!res.data.step_up_required) {
+      showError(res.data.message);
+    }
+  };
+
+  const columns = [
+    { title: t('名称'), dataIndex: 'name' },
+    {
+      title: t('添加时间'),
+      dataIndex: 'created_time',
+      render: (value) => timestamp2string(value),
+    },
+    {
+      title: t('最后使用'),
+      dataIndex: 'last_used_time',
+      render: (value) => (value ? timestamp2string(value) : t('从未使用')),
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record) => (
+        <Button
+          type='danger'
+          size='small'
+          onClick={() => deletePasskey(record.id)}
+        >
+          {t('删除')}
+        </Button>
+      ),
+    },
+  ];
+
+  return (
+    <Card style={{ marginTop: 10 }}>
+      <Typography.Title heading={6}>{t('两步验证')}</Typography.Title>
+      <Space style={{ marginTop: 10 }}>
+        {status.enabled ? (
+          <>
+            <Tag color='green'>{t('已启用')}</Tag>
+            <Typography.Text>
+              {t('剩余恢复码')}：{status.recovery_codes_remaining}
+            </Typography.Text>
+            <Button
+              onClick={() => {
+                setCode('');
+                setCodeAction('recovery_codes');
+              }}
+            >
+              {t('重新生成恢复码')}
+            </Button>
+            <Button
+              type='danger'
+              onClick={() => {
+                setCode('');
+                setCodeAction('disable');
+              }}
+            >
+              {t('关闭两步验证')}
+            </Button>
+          </>
+        ) : (
+          <>
+            <Tag>{t('未启用')}</Tag>
+            <Button onClick={startSetup}>{t('启用两步验证')}</Button>
+          </>
+        )}
+      </Space>
+
+      <Typography.Title heading={6} style={{ marginTop: 20 }}>
+        {t('通行密钥')}
+      </Typography.Title>
+      {isPasskeySupported() ? (
+        <Space style={{ marginTop: 10, marginBottom: 10 }}>
+          <Input
+            placeholder={t('通行密钥名称，例如：我的笔记本')}
+            value={passkeyName}
+            onChange={setPasskeyName}
+          />
+          <Button onClick={registerPasskey}>{t('添加通行密钥')}</Button>
+        </Space>
+      ) : (
+        <Typography.Text type='tertiary'>
+          {t('当前浏览器不支持通行密钥')}
+        </Typography.Text>
+      )}
+      <Table
+        columns={columns}
+        dataSource={passkeys}
+        rowKey='id'
+        pagination={false}
+        size='small'
+      />
+
+      <Modal
+        title={t('启用两步验证')}
+        visible={setup !== null}
+        onOk={enableTwoFA}
+        onCancel={() => setSetup(null)}
+        okText={t('启用')}
+        centered
+      >
+        <Typography.Paragraph>
+          {t(
+            '请在验证器应用（如 Google Authenticator、1Password）中添加以下密钥或链接，然后输入生成的 6 位验证码',
+          )}
+        </Typography.Paragraph>
+        {setup ? (
+          <>
+            <Typography.Paragraph copyable={{ content: setup.secret }}>
+              {t('密钥')}：<code>{setup.secret}</code>
+            </Typography.Paragraph>
+            <Button
+              size='small'
+              style={{ marginBottom: 10 }}
+              onClick={async () => {
+                if (await copy(setup.uri)) {
+                  showSuccess(t('已复制到剪贴板！'));
+                }
+              }}
+            >
+              {t('复制 otpauth 链接')}
+            </Button>
+          </>
+        ) : null}
+        <Input
+          placeholder={t('验证码')}
+          value={code}
+          onChange={setCode}
+        />
+      </Modal>
+
+      <Modal
+        title={
+          codeAction === 'disable' ? t('关闭两步验证') : t('重新生成恢复码')
+        }
+        visible={codeAction !== ''}
+        onOk={submitCodeAction}
+        onCancel={() => setCodeAction('')}
+        centered
+      >
+        <Input
+          placeholder={t('验证码或恢复码')}
+          value={code}
+          onChange={setCode}
+        />
+      </Modal>
+
+      <Modal
+        title={t('恢复码')}
+        visible={recoveryCodes.length > 0}
+        onOk={() => setRecoveryCodes([])}
+        onCancel={() => setRecoveryCodes([])}
+        hasCancel={false}
+        centered
+      >
+        <Typography.Paragraph>
+          {t(
+            '请妥善保存以下恢复码，每个恢复码只能使用一次，关闭窗口后将无法再次查看',
+          )}
+        </Typography.Paragraph>
+        <Typography.Paragraph copyable={{ content: recoveryCodes.join('\n') }}>
+          <code style={{ whiteSpace: 'pre-line' }}>
+            {recoveryCodes.join('\n')}
+          </code>
+        </Typography.Paragraph>
+      </Modal>
+    </Card>
+  );
+};
+
+export default SecuritySetting;
@@ -8,7 +8,8 @@ import {
   API,
   getLogo,
   getSystemName,
-  isAdmin,
+  hasAnyPermission,
+  hasPermission,
   isMobile,
   showError,
 } from '../helpers';
@@ -221,29 +222,38 @@ const SiderBar = () => {
         itemKey: 'channel',
         to: '/channel',
         icon: <IconLayers />,
-        className: isAdmin() ? '' : 'tableHiddle',
+        className: hasPermission('channels:read') ? '' : 'tableHiddle',
       },
       {
         text: t('兑换码'),
         itemKey: 'redemption',
         to: '/redemption',
         icon: <IconGift />,
-        className: isAdmin() ? '' : 'tableHiddle',
+        className: hasPermission('redemptions:read') ? '' : 'tableHiddle',
       },
       {
         text: t('用户管理'),
         itemKey: 'user',
         to: '/user',
         icon: <IconUser />,
+        className: hasPermission('users:read') ? '' : 'tableHiddle',
       },
       {
         text: t('系统设置'),
         itemKey: 'setting',
         to: '/setting',
         icon: <IconSetting />,
+        className:
+          hasPermission('options:read') ||
+          hasPermission('roles:manage') ||
+          hasPermission('audit:read') ||
+          hasPermission('refunds:manage') ||
+          hasPermission('data:read')
+            ? ''
+            : 'tableHiddle',
       },
     ],
-    [isAdmin(), t],
+    [localStorage.getItem('user'), t],
   );
 
   const chatMenuItems = useMemo(
@@ -482,7 +492,7 @@ const SiderBar = () => {
           />
         ))}
 
-        {isAdmin() && (
+        {hasAnyPermission() && (
           <>
             {/* Divider */}
             <Divider style={dividerStyle} />
@@ -0,0 +1,116 @@
+import React, { useEffect, useState } from 'react';
+import { Button, Form, Modal, Typography } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  API,
+  STEP_UP_REQUIRED_EVENT,
+  getPasskeyAssertion,
+  isPasskeySupported,
+  showError,
+  showSuccess,
+} from '../helpers';
+
+// StepUpModal 在敏感操作返回 step_up_required 时弹出，重新验证身份后由用户重试操作
+const StepUpModal = () => {
+  const { t } = useTranslation();
+  const [visible, setVisible] = useState(false);
+  const [loading, setLoading] = useState(false);
+  const [twoFAEnabled, setTwoFAEnabled] = useState(false);
+  const [hasPasskey, setHasPasskey] = useState(false);
+  const [code, setCode] = useState('');
+  const [password, setPassword] = useState('');
+
+  useEffect(() => {
+    const onRequired = async () => {
+      setCode('');
+      setPassword('');
+      setVisible(true);
+      const res = await API.get('/api/user/2fa');
+      if (res && res.data.success) {
+        setTwoFAEnabled(res.data.data.enabled);
+        setHasPasskey(res.data.data.has_passkey);
+      }
+    };
+    window.addEventListener(STEP_UP_REQUIRED_EVENT, onRequired);
+    return () => window.removeEventListener(STEP_UP_REQUIRED_EVENT, onRequired);
+  }, []);
+
+  const submit = async (payload) => {
+    setLoading(true);
+    try {
+      const res = await API.post('/api/user/step_up', payload);
+      const { success, message } = res.data;
+      if (success) {
+        showSuccess(t('验证成功，请重新执行刚才的操作'));
+        setVisible(false);
+      } else {
+        showError(message);
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const verifyWithPasskey = async () => {
+    try {
+      const res = await API.post('/api/user/passkey/login/begin');
+      if (!res.data.success) {
+        showError(res.data.message);
+        return;
+      }
+      const assertion = await getPasskeyAssertion(res.data.data);
+      await submit({ passkey: assertion });
+    } catch (error) {
+      showError(error.message || error);
+    }
+  };
+
+  const onOk = () => {
+    if (twoFAEnabled) {
+      submit({ code });
+    } else if (!hasPasskey) {
+      submit({ password });
+    }
+  };
+
+  return (
+    <Modal
+      title={t('验证身份')}
+      visible={visible}
+      onOk={onOk}
+      onCancel={() => setVisible(false)}
+      okButtonProps={{ disabled: !twoFAEnabled && hasPasskey }}
+      confirmLoading={loading}
+      centered
+    >
+      <Typography.Text>
+        {t('该操作需要重新验证身份，验证后请重新执行刚才的操作')}
+      </Typography.Text>
+      <Form style={{ marginTop: 10 }}>
+        {twoFAEnabled ? (
+          <Form.Input
+            field='step_up_code'
+            label={t('两步验证码或恢复码')}
+            value={code}
+            onChange={setCode}
+          />
+        ) : !hasPasskey ? (
+          <Form.Input
+            field='step_up_password'
+            label={t('密码')}
+            mode='password'
+            value={password}
+            onChange={setPassword}
+          />
+        ) : null}
+      </Form>
+      {hasPasskey && isPasskeySupported() ? (
+        <Button style={{ marginTop: 10 }} onClick={verifyWithPasskey}>
+          {t('使用通行密钥验证')}
+        </Button>
+      ) : null}
+    </Modal>
+  );
+};
+
+export default StepUpModal;
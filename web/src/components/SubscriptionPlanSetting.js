@@ -0,0 +1,252 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Button,
+  Card,
+  Input,
+  InputNumber,
+  Modal,
+  Popconfirm,
+  Space,
+  Switch,
+  Table,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import { API, showError, showSuccess } from '../helpers';
+import { renderQuota } from '../helpers/render';
+
+const emptyPlan = {
+  id: 0,
+  name: '',
+  description: '',
+  price: 0,
+  quota: 0,
+  group: '',
+  models: '',
+  rollover_percent: 0,
+  status: 1,
+};
+
+// SubscriptionPlanSetting 订阅套餐管理，用户在钱包页面通过在线支付订阅
+const SubscriptionPlanSetting = () => {
+  const { t } = useTranslation();
+  const [plans, setPlans] = useState([]);
+  const [loading, setLoading] = useState(false);
+  const [editingPlan, setEditingPlan] = useState(null);
+
+  const loadPlans = async () => {
+    setLoading(true);
+    const res = await API.get('/api/subscription_plan/');
+    const { success, message, data } = res.data;
+    if (success) {
+      setPlans(data || []);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  useEffect(() => {
+    loadPlans().then();
+  }, []);
+
+  const savePlan = async () => {
+    const payload = {
+      ...editingPlan,
+      price: parseFloat(editingPlan.price) || 0,
+      quota: parseInt(editingPlan.quota) || 0,
+      rollover_percent: parseInt(editingPlan.rollover_percent) || 0,
+    };
+    const res = editingPlan.id
+      ? await API.put('/api/subscription_plan/', payload)
+      : await API.post('/api/subscription_plan/', payload);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('保存成功'));
+      setEditingPlan(null);
+      await loadPlans();
+    } else if (!res.data.step_up_required) {
+      showError(message);
+    }
+  };
+
+  const deletePlan = async (id) => {
+    const res = await API.delete(`/api/subscription_plan/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('删除成功'));
+      await loadPlans();
+    } else if (!res.data.step_up_required) {
+      showError(message);
+    }
+  };
+
+  const columns = [
+    {
+      title: t('名称'),
+      dataIndex: 'name',
+    },
+    {
+      title: t('每月价格（美金）'),
+      dataIndex: 'price',
+    },
+    {
+      title: t('每月额度'),
+      dataIndex: 'quota',
+      render: (text) => renderQuota(text),
+    },
+    {
+      title: t('分组'),
+      dataIndex: 'group',
+      render: (text) => text || '-',
+    },
+    {
+      title: t('可用模型'),
+      dataIndex: 'models',
+      render: (text) => text || t('不限制'),
+    },
+    {
+      title: t('结转比例'),
+      dataIndex: 'rollover_percent',
+      render: (text) => `${text}%`,
+    },
+    {
+      title: t('状态'),
+      dataIndex: 'status',
+      render: (text) =>
+        text === 1 ? (
+          <Tag color='green'>{t('可订阅')}</Tag>
+        ) : (
+          <Tag color='grey'>{t('已停售')}</Tag>
+        ),
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record) => (
+        <Space>
+          <Button
+            theme='light'
+            type='tertiary'
+            onClick={() => setEditingPlan({ ...record })}
+          >
+            {t('编辑')}
+          </Button>
+          <Popconfirm
+            title={t('确定要删除该套餐吗？仍有用户订阅的套餐只能停售')}
+            okType={'danger'}
+            onConfirm={() => deletePlan(record.id)}
+          >
+            <Button theme='light' type='danger'>
+              {t('删除')}
+            </Button>
+          </Popconfirm>
+        </Space>
+      ),
+    },
+  ];
+
+  return (
+    <Card style={{ marginTop: '10px' }}>
+      <Space vertical align='start' style={{ width: '100%' }}>
+        <Typography.Text type='tertiary'>
+          {t(
+            '订阅后每月发放一次额度，周期结束时未使用的额度按结转比例保留到下个周期，其余作废；订阅到期后恢复用户原来的分组',
+          )}
+        </Typography.Text>
+        <Button type='primary' onClick={() => setEditingPlan({ ...emptyPlan })}>
+          {t('新建套餐')}
+        </Button>
+        <Table
+          style={{ width: '100%' }}
+          columns={columns}
+          dataSource={plans}
+          rowKey='id'
+          loading={loading}
+          pagination={false}
+        />
+      </Space>
+      <Modal
+        title={editingPlan && editingPlan.id ? t('编辑套餐') : t('新建套餐')}
+        visible={editingPlan !== null}
+        onOk={savePlan}
+        onCancel={() => setEditingPlan(null)}
+      >
+        {editingPlan && (
+          <Space vertical align='start' style={{ width: '100%' }}>
+            <Typography.Text>{t('名称')}</Typography.Text>
+            <Input
+              value={editingPlan.name}
+              onChange={(value) => setEditingPlan({ ...editingPlan, name: value })}
+            />
+            <Typography.Text>{t('描述')}</Typography.Text>
+            <Input
+              value={editingPlan.description}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, description: value })
+              }
+            />
+            <Typography.Text>
+              {t('每月价格（美金），实付金额按支付渠道的充值价格换算')}
+            </Typography.Text>
+            <InputNumber
+              min={0}
+              precision={2}
+              value={editingPlan.price}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, price: value })
+              }
+            />
+            <Typography.Text>
+              {t('每月额度') + ' ' + renderQuota(editingPlan.quota || 0)}
+            </Typography.Text>
+            <InputNumber
+              min={0}
+              value={editingPlan.quota}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, quota: value })
+              }
+            />
+            <Typography.Text>{t('订阅期间的分组，留空不修改')}</Typography.Text>
+            <Input
+              value={editingPlan.group}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, group: value })
+              }
+            />
+            <Typography.Text>
+              {t('可用模型，逗号分隔，以 * 结尾表示前缀匹配，留空不限制')}
+            </Typography.Text>
+            <Input
+              value={editingPlan.models}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, models: value })
+              }
+            />
+            <Typography.Text>{t('结转比例 (%)')}</Typography.Text>
+            <InputNumber
+              min={0}
+              max={100}
+              value={editingPlan.rollover_percent}
+              onChange={(value) =>
+                setEditingPlan({ ...editingPlan, rollover_percent: value })
+              }
+            />
+            <Space>
+              <Switch
+                checked={editingPlan.status === 1}
+                onChange={(checked) =>
+                  setEditingPlan({ ...editingPlan, status: checked ? 1 : 2 })
+                }
+              />
+              <Typography.Text>{t('可订阅')}</Typography.Text>
+            </Space>
+          </Space>
+        )}
+      </Modal>
+    </Card>
+  );
+};
+
+export default SubscriptionPlanSetting;
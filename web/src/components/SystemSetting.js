@@ -44,9 +44,28 @@ const SystemSetting = () => {
     ServerAddress: '',
     WorkerUrl: '',
     WorkerValidKey: '',
+    'fetch_setting.allow_private_ip': false,
+    'fetch_setting.allowed_hosts': '',
+    'fetch_setting.denied_hosts': '',
+    'fetch_setting.allowed_file_types': '',
+    'fetch_setting.max_redirects': '',
+    'fetch_setting.cache_seconds': '',
+    'security.admin_require_mfa': false,
+    'security.passkey_login_enabled': false,
+    'security.step_up_enabled': false,
+    'security.step_up_max_age': '',
+    'security.webauthn_rp_id': '',
+    'security.webauthn_origins': '',
     EpayId: '',
     EpayKey: '',
     Price: 7.3,
+    EpayCurrency: 'CNY',
+    'stripe.enabled': false,
+    'stripe.secret_key': '',
+    'stripe.webhook_secret': '',
+    'stripe.api_base': '',
+    'stripe.currency': '',
+    'stripe.unit_price': '',
     MinTopUp: 1,
     TopupGroupRatio: '',
     PayAddress: '',
@@ -92,6 +111,10 @@ const SystemSetting = () => {
       data.forEach((item) => {
         switch (item.key) {
           case 'TopupGroupRatio':
+          case 'fetch_setting.allowed_hosts':
+          case 'fetch_setting.denied_hosts':
+          case 'fetch_setting.allowed_file_types':
+          case 'security.webauthn_origins':
             item.value = JSON.stringify(JSON.parse(item.value), null, 2);
             break;
           case 'EmailDomainWhitelist':
@@ -110,10 +133,16 @@ const SystemSetting = () => {
           case 'SMTPSSLEnabled':
           case 'LinuxDOOAuthEnabled':
           case 'oidc.enabled':
+          case 'stripe.enabled':
+          case 'fetch_setting.allow_private_ip':
+          case 'security.admin_require_mfa':
+          case 'security.passkey_login_enabled':
+          case 'security.step_up_enabled':
             item.value = item.value === 'true';
             break;
           case 'Price':
           case 'MinTopUp':
+          case 'stripe.unit_price':
             item.value = parseFloat(item.value);
             break;
           default:
@@ -209,6 +238,59 @@ const SystemSetting = () => {
     ]);
   };
 
+  const submitSecuritySetting = async () => {
+    if (!verifyJSON(inputs['security.webauthn_origins'])) {
+      showError('通行密钥允许来源必须是合法的 JSON 数组');
+      return;
+    }
+    const options = [
+      'security.admin_require_mfa',
+      'security.passkey_login_enabled',
+      'security.step_up_enabled',
+      'security.webauthn_rp_id',
+      'security.webauthn_origins',
+    ].map((key) => ({ key, value: inputs[key] }));
+    options.push({
+      key: 'security.step_up_max_age',
+      value: String(inputs['security.step_up_max_age']),
+    });
+    await updateOptions(
+      options.filter((opt) => originInputs[opt.key] !== inputs[opt.key]),
+    );
+  };
+
+  const submitFetchSetting = async () => {
+    const jsonKeys = [
+      'fetch_setting.allowed_hosts',
+      'fetch_setting.denied_hosts',
+      'fetch_setting.allowed_file_types',
+    ];
+    for (const key of jsonKeys) {
+      if (!verifyJSON(inputs[key])) {
+        showError('域名和文件类型列表必须是合法的 JSON 数组');
+        return;
+      }
+    }
+    const options = [
+      {
+        key: 'fetch_setting.allow_private_ip',
+        value: inputs['fetch_setting.allow_private_ip'],
+      },
+      ...jsonKeys.map((key) => ({ key, value: inputs[key] })),
+      {
+        key: 'fetch_setting.max_redirects',
+        value: String(inputs['fetch_setting.max_redirects']),
+      },
+      {
+        key: 'fetch_setting.cache_seconds',
+        value: String(inputs['fetch_setting.cache_seconds']),
+      },
+    ];
+    await updateOptions(
+      options.filter((opt) => originInputs[opt.key] !== inputs[opt.key]),
+    );
+  };
+
   const submitPayAddress = async () => {
     if (inputs.ServerAddress === '') {
       showError('请先填写服务器地址');
@@ -234,6 +316,9 @@ const SystemSetting = () => {
     if (inputs.Price !== '') {
       options.push({ key: 'Price', value: inputs.Price.toString() });
     }
+    if (inputs.EpayCurrency !== '') {
+      options.push({ key: 'EpayCurrency', value: inputs.EpayCurrency });
+    }
     if (inputs.MinTopUp !== '') {
       options.push({ key: 'MinTopUp', value: inputs.MinTopUp.toString() });
     }
@@ -250,6 +335,30 @@ const SystemSetting = () => {
     await updateOptions(options);
   };
 
+  const submitStripe = async () => {
+    const options = [];
+    ['stripe.api_base', 'stripe.currency'].forEach((key) => {
+      if (originInputs[key] !== inputs[key]) {
+        options.push({ key, value: removeTrailingSlash(inputs[key]) });
+      }
+    });
+    if (originInputs['stripe.unit_price'] !== inputs['stripe.unit_price']) {
+      options.push({
+        key: 'stripe.unit_price',
+        value: String(inputs['stripe.unit_price']),
+      });
+    }
+    // 密钥不会发送到前端，留空表示不修改
+    ['stripe.secret_key', 'stripe.webhook_secret'].forEach((key) => {
+      if (inputs[key] !== undefined && inputs[key] !== '') {
+        options.push({ key, value: inputs[key] });
+      }
+    });
+    if (options.length > 0) {
+      await updateOptions(options);
+    }
+  };
+
   const submitSMTP = async () => {
     const options = [];
 
@@ -576,11 +685,129 @@ const SystemSetting = () => {
                   <Button onClick={submitWorker}>更新Worker设置</Button>
                 </Form.Section>
               </Card>
+              <Card>
+                <Form.Section text='下载安全设置'>
+                  <Text>
+                    用户在请求中提供的图片、文件 URL 以及绘图图片代理都会经过以下限制，域名解析后的内网、回环、链路本地地址默认禁止访问
+                  </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Checkbox
+                        field='fetch_setting.allow_private_ip'
+                        noLabel
+                      >
+                        允许访问内网地址（仅在可信环境中开启）
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='fetch_setting.max_redirects'
+                        label='最大重定向次数'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='fetch_setting.cache_seconds'
+                        label='下载缓存时间（秒）'
+                        placeholder='0 表示不缓存'
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.TextArea
+                        field='fetch_setting.allowed_hosts'
+                        label='域名白名单'
+                        placeholder='["example.com", "*.example.com"]，留空数组表示不限制'
+                        autosize
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.TextArea
+                        field='fetch_setting.denied_hosts'
+                        label='域名黑名单'
+                        placeholder='["internal.example.com", "203.0.113.0/24"]'
+                        autosize
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.TextArea
+                        field='fetch_setting.allowed_file_types'
+                        label='允许的文件类型'
+                        placeholder='["application/pdf", "text/"]，留空数组表示不限制'
+                        autosize
+                      />
+                    </Col>
+                  </Row>
+                  <Button onClick={submitFetchSetting}>更新下载安全设置</Button>
+                </Form.Section>
+              </Card>
+              <Card>
+                <Form.Section text='账户安全设置'>
+                  <Text>
+                    用户可以在个人设置中启用 TOTP 两步验证和通行密钥；开启敏感操作验证后，查看渠道密钥、修改系统设置、生成访问令牌前需要重新验证身份
+                  </Text>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Checkbox field='security.admin_require_mfa' noLabel>
+                        管理员必须使用两步验证或通行密钥登录
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Checkbox
+                        field='security.passkey_login_enabled'
+                        noLabel
+                      >
+                        允许通过通行密钥登录
+                      </Form.Checkbox>
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Checkbox field='security.step_up_enabled' noLabel>
+                        敏感操作前重新验证身份
+                      </Form.Checkbox>
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='security.step_up_max_age'
+                        label='身份验证有效期（秒）'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='security.webauthn_rp_id'
+                        label='通行密钥域名（RP ID）'
+                        placeholder='留空使用服务器地址的域名'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.TextArea
+                        field='security.webauthn_origins'
+                        label='通行密钥允许来源'
+                        placeholder='["https://example.com"]，留空数组使用服务器地址'
+                        autosize
+                      />
+                    </Col>
+                  </Row>
+                  <Button onClick={submitSecuritySetting}>
+                    更新账户安全设置
+                  </Button>
+                </Form.Section>
+              </Card>
 
               <Card>
                 <Form.Section text='支付设置'>
                   <Text>
-                    （当前仅支持易支付接口，默认使用上方服务器地址作为回调地址！）
+                    （易支付接口，默认使用上方服务器地址作为回调地址！）
                   </Text>
                   <Row
                     gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
@@ -627,6 +854,13 @@ const SystemSetting = () => {
                         placeholder='例如：7，就是7元/美金'
                       />
                     </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field='EpayCurrency'
+                        label='易支付币种'
+                        placeholder='例如：CNY'
+                      />
+                    </Col>
                     <Col xs={24} sm={24} md={8} lg={8} xl={8}>
                       <Form.InputNumber
                         field='MinTopUp'
@@ -645,6 +879,72 @@ const SystemSetting = () => {
                 </Form.Section>
               </Card>
 
+              <Card>
+                <Form.Section text='Stripe 支付设置'>
+                  <Text>
+                    在 Stripe 控制台添加 Webhook，地址为 {inputs.ServerAddress}
+                    /api/user/stripe/webhook，并订阅
+                    checkout.session.completed、checkout.session.async_payment_succeeded
+                    和 charge.refunded 事件；退款后会按比例扣回充值的额度
+                  </Text>
+                  <Form.Checkbox
+                    field="['stripe.enabled']"
+                    noLabel
+                    onChange={(e) => handleCheckboxChange('stripe.enabled', e)}
+                  >
+                    启用 Stripe 支付
+                  </Form.Checkbox>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['stripe.secret_key']"
+                        label='Secret Key'
+                        placeholder='敏感信息不会发送到前端显示'
+                        type='password'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['stripe.webhook_secret']"
+                        label='Webhook 签名密钥'
+                        placeholder='敏感信息不会发送到前端显示'
+                        type='password'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['stripe.api_base']"
+                        label='API 地址'
+                        placeholder='默认 https://api.stripe.com，可填写兼容的模拟服务'
+                      />
+                    </Col>
+                  </Row>
+                  <Row
+                    gutter={{ xs: 8, sm: 16, md: 24, lg: 24, xl: 24, xxl: 24 }}
+                    style={{ marginTop: 16 }}
+                  >
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.Input
+                        field="['stripe.currency']"
+                        label='币种'
+                        placeholder='例如：usd'
+                      />
+                    </Col>
+                    <Col xs={24} sm={24} md={8} lg={8} xl={8}>
+                      <Form.InputNumber
+                        field="['stripe.unit_price']"
+                        precision={2}
+                        label='充值价格（每美金额度）'
+                        placeholder='例如：1，就是1 usd/美金'
+                      />
+                    </Col>
+                  </Row>
+                  <Button onClick={submitStripe}>更新 Stripe 设置</Button>
+                </Form.Section>
+              </Card>
+
               <Card>
                 <Form.Section text='配置登录注册'>
                   <Row
@@ -3,7 +3,7 @@ import { Label } from 'semantic-ui-react';
 import {
   API,
   copy,
-  isAdmin,
+  hasPermission,
   showError,
   showSuccess,
   timestamp2string,
@@ -81,7 +81,7 @@ function renderDuration(submit_time, finishTime) {
 const LogsTable = () => {
   const [isModalOpen, setIsModalOpen] = useState(false);
   const [modalContent, setModalContent] = useState('');
-  const isAdminUser = isAdmin();
+  const isAdminUser = hasPermission('logs:read');
   const columns = [
     {
       title: '提交时间',
@@ -1,11 +1,13 @@
 import React, { useEffect, useState } from 'react';
-import { API, showError, showSuccess } from '../helpers';
+import { API, hasPermission, showError, showSuccess } from '../helpers';
 import {
   Button,
   Form,
+  Modal,
   Popconfirm,
   Space,
   Table,
+  Select,
   Tag,
   Tooltip,
 } from '@douyinfe/semi-ui';
@@ -122,7 +124,21 @@ const UsersTable = () => {
       title: t('角色'),
       dataIndex: 'role',
       render: (text, record, index) => {
-        return <div>{renderRole(text)}</div>;
+        const customRole = roles.find(
+          (role) => role.id === record.custom_role_id,
+        );
+        return (
+          <div>
+            <Space spacing={1}>
+              {renderRole(text)}
+              {customRole && (
+                <Tag color='cyan' size='large'>
+                  {customRole.name}
+                </Tag>
+              )}
+            </Space>
+          </div>
+        );
       },
     },
     {
@@ -199,6 +215,30 @@ const UsersTable = () => {
                   {t('启用')}
                 </Button>
               )}
+              <Popconfirm
+                title={t('确定要重置该用户的两步验证和通行密钥吗？')}
+                okType={'warning'}
+                onConfirm={() => {
+                  manageUser(record.id, 'reset_2fa', record);
+                }}
+              >
+                <Button theme='light' type='warning' style={{ marginRight: 1 }}>
+                  {t('重置两步验证')}
+                </Button>
+              </Popconfirm>
+              {hasPermission('roles:manage') && (
+                <Button
+                  theme='light'
+                  type='tertiary'
+                  style={{ marginRight: 1 }}
+                  onClick={() => {
+                    setAssigningUser(record);
+                    setAssignRoleId(record.custom_role_id || 0);
+                  }}
+                >
+                  {t('分配角色')}
+                </Button>
+              )}
               <Button
                 theme='light'
                 type='tertiary'
@@ -246,6 +286,9 @@ const UsersTable = () => {
   const [editingUser, setEditingUser] = useState({
     id: undefined,
   });
+  const [roles, setRoles] = useState([]);
+  const [assigningUser, setAssigningUser] = useState(null);
+  const [assignRoleId, setAssignRoleId] = useState(0);
 
   const removeRecord = (key) => {
     let newDataSource = [...users];
@@ -288,8 +331,37 @@ const UsersTable = () => {
         showError(reason);
       });
     fetchGroups().then();
+    if (hasPermission('roles:manage')) {
+      loadRoles().then();
+    }
   }, []);
 
+  const loadRoles = async () => {
+    const res = await API.get('/api/role/');
+    const { success, message, data } = res.data;
+    if (success) {
+      setRoles(data);
+    } else {
+      showError(message);
+    }
+  };
+
+  const assignRole = async () => {
+    const res = await API.post('/api/role/assign', {
+      user_id: assigningUser.id,
+      role_id: assignRoleId,
+    });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(t('操作成功完成！'));
+      assigningUser.custom_role_id = assignRoleId;
+      setUsers([...users]);
+      setAssigningUser(null);
+    } else {
+      showError(message);
+    }
+  };
+
   const manageUser = async (userId, action, record) => {
     const res = await API.post('/api/user/manage', {
       id: userId,
@@ -427,6 +499,22 @@ const UsersTable = () => {
         visible={showAddUser}
         handleClose={closeAddUser}
       ></AddUser>
+      <Modal
+        title={t('分配角色')}
+        visible={assigningUser !== null}
+        onOk={assignRole}
+        onCancel={() => setAssigningUser(null)}
+      >
+        <Select
+          style={{ width: '100%' }}
+          value={assignRoleId}
+          onChange={(value) => setAssignRoleId(value)}
+          optionList={[
+            { label: t('无'), value: 0 },
+            ...roles.map((role) => ({ label: role.name, value: role.id })),
+          ]}
+        />
+      </Modal>
       <EditUser
         refresh={refresh}
         visible={showEditUser}
@@ -1,6 +1,16 @@
 import { getUserIdFromLocalStorage, showError } from './utils';
 import axios from 'axios';
 
+export const STEP_UP_REQUIRED_EVENT = 'step-up-required';
+
+// 敏感操作需要重新验证身份时通知 StepUpModal 弹出验证窗口
+function onStepUpRequired(response) {
+  if (response && response.data && response.data.step_up_required) {
+    window.dispatchEvent(new CustomEvent(STEP_UP_REQUIRED_EVENT));
+  }
+  return response;
+}
+
 export let API = axios.create({
   baseURL: import.meta.env.VITE_REACT_APP_SERVER_URL
     ? import.meta.env.VITE_REACT_APP_SERVER_URL
@@ -21,10 +31,11 @@ export function updateAPI() {
       'Cache-Control': 'no-store',
     },
   });
+  API.interceptors.response.use(onStepUpRequired);
 }
 
 API.interceptors.response.use(
-  (response) => response,
+  (response) => onStepUpRequired(response),
   (error) => {
     showError(error);
   },
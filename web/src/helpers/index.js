@@ -2,3 +2,4 @@ export * from './history';
 export * from './auth-header';
 export * from './utils';
 export * from './api';
+export * from './webauthn';
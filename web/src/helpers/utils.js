@@ -21,6 +21,35 @@ export function isRoot() {
   return user.role >= 100;
 }
 
+// hasPermission 判断当前用户是否拥有管理接口的细粒度权限，
+// 旧版本登录时没有保存权限列表，按内置管理员角色判断
+export function hasPermission(permission) {
+  let user = localStorage.getItem('user');
+  if (!user) return false;
+  user = JSON.parse(user);
+  if (user.role >= 100) return true;
+  if (!Array.isArray(user.permissions)) {
+    return (
+      user.role >= 10 &&
+      !permission.startsWith('options:') &&
+      permission !== 'roles:manage' &&
+      permission !== 'audit:read'
+    );
+  }
+  return user.permissions.includes(permission);
+}
+
+// hasAnyPermission 当前用户是否可以访问管理员菜单
+export function hasAnyPermission() {
+  let user = localStorage.getItem('user');
+  if (!user) return false;
+  user = JSON.parse(user);
+  return (
+    user.role >= 10 ||
+    (Array.isArray(user.permissions) && user.permissions.length > 0)
+  );
+}
+
 export function getSystemName() {
   let system_name = localStorage.getItem('system_name');
   if (!system_name) return 'Veloera';
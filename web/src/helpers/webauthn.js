@@ -0,0 +1,78 @@
+// 通行密钥相关的二进制字段在前后端之间统一使用 Base64URL 编码传输
+
+export function base64UrlToBuffer(value) {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4);
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+export function bufferToBase64Url(buffer) {
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+export function isPasskeySupported() {
+  return (
+    typeof window !== 'undefined' &&
+    window.PublicKeyCredential !== undefined &&
+    navigator.credentials !== undefined
+  );
+}
+
+// createPasskey 调用浏览器注册通行密钥，返回提交给后端的凭据
+export async function createPasskey(options) {
+  const credential = await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: base64UrlToBuffer(options.challenge),
+      user: { ...options.user, id: base64UrlToBuffer(options.user.id) },
+      excludeCredentials: (options.excludeCredentials || []).map((item) => ({
+        ...item,
+        id: base64UrlToBuffer(item.id),
+      })),
+    },
+  });
+  const response = credential.response;
+  if (typeof response.getPublicKey !== 'function') {
+    throw new Error('当前浏览器不支持导出通行密钥公钥，请升级浏览器后重试');
+  }
+  return {
+    id: bufferToBase64Url(credential.rawId),
+    client_data_json: bufferToBase64Url(response.clientDataJSON),
+    authenticator_data: bufferToBase64Url(response.getAuthenticatorData()),
+    public_key: bufferToBase64Url(response.getPublicKey()),
+  };
+}
+
+// getPasskeyAssertion 调用浏览器使用通行密钥签名，返回提交给后端的断言
+export async function getPasskeyAssertion(options) {
+  const credential = await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: base64UrlToBuffer(options.challenge),
+      allowCredentials: (options.allowCredentials || []).map((item) => ({
+        ...item,
+        id: base64UrlToBuffer(item.id),
+      })),
+    },
+  });
+  const response = credential.response;
+  return {
+    id: bufferToBase64Url(credential.rawId),
+    client_data_json: bufferToBase64Url(response.clientDataJSON),
+    authenticator_data: bufferToBase64Url(response.authenticatorData),
+    signature: bufferToBase64Url(response.signature),
+    user_handle: response.userHandle
+      ? bufferToBase64Url(response.userHandle)
+      : '',
+  };
+}
@@ -257,6 +257,8 @@ const EditChannel = (props) => {
   const channelId = props.editingChannel.id;
   const isEdit = channelId !== undefined;
   const [loading, setLoading] = useState(isEdit);
+  const [keyHidden, setKeyHidden] = useState(false);
+  const [keyPreview, setKeyPreview] = useState('');
   const [showKey, setShowKey] = useState(false);
   const [initialKey, setInitialKey] = useState('');
   const [keyList, setKeyList] = useState([]);
@@ -483,6 +485,40 @@ const EditChannel = (props) => {
     }
   };
 
+  // 处理密钥
+  const applyChannelKey = (key, type) => {
+    if (key && supportsMultiKeyView(type)) {
+      const keys = key.split(',').map(k => k.trim()).filter(k => k.length > 0);
+      if (keys.length > 1) {
+        setUseKeyListMode(true);
+        setShowKey(true); // Ensure showKey is true for list mode
+        setKeyList(keys);
+      } else {
+        setUseKeyListMode(false);
+        setKeyList([]); // Clear keyList if not in list mode
+      }
+    } else {
+      setUseKeyListMode(false);
+      setKeyList([]);
+    }
+    setInitialKey(key); // Store initial key for single input mode placeholder
+  };
+
+  const revealChannelKey = async () => {
+    const res = await API.get(`/api/channel/${channelId}/key`);
+    if (res === undefined) {
+      return;
+    }
+    const { success, message, data } = res.data;
+    if (success) {
+      applyChannelKey(data.key, inputs.type);
+      setInputs((inputs) => ({ ...inputs, key: data.key }));
+      setKeyHidden(false);
+    } else if (!res.data.step_up_required) {
+      showError(message);
+    }
+  };
+
   const loadChannel = async () => {
     setLoading(true);
     let res = await API.get(`/api/channel/${channelId}`);
@@ -539,23 +575,10 @@ const EditChannel = (props) => {
       }
 
 
-      // 处理密钥
-      if (data.key && supportsMultiKeyView(data.type)) {
-         const keys = data.key.split(',').map(k => k.trim()).filter(k => k.length > 0);
-         if (keys.length > 1) {
-           setUseKeyListMode(true);
-           setShowKey(true); // Ensure showKey is true for list mode
-           setKeyList(keys);
-         } else {
-           setUseKeyListMode(false);
-           setKeyList([]); // Clear keyList if not in list mode
-         }
-      } else {
-        setUseKeyListMode(false);
-        setKeyList([]);
-      }
-       setInitialKey(data.key); // Store initial key for single input mode placeholder
-
+      applyChannelKey(data.key, data.type);
+      // 开启敏感操作验证时接口不返回密钥，留空保存会保留原密钥
+      setKeyHidden(!!res.data.key_hidden);
+      setKeyPreview(res.data.key_preview || '');
 
       setInputs(data);
       if (data.auto_ban === 0) {
@@ -1309,6 +1332,17 @@ const EditChannel = (props) => {
           <div style={{ marginTop: 10 }}>
             <Typography.Text strong>{t('密钥')}：</Typography.Text>
           </div>
+          {keyHidden && (
+            <Space style={{ marginBottom: 5 }}>
+              <Typography.Text type='tertiary'>
+                {t('密钥已隐藏，留空保存将保留原密钥')}
+                {keyPreview && `（${keyPreview}）`}
+              </Typography.Text>
+              <Button size='small' onClick={revealChannelKey}>
+                {t('查看密钥')}
+              </Button>
+            </Space>
+          )}
           {renderKeyInput()}
           {inputs.type === 22 && (
             <>
@@ -15,7 +15,7 @@ import {
 import { VChart } from '@visactor/react-vchart';
 import {
   API,
-  isAdmin,
+  hasPermission,
   showError,
   timestamp2string,
   timestamp2string1,
@@ -55,7 +55,7 @@ const Detail = (props) => {
   });
   const { username, model_name, start_timestamp, end_timestamp, channel } =
     inputs;
-  const isAdminUser = isAdmin();
+  const isAdminUser = hasPermission('data:read');
   const initialized = useRef(false);
   const [loading, setLoading] = useState(false);
   const [quotaData, setQuotaData] = useState([]);
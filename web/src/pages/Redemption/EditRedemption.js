@@ -19,6 +19,7 @@ import {
   DatePicker,
   Input,
   Modal,
+  Select,
   SideSheet,
   Space,
   Spin,
@@ -42,7 +43,15 @@ const EditRedemption = (props) => {
     is_gift: false,
     max_uses: -1,  // -1 means unlimited
     valid_from: 0,  // 0 means immediately effective
-    valid_until: 0  // 0 means never expires
+    valid_until: 0,  // 0 means never expires
+    type: 0, // 0 额度，1 充值优惠券，2 分组升级，3 模型额度
+    campaign: '',
+    user_groups: '',
+    new_user_days: 0,
+    bonus_percent: 0,
+    upgrade_group: '',
+    upgrade_days: 0,
+    models: '',
   };
   const [inputs, setInputs] = useState(originInputs);
   const [redemptionKey, setRedemptionKey] = useState(''); // New state for optional key
@@ -81,7 +90,7 @@ const EditRedemption = (props) => {
   const submit = async () => {
     let name = inputs.name;
     if (!isEdit && inputs.name === '') {
-      name = renderQuota(quota);
+      name = inputs.campaign || renderQuota(quota);
     }
     
     // 验证时间范围
@@ -96,6 +105,9 @@ const EditRedemption = (props) => {
     localInputs.max_uses = parseInt(localInputs.max_uses);
     localInputs.valid_from = parseInt(localInputs.valid_from);
     localInputs.valid_until = parseInt(localInputs.valid_until);
+    localInputs.new_user_days = parseInt(localInputs.new_user_days) || 0;
+    localInputs.bonus_percent = parseInt(localInputs.bonus_percent) || 0;
+    localInputs.upgrade_days = parseInt(localInputs.upgrade_days) || 0;
     localInputs.name = name;
     let res;
     if (isEdit) {
@@ -191,6 +203,57 @@ const EditRedemption = (props) => {
             required={!isEdit}
           />
           <Divider />
+          <Typography.Text>{t('优惠类型')}</Typography.Text>
+          <Select
+            style={{ marginTop: 8, width: '100%' }}
+            value={inputs.type}
+            disabled={isEdit}
+            onChange={(value) => handleInputChange('type', value)}
+            optionList={[
+              { value: 0, label: t('额度') },
+              { value: 1, label: t('充值优惠券') },
+              { value: 2, label: t('分组升级') },
+              { value: 3, label: t('模型额度') },
+            ]}
+          />
+          {inputs.type === 1 && (
+            <Input
+              style={{ marginTop: 8 }}
+              label={t('赠送比例 (%)')}
+              placeholder={t('在线充值时按充值额度的比例赠送')}
+              onChange={(value) => handleInputChange('bonus_percent', value)}
+              value={inputs.bonus_percent}
+              type='number'
+            />
+          )}
+          {inputs.type === 2 && (
+            <>
+              <Input
+                style={{ marginTop: 8 }}
+                label={t('升级到的分组')}
+                onChange={(value) => handleInputChange('upgrade_group', value)}
+                value={inputs.upgrade_group}
+              />
+              <Input
+                style={{ marginTop: 8 }}
+                label={t('升级天数')}
+                onChange={(value) => handleInputChange('upgrade_days', value)}
+                value={inputs.upgrade_days}
+                type='number'
+              />
+            </>
+          )}
+          {inputs.type === 3 && (
+            <Input
+              style={{ marginTop: 8 }}
+              label={t('可用模型')}
+              placeholder={t('逗号分隔，以 * 结尾表示前缀匹配')}
+              onChange={(value) => handleInputChange('models', value)}
+              value={inputs.models}
+            />
+          )}
+          {(inputs.type === 0 || inputs.type === 3) && (
+            <>
           <div style={{ marginTop: 20 }}>
             <Typography.Text>
               {t('额度') + renderQuotaWithPrompt(quota)}
@@ -213,6 +276,32 @@ const EditRedemption = (props) => {
               { value: 250000000, label: '500$' },
               { value: 500000000, label: '1000$' },
             ]}
+          />
+            </>
+          )}
+          <Divider />
+          <Typography.Text>{t('活动限制')}</Typography.Text>
+          <Input
+            style={{ marginTop: 8 }}
+            label={t('活动名称')}
+            placeholder={t('同一活动每个用户只能参与一次，留空不限制')}
+            onChange={(value) => handleInputChange('campaign', value)}
+            value={inputs.campaign}
+          />
+          <Input
+            style={{ marginTop: 8 }}
+            label={t('限制用户分组')}
+            placeholder={t('逗号分隔，留空不限制')}
+            onChange={(value) => handleInputChange('user_groups', value)}
+            value={inputs.user_groups}
+          />
+          <Input
+            style={{ marginTop: 8 }}
+            label={t('仅限注册天数内')}
+            placeholder={t('0 表示不限制')}
+            onChange={(value) => handleInputChange('new_user_days', value)}
+            value={inputs.new_user_days}
+            type='number'
           />
           {!isEdit && (
             <>
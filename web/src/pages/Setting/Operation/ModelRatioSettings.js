@@ -25,6 +25,7 @@ export default function ModelRatioSettings(props) {
     ModelRatio: '',
     CacheRatio: '',
     CompletionRatio: '',
+    PricingRules: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -206,6 +207,32 @@ export default function ModelRatioSettings(props) {
               />
             </Col>
           </Row>
+          <Row gutter={16}>
+            <Col xs={24} sm={16}>
+              <Form.TextArea
+                label={t('模型计费规则')}
+                extraText={t(
+                  '支持按提示词长度分档、推理/音频/图片 token 单独倍率、每次请求固定费用（美元）以及分时段折扣',
+                )}
+                placeholder={t(
+                  '为一个 JSON 文本，键为模型名称，值为计费规则，比如 {"gemini-2.5-pro": {"tiers": [{"min_prompt_tokens": 0, "model_ratio": 0.625}, {"min_prompt_tokens": 200000, "model_ratio": 1.25}], "reasoning_ratio": 8, "time_discounts": [{"start": "00:30", "end": "08:30", "discount": 0.5}]}}',
+                )}
+                field={'PricingRules'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => verifyJSON(value),
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({ ...inputs, PricingRules: value })
+                }
+              />
+            </Col>
+          </Row>
         </Form.Section>
       </Form>
       <Space>
@@ -0,0 +1,148 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Banner, Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  compareObjects,
+  API,
+  hasPermission,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { renderQuota } from '../../../helpers/render';
+
+const expireDayFields = [
+  ['credit.topup_expire_days', '在线充值'],
+  ['credit.promotion_expire_days', '充值赠送'],
+  ['credit.redemption_expire_days', '兑换码'],
+  ['credit.gift_expire_days', '礼品码'],
+  ['credit.checkin_expire_days', '签到'],
+  ['credit.affiliate_expire_days', '邀请返利'],
+  ['credit.signup_expire_days', '注册赠送'],
+];
+
+export default function SettingsCredit(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState(
+    Object.fromEntries(expireDayFields.map(([field]) => [field, 0])),
+  );
+  const [liability, setLiability] = useState(null);
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+
+  // 未消耗的付费额度，用于财务对账
+  useEffect(() => {
+    if (!hasPermission('data:read')) {
+      return;
+    }
+    API.get('/api/data/credit_liability').then((res) => {
+      if (res.data.success) {
+        setLiability(res.data.data);
+      }
+    });
+  }, []);
+
+  function handleFieldChange(fieldName) {
+    return (value) => {
+      setInputs((inputs) => ({
+        ...inputs,
+        [fieldName]: typeof value === 'number' ? String(value) : value,
+      }));
+    };
+  }
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('额度有效期设置')}>
+            {liability && (
+              <Banner
+                type='info'
+                closeIcon={null}
+                style={{ marginBottom: 10 }}
+                description={
+                  t('未消耗的付费额度：') +
+                  renderQuota(liability.quota) +
+                  Object.entries(liability.currency || {})
+                    .map(
+                      ([currency, balance]) =>
+                        '，' + balance.money.toFixed(2) + ' ' + currency,
+                    )
+                    .join('')
+                }
+              />
+            )}
+            <Row gutter={16}>
+              {expireDayFields.map(([field, label]) => (
+                <Col xs={24} sm={12} md={8} lg={8} xl={8} key={field}>
+                  <Form.InputNumber
+                    label={t(label) + t('额度有效天数')}
+                    field={field}
+                    min={0}
+                    suffix={t('天')}
+                    extraText={t('0 表示永不过期，只影响之后发放的额度')}
+                    onChange={handleFieldChange(field)}
+                  />
+                </Col>
+              ))}
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit} style={{ marginBottom: 20 }}>
+                {t('保存额度有效期设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
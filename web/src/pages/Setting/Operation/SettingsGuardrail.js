@@ -0,0 +1,159 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin, Tag } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsGuardrail(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'guardrail_setting.enabled': false,
+    'guardrail_setting.default_policy': '',
+    'guardrail_setting.policies': '',
+    'guardrail_setting.group_policies': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    if (typeof currentInputs['guardrail_setting.enabled'] === 'string') {
+      currentInputs['guardrail_setting.enabled'] =
+        currentInputs['guardrail_setting.enabled'] === 'true';
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('内容护栏设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'guardrail_setting.enabled'}
+                  label={t('启用内容护栏')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'guardrail_setting.enabled': value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Input
+                  field={'guardrail_setting.default_policy'}
+                  label={t('默认护栏策略')}
+                  placeholder={t('留空表示未指定分组或令牌策略时不检查')}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'guardrail_setting.default_policy': value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('护栏策略')}
+                  extraText={t(
+                    '策略名到 {input, output} 阶段列表的映射，阶段类型支持 keyword、pii、moderation、http，处理方式支持 block、redact、log',
+                  )}
+                  placeholder={
+                    '{\n  "strict": {\n    "input": [{"type": "pii", "action": "redact"}],\n    "output": [{"type": "keyword", "action": "block", "use_sensitive_words": true}]\n  }\n}'
+                  }
+                  field={'guardrail_setting.policies'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'guardrail_setting.policies': value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                />
+              </Col>
+              <Col xs={24} sm={24} md={12} lg={12} xl={12}>
+                <Form.TextArea
+                  label={t('分组护栏策略')}
+                  extraText={t('分组名到策略名的映射，令牌上设置的策略只能在此之后追加检查')}
+                  placeholder={'{\n  "default": "strict"\n}'}
+                  field={'guardrail_setting.group_policies'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'guardrail_setting.group_policies': value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存内容护栏设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
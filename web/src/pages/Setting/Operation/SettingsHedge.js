@@ -0,0 +1,158 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsHedge(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'hedge_setting.enabled': false,
+    'hedge_setting.rules': '',
+    'stream_failover_setting.enabled': false,
+    'stream_failover_setting.max_attempts': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('渠道容错设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'hedge_setting.enabled'}
+                  label={t('启用对冲请求')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'hedge_setting.enabled': value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={24} md={16} lg={16} xl={16}>
+                <Form.TextArea
+                  label={t('对冲规则')}
+                  extraText={t(
+                    '按顺序匹配模型与分组，留空表示全部，模型名支持以 * 结尾的前缀匹配；首个渠道在 delay_ms 内没有返回首字节时向另一个渠道发起相同请求，只对先返回的渠道计费',
+                  )}
+                  placeholder={
+                    '[\n  {\n    "models": ["gpt-4o*"],\n    "groups": ["vip"],\n    "delay_ms": 1500\n  }\n]'
+                  }
+                  field={'hedge_setting.rules'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'hedge_setting.rules': value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'stream_failover_setting.enabled'}
+                  label={t('启用流式中断续写')}
+                  extraText={t(
+                    '上游流式响应中途中断时，将已发送的内容作为预填充在其他渠道继续生成，每个渠道分别计费；仅支持 OpenAI 兼容的渠道，Claude、Gemini、AWS 等渠道不参与续写',
+                  )}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'stream_failover_setting.enabled': value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'stream_failover_setting.max_attempts'}
+                  label={t('最多续写次数')}
+                  step={1}
+                  min={1}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'stream_failover_setting.max_attempts': String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存渠道容错设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
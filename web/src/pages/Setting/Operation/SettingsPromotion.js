@@ -0,0 +1,128 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+
+export default function SettingsPromotion(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'promotion.topup_bonus_percent': 0,
+    'promotion.first_topup_bonus_percent': 0,
+    'promotion.max_bonus_percent': 0,
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+
+  function handleFieldChange(fieldName) {
+    return (value) => {
+      setInputs((inputs) => ({
+        ...inputs,
+        [fieldName]: typeof value === 'number' ? String(value) : value,
+      }));
+    };
+  }
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('充值活动设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('充值赠送比例')}
+                  field={'promotion.topup_bonus_percent'}
+                  min={0}
+                  suffix={'%'}
+                  extraText={t('每次在线充值按充值额度的比例赠送')}
+                  onChange={handleFieldChange('promotion.topup_bonus_percent')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('首充额外赠送比例')}
+                  field={'promotion.first_topup_bonus_percent'}
+                  min={0}
+                  suffix={'%'}
+                  extraText={t('用户首次在线充值时额外赠送')}
+                  onChange={handleFieldChange(
+                    'promotion.first_topup_bonus_percent',
+                  )}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('赠送比例上限')}
+                  field={'promotion.max_bonus_percent'}
+                  min={0}
+                  suffix={'%'}
+                  extraText={t('包括充值优惠券在内的单笔赠送比例上限，0 表示不限制')}
+                  onChange={handleFieldChange('promotion.max_bonus_percent')}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit} style={{ marginBottom: 20 }}>
+                {t('保存充值活动设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
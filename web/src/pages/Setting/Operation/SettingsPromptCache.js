@@ -0,0 +1,127 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsPromptCache(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'prompt_cache_setting.enabled': false,
+    'prompt_cache_setting.rules': '',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('提示词缓存设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'prompt_cache_setting.enabled'}
+                  label={t('自动设置 Claude 缓存断点')}
+                  extraText={t(
+                    'OpenAI 格式的请求转发到 Claude、AWS Claude 和 Vertex Claude 渠道时，按规则自动添加 cache_control',
+                  )}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'prompt_cache_setting.enabled': value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={24} md={16} lg={16} xl={16}>
+                <Form.TextArea
+                  label={t('缓存断点规则')}
+                  extraText={t(
+                    '按顺序匹配模型与分组，留空表示全部，模型名支持以 * 结尾的前缀匹配；system 与 tools 分别在系统提示词和工具定义末尾设置断点，last_turns 在最后 N 条消息末尾设置断点，每个请求最多 4 个断点；ttl 可选 5m 或 1h，使用 1h 时上游可能需要在 Claude 请求头设置中添加对应的 anthropic-beta',
+                  )}
+                  placeholder={
+                    '[\n  {\n    "models": ["claude-*"],\n    "groups": [],\n    "system": true,\n    "tools": true,\n    "last_turns": 2,\n    "ttl": ""\n  }\n]'
+                  }
+                  field={'prompt_cache_setting.rules'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'prompt_cache_setting.rules': value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存提示词缓存设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
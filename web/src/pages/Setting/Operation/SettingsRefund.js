@@ -0,0 +1,157 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin } from '@douyinfe/semi-ui';
+import { useTranslation } from 'react-i18next';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+
+// 将 JSON 数组形式的 finish_reason 列表转换为逗号分隔的文本
+function finishReasonsToText(value) {
+  try {
+    return (JSON.parse(value) || []).join(',');
+  } catch (e) {
+    return '';
+  }
+}
+
+export default function SettingsRefund(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'refund.enabled': false,
+    'refund.window_days': 7,
+    'refund.auto_refund_empty_response': false,
+    'refund.auto_refund_finish_reasons': '[]',
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues({
+      ...currentInputs,
+      finish_reasons_text: finishReasonsToText(
+        currentInputs['refund.auto_refund_finish_reasons'],
+      ),
+    });
+  }, [props.options]);
+
+  function handleFieldChange(fieldName) {
+    return (value) => {
+      setInputs((inputs) => ({
+        ...inputs,
+        [fieldName]: typeof value === 'number' ? String(value) : value,
+      }));
+    };
+  }
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+
+    const requestQueue = updateArray.map((item) =>
+      API.put('/api/option/', {
+        key: item.key,
+        value: String(inputs[item.key]),
+      }),
+    );
+
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('消费退款设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  label={t('允许用户申请退款')}
+                  field={'refund.enabled'}
+                  onChange={handleFieldChange('refund.enabled')}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('可申请退款的天数')}
+                  field={'refund.window_days'}
+                  min={0}
+                  suffix={t('天')}
+                  extraText={t('0 表示不限制')}
+                  onChange={handleFieldChange('refund.window_days')}
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  label={t('上游返回空内容时自动退款')}
+                  field={'refund.auto_refund_empty_response'}
+                  onChange={handleFieldChange(
+                    'refund.auto_refund_empty_response',
+                  )}
+                />
+              </Col>
+              <Col xs={24} sm={12} md={16} lg={16} xl={16}>
+                <Form.Input
+                  label={t('自动退款的 finish_reason')}
+                  field={'finish_reasons_text'}
+                  placeholder={'error'}
+                  extraText={t('按 OpenAI 格式匹配，只对 OpenAI 兼容、Claude 和 Gemini 渠道生效；多个值用英文逗号分隔，留空表示不启用')}
+                  onChange={(value) =>
+                    handleFieldChange('refund.auto_refund_finish_reasons')(
+                      JSON.stringify(
+                        value
+                          .split(',')
+                          .map((reason) => reason.trim())
+                          .filter((reason) => reason !== ''),
+                      ),
+                    )
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit} style={{ marginBottom: 20 }}>
+                {t('保存消费退款设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+      </Spin>
+    </>
+  );
+}
@@ -15,6 +15,11 @@ export default function SettingsSensitiveWords(props) {
   const [inputs, setInputs] = useState({
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
+    StopOnSensitiveEnabled: false,
+    StreamCacheQueueLength: 0,
+    StreamFilterHoldLength: 64,
+    StreamGuardrailCheckLength: 200,
     SensitiveWords: '',
   });
   const refForm = useRef();
@@ -102,6 +107,79 @@ export default function SettingsSensitiveWords(props) {
                   }
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'CheckSensitiveOnCompletionEnabled'}
+                  label={t('启用输出内容检查')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CheckSensitiveOnCompletionEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'StopOnSensitiveEnabled'}
+                  label={t('输出命中屏蔽词时停止生成，关闭则替换屏蔽词')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      StopOnSensitiveEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'StreamCacheQueueLength'}
+                  label={t('流模式缓存队列长度')}
+                  extraText={t('额外缓存的数据块数量，用于跨数据块匹配，0 表示只缓存最长屏蔽词长度')}
+                  min={0}
+                  step={1}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      StreamCacheQueueLength: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'StreamFilterHoldLength'}
+                  label={t('流模式正则检查保留字符数')}
+                  extraText={t('存在正则屏蔽词或个人信息检查时至少暂缓发送的字符数，用于匹配跨数据块的内容')}
+                  min={0}
+                  step={1}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      StreamFilterHoldLength: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  field={'StreamGuardrailCheckLength'}
+                  label={t('流模式远程护栏检查间隔字符数')}
+                  extraText={t('审核模型与自定义服务每累积多少字符检查一次，遇到句末标点时提前检查')}
+                  min={0}
+                  step={1}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      StreamGuardrailCheckLength: String(value),
+                    })
+                  }
+                />
+              </Col>
             </Row>
             <Row>
               <Col xs={24} sm={12} md={8} lg={8} xl={8}>
@@ -0,0 +1,208 @@
+import React, { useEffect, useState, useRef } from 'react';
+import { Button, Col, Form, Row, Spin, Table } from '@douyinfe/semi-ui';
+import {
+  compareObjects,
+  API,
+  showError,
+  showSuccess,
+  showWarning,
+} from '../../../helpers';
+import { useTranslation } from 'react-i18next';
+
+export default function SettingsSessionAffinity(props) {
+  const { t } = useTranslation();
+  const [loading, setLoading] = useState(false);
+  const [inputs, setInputs] = useState({
+    'session_affinity_setting.enabled': false,
+    'session_affinity_setting.ttl_seconds': '',
+    'session_affinity_setting.use_user_field': false,
+    'session_affinity_setting.use_prefix_hash': false,
+  });
+  const refForm = useRef();
+  const [inputsRow, setInputsRow] = useState(inputs);
+  const [stats, setStats] = useState([]);
+
+  function onSubmit() {
+    const updateArray = compareObjects(inputs, inputsRow);
+    if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
+    const requestQueue = updateArray.map((item) => {
+      let value = '';
+      if (typeof inputs[item.key] === 'boolean') {
+        value = String(inputs[item.key]);
+      } else {
+        value = inputs[item.key];
+      }
+      return API.put('/api/option/', {
+        key: item.key,
+        value,
+      });
+    });
+    setLoading(true);
+    Promise.all(requestQueue)
+      .then((res) => {
+        if (requestQueue.length === 1) {
+          if (res.includes(undefined)) return;
+        } else if (requestQueue.length > 1) {
+          if (res.includes(undefined))
+            return showError(t('部分保存失败，请重试'));
+        }
+        showSuccess(t('保存成功'));
+        props.refresh();
+      })
+      .catch(() => {
+        showError(t('保存失败，请重试'));
+      })
+      .finally(() => {
+        setLoading(false);
+      });
+  }
+
+  async function loadStats() {
+    const res = await API.get('/api/channel/cache_stats');
+    const { success, message, data } = res.data;
+    if (success) {
+      setStats(data);
+    } else {
+      showError(message);
+    }
+  }
+
+  async function resetStats() {
+    const res = await API.delete('/api/channel/cache_stats');
+    const { success, message } = res.data;
+    if (success) {
+      setStats([]);
+    } else {
+      showError(message);
+    }
+  }
+
+  useEffect(() => {
+    const currentInputs = {};
+    for (let key in props.options) {
+      if (Object.keys(inputs).includes(key)) {
+        currentInputs[key] = props.options[key];
+      }
+    }
+    setInputs(currentInputs);
+    setInputsRow(structuredClone(currentInputs));
+    refForm.current.setValues(currentInputs);
+  }, [props.options]);
+
+  useEffect(() => {
+    loadStats().then();
+  }, []);
+
+  const columns = [
+    { title: t('渠道 ID'), dataIndex: 'channel_id' },
+    { title: t('请求数'), dataIndex: 'requests' },
+    { title: t('会话亲和命中'), dataIndex: 'affinity_requests' },
+    { title: t('输入 Token'), dataIndex: 'prompt_tokens' },
+    { title: t('缓存命中 Token'), dataIndex: 'cached_tokens' },
+    {
+      title: t('缓存命中率'),
+      dataIndex: 'cache_hit_rate',
+      render: (value) => `${(value * 100).toFixed(2)}%`,
+    },
+  ];
+
+  return (
+    <>
+      <Spin spinning={loading}>
+        <Form
+          values={inputs}
+          getFormApi={(formAPI) => (refForm.current = formAPI)}
+          style={{ marginBottom: 15 }}
+        >
+          <Form.Section text={t('会话亲和设置')}>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'session_affinity_setting.enabled'}
+                  label={t('启用会话亲和路由')}
+                  extraText={t(
+                    '同一会话的连续请求优先发往上次使用的渠道和密钥，以便命中上游的提示词缓存；渠道不可用时自动重新选择',
+                  )}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'session_affinity_setting.enabled': value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.InputNumber
+                  label={t('绑定有效期')}
+                  field={'session_affinity_setting.ttl_seconds'}
+                  step={60}
+                  min={1}
+                  suffix={t('秒')}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'session_affinity_setting.ttl_seconds': String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'session_affinity_setting.use_user_field'}
+                  label={t('使用请求中的 user 字段')}
+                  extraText={t('没有 X-Veloera-Session-Id 请求头时，以 user 字段作为会话标识')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'session_affinity_setting.use_user_field': value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'session_affinity_setting.use_prefix_hash'}
+                  label={t('使用消息前缀哈希')}
+                  extraText={t('以系统提示词和第一条用户消息的哈希作为会话标识')}
+                  size='default'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'session_affinity_setting.use_prefix_hash': value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Button size='default' onClick={onSubmit}>
+                {t('保存会话亲和设置')}
+              </Button>
+            </Row>
+          </Form.Section>
+        </Form>
+        <Form.Section text={t('渠道缓存命中统计（当前实例）')}>
+          <Table
+            columns={columns}
+            dataSource={stats}
+            rowKey='channel_id'
+            pagination={false}
+            size='small'
+          />
+          <Row style={{ marginTop: 10 }}>
+            <Button size='default' onClick={loadStats}>
+              {t('刷新')}
+            </Button>
+            <Button size='default' style={{ marginLeft: 8 }} onClick={resetStats}>
+              {t('清空统计')}
+            </Button>
+          </Row>
+        </Form.Section>
+      </Spin>
+    </>
+  );
+}
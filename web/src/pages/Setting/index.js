@@ -4,12 +4,18 @@ import { useNavigate, useLocation } from 'react-router-dom';
 import { useTranslation } from 'react-i18next';
 
 import SystemSetting from '../../components/SystemSetting';
-import { isRoot } from '../../helpers';
+import { hasPermission } from '../../helpers';
 import OtherSetting from '../../components/OtherSetting';
 import PersonalSetting from '../../components/PersonalSetting';
 import OperationSetting from '../../components/OperationSetting';
 import RateLimitSetting from '../../components/RateLimitSetting.js';
 import ModelSetting from '../../components/ModelSetting.js';
+import RoleSetting from '../../components/RoleSetting.js';
+import AuditLogSetting from '../../components/AuditLogSetting.js';
+import ConfigSyncSetting from '../../components/ConfigSyncSetting.js';
+import SubscriptionPlanSetting from '../../components/SubscriptionPlanSetting.js';
+import RefundSetting from '../../components/RefundSetting.js';
+import MarginReport from '../../components/MarginReport.js';
 
 const Setting = () => {
   const { t } = useTranslation();
@@ -18,7 +24,7 @@ const Setting = () => {
   const [tabActiveKey, setTabActiveKey] = useState('1');
   let panes = [];
 
-  if (isRoot()) {
+  if (hasPermission('options:read')) {
     panes.push({
       tab: t('运营设置'),
       content: <OperationSetting />,
@@ -44,6 +50,46 @@ const Setting = () => {
       content: <OtherSetting />,
       itemKey: 'other',
     });
+    panes.push({
+      tab: t('订阅套餐'),
+      content: <SubscriptionPlanSetting />,
+      itemKey: 'plans',
+    });
+  }
+  if (hasPermission('options:write')) {
+    panes.push({
+      tab: t('配置同步'),
+      content: <ConfigSyncSetting />,
+      itemKey: 'config',
+    });
+  }
+  if (hasPermission('roles:manage')) {
+    panes.push({
+      tab: t('角色权限'),
+      content: <RoleSetting />,
+      itemKey: 'roles',
+    });
+  }
+  if (hasPermission('audit:read')) {
+    panes.push({
+      tab: t('审计日志'),
+      content: <AuditLogSetting />,
+      itemKey: 'audit',
+    });
+  }
+  if (hasPermission('refunds:manage')) {
+    panes.push({
+      tab: t('退款审核'),
+      content: <RefundSetting />,
+      itemKey: 'refunds',
+    });
+  }
+  if (hasPermission('data:read')) {
+    panes.push({
+      tab: t('毛利报表'),
+      content: <MarginReport />,
+      itemKey: 'margin',
+    });
   }
   const onChangeTab = (key) => {
     setTabActiveKey(key);
@@ -54,8 +100,8 @@ const Setting = () => {
     const tab = searchParams.get('tab');
     if (tab) {
       setTabActiveKey(tab);
-    } else {
-      onChangeTab('operation');
+    } else if (panes.length > 0) {
+      onChangeTab(panes[0].itemKey);
     }
   }, [location.search]);
   return (
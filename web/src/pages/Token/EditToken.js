@@ -43,6 +43,7 @@ const EditToken = (props) => {
     model_limits: [],
     allow_ips: '',
     group: '',
+    guardrail_policy: '',
   };
   const [inputs, setInputs] = useState(originInputs);
   const {
@@ -526,6 +527,17 @@ const EditToken = (props) => {
               disabled={true}
             />
           )}
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text>{t('附加的护栏策略，在分组或默认策略之后额外检查，留空表示不附加')}</Typography.Text>
+          </div>
+          <Input
+            style={{ marginTop: 8 }}
+            placeholder={t('附加的护栏策略，在分组或默认策略之后额外检查，留空表示不附加')}
+            name='guardrail_policy'
+            onChange={(value) => handleInputChange('guardrail_policy', value)}
+            value={inputs.guardrail_policy}
+            autoComplete='new-password'
+          />
         </Spin>
       </SideSheet>
     </>
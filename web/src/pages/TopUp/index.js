@@ -5,6 +5,7 @@ import {
   showError,
   showInfo,
   showSuccess,
+  timestamp2string,
 } from '../../helpers';
 import {
   renderNumber,
@@ -21,6 +22,8 @@ import {
   Modal,
   Toast,
   Banner,
+  Table,
+  Tag,
 } from '@douyinfe/semi-ui';
 import Title from '@douyinfe/semi-ui/lib/es/typography/title';
 import { useTranslation } from 'react-i18next';
@@ -37,10 +40,19 @@ const TopUp = () => {
   const [minTopUp, setMinTopUp] = useState(1);
   const [topUpLink, setTopUpLink] = useState('');
   const [enableOnlineTopUp, setEnableOnlineTopUp] = useState(false);
+  const [enableEpayTopUp, setEnableEpayTopUp] = useState(false);
+  const [enableStripeTopUp, setEnableStripeTopUp] = useState(false);
+  const [currency, setCurrency] = useState('CNY');
   const [userQuota, setUserQuota] = useState(0);
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [open, setOpen] = useState(false);
   const [payWay, setPayWay] = useState('');
+  const [plans, setPlans] = useState([]);
+  const [subscription, setSubscription] = useState(null);
+  const [subscribeMonths, setSubscribeMonths] = useState(1);
+  const [creditLots, setCreditLots] = useState([]);
+  const [creditLotsTotal, setCreditLotsTotal] = useState(0);
+  const [creditLotsPage, setCreditLotsPage] = useState(1);
 
   // --- 新增：标记 code 是否来源于 URL 且尚未重置 ---
   const [useUrlCode, setUseUrlCode] = useState(false);
@@ -67,12 +79,93 @@ const TopUp = () => {
       if (status.enable_online_topup) {
         setEnableOnlineTopUp(status.enable_online_topup);
       }
+      setEnableEpayTopUp(!!status.enable_epay_topup);
+      setEnableStripeTopUp(!!status.enable_stripe_topup);
     }
 
     getUserQuota();
+    getSubscriptions();
+    getCreditLots(1);
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, []);
 
+  // 获取可订阅的套餐和当前订阅
+  const getSubscriptions = async () => {
+    try {
+      let res = await API.get('/api/user/self/subscription_plans');
+      if (res.data.success) {
+        setPlans(res.data.data || []);
+      }
+      res = await API.get('/api/user/self/subscriptions');
+      if (res.data.success) {
+        setSubscription(
+          (res.data.data || []).find((sub) => sub.status === 'active') || null,
+        );
+      }
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  // 获取额度明细，按消耗顺序排列
+  const getCreditLots = async (page) => {
+    try {
+      const res = await API.get(
+        `/api/user/self/credit_lots?p=${page}&page_size=10`,
+      );
+      const { success, data } = res.data;
+      if (success) {
+        setCreditLots(data.items || []);
+        setCreditLotsTotal(data.total);
+        setCreditLotsPage(page);
+      }
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const creditSourceNames = {
+    topup: t('在线充值'),
+    promotion: t('充值赠送'),
+    redemption: t('兑换码'),
+    gift: t('礼品码'),
+    checkin: t('签到'),
+    affiliate: t('邀请返利'),
+    signup: t('注册赠送'),
+    subscription: t('订阅套餐'),
+  };
+
+  const creditLotColumns = [
+    {
+      title: t('来源'),
+      dataIndex: 'source',
+      render: (text) => creditSourceNames[text] || text,
+    },
+    {
+      title: t('剩余 / 发放'),
+      dataIndex: 'remaining',
+      render: (text, record) =>
+        renderQuota(text) + ' / ' + renderQuota(record.amount),
+    },
+    {
+      title: t('过期时间'),
+      dataIndex: 'expire_time',
+      render: (text, record) => {
+        if (record.remaining <= 0) {
+          return (
+            <Tag color='grey'>
+              {record.expired > 0 ? t('已过期') : t('已用完')}
+            </Tag>
+          );
+        }
+        if (!text) {
+          return t('永不过期');
+        }
+        return timestamp2string(text);
+      },
+    },
+  ];
+
   // 点击“点我更改”
   const handleResetCode = () => {
     setRedemptionCode('');
@@ -114,12 +207,27 @@ const TopUp = () => {
         showSuccess(successMessage);
 
         const quotaAmount = parseInt(data.quota, 10);
+        let content = t('成功兑换额度：') + renderQuotaWithAmount(quotaAmount);
+        if (data.type === 2) {
+          content = t('分组已升级为 {{group}}，有效期 {{days}} 天', {
+            group: data.upgrade_group,
+            days: data.upgrade_days,
+          });
+        } else if (data.type === 3) {
+          content =
+            t('成功兑换模型额度：') +
+            renderQuotaWithAmount(quotaAmount) +
+            t('，可用于模型：') +
+            data.models;
+        }
         Modal.success({
           title: successMessage,
-          content: t('成功兑换额度：') + renderQuotaWithAmount(quotaAmount),
+          content: content,
           centered: true,
         });
-        setUserQuota((q) => q + quotaAmount);
+        if (data.type !== 2 && data.type !== 3) {
+          setUserQuota((q) => q + quotaAmount);
+        }
 
         // 兑换成功后清空，并恢复输入框
         setRedemptionCode('');
@@ -149,7 +257,7 @@ const TopUp = () => {
       showError(t('管理员未开启在线充值！'));
       return;
     }
-    await getAmount(topUpCount);
+    await getAmount(topUpCount, payment);
     if (topUpCount < minTopUp) {
       showError(t('充值数量不能小于') + minTopUp);
       return;
@@ -158,10 +266,57 @@ const TopUp = () => {
     setOpen(true);
   };
 
+  // 跳转到支付页面，易支付需要以表单提交参数，Stripe Checkout 直接跳转
+  const redirectToPayment = (data, url) => {
+    if (!data) {
+      window.location.href = url;
+      return;
+    }
+    const form = document.createElement('form');
+    form.action = url;
+    form.method = 'POST';
+    const isSafari =
+      navigator.userAgent.indexOf('Safari') > -1 &&
+      navigator.userAgent.indexOf('Chrome') < 0;
+    if (!isSafari) {
+      form.target = '_blank';
+    }
+    Object.keys(data).forEach((key) => {
+      const input = document.createElement('input');
+      input.type = 'hidden';
+      input.name = key;
+      input.value = data[key];
+      form.appendChild(input);
+    });
+    document.body.appendChild(form);
+    form.submit();
+    document.body.removeChild(form);
+  };
+
+  // 订阅套餐
+  const subscribe = async (plan, payment) => {
+    try {
+      const res = await API.post('/api/user/pay', {
+        plan_id: plan.id,
+        months: parseInt(subscribeMonths) || 1,
+        payment_method: payment,
+      });
+      const { message, data, url } = res.data;
+      if (message === 'success') {
+        redirectToPayment(data, url);
+      } else {
+        showError(data);
+      }
+    } catch (err) {
+      console.error(err);
+      showError(t('支付请求失败'));
+    }
+  };
+
   // 执行在线充值
   const onlineTopUp = async () => {
     if (amount === 0) {
-      await getAmount(topUpCount);
+      await getAmount(topUpCount, payWay);
     }
     if (topUpCount < minTopUp) {
       showError(t('充值数量不能小于') + minTopUp);
@@ -176,26 +331,7 @@ const TopUp = () => {
       });
       const { message, data, url } = res.data;
       if (message === 'success') {
-        // 动态构建表单并提交
-        const form = document.createElement('form');
-        form.action = url;
-        form.method = 'POST';
-        const isSafari =
-          navigator.userAgent.indexOf('Safari') > -1 &&
-          navigator.userAgent.indexOf('Chrome') < 0;
-        if (!isSafari) {
-          form.target = '_blank';
-        }
-        Object.keys(data).forEach((key) => {
-          const input = document.createElement('input');
-          input.type = 'hidden';
-          input.name = key;
-          input.value = data[key];
-          form.appendChild(input);
-        });
-        document.body.appendChild(form);
-        form.submit();
-        document.body.removeChild(form);
+        redirectToPayment(data, url);
       } else {
         showError(data);
       }
@@ -206,18 +342,23 @@ const TopUp = () => {
   };
 
   // 获取实际需支付金额
-  const getAmount = async (value) => {
+  const getAmount = async (value, payment) => {
     if (value === undefined) {
       value = topUpCount;
     }
+    if (payment === undefined) {
+      payment = payWay;
+    }
     try {
       const res = await API.post('/api/user/amount', {
         amount: parseFloat(value),
         top_up_code: topUpCode,
+        payment_method: payment,
       });
-      const { message, data } = res.data;
+      const { message, data, currency } = res.data;
       if (message === 'success') {
         setAmount(parseFloat(data));
+        setCurrency(currency || 'CNY');
       } else {
         setAmount(0);
         Toast.error({ content: '错误：' + data, id: 'getAmount' });
@@ -233,7 +374,10 @@ const TopUp = () => {
 
   // 渲染实付金额文字
   const renderAmountText = () => {
-    return amount + ' ' + t('元');
+    if (currency.toUpperCase() === 'CNY') {
+      return amount + ' ' + t('元');
+    }
+    return amount + ' ' + currency.toUpperCase();
   };
 
   return (
@@ -342,24 +486,47 @@ const TopUp = () => {
                       await getAmount(value);
                     }}
                   />
+                  <Form.Input
+                    field="topUpCode"
+                    label={t('充值优惠券')}
+                    placeholder={t('选填，支付成功后按优惠券比例赠送额度')}
+                    value={topUpCode}
+                    onChange={(value) => setTopUpCode(value)}
+                  />
                   <Space>
-                    <Button
-                      type="primary"
-                      theme="solid"
-                      onClick={() => preTopUp('zfb')}
-                    >
-                      {t('支付宝')}
-                    </Button>
-                    <Button
-                      style={{
-                        backgroundColor: 'rgba(var(--semi-green-5), 1)',
-                      }}
-                      type="primary"
-                      theme="solid"
-                      onClick={() => preTopUp('wx')}
-                    >
-                      {t('微信')}
-                    </Button>
+                    {enableEpayTopUp && (
+                      <>
+                        <Button
+                          type="primary"
+                          theme="solid"
+                          onClick={() => preTopUp('zfb')}
+                        >
+                          {t('支付宝')}
+                        </Button>
+                        <Button
+                          style={{
+                            backgroundColor: 'rgba(var(--semi-green-5), 1)',
+                          }}
+                          type="primary"
+                          theme="solid"
+                          onClick={() => preTopUp('wx')}
+                        >
+                          {t('微信')}
+                        </Button>
+                      </>
+                    )}
+                    {enableStripeTopUp && (
+                      <Button
+                        style={{
+                          backgroundColor: 'rgba(var(--semi-violet-5), 1)',
+                        }}
+                        type="primary"
+                        theme="solid"
+                        onClick={() => preTopUp('stripe')}
+                      >
+                        {t('银行卡')}
+                      </Button>
+                    )}
                   </Space>
                 </Form>
               ) : (
@@ -383,6 +550,91 @@ const TopUp = () => {
                 />
               )}
             </div>
+
+            {/* 订阅套餐 */}
+            {enableOnlineTopUp && plans.length > 0 && (
+              <div style={{ marginTop: 20 }}>
+                <Divider>{t('订阅套餐')}</Divider>
+                {subscription && (
+                  <Banner
+                    fullMode={false}
+                    type="success"
+                    bordered
+                    closeIcon={null}
+                    description={t('当前订阅：{{name}}，到期时间 {{time}}', {
+                      name:
+                        (
+                          plans.find(
+                            (plan) => plan.id === subscription.plan_id,
+                          ) || {}
+                        ).name || subscription.plan_id,
+                      time: timestamp2string(subscription.end_time),
+                    })}
+                  />
+                )}
+                <Form style={{ marginTop: 8 }}>
+                  <Form.InputNumber
+                    field="subscribeMonths"
+                    label={t('订阅月数')}
+                    min={1}
+                    max={12}
+                    value={subscribeMonths}
+                    onChange={(value) => setSubscribeMonths(value)}
+                  />
+                </Form>
+                {plans.map((plan) => (
+                  <Card key={plan.id} style={{ marginTop: 8 }}>
+                    <Title heading={6}>{plan.name}</Title>
+                    <p>{plan.description}</p>
+                    <p>
+                      {t('每月价格：') + '$' + plan.price}，
+                      {t('每月额度：') + renderQuota(plan.quota)}
+                      {plan.group && '，' + t('分组：') + plan.group}
+                      {plan.models && '，' + t('可用模型：') + plan.models}
+                    </p>
+                    <Space>
+                      {enableEpayTopUp && (
+                        <>
+                          <Button onClick={() => subscribe(plan, 'zfb')}>
+                            {t('支付宝')}
+                          </Button>
+                          <Button onClick={() => subscribe(plan, 'wx')}>
+                            {t('微信')}
+                          </Button>
+                        </>
+                      )}
+                      {enableStripeTopUp && (
+                        <Button onClick={() => subscribe(plan, 'stripe')}>
+                          {t('银行卡')}
+                        </Button>
+                      )}
+                    </Space>
+                  </Card>
+                ))}
+              </div>
+            )}
+
+            {/* 额度明细 */}
+            {creditLotsTotal > 0 && (
+              <div style={{ marginTop: 20 }}>
+                <Divider>{t('额度明细')}</Divider>
+                <Table
+                  size='small'
+                  columns={creditLotColumns}
+                  dataSource={creditLots}
+                  rowKey='id'
+                  pagination={{
+                    currentPage: creditLotsPage,
+                    pageSize: 10,
+                    total: creditLotsTotal,
+                    onPageChange: (page) => getCreditLots(page),
+                  }}
+                />
+                <p style={{ marginTop: 8, color: 'var(--semi-color-text-2)' }}>
+                  {t('额度按过期时间先后消耗，过期未使用的额度将被清除')}
+                </p>
+              </div>
+            )}
           </Card>
         </div>
       </Layout.Content>
@@ -31,6 +31,7 @@ const EditUser = (props) => {
     email: '',
     quota: 0,
     group: 'default',
+    routing_hints: [],
   });
   const [groupOptions, setGroupOptions] = useState([]);
   const {
@@ -76,6 +77,9 @@ const EditUser = (props) => {
     const { success, message, data } = res.data;
     if (success) {
       data.password = '';
+      data.routing_hints = data.routing_hints
+        ? data.routing_hints.split(',')
+        : [];
       setInputs(data);
     } else {
       showError(message);
@@ -98,6 +102,7 @@ const EditUser = (props) => {
       if (typeof data.quota === 'string') {
         data.quota = parseInt(data.quota);
       }
+      data.routing_hints = data.routing_hints.join(',');
       res = await API.put(`/api/user/`, data);
     } else {
       res = await API.put(`/api/user/self`, inputs);
@@ -209,6 +214,37 @@ const EditUser = (props) => {
                 autoComplete='new-password'
                 optionList={groupOptions}
               />
+              <div style={{ marginTop: 20 }}>
+                <Typography.Text>
+                  {t('允许令牌使用的路由请求头，留空则不允许')}
+                </Typography.Text>
+              </div>
+              <Select
+                placeholder={t('允许令牌使用的路由请求头，留空则不允许')}
+                name='routing_hints'
+                multiple
+                style={{ width: '100%' }}
+                onChange={(value) => handleInputChange('routing_hints', value)}
+                value={inputs.routing_hints}
+                optionList={[
+                  {
+                    label: t(
+                      '渠道标签 (X-Veloera-Channel-Tags / X-Veloera-Exclude-Channel-Tags)',
+                    ),
+                    value: 'tags',
+                  },
+                  { label: t('禁止重试 (X-Veloera-No-Retry)'), value: 'no_retry' },
+                  {
+                    label: t('最高成本倍率 (X-Veloera-Max-Price-Ratio)'),
+                    value: 'max_price_ratio',
+                  },
+                  { label: t('优先区域标签 (X-Veloera-Region)'), value: 'region' },
+                  {
+                    label: t('不使用渠道缓存 (X-Veloera-No-Cache)'),
+                    value: 'no_cache',
+                  },
+                ]}
+              />
               <div style={{ marginTop: 20 }}>
                 <Typography.Text>{`${t('剩余额度')}${renderQuotaWithPrompt(quota)}`}</Typography.Text>
               </div>